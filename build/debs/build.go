@@ -17,14 +17,11 @@ limitations under the License.
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -32,7 +29,6 @@ import (
 	"time"
 
 	"github.com/blang/semver"
-	"github.com/google/go-github/v28/github"
 )
 
 type ChannelType string
@@ -42,10 +38,6 @@ const (
 	ChannelTesting ChannelType = "testing"
 	ChannelNightly ChannelType = "nightly"
 
-	minimumKubernetesVersion = "1.13.0"
-	minimumCNIVersion        = "0.7.5"
-	pre117CNIVersion         = "0.7.5"
-
 	defaultRevision = "0"
 
 	packagesRootDir = "packages"
@@ -53,10 +45,7 @@ const (
 	kubeadmConf = "10-kubeadm.conf"
 )
 
-var (
-	minimumCRIToolsVersion = minimumKubernetesVersion
-	latestPackagesDir      = fmt.Sprintf("%s/%s", packagesRootDir, "latest")
-)
+var defaultCatalog = fmt.Sprintf("%s/%s", packagesRootDir, "catalog.yaml")
 
 type work struct {
 	src  string
@@ -77,20 +66,27 @@ type packageDefinition struct {
 
 	Channel           ChannelType
 	KubernetesVersion string
-	KubeletCNIVersion string
 
 	DownloadLinkBase         string
 	KubeadmKubeletConfigFile string
-
-	CNIDownloadLink string
 }
 
 type cfg struct {
 	*packageDefinition
-	Arch         string
-	DebArch      string
-	Package      string
-	Dependencies string
+	Arch        string
+	Format      string
+	PackageArch string
+	Package     string
+
+	// definition is the declaration of the package in the catalog
+	definition *catalogPackage
+
+	// SysconfigDir contains the environment files of services, which is
+	// /etc/default for debs and /etc/sysconfig for rpms
+	SysconfigDir string
+
+	// UnitDir contains the systemd units shipped by packages
+	UnitDir string
 }
 
 type stringList []string
@@ -108,7 +104,14 @@ var (
 	kubeVersion     string
 	cniVersion      string
 	criToolsVersion string
+	catalogFile     string
+	versionsFile    string
+
+	// versions are the package versions given via the command line by
+	// package name
+	versions stringList
 
+	formats       = stringList{FormatDeb}
 	packages      = stringList{"kubelet", "kubectl", "kubeadm", "kubernetes-cni", "cri-tools"}
 	channels      = stringList{"release", "testing", "nightly"}
 	architectures = stringList{"amd64", "arm", "arm64", "ppc64le", "s390x"}
@@ -117,7 +120,18 @@ var (
 
 	builtins = map[string]interface{}{
 		"date": func() string {
-			return time.Now().Format(time.RFC1123Z)
+			return buildDate().Format(time.RFC1123Z)
+		},
+		"versionLTE": func(version, max string) (bool, error) {
+			v, err := semver.Parse(version)
+			if err != nil {
+				return false, err
+			}
+			m, err := semver.Parse(max)
+			if err != nil {
+				return false, err
+			}
+			return v.LTE(m), nil
 		},
 	}
 
@@ -125,13 +139,17 @@ var (
 )
 
 func init() {
+	flag.Var(&formats, "formats", "package formats to build, deb and rpm are supported")
 	flag.Var(&packages, "packages", "packages to build")
 	flag.Var(&channels, "channels", "channels to build for")
 	flag.Var(&architectures, "arch", "architectures to build for")
 	flag.StringVar(&kubeVersion, "kube-version", "", "Kubernetes version to build")
 	flag.StringVar(&revision, "revision", defaultRevision, "deb package revision.")
-	flag.StringVar(&cniVersion, "cni-version", "", "CNI version to build")
-	flag.StringVar(&criToolsVersion, "cri-tools-version", "", "CRI tools version to build")
+	flag.StringVar(&cniVersion, "cni-version", "", "CNI version to build, short for --versions kubernetes-cni=<version>")
+	flag.StringVar(&criToolsVersion, "cri-tools-version", "", "CRI tools version to build, short for --versions cri-tools=<version>")
+	flag.Var(&versions, "versions", "package versions to build instead of the versions of the catalog, like kubernetes-cni=0.8.2,cri-tools=1.17.0")
+	flag.StringVar(&catalogFile, "catalog", defaultCatalog, "catalog declaring the packages")
+	flag.StringVar(&versionsFile, "versions-file", "", "file pinning the Kubernetes versions of the channels and the package versions of every Kubernetes minor version, which are not looked up online if set")
 	flag.StringVar(&releaseDownloadLinkBase, "release-download-link-base", "https://dl.k8s.io", "release download link base.")
 }
 
@@ -141,20 +159,78 @@ func main() {
 	// Replace the "+" with a "-" to make it semver-compliant
 	kubeVersion = strings.TrimPrefix(kubeVersion, "v")
 
-	builds, err := constructBuilds(packages, channels, kubeVersion, revision, cniVersion)
+	for _, arch := range architectures {
+		for _, format := range formats {
+			if _, err := packageArch(arch, format); err != nil {
+				log.Fatalf("err: %v", err)
+			}
+		}
+	}
+
+	cat, err := loadCatalog(catalogFile)
 	if err != nil {
 		log.Fatalf("err: %v", err)
 	}
+	if err := validateTemplates(packagesRootDir, cat); err != nil {
+		log.Fatalf("err: %v", err)
+	}
 
-	if err := walkBuilds(builds); err != nil {
+	var resolver versionResolver = &onlineResolver{
+		http:   newHTTPResolver(cat.Kubernetes.VersionURLs),
+		github: newGitHubResolver(),
+	}
+	if versionsFile != "" {
+		if resolver, err = loadVersionsFile(versionsFile); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	}
+
+	overrides, err := versionOverrides(versions, cniVersion, criToolsVersion)
+	if err != nil {
 		log.Fatalf("err: %v", err)
 	}
+
+	builds, err := constructBuilds(cat, packages, channels, kubeVersion, revision, overrides)
+	if err != nil {
+		log.Fatalf("err: %v", err)
+	}
+
+	if err := walkBuilds(cat, resolver, builds); err != nil {
+		log.Fatalf("err: %v", err)
+	}
+}
+
+// versionOverrides returns the package versions given via the command line
+// by package name
+func versionOverrides(versions []string, cniVersion, criToolsVersion string) (map[string]string, error) {
+	overrides := map[string]string{}
+	if cniVersion != "" {
+		overrides["kubernetes-cni"] = cniVersion
+	}
+	if criToolsVersion != "" {
+		overrides["cri-tools"] = criToolsVersion
+	}
+	for _, v := range versions {
+		if v == "" {
+			continue
+		}
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid package version %q, expected <package>=<version>", v)
+		}
+		overrides[parts[0]] = strings.TrimPrefix(parts[1], "v")
+	}
+	return overrides, nil
 }
 
-func constructBuilds(packages, channels []string, kubeVersion, revision, cniVersion string) ([]build, error) {
+func constructBuilds(cat *catalog, packages, channels []string, kubeVersion, revision string, overrides map[string]string) ([]build, error) {
 	var builds []build
 
 	for _, pkg := range packages {
+		if _, err := cat.lookup(pkg); err != nil {
+			return nil, err
+		}
+
 		b := &build{
 			Package: pkg,
 		}
@@ -163,17 +239,11 @@ func constructBuilds(packages, channels []string, kubeVersion, revision, cniVers
 			packageDef := &packageDefinition{
 				Revision: revision,
 				Channel:  ChannelType(channel),
+				Version:  overrides[pkg],
 			}
 
 			packageDef.KubernetesVersion = kubeVersion
 
-			switch b.Package {
-			case "kubernetes-cni":
-				packageDef.Version = cniVersion
-			case "cri-tools":
-				packageDef.Version = criToolsVersion
-			}
-
 			b.Definitions = append(b.Definitions, *packageDef)
 		}
 
@@ -183,12 +253,14 @@ func constructBuilds(packages, channels []string, kubeVersion, revision, cniVers
 	return builds, nil
 }
 
-func walkBuilds(builds []build) error {
+func walkBuilds(cat *catalog, resolver versionResolver, builds []build) error {
 	for _, arch := range architectures {
-		for _, build := range builds {
-			for _, packageDef := range build.Definitions {
-				if err := buildPackage(build.Package, arch, packageDef); err != nil {
-					return err
+		for _, format := range formats {
+			for _, build := range builds {
+				for _, packageDef := range build.Definitions {
+					if err := buildPackage(cat, resolver, build.Package, arch, format, packageDef); err != nil {
+						return err
+					}
 				}
 			}
 		}
@@ -196,92 +268,96 @@ func walkBuilds(builds []build) error {
 	return nil
 }
 
-func buildPackage(pkg, arch string, packageDef packageDefinition) error {
+func buildPackage(cat *catalog, resolver versionResolver, pkg, arch, format string, packageDef packageDefinition) error {
+	definition, err := cat.lookup(pkg)
+	if err != nil {
+		return err
+	}
+
 	c := cfg{
 		packageDefinition: &packageDef,
 		Package:           pkg,
 		Arch:              arch,
+		Format:            format,
+		definition:        definition,
 	}
 
 	c.Name = pkg
 
-	var err error
-
 	if c.KubernetesVersion != "" {
 		log.Printf("checking k8s semver")
 		kubeSemver, err := semver.Parse(c.KubernetesVersion)
 		if err != nil {
-			log.Fatalf("could not parse k8s semver: %v", err)
+			return fmt.Errorf("could not parse k8s semver: %v", err)
 		}
 
-		kubeVersionString := kubeSemver.String()
-		kubeVersionParts := strings.Split(kubeVersionString, ".")
-
-		log.Printf("%v, len: %d", kubeVersionParts, len(kubeVersionParts))
-		switch {
-		case len(kubeVersionParts) > 4:
-			c.Channel = ChannelNightly
-		case len(kubeVersionParts) == 4:
-			c.Channel = ChannelTesting
-		default:
-			c.Channel = ChannelRelease
-		}
+		c.Channel = channelForVersion(kubeSemver)
+		log.Printf("channel for k8s version %s is %s", kubeSemver, c.Channel)
 	}
 
-	c.KubernetesVersion, err = getKubernetesVersion(packageDef)
+	c.KubernetesVersion, err = getKubernetesVersion(resolver, packageDef)
 	if err != nil {
-		log.Fatalf("error getting Kubernetes version: %v", err)
+		return fmt.Errorf("error getting Kubernetes version: %v", err)
 	}
 
-	log.Printf("download link base is %s", c.DownloadLinkBase)
-	c.DownloadLinkBase, err = getDownloadLinkBase(packageDef)
+	c.DownloadLinkBase, err = renderTemplate(cat.Kubernetes.DownloadLinkBase[c.Channel], struct {
+		KubernetesVersion       string
+		ReleaseDownloadLinkBase string
+	}{c.KubernetesVersion, releaseDownloadLinkBase})
 	if err != nil {
-		log.Fatalf("error getting Kubernetes download link base: %v", err)
+		return fmt.Errorf("error getting Kubernetes download link base: %v", err)
 	}
 
 	log.Printf("download link base is %s", c.DownloadLinkBase)
 
-	// TODO: Add note about this
+	// CI builds like 1.18.0-alpha.1.123+5a1ae3a2aaa3c0 carry the commit as
+	// build metadata, which is not allowed in package versions
 	c.KubernetesVersion = strings.Replace(c.KubernetesVersion, "+", "-", 1)
 
-	c.Version, err = getPackageVersion(packageDef)
+	c.Version, err = getPackageVersion(resolver, packageDef, definition)
 	if err != nil {
-		log.Fatalf("error getting package version: %v", err)
+		return fmt.Errorf("error getting package version: %v", err)
 	}
 
 	log.Printf("package version is %s", c.Version)
 
-	c.KubeletCNIVersion = minimumCNIVersion
-
-	c.Dependencies, err = getKubeadmDependencies(packageDef)
-	if err != nil {
-		log.Fatalf("error getting kubeadm dependencies: %v", err)
-	}
-
 	c.KubeadmKubeletConfigFile = kubeadmConf
 
-	if c.Arch == "arm" {
-		c.DebArch = "armhf"
-	} else if c.Arch == "ppc64le" {
-		c.DebArch = "ppc64el"
-	} else {
-		c.DebArch = c.Arch
+	if err := c.setFormat(); err != nil {
+		return err
 	}
 
-	c.CNIDownloadLink, err = getCNIDownloadLink(packageDef, c.Arch)
+	return c.run()
+}
+
+// setFormat sets the architecture and the paths used by the templates for
+// the package format
+func (c *cfg) setFormat() error {
+	var err error
+	c.PackageArch, err = packageArch(c.Arch, c.Format)
 	if err != nil {
-		log.Fatalf("error getting CNI download link: %v", err)
+		return err
 	}
-
-	return c.run()
+	switch c.Format {
+	case FormatRPM:
+		c.SysconfigDir = "/etc/sysconfig"
+		c.UnitDir = "/usr/lib/systemd/system"
+	default:
+		c.SysconfigDir = "/etc/default"
+		c.UnitDir = "/lib/systemd/system"
+	}
+	return nil
 }
 
 func (c cfg) run() error {
 	log.Printf("!!!!!!!!! doing: %#v", c)
-	var w []work
 
-	// TODO: Get package directory for any version once package definitions are broken out
-	srcdir := filepath.Join(latestPackagesDir, c.Package)
+	srcdir, err := resolveTemplateDir(packagesRootDir, c.definition.templateDir(), c.KubernetesVersion)
+	if err != nil {
+		return err
+	}
+	log.Printf("using templates of %s", srcdir)
+
 	dstdir, err := ioutil.TempDir(os.TempDir(), "debs")
 	if err != nil {
 		return err
@@ -290,6 +366,49 @@ func (c cfg) run() error {
 		defer os.RemoveAll(dstdir)
 	}
 
+	if err := c.render(srcdir, dstdir); err != nil {
+		return err
+	}
+
+	if err := c.fetchSources(dstdir); err != nil {
+		return err
+	}
+	spec, err := c.packageSpec(dstdir)
+	if err != nil {
+		return err
+	}
+
+	dst := filepath.Join("bin", string(c.Channel))
+	var written string
+	switch c.Format {
+	case FormatRPM:
+		p, err := spec.rpm()
+		if err != nil {
+			return err
+		}
+		written, err = p.Build(dst)
+		if err != nil {
+			return err
+		}
+	default:
+		p, err := spec.deb()
+		if err != nil {
+			return err
+		}
+		written, err = p.WriteFile(dst)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("wrote %s", written)
+
+	return nil
+}
+
+// render renders the package templates of srcdir into dstdir
+func (c cfg) render(srcdir, dstdir string) error {
+	var w []work
+
 	if err := filepath.Walk(srcdir, func(srcfile string, f os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -343,264 +462,96 @@ func (c cfg) run() error {
 		}
 	}
 
-	err = runCommand(dstdir, "dpkg-buildpackage", "-us", "-uc", "-b", "-a"+c.DebArch)
-	if err != nil {
-		return err
-	}
-
-	dstParts := []string{"bin", string(c.Channel)}
-
-	dstPath := filepath.Join(dstParts...)
-	os.MkdirAll(dstPath, 0777)
-
-	fileName := fmt.Sprintf("%s_%s-%s_%s.deb", c.Package, c.Version, c.Revision, c.DebArch)
-	err = runCommand("", "mv", filepath.Join("/tmp", fileName), dstPath)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
-func runCommand(pwd string, command string, cmdArgs ...string) error {
-	cmd := exec.Command(command, cmdArgs...)
-	if len(pwd) != 0 {
-		cmd.Dir = pwd
+// buildDate returns the time of the build, which is taken from
+// SOURCE_DATE_EPOCH if set to make the packages reproducible
+func buildDate() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
 	}
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return err
-	}
-	return nil
+	return time.Now()
 }
 
-func getPackageVersion(packageDef packageDefinition) (string, error) {
+// getPackageVersion returns the version of the package, which is the
+// version given via the command line or the version of the source declared
+// in the catalog, unless a version is pinned for the Kubernetes version.
+// The versions file may override the catalog version of static packages.
+func getPackageVersion(resolver versionResolver, packageDef packageDefinition, definition *catalogPackage) (string, error) {
 	log.Printf("Setting version for %s package...", packageDef.Name)
-	switch packageDef.Name {
-	case "kubernetes-cni":
-		return getCNIVersion(packageDef)
-	case "cri-tools":
-		return getCRIToolsVersion(packageDef)
-	}
 
-	log.Printf("using Kubernetes version")
-	return packageDef.KubernetesVersion, nil
-}
-
-func getKubernetesVersion(packageDef packageDefinition) (string, error) {
-	if packageDef.KubernetesVersion != "" {
-		log.Printf("Using Kubernetes version (%s) for %s package...", packageDef.KubernetesVersion, packageDef.Name)
-		return packageDef.KubernetesVersion, nil
-	}
-	switch packageDef.Channel {
-	case ChannelTesting:
-		return getTestingKubeVersion()
-	case ChannelNightly:
-		return getNightlyKubeVersion()
-	}
-
-	return getReleaseKubeVersion()
-}
-
-func getReleaseKubeVersion() (string, error) {
-	log.Print("Retrieving Kubernetes release version...")
-	return fetchVersion("https://dl.k8s.io/release/stable.txt")
-}
-
-func getTestingKubeVersion() (string, error) {
-	log.Print("Retrieving Kubernetes testing version...")
-	return fetchVersion("https://dl.k8s.io/release/latest.txt")
-}
-
-func getNightlyKubeVersion() (string, error) {
-	log.Print("Retrieving Kubernetes nightly version...")
-	return fetchVersion("https://dl.k8s.io/ci/k8s-master.txt")
-}
-
-func fetchVersion(url string) (string, error) {
-	res, err := http.Get(url)
+	pinned, err := definition.pinnedVersion(packageDef.KubernetesVersion)
 	if err != nil {
 		return "", err
 	}
-
-	versionBytes, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-	if err != nil {
-		return "", err
+	if pinned != "" {
+		log.Printf("using version %s pinned for Kubernetes %s", pinned, packageDef.KubernetesVersion)
+		return pinned, nil
 	}
 
-	// Remove a newline and the v prefix from the string
-	return strings.Replace(strings.Replace(string(versionBytes), "v", "", 1), "\n", "", 1), nil
-}
-
-func getCNIVersion(packageDef packageDefinition) (string, error) {
-	log.Printf("using CNI version")
-
-	kubeSemver, err := semver.Make(packageDef.KubernetesVersion)
-	if err != nil {
-		return "", err
-	}
-
-	v117, err := semver.Make("1.17.0-alpha.0")
-	if err != nil {
-		return "", err
-	}
-
-	log.Printf("checking kube version (%s) against %s", kubeSemver.String(), v117.String())
-	if packageDef.Version != "" {
-		if kubeSemver.LT(v117) {
-			return pre117CNIVersion, nil
-		}
-		return packageDef.Version, nil
-	}
-
-	return minimumCNIVersion, nil
-}
-
-func getCRIToolsVersion(packageDef packageDefinition) (string, error) {
-	if packageDef.Version != "" {
-		return packageDef.Version, nil
-	}
-
-	kubeSemver, err := semver.Parse(packageDef.KubernetesVersion)
-	if err != nil {
-		return "", err
-	}
-
-	log.Printf("using CRI version")
-	kubeVersionString := kubeSemver.String()
-	kubeVersionParts := strings.Split(kubeVersionString, ".")
-
-	criToolsMajor := kubeVersionParts[0]
-	criToolsMinor := kubeVersionParts[1]
-
-	log.Printf("%v, len: %v", kubeVersionParts, len(kubeVersionParts))
-	// v1.17.0-alpha.0.1809+ff8716f4cf6180
-	if len(kubeVersionParts) >= 4 {
-		criToolsMinorInt, err := strconv.Atoi(criToolsMinor)
-		if err != nil {
-			return "", err
-		}
-
-		log.Printf("CRI minor is %s", criToolsMinor)
-		criToolsMinorInt--
-		criToolsMinor = strconv.Itoa(criToolsMinorInt)
-		log.Printf("CRI minor is %s", criToolsMinor)
-	}
-
-	criToolsVersion := fmt.Sprintf("%s.%s.0", criToolsMajor, criToolsMinor)
-
-	releases, err := fetchReleases("kubernetes-sigs", "cri-tools", false)
-	if err != nil {
-		log.Fatalf("err: %v", err)
-	}
-
-	var tags []string
-	for _, release := range releases {
-		criToolsReleaseTag := strings.Trim(*release.TagName, "v")
-		criToolsReleaseVersionParts := strings.Split(criToolsReleaseTag, ".")
-		criToolsReleaseMinor := criToolsReleaseVersionParts[1]
-
-		if criToolsReleaseMinor == criToolsMinor {
-			tags = append(tags, criToolsReleaseTag)
-		}
-	}
-
-	for _, tag := range tags {
-		tagSemver, err := semver.Parse(tag)
-		if err != nil {
-			log.Fatalf("could not parse tag semver: %v", err)
-		}
-
-		criToolsSemver, err := semver.Parse(criToolsVersion)
-		if err != nil {
-			log.Fatalf("could not parse CRI tools semver: %v", err)
-		}
-
-		if tagSemver.GTE(criToolsSemver) {
-			criToolsVersion = tag
+	switch definition.Version.Source {
+	case VersionSourceKubernetes:
+		log.Printf("using Kubernetes version")
+		return packageDef.KubernetesVersion, nil
+	case VersionSourceStatic:
+		if packageDef.Version != "" {
+			return packageDef.Version, nil
 		}
-	}
-
-	log.Printf("CRI tools version is %s", criToolsVersion)
-	return criToolsVersion, nil
-}
-
-func fetchReleases(owner, repo string, includePrereleases bool) ([]*github.RepositoryRelease, error) {
-	ghClient := github.NewClient(nil)
-
-	allReleases, _, err := ghClient.Repositories.ListReleases(context.Background(), owner, repo, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	var releases []*github.RepositoryRelease
-	for _, release := range allReleases {
-		if *release.Prerelease {
-			if includePrereleases {
-				releases = append(releases, release)
+		if static, ok := resolver.(*staticResolver); ok {
+			version, found, err := static.lookupPackageVersion(definition.Name, packageDef.KubernetesVersion)
+			if err != nil {
+				return "", err
+			}
+			if found {
+				log.Printf("using version %s from versions file", version)
+				return version, nil
 			}
-		} else {
-			releases = append(releases, release)
 		}
+		return definition.Version.Version, nil
+	case VersionSourceGitHub:
+		if packageDef.Version != "" {
+			return packageDef.Version, nil
+		}
+		return resolver.packageVersion(definition, packageDef.KubernetesVersion)
 	}
-
-	return releases, nil
+	return "", fmt.Errorf("unknown version source %q", definition.Version.Source)
 }
 
-func getDownloadLinkBase(packageDef packageDefinition) (string, error) {
-	switch packageDef.Channel {
-	case ChannelNightly:
-		return getCIBuildsDownloadLinkBase(packageDef)
-	}
-
-	return getReleaseDownloadLinkBase(packageDef)
-}
-
-func getCIBuildsDownloadLinkBase(packageDef packageDefinition) (string, error) {
-	ciVersion := packageDef.KubernetesVersion
-	if ciVersion == "" {
-		var err error
-		ciVersion, err = getNightlyKubeVersion()
-		if err != nil {
-			return "", err
-		}
+func getKubernetesVersion(resolver versionResolver, packageDef packageDefinition) (string, error) {
+	if packageDef.KubernetesVersion != "" {
+		log.Printf("Using Kubernetes version (%s) for %s package...", packageDef.KubernetesVersion, packageDef.Name)
+		return packageDef.KubernetesVersion, nil
 	}
-
-	return fmt.Sprintf("https://dl.k8s.io/ci/v%s", ciVersion), nil
+	return resolver.kubernetesVersion(packageDef.Channel)
 }
 
-func getReleaseDownloadLinkBase(packageDef packageDefinition) (string, error) {
-	return fmt.Sprintf("%s/v%s", releaseDownloadLinkBase, packageDef.KubernetesVersion), nil
+// channelForVersion returns the channel for a Kubernetes version, which is
+// the nightly channel for CI builds like 1.18.0-alpha.1.123+5a1ae3a2aaa3c0,
+// the testing channel for pre-releases like 1.18.0-rc.1 and the release
+// channel for official releases.
+func channelForVersion(version semver.Version) ChannelType {
+	switch {
+	case isBuild(version):
+		return ChannelNightly
+	case isPreRelease(version):
+		return ChannelTesting
+	}
+	return ChannelRelease
 }
 
-func getKubeadmDependencies(packageDef packageDefinition) (string, error) {
-	deps := []string{
-		fmt.Sprintf("kubelet (>= %s)", minimumKubernetesVersion),
-		fmt.Sprintf("kubectl (>= %s)", minimumKubernetesVersion),
-		fmt.Sprintf("kubernetes-cni (>= %s)", minimumCNIVersion),
-		fmt.Sprintf("cri-tools (>= %s)", minimumCRIToolsVersion),
-		"${misc:Depends}",
-	}
-
-	return strings.Join(deps, ", "), nil
+// isPreRelease returns true if the version is an alpha, beta or release
+// candidate. It mirrors release.Version.IsPreRelease, like isBuild mirrors
+// release.Version.IsBuild: this module is built on its own and cannot import
+// k8s.io/release/pkg/release, so both have to be kept in sync with
+// pkg/release/version.go.
+func isPreRelease(version semver.Version) bool {
+	return len(version.Pre) > 0
 }
 
-func getCNIDownloadLink(packageDef packageDefinition, arch string) (string, error) {
-	sv, err := semver.Parse(packageDef.Version)
-	if err != nil {
-		return "", err
-	}
-
-	v075, err := semver.Make(pre117CNIVersion)
-	if err != nil {
-		return "", err
-	}
-
-	if sv.LTE(v075) {
-		return fmt.Sprintf("https://github.com/containernetworking/plugins/releases/download/v%s/cni-plugins-%s-v%s.tgz", packageDef.Version, arch, packageDef.Version), nil
-	}
-
-	return fmt.Sprintf("https://github.com/containernetworking/plugins/releases/download/v%s/cni-plugins-linux-%s-v%s.tgz", packageDef.Version, arch, packageDef.Version), nil
+// isBuild returns true if the version refers to a build on top of a tagged
+// version, which carries the amount of commits after the pre-release or the
+// commit as build metadata
+func isBuild(version semver.Version) bool {
+	return len(version.Build) > 0 || len(version.Pre) > 2
 }
@@ -18,77 +18,87 @@ package main
 
 import (
 	"reflect"
-	"strings"
 	"testing"
+
+	"github.com/blang/semver"
 )
 
-func TestGetKubeadmDependencies(t *testing.T) {
+func TestVersionOverrides(t *testing.T) {
 	testcases := []struct {
-		name    string
-		version string
-		deps    []string
+		name      string
+		versions  []string
+		cni       string
+		criTools  string
+		expected  map[string]string
+		shouldErr bool
 	}{
 		{
-			name:    "minimum supported kubernetes",
-			version: "1.13.0",
-			deps: []string{
-				"kubelet (>= 1.13.0)",
-				"kubectl (>= 1.13.0)",
-				"kubernetes-cni (>= 0.7.5)",
-				"cri-tools (>= 1.13.0)",
-				"${misc:Depends}",
-			},
+			name:     "no versions",
+			expected: map[string]string{},
+		},
+		{
+			name:     "shorthand flags",
+			cni:      "0.8.2",
+			criTools: "1.17.0",
+			expected: map[string]string{"kubernetes-cni": "0.8.2", "cri-tools": "1.17.0"},
 		},
 		{
-			name:    "latest stable minor kubernetes",
-			version: "1.16.0",
-			deps: []string{
-				"kubelet (>= 1.13.0)",
-				"kubectl (>= 1.13.0)",
-				"kubernetes-cni (>= 0.7.5)",
-				"cri-tools (>= 1.13.0)",
-				"${misc:Depends}",
-			},
+			name:     "versions take precedence",
+			versions: []string{"kubernetes-cni=v0.8.3", "kubernetes-cni-plugins=0.8.3"},
+			cni:      "0.8.2",
+			expected: map[string]string{"kubernetes-cni": "0.8.3", "kubernetes-cni-plugins": "0.8.3"},
 		},
 		{
-			name:    "latest alpha kubernetes",
-			version: "1.17.0-alpha.0",
-			deps: []string{
-				"kubelet (>= 1.13.0)",
-				"kubectl (>= 1.13.0)",
-				"kubernetes-cni (>= 0.7.5)",
-				"cri-tools (>= 1.13.0)",
-				"${misc:Depends}",
-			},
+			name:      "missing version",
+			versions:  []string{"kubernetes-cni"},
+			shouldErr: true,
 		},
 		{
-			name:    "next stable minor kubernetes",
-			version: "1.17.0",
-			deps: []string{
-				"kubelet (>= 1.13.0)",
-				"kubectl (>= 1.13.0)",
-				"kubernetes-cni (>= 0.7.5)",
-				"cri-tools (>= 1.13.0)",
-				"${misc:Depends}",
-			},
+			name:      "empty version",
+			versions:  []string{"kubernetes-cni="},
+			shouldErr: true,
 		},
 	}
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			packageDef := packageDefinition{Version: tc.version}
-			deps, err := getKubeadmDependencies(packageDef)
+			actual, err := versionOverrides(tc.versions, tc.cni, tc.criTools)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
 			if err != nil {
 				t.Fatalf("did not expect an error: %v", err)
 			}
-			actual := strings.Split(deps, ", ")
-			if len(actual) != len(tc.deps) {
-				t.Fatalf("Expected %d deps but found %d", len(tc.deps), len(actual))
-			}
-			if !reflect.DeepEqual(actual, tc.deps) {
-				t.Fatalf("expected %q but got %q", tc.deps, actual)
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("expected %v but got %v", tc.expected, actual)
 			}
 		})
 	}
+}
+
+func TestChannelForVersion(t *testing.T) {
+	testcases := []struct {
+		version string
+		channel ChannelType
+	}{
+		{version: "1.17.0", channel: ChannelRelease},
+		{version: "1.17.0-alpha.0", channel: ChannelTesting},
+		{version: "1.17.0-rc.1", channel: ChannelTesting},
+		{version: "1.17.0-alpha.0.1809+ff8716f4cf6180", channel: ChannelNightly},
+		{version: "1.17.0-beta.2.5+ff8716f4cf6180", channel: ChannelNightly},
+		{version: "1.17.0-beta.2.5", channel: ChannelNightly},
+		{version: "1.17.0+ff8716f4cf6180", channel: ChannelNightly},
+	}
 
+	for _, tc := range testcases {
+		t.Run(tc.version, func(t *testing.T) {
+			actual := channelForVersion(semver.MustParse(tc.version))
+			if actual != tc.channel {
+				t.Fatalf("expected channel %q but got %q", tc.channel, actual)
+			}
+		})
+	}
 }
@@ -0,0 +1,279 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/blang/semver"
+	"gopkg.in/yaml.v2"
+)
+
+// The sources of package versions
+const (
+	// VersionSourceKubernetes uses the Kubernetes version
+	VersionSourceKubernetes = "kubernetes"
+
+	// VersionSourceStatic uses the version declared in the catalog
+	VersionSourceStatic = "static"
+
+	// VersionSourceGitHub uses the latest GitHub release of the repository
+	// matching the Kubernetes minor version
+	VersionSourceGitHub = "github"
+)
+
+// catalog declares the packages which can be built
+type catalog struct {
+	Kubernetes kubernetesDefinition `yaml:"kubernetes"`
+	Packages   []*catalogPackage    `yaml:"packages"`
+}
+
+// kubernetesDefinition declares where Kubernetes versions and binaries are
+// found for each channel
+type kubernetesDefinition struct {
+	// VersionURLs are the markers of the latest Kubernetes version
+	VersionURLs map[ChannelType]string `yaml:"versionURLs"`
+
+	// DownloadLinkBase are templates of the base URL of the Kubernetes
+	// binaries, rendered with the Kubernetes version and the release
+	// download link base
+	DownloadLinkBase map[ChannelType]string `yaml:"downloadLinkBase"`
+
+	// MinimumVersion and MaximumVersion are the first and the last
+	// supported Kubernetes minor versions, like 1.13.0
+	MinimumVersion string `yaml:"minimumVersion"`
+	MaximumVersion string `yaml:"maximumVersion"`
+}
+
+// catalogPackage declares a package
+type catalogPackage struct {
+	Name string `yaml:"name"`
+
+	// TemplateDir is the directory of the package template below the
+	// packages directory, which defaults to the name of the package
+	TemplateDir string `yaml:"templateDir"`
+
+	Version      versionSource   `yaml:"version"`
+	Dependencies []dependency    `yaml:"dependencies"`
+	Sources      []catalogSource `yaml:"sources"`
+}
+
+// versionSource declares how the version of a package is determined. An
+// explicit version given via the command line takes precedence over the
+// source, while pinned versions take precedence over both.
+type versionSource struct {
+	Source string `yaml:"source"`
+
+	// Version is the version of static sources
+	Version string `yaml:"version"`
+
+	// Repository is the owner and name of the repository of GitHub sources,
+	// like kubernetes-sigs/cri-tools
+	Repository string `yaml:"repository"`
+
+	// Pinned are the versions to use for ranges of Kubernetes versions
+	Pinned []pinnedVersion `yaml:"pinned"`
+}
+
+// pinnedVersion is the version of a package for a Kubernetes version range
+type pinnedVersion struct {
+	// Kubernetes is the range of Kubernetes versions, like <1.17.0-alpha.0
+	Kubernetes string `yaml:"kubernetes"`
+	Version    string `yaml:"version"`
+}
+
+// catalogSource is an input of a package. The URL is a template rendered
+// with the package configuration.
+type catalogSource struct {
+	URL string `yaml:"url"`
+
+	// Destination is the file within the build directory the source is
+	// written to, or the directory it gets extracted to
+	Destination string `yaml:"destination"`
+
+	// Extract extracts the source as gzipped tarball
+	Extract bool `yaml:"extract"`
+
+	// LocalArtifact uses the binary of a local Kubernetes build instead if
+	// KUBE_USE_LOCAL_ARTIFACTS is set
+	LocalArtifact bool `yaml:"localArtifact"`
+}
+
+// loadCatalog reads and validates the catalog
+func loadCatalog(path string) (*catalog, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &catalog{}
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return nil, fmt.Errorf("parsing catalog %s: %v", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid catalog %s: %v", path, err)
+	}
+	return c, nil
+}
+
+func (c *catalog) validate() error {
+	for _, channel := range []ChannelType{ChannelRelease, ChannelTesting, ChannelNightly} {
+		if c.Kubernetes.VersionURLs[channel] == "" || c.Kubernetes.DownloadLinkBase[channel] == "" {
+			return fmt.Errorf("kubernetes needs a version URL and a download link base for channel %s", channel)
+		}
+		if _, err := parseTemplate(c.Kubernetes.DownloadLinkBase[channel]); err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.Kubernetes.supportedMinors(); err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for _, p := range c.Packages {
+		if p.Name == "" {
+			return fmt.Errorf("package without name")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate package %s", p.Name)
+		}
+		names[p.Name] = true
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("package %s: %v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p *catalogPackage) validate() error {
+	v := p.Version
+	switch v.Source {
+	case VersionSourceKubernetes:
+	case VersionSourceStatic:
+		if _, err := semver.Parse(v.Version); err != nil {
+			return fmt.Errorf("invalid static version %q: %v", v.Version, err)
+		}
+	case VersionSourceGitHub:
+		if len(strings.Split(v.Repository, "/")) != 2 {
+			return fmt.Errorf("invalid GitHub repository %q", v.Repository)
+		}
+	default:
+		return fmt.Errorf("unknown version source %q", v.Source)
+	}
+	for _, pinned := range v.Pinned {
+		if _, err := semver.ParseRange(pinned.Kubernetes); err != nil {
+			return fmt.Errorf("invalid Kubernetes version range %q: %v", pinned.Kubernetes, err)
+		}
+		if _, err := semver.Parse(pinned.Version); err != nil {
+			return fmt.Errorf("invalid pinned version %q: %v", pinned.Version, err)
+		}
+	}
+
+	for _, d := range p.Dependencies {
+		if err := d.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range p.Sources {
+		if s.URL == "" || s.Destination == "" {
+			return fmt.Errorf("sources need a URL and a destination")
+		}
+		if _, err := parseTemplate(s.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// supportedMinors returns the first release of every supported Kubernetes
+// minor version
+func (k *kubernetesDefinition) supportedMinors() ([]semver.Version, error) {
+	minimum, err := semver.Parse(k.MinimumVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid minimum Kubernetes version %q: %v", k.MinimumVersion, err)
+	}
+	maximum, err := semver.Parse(k.MaximumVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maximum Kubernetes version %q: %v", k.MaximumVersion, err)
+	}
+	if minimum.Major != maximum.Major || minimum.Minor > maximum.Minor {
+		return nil, fmt.Errorf("invalid supported Kubernetes versions %s to %s", minimum, maximum)
+	}
+	minors := []semver.Version{}
+	for minor := minimum.Minor; minor <= maximum.Minor; minor++ {
+		minors = append(minors, semver.Version{Major: minimum.Major, Minor: minor})
+	}
+	return minors, nil
+}
+
+// lookup returns the package of the catalog
+func (c *catalog) lookup(name string) (*catalogPackage, error) {
+	for _, p := range c.Packages {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("package %s is not part of the catalog", name)
+}
+
+// templateDir returns the directory of the package template
+func (p *catalogPackage) templateDir() string {
+	if p.TemplateDir != "" {
+		return p.TemplateDir
+	}
+	return p.Name
+}
+
+// pinnedVersion returns the version pinned for the Kubernetes version, if
+// any
+func (p *catalogPackage) pinnedVersion(kubeVersion string) (string, error) {
+	if len(p.Version.Pinned) == 0 {
+		return "", nil
+	}
+	kubeSemver, err := semver.Parse(kubeVersion)
+	if err != nil {
+		return "", fmt.Errorf("could not parse k8s semver: %v", err)
+	}
+	for _, pinned := range p.Version.Pinned {
+		if semver.MustParseRange(pinned.Kubernetes)(kubeSemver) {
+			return pinned.Version, nil
+		}
+	}
+	return "", nil
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("").Funcs(builtins).Option("missingkey=error").Parse(text)
+}
+
+// renderTemplate renders the text with the data
+func renderTemplate(text string, data interface{}) (string, error) {
+	t, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
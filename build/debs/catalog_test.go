@@ -0,0 +1,262 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCatalog = `kubernetes:
+  versionURLs:
+    release: https://dl.k8s.io/release/stable.txt
+    testing: https://dl.k8s.io/release/latest.txt
+    nightly: https://dl.k8s.io/ci/k8s-master.txt
+  downloadLinkBase:
+    release: "{{ .ReleaseDownloadLinkBase }}/v{{ .KubernetesVersion }}"
+    testing: "{{ .ReleaseDownloadLinkBase }}/v{{ .KubernetesVersion }}"
+    nightly: "https://dl.k8s.io/ci/v{{ .KubernetesVersion }}"
+  minimumVersion: 1.13.0
+  maximumVersion: 1.18.0
+packages:
+  - name: kubernetes-cni-plugins
+    templateDir: kubernetes-cni
+    version:
+      source: static
+      version: 0.8.2
+    dependencies:
+      - name: kubelet
+        constraint: ">= 1.13.0"
+    sources:
+      - url: "https://example.com/cni-plugins-linux-{{ .Arch }}-v{{ .Version }}.tgz"
+        destination: bin
+        extract: true
+`
+
+func writeTestCatalog(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "catalog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "catalog.yaml")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadCatalog(t *testing.T) {
+	file, cleanup := writeTestCatalog(t, testCatalog)
+	defer cleanup()
+
+	cat, err := loadCatalog(file)
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	p, err := cat.lookup("kubernetes-cni-plugins")
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	if p.templateDir() != "kubernetes-cni" || p.Version.Version != "0.8.2" {
+		t.Fatalf("unexpected package %+v", p)
+	}
+	if want := []dependency{{"kubelet", ">= 1.13.0"}}; !reflect.DeepEqual(p.Dependencies, want) {
+		t.Fatalf("expected dependencies %v but got %v", want, p.Dependencies)
+	}
+	if _, err := cat.lookup("kubelet"); err == nil {
+		t.Fatalf("expected an error for a package which is not part of the catalog")
+	}
+}
+
+func TestLoadDefaultCatalog(t *testing.T) {
+	cat, err := loadCatalog(defaultCatalog)
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	for _, name := range []string{"kubelet", "kubectl", "kubeadm", "kubernetes-cni", "cri-tools"} {
+		if _, err := cat.lookup(name); err != nil {
+			t.Fatalf("did not expect an error: %v", err)
+		}
+	}
+
+	kubeadm, err := cat.lookup("kubeadm")
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	want := []dependency{
+		{"kubelet", ">= 1.13.0"},
+		{"kubectl", ">= 1.13.0"},
+		{"kubernetes-cni", ">= 0.7.5"},
+		{"cri-tools", ">= 1.13.0"},
+	}
+	if !reflect.DeepEqual(kubeadm.Dependencies, want) {
+		t.Fatalf("expected dependencies %v but got %v", want, kubeadm.Dependencies)
+	}
+}
+
+func TestLoadCatalogInvalid(t *testing.T) {
+	testcases := []struct {
+		name    string
+		catalog string
+	}{
+		{
+			name:    "unknown field",
+			catalog: testCatalog + "    unknown: true\n",
+		},
+		{
+			name:    "missing channel",
+			catalog: "kubernetes:\n  versionURLs:\n    release: https://dl.k8s.io/release/stable.txt\n",
+		},
+		{
+			name:    "invalid supported versions",
+			catalog: strings.Replace(testCatalog, "minimumVersion: 1.13.0", "minimumVersion: 1.19.0", 1),
+		},
+		{
+			name:    "duplicate package",
+			catalog: testCatalog + "  - name: kubernetes-cni-plugins\n    version:\n      source: kubernetes\n",
+		},
+		{
+			name:    "unknown version source",
+			catalog: testCatalog + "  - name: foo\n    version:\n      source: git\n",
+		},
+		{
+			name:    "invalid static version",
+			catalog: testCatalog + "  - name: foo\n    version:\n      source: static\n      version: latest\n",
+		},
+		{
+			name:    "invalid repository",
+			catalog: testCatalog + "  - name: foo\n    version:\n      source: github\n      repository: cri-tools\n",
+		},
+		{
+			name:    "invalid pinned range",
+			catalog: testCatalog + "  - name: foo\n    version:\n      source: kubernetes\n      pinned:\n        - kubernetes: before 1.17\n          version: 0.7.5\n",
+		},
+		{
+			name:    "invalid dependency",
+			catalog: testCatalog + "  - name: foo\n    version:\n      source: kubernetes\n    dependencies:\n      - name: kubelet\n        constraint: newer\n",
+		},
+		{
+			name:    "source without destination",
+			catalog: testCatalog + "  - name: foo\n    version:\n      source: kubernetes\n    sources:\n      - url: https://example.com\n",
+		},
+		{
+			name:    "invalid source template",
+			catalog: testCatalog + "  - name: foo\n    version:\n      source: kubernetes\n    sources:\n      - url: \"{{ .Version \"\n        destination: bin\n",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			file, cleanup := writeTestCatalog(t, tc.catalog)
+			defer cleanup()
+
+			if _, err := loadCatalog(file); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
+
+func TestGetPackageVersion(t *testing.T) {
+	cat, err := loadCatalog(defaultCatalog)
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+
+	testcases := []struct {
+		name        string
+		pkg         string
+		kubeVersion string
+		version     string
+		expected    string
+	}{
+		{name: "kubernetes", pkg: "kubelet", kubeVersion: "1.17.0-rc.1", expected: "1.17.0-rc.1"},
+		{name: "static", pkg: "kubernetes-cni", kubeVersion: "1.17.0", expected: "0.7.5"},
+		{name: "static override", pkg: "kubernetes-cni", kubeVersion: "1.17.0", version: "0.8.2", expected: "0.8.2"},
+		{name: "static versions file", pkg: "kubernetes-cni", kubeVersion: "1.18.0-alpha.1", expected: "0.8.5"},
+		{name: "static versions file override", pkg: "kubernetes-cni", kubeVersion: "1.18.0", version: "0.8.2", expected: "0.8.2"},
+		{name: "pinned", pkg: "kubernetes-cni", kubeVersion: "1.16.3", version: "0.8.2", expected: "0.7.5"},
+		{name: "github", pkg: "cri-tools", kubeVersion: "1.17.0", expected: "1.16.1"},
+		{name: "github override", pkg: "cri-tools", kubeVersion: "1.17.0", version: "1.17.0", expected: "1.17.0"},
+	}
+	resolver := &staticResolver{Packages: map[string]map[string]string{
+		"cri-tools":      {"1.17": "1.16.1"},
+		"kubernetes-cni": {"1.18": "v0.8.5"},
+	}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			definition, err := cat.lookup(tc.pkg)
+			if err != nil {
+				t.Fatalf("did not expect an error: %v", err)
+			}
+			packageDef := packageDefinition{Name: tc.pkg, KubernetesVersion: tc.kubeVersion, Version: tc.version}
+			actual, err := getPackageVersion(resolver, packageDef, definition)
+			if err != nil {
+				t.Fatalf("did not expect an error: %v", err)
+			}
+			if actual != tc.expected {
+				t.Fatalf("expected version %s but got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSourceURL(t *testing.T) {
+	cat, err := loadCatalog(defaultCatalog)
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	cni, err := cat.lookup("kubernetes-cni")
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+
+	testcases := []struct {
+		version  string
+		expected string
+	}{
+		{
+			version:  "0.7.5",
+			expected: "https://github.com/containernetworking/plugins/releases/download/v0.7.5/cni-plugins-amd64-v0.7.5.tgz",
+		},
+		{
+			version:  "0.8.2",
+			expected: "https://github.com/containernetworking/plugins/releases/download/v0.8.2/cni-plugins-linux-amd64-v0.8.2.tgz",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.version, func(t *testing.T) {
+			c := cfg{
+				packageDefinition: &packageDefinition{Version: tc.version},
+				Arch:              "amd64",
+			}
+			actual, err := renderTemplate(cni.Sources[0].URL, c)
+			if err != nil {
+				t.Fatalf("did not expect an error: %v", err)
+			}
+			if actual != tc.expected {
+				t.Fatalf("expected %s but got %s", tc.expected, actual)
+			}
+		})
+	}
+}
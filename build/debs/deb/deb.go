@@ -0,0 +1,463 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package deb writes Debian binary packages without the need of a Debian
+// toolchain. Packages are reproducible: all archive entries are sorted and
+// use a fixed modification time and root ownership.
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Maintainer scripts which can be part of a package
+const (
+	PreInst  = "preinst"
+	PostInst = "postinst"
+	PreRm    = "prerm"
+	PostRm   = "postrm"
+)
+
+// File is a file installed by a package
+type File struct {
+	// Path is the absolute installation path, like /usr/bin/kubelet
+	Path string
+
+	// Mode are the permission bits of the file
+	Mode os.FileMode
+
+	// Content is the content of the file if Source is not set
+	Content []byte
+
+	// Source is a local file providing the content. It gets streamed into
+	// the data archive instead of being read as a whole, while the compressed
+	// archive itself is still held in memory.
+	Source string
+}
+
+// Package is the definition of a Debian binary package
+type Package struct {
+	Name         string
+	Version      string
+	Architecture string
+	Maintainer   string
+	Section      string
+	Priority     string
+	Homepage     string
+
+	// Depends are the dependencies including their version constraints,
+	// like "kubelet (>= 1.13.0)"
+	Depends []string
+
+	// Description is the synopsis in the first line, followed by the
+	// extended description
+	Description string
+
+	// Files are the files installed by the package. Parent directories are
+	// added automatically.
+	Files []File
+
+	// Dirs are directories owned by the package, which may be empty
+	Dirs []string
+
+	// Conffiles are the paths of files which are treated as configuration
+	// and do not get overwritten on upgrades
+	Conffiles []string
+
+	// Scripts are the maintainer scripts by name, like postinst
+	Scripts map[string][]byte
+
+	// ModTime is used for all archive entries, the Unix epoch if not set
+	ModTime time.Time
+}
+
+// Filename returns the conventional file name of the package, like
+// kubelet_1.17.0-0_amd64.deb
+func (p *Package) Filename() string {
+	return fmt.Sprintf("%s_%s_%s.deb", p.Name, p.Version, p.Architecture)
+}
+
+// Validate checks that the package can be written
+func (p *Package) Validate() error {
+	if p.Name == "" || p.Version == "" || p.Architecture == "" {
+		return fmt.Errorf("package name, version and architecture are required")
+	}
+	if p.Maintainer == "" || p.Description == "" {
+		return fmt.Errorf("package %s needs a maintainer and a description", p.Name)
+	}
+	paths := map[string]bool{}
+	for _, f := range p.Files {
+		if !path.IsAbs(f.Path) || path.Clean(f.Path) != f.Path {
+			return fmt.Errorf("file path %q is not a clean absolute path", f.Path)
+		}
+		if paths[f.Path] {
+			return fmt.Errorf("duplicate file %s", f.Path)
+		}
+		paths[f.Path] = true
+	}
+	for _, d := range p.Dirs {
+		if !path.IsAbs(d) || path.Clean(d) != d {
+			return fmt.Errorf("directory %q is not a clean absolute path", d)
+		}
+	}
+	for _, c := range p.Conffiles {
+		if !paths[c] {
+			return fmt.Errorf("conffile %s is not part of the package", c)
+		}
+	}
+	for name := range p.Scripts {
+		switch name {
+		case PreInst, PostInst, PreRm, PostRm:
+		default:
+			return fmt.Errorf("unknown maintainer script %s", name)
+		}
+	}
+	return nil
+}
+
+// WriteFile writes the package to the directory and returns the path of the
+// written .deb. The package is written to a temporary file first, which
+// means that no partial package is left behind on errors.
+func (p *Package) WriteFile(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	dst := path.Join(dir, p.Filename())
+	tmp, err := ioutil.TempFile(dir, "."+p.Filename()+"-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if err := p.Write(tmp); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("writing %s: %v", dst, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	return dst, os.Rename(tmp.Name(), dst)
+}
+
+// Write writes the package in the deb format: an ar archive containing the
+// debian-binary version, control.tar.gz and data.tar.gz
+func (p *Package) Write(w io.Writer) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	data, sums, size, err := p.dataTar()
+	if err != nil {
+		return err
+	}
+	control, err := p.controlTar(sums, size)
+	if err != nil {
+		return err
+	}
+
+	ar := newArWriter(w, p.modTime())
+	if err := ar.writeHeader(); err != nil {
+		return err
+	}
+	for _, member := range []struct {
+		name    string
+		content []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", control},
+		{"data.tar.gz", data},
+	} {
+		if err := ar.writeMember(member.name, member.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Control returns the content of the control file. The installed size is
+// the total size of the files in KiB.
+func (p *Package) Control(installedSize int64) []byte {
+	b := &strings.Builder{}
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(b, "%s: %s\n", name, value)
+		}
+	}
+	field("Package", p.Name)
+	field("Version", p.Version)
+	field("Architecture", p.Architecture)
+	field("Maintainer", p.Maintainer)
+	field("Installed-Size", fmt.Sprint((installedSize+1023)/1024))
+	field("Depends", strings.Join(p.Depends, ", "))
+	field("Section", p.Section)
+	field("Priority", p.Priority)
+	field("Homepage", p.Homepage)
+
+	lines := strings.Split(strings.TrimSpace(p.Description), "\n")
+	field("Description", strings.TrimSpace(lines[0]))
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			line = "."
+		}
+		fmt.Fprintf(b, " %s\n", line)
+	}
+	return []byte(b.String())
+}
+
+// dataTar returns the compressed data archive, the md5sums file and the
+// installed size of the files
+func (p *Package) dataTar() (data, sums []byte, size int64, err error) {
+	// Directories are files without content for sorting
+	files := append([]File{}, p.Files...)
+	dirs := map[string]bool{}
+	for _, d := range p.Dirs {
+		dirs[d] = true
+		files = append(files, File{Path: d})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	t := p.newTar()
+	written := map[string]bool{}
+	md5sums := &strings.Builder{}
+	for _, f := range files {
+		if err := t.parents(f.Path, written); err != nil {
+			return nil, nil, 0, err
+		}
+		if dirs[f.Path] {
+			if !written[f.Path] {
+				written[f.Path] = true
+				if err := t.dir("." + f.Path + "/"); err != nil {
+					return nil, nil, 0, err
+				}
+			}
+			continue
+		}
+
+		content, fileSize, err := f.open()
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		sum := md5.New()
+		err = t.fileFrom("."+f.Path, f.Mode, fileSize, io.TeeReader(content, sum))
+		content.Close()
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("writing %s: %v", f.Path, err)
+		}
+		fmt.Fprintf(md5sums, "%s  %s\n", hex.EncodeToString(sum.Sum(nil)), strings.TrimPrefix(f.Path, "/"))
+		size += fileSize
+	}
+	data, err = t.close()
+	return data, []byte(md5sums.String()), size, err
+}
+
+// controlTar returns the compressed control archive
+func (p *Package) controlTar(sums []byte, size int64) ([]byte, error) {
+	entries := map[string]struct {
+		mode    os.FileMode
+		content []byte
+	}{
+		"control": {0o644, p.Control(size)},
+		"md5sums": {0o644, sums},
+	}
+	if len(p.Conffiles) > 0 {
+		conffiles := append([]string{}, p.Conffiles...)
+		sort.Strings(conffiles)
+		entries["conffiles"] = struct {
+			mode    os.FileMode
+			content []byte
+		}{0o644, []byte(strings.Join(conffiles, "\n") + "\n")}
+	}
+	for name, script := range p.Scripts {
+		entries[name] = struct {
+			mode    os.FileMode
+			content []byte
+		}{0o755, script}
+	}
+
+	names := []string{}
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t := p.newTar()
+	if err := t.dir("./"); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if err := t.file("./"+name, entries[name].mode, entries[name].content); err != nil {
+			return nil, err
+		}
+	}
+	return t.close()
+}
+
+func (p *Package) modTime() time.Time {
+	if p.ModTime.IsZero() {
+		return time.Unix(0, 0)
+	}
+	return p.ModTime
+}
+
+// open returns a reader for the content of the file and its size
+func (f *File) open() (io.ReadCloser, int64, error) {
+	if f.Source == "" {
+		return ioutil.NopCloser(bytes.NewReader(f.Content)), int64(len(f.Content)), nil
+	}
+	file, err := os.Open(f.Source)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// tarWriter writes a gzip compressed tar archive with fixed metadata
+type tarWriter struct {
+	buf     *bytes.Buffer
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	modTime time.Time
+}
+
+func (p *Package) newTar() *tarWriter {
+	buf := &bytes.Buffer{}
+	// The gzip header contains neither a name nor a modification time
+	gz := gzip.NewWriter(buf)
+	return &tarWriter{buf: buf, gz: gz, tw: tar.NewWriter(gz), modTime: p.modTime()}
+}
+
+// parents writes all parent directories of the path which have not been
+// written yet
+func (t *tarWriter) parents(file string, written map[string]bool) error {
+	dirs := []string{}
+	for dir := path.Dir(file); dir != "/"; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+	dirs = append([]string{""}, dirs...)
+	for _, dir := range dirs {
+		if written[dir] {
+			continue
+		}
+		written[dir] = true
+		if err := t.dir("." + dir + "/"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tarWriter) dir(name string) error {
+	return t.tw.WriteHeader(t.header(name, tar.TypeDir, 0o755, 0))
+}
+
+func (t *tarWriter) file(name string, mode os.FileMode, content []byte) error {
+	return t.fileFrom(name, mode, int64(len(content)), bytes.NewReader(content))
+}
+
+// fileFrom writes a file of the provided size, which the reader has to match
+func (t *tarWriter) fileFrom(name string, mode os.FileMode, size int64, r io.Reader) error {
+	if err := t.tw.WriteHeader(t.header(name, tar.TypeReg, mode, size)); err != nil {
+		return err
+	}
+	n, err := io.Copy(t.tw, r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("read %d bytes instead of %d", n, size)
+	}
+	return nil
+}
+
+func (t *tarWriter) header(name string, typeflag byte, mode os.FileMode, size int64) *tar.Header {
+	return &tar.Header{
+		Typeflag: typeflag,
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		Size:     size,
+		ModTime:  t.modTime,
+		Uname:    "root",
+		Gname:    "root",
+		Format:   tar.FormatGNU,
+	}
+}
+
+func (t *tarWriter) close() ([]byte, error) {
+	if err := t.tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := t.gz.Close(); err != nil {
+		return nil, err
+	}
+	return t.buf.Bytes(), nil
+}
+
+// arWriter writes the common ar format used by deb packages
+type arWriter struct {
+	w       io.Writer
+	modTime time.Time
+}
+
+func newArWriter(w io.Writer, modTime time.Time) *arWriter {
+	return &arWriter{w: w, modTime: modTime}
+}
+
+func (a *arWriter) writeHeader() error {
+	_, err := io.WriteString(a.w, "!<arch>\n")
+	return err
+}
+
+// writeMember writes a file with a 60 byte header, padded to an even size
+func (a *arWriter) writeMember(name string, content []byte) error {
+	header := fmt.Sprintf(
+		"%-16s%-12d%-6d%-6d%-8o%-10d`\n",
+		name, a.modTime.Unix(), 0, 0, 0o100644, len(content),
+	)
+	if len(header) != 60 {
+		return fmt.Errorf("ar header of %s exceeds 60 bytes", name)
+	}
+	if _, err := io.WriteString(a.w, header); err != nil {
+		return err
+	}
+	if _, err := a.w.Write(content); err != nil {
+		return err
+	}
+	if len(content)%2 == 1 {
+		_, err := a.w.Write([]byte{'\n'})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// entry is a parsed tar entry
+type entry struct {
+	mode    int64
+	dir     bool
+	content string
+}
+
+// parsed is a deb package parsed back into its parts
+type parsed struct {
+	members []string
+	version string
+	control map[string]entry
+	data    map[string]entry
+	order   []string
+}
+
+// parseDeb parses the ar archive and both tarballs of a deb package
+func parseDeb(t *testing.T, content []byte) *parsed {
+	if !bytes.HasPrefix(content, []byte("!<arch>\n")) {
+		t.Fatalf("missing ar magic")
+	}
+	res := &parsed{}
+	r := bytes.NewReader(content[8:])
+	for r.Len() > 0 {
+		header := make([]byte, 60)
+		if _, err := io.ReadFull(r, header); err != nil {
+			t.Fatalf("reading ar header: %v", err)
+		}
+		if string(header[58:]) != "`\n" {
+			t.Fatalf("invalid ar header %q", header)
+		}
+		if mtime := strings.TrimSpace(string(header[16:28])); mtime != "0" {
+			t.Fatalf("expected fixed mtime but got %s", mtime)
+		}
+		name := strings.TrimSpace(string(header[:16]))
+		size, err := strconv.Atoi(strings.TrimSpace(string(header[48:58])))
+		if err != nil {
+			t.Fatalf("invalid size in ar header %q", header)
+		}
+		member := make([]byte, size)
+		if _, err := io.ReadFull(r, member); err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		if size%2 == 1 {
+			r.ReadByte() // nolint: errcheck
+		}
+		res.members = append(res.members, name)
+
+		switch name {
+		case "debian-binary":
+			res.version = string(member)
+		case "control.tar.gz":
+			res.control, _ = parseTar(t, member)
+		case "data.tar.gz":
+			res.data, res.order = parseTar(t, member)
+		}
+	}
+	return res
+}
+
+func parseTar(t *testing.T, content []byte) (map[string]entry, []string) {
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("opening gzip: %v", err)
+	}
+	entries := map[string]entry{}
+	order := []string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading tar: %v", err)
+		}
+		if header.Uid != 0 || header.Gid != 0 || header.ModTime.Unix() != 0 {
+			t.Fatalf("%s is not owned by root with a fixed mtime", header.Name)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("reading %s: %v", header.Name, err)
+		}
+		entries[header.Name] = entry{
+			mode: header.Mode, dir: header.Typeflag == tar.TypeDir, content: string(data),
+		}
+		order = append(order, header.Name)
+	}
+	return entries, order
+}
+
+func testPackage(t *testing.T) *Package {
+	dir, err := ioutil.TempDir("", "deb-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "kubeadm")
+	if err := ioutil.WriteFile(source, []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return &Package{
+		Name:         "kubeadm",
+		Version:      "1.17.0-00",
+		Architecture: "amd64",
+		Maintainer:   "Kubernetes Authors <kubernetes-dev+release@googlegroups.com>",
+		Section:      "misc",
+		Priority:     "optional",
+		Homepage:     "https://kubernetes.io",
+		Depends:      []string{"kubelet (>= 1.13.0)", "kubectl (>= 1.13.0)"},
+		Description:  "Kubernetes Cluster Bootstrapping Tool\n The Kubernetes command line tool.\n\n More text.",
+		Files: []File{
+			{Path: "/usr/bin/kubeadm", Mode: 0o755, Source: source},
+			{Path: "/etc/systemd/system/kubelet.service.d/10-kubeadm.conf", Mode: 0o644, Content: []byte("[Service]\n")},
+		},
+		Dirs:      []string{"/etc/kubernetes/manifests"},
+		Conffiles: []string{"/etc/systemd/system/kubelet.service.d/10-kubeadm.conf"},
+		Scripts:   map[string][]byte{PostInst: []byte("#!/bin/sh\nexit 0\n")},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	p := testPackage(t)
+	defer os.RemoveAll(filepath.Dir(p.Files[0].Source))
+
+	buf := &bytes.Buffer{}
+	if err := p.Write(buf); err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	res := parseDeb(t, buf.Bytes())
+
+	if want := []string{"debian-binary", "control.tar.gz", "data.tar.gz"}; !reflect.DeepEqual(res.members, want) {
+		t.Fatalf("expected members %q but got %q", want, res.members)
+	}
+	if res.version != "2.0\n" {
+		t.Fatalf("unexpected format version %q", res.version)
+	}
+
+	wantControl := `Package: kubeadm
+Version: 1.17.0-00
+Architecture: amd64
+Maintainer: Kubernetes Authors <kubernetes-dev+release@googlegroups.com>
+Installed-Size: 1
+Depends: kubelet (>= 1.13.0), kubectl (>= 1.13.0)
+Section: misc
+Priority: optional
+Homepage: https://kubernetes.io
+Description: Kubernetes Cluster Bootstrapping Tool
+ The Kubernetes command line tool.
+ .
+ More text.
+`
+	if got := res.control["./control"].content; got != wantControl {
+		t.Fatalf("expected control\n%s\nbut got\n%s", wantControl, got)
+	}
+	wantSums := "1a1a5e790e20ea383747d168e6044c63  etc/systemd/system/kubelet.service.d/10-kubeadm.conf\n" +
+		"9d7183f16acce70658f686ae7f1a4d20  usr/bin/kubeadm\n"
+	if got := res.control["./md5sums"].content; got != wantSums {
+		t.Fatalf("expected md5sums %q but got %q", wantSums, got)
+	}
+	if got := res.control["./conffiles"].content; got != "/etc/systemd/system/kubelet.service.d/10-kubeadm.conf\n" {
+		t.Fatalf("unexpected conffiles %q", got)
+	}
+	if got := res.control["./postinst"]; got.mode != 0o755 || got.content != "#!/bin/sh\nexit 0\n" {
+		t.Fatalf("unexpected postinst %+v", got)
+	}
+
+	wantOrder := []string{
+		"./", "./etc/", "./etc/kubernetes/", "./etc/kubernetes/manifests/",
+		"./etc/systemd/", "./etc/systemd/system/",
+		"./etc/systemd/system/kubelet.service.d/",
+		"./etc/systemd/system/kubelet.service.d/10-kubeadm.conf",
+		"./usr/", "./usr/bin/", "./usr/bin/kubeadm",
+	}
+	if !reflect.DeepEqual(res.order, wantOrder) {
+		t.Fatalf("expected data entries %q but got %q", wantOrder, res.order)
+	}
+	if got := res.data["./usr/bin/kubeadm"]; got.mode != 0o755 || got.content != "binary" {
+		t.Fatalf("unexpected binary %+v", got)
+	}
+	if got := res.data["./usr/"]; !got.dir || got.mode != 0o755 {
+		t.Fatalf("unexpected directory %+v", got)
+	}
+}
+
+func TestReproducible(t *testing.T) {
+	p := testPackage(t)
+	defer os.RemoveAll(filepath.Dir(p.Files[0].Source))
+
+	first := &bytes.Buffer{}
+	if err := p.Write(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// The order of the files does not matter
+	p.Files[0], p.Files[1] = p.Files[1], p.Files[0]
+	second := &bytes.Buffer{}
+	if err := p.Write(second); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatalf("package is not reproducible")
+	}
+
+	dir := filepath.Dir(p.Files[1].Source)
+	written, err := p.WriteFile(filepath.Join(dir, "bin", "release"))
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	if filepath.Base(written) != "kubeadm_1.17.0-00_amd64.deb" {
+		t.Fatalf("unexpected file name %s", written)
+	}
+	content, err := ioutil.ReadFile(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), content) {
+		t.Fatalf("written package differs")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testcases := []struct {
+		name   string
+		modify func(p *Package)
+	}{
+		{name: "no version", modify: func(p *Package) { p.Version = "" }},
+		{name: "no maintainer", modify: func(p *Package) { p.Maintainer = "" }},
+		{name: "relative path", modify: func(p *Package) { p.Files[0].Path = "usr/bin/kubeadm" }},
+		{name: "unclean path", modify: func(p *Package) { p.Files[0].Path = "/usr/bin/../kubeadm" }},
+		{name: "relative directory", modify: func(p *Package) { p.Dirs = []string{"etc/kubernetes"} }},
+		{name: "duplicate file", modify: func(p *Package) { p.Files[1].Path = p.Files[0].Path }},
+		{name: "unknown conffile", modify: func(p *Package) { p.Conffiles = []string{"/etc/missing"} }},
+		{name: "unknown script", modify: func(p *Package) { p.Scripts["config"] = nil }},
+		{name: "missing source", modify: func(p *Package) { p.Files[0].Source = "/missing" }},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := testPackage(t)
+			defer os.RemoveAll(filepath.Dir(p.Files[0].Source))
+			tc.modify(p)
+			if err := p.Write(ioutil.Discard); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
@@ -5,4 +5,5 @@ go 1.13
 require (
 	github.com/blang/semver v3.5.1+incompatible
 	github.com/google/go-github/v28 v28.1.1
+	gopkg.in/yaml.v2 v2.2.4
 )
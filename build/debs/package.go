@@ -0,0 +1,406 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/release/build/debs/deb"
+)
+
+const (
+	// debianDir is the directory of a rendered package template containing
+	// the package metadata
+	debianDir = "debian"
+
+	downloadRetries = 5
+
+	// localArtifactsEnv uses binaries of a local Kubernetes build instead of
+	// downloading them if set to "y"
+	localArtifactsEnv = "KUBE_USE_LOCAL_ARTIFACTS"
+)
+
+// fetchSources downloads the inputs of the package declared in the catalog,
+// like the kubelet binary, into the build directory
+func (c cfg) fetchSources(dir string) error {
+	for _, s := range c.definition.Sources {
+		url, err := renderTemplate(s.URL, c)
+		if err != nil {
+			return fmt.Errorf("rendering source URL of %s: %v", c.Package, err)
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(s.Destination))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+
+		if s.LocalArtifact && os.Getenv(localArtifactsEnv) == "y" {
+			if err := copyLocalArtifact(c.Arch, dst); err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Printf("downloading %s", url)
+		content, err := download(url)
+		if err != nil {
+			return err
+		}
+		if s.Extract {
+			if err := extractTarball(content, dst); err != nil {
+				return fmt.Errorf("extracting %s: %v", url, err)
+			}
+			continue
+		}
+		if err := ioutil.WriteFile(dst, content, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyLocalArtifact copies a binary of a dockerized Kubernetes build
+func copyLocalArtifact(arch, dst string) error {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		gopath = filepath.Join(home, "go")
+	}
+	src := filepath.Join(
+		gopath, "src", "k8s.io", "kubernetes", "_output", "dockerized", "bin", "linux", arch, filepath.Base(dst),
+	)
+	log.Printf("using local artifact %s", src)
+	content, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, content, 0755)
+}
+
+// download fetches the url, retrying on failures
+func download(url string) ([]byte, error) {
+	var err error
+	for i := 0; i < downloadRetries; i++ {
+		if i > 0 {
+			log.Printf("retrying download of %s: %v", url, err)
+			time.Sleep(time.Duration(i) * time.Second)
+		}
+		var content []byte
+		if content, err = downloadOnce(url); err == nil {
+			return content, nil
+		}
+	}
+	return nil, err
+}
+
+func downloadOnce(url string) ([]byte, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", url, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// extractTarball extracts the regular files of a gzipped tarball into the
+// directory
+func extractTarball(content []byte, dir string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean("/" + header.Name)
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(dst, data, os.FileMode(header.Mode).Perm()); err != nil {
+			return err
+		}
+	}
+}
+
+// control is the package metadata of a rendered debian/control file
+type control struct {
+	source map[string]string
+	binary map[string]string
+}
+
+// parseControl parses the source and the binary stanza of a control file
+func parseControl(content []byte) (*control, error) {
+	stanzas := []map[string]string{}
+	var current map[string]string
+	var field string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			current = nil
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"):
+			if current == nil || field == "" {
+				return nil, fmt.Errorf("continuation line without field: %q", line)
+			}
+			current[field] += "\n" + line
+		default:
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid control line: %q", line)
+			}
+			if current == nil {
+				current = map[string]string{}
+				stanzas = append(stanzas, current)
+			}
+			field = parts[0]
+			current[field] = strings.TrimSpace(parts[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(stanzas) != 2 {
+		return nil, fmt.Errorf("expected a source and a binary stanza but got %d stanzas", len(stanzas))
+	}
+	return &control{source: stanzas[0], binary: stanzas[1]}, nil
+}
+
+// readMetaFile reads a file of the package metadata like debhelper does:
+// <name>.<kind> takes precedence over the plain <kind> file, which allows
+// templates to be shared by packages. Missing files are empty.
+func readMetaFile(metaDir, name, kind string) ([]byte, error) {
+	for _, file := range []string{name + "." + kind, kind} {
+		content, err := ioutil.ReadFile(filepath.Join(metaDir, file))
+		if err == nil {
+			return content, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// installFiles maps the files of the build directory to their installation
+// paths like dh_install does: every line of the install file names a file or
+// directory and the directory to install it to.
+func installFiles(buildDir string, install []byte) ([]specFile, error) {
+	files := []specFile{}
+	for _, line := range strings.Split(string(install), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid install line: %q", line)
+		}
+		src := filepath.Join(buildDir, filepath.FromSlash(fields[0]))
+		dstDir := path.Join("/", fields[1])
+
+		if err := filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(filepath.Dir(filepath.Clean(src)), file)
+			if err != nil {
+				return err
+			}
+			// Like dh_fixperms, the permissions do not depend on the umask
+			mode := os.FileMode(0644)
+			if info.Mode()&0111 != 0 {
+				mode = 0755
+			}
+			files = append(files, specFile{
+				Path:   path.Join(dstDir, filepath.ToSlash(rel)),
+				Mode:   mode,
+				Source: file,
+			})
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// systemdScript enables and starts the systemd units on configuration
+const systemdScript = `if [ "$1" = "configure" ] && [ -d /run/systemd/system ]; then
+	systemctl daemon-reload >/dev/null || true
+	systemctl enable %[1]s >/dev/null || true
+	systemctl restart %[1]s >/dev/null || true
+fi`
+
+// packageSpec assembles the format neutral package from the rendered
+// package template and the fetched sources within the build directory
+func (c cfg) packageSpec(buildDir string) (*packageSpec, error) {
+	metaDir := filepath.Join(buildDir, debianDir)
+	content, err := ioutil.ReadFile(filepath.Join(metaDir, "control"))
+	if err != nil {
+		return nil, err
+	}
+	ctrl, err := parseControl(content)
+	if err != nil {
+		return nil, fmt.Errorf("parsing control of %s: %v", c.Package, err)
+	}
+
+	// The extended description is indented with single dots for empty lines
+	lines := strings.Split(ctrl.binary["Description"], "\n")
+	for i, line := range lines[1:] {
+		if line = strings.TrimSpace(line); line == "." {
+			line = ""
+		}
+		lines[i+1] = line
+	}
+	summary, description := lines[0], strings.Join(lines[1:], "\n")
+	s := &packageSpec{
+		Name:        ctrl.binary["Package"],
+		Version:     c.Version,
+		Revision:    c.Revision,
+		Arch:        c.Arch,
+		Maintainer:  ctrl.source["Maintainer"],
+		Section:     ctrl.source["Section"],
+		Priority:    ctrl.source["Priority"],
+		Homepage:    ctrl.source["Homepage"],
+		Summary:     summary,
+		Description: description,
+		Scripts:     map[string][]byte{},
+	}
+	if c.definition != nil {
+		s.Dependencies = c.definition.Dependencies
+	}
+
+	install, err := readMetaFile(metaDir, s.Name, "install")
+	if err != nil {
+		return nil, err
+	}
+	if s.Files, err = installFiles(buildDir, install); err != nil {
+		return nil, fmt.Errorf("installing files of %s: %v", c.Package, err)
+	}
+
+	docs, err := c.docFiles(metaDir, s.Name)
+	if err != nil {
+		return nil, err
+	}
+	s.Files = append(s.Files, docs...)
+
+	dirs, err := readMetaFile(metaDir, s.Name, "dirs")
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range strings.Fields(string(dirs)) {
+		s.Dirs = append(s.Dirs, path.Join("/", dir))
+	}
+
+	units := []string{}
+	for _, f := range s.Files {
+		// Like debhelper, all files below /etc are configuration files
+		if strings.HasPrefix(f.Path, "/etc/") {
+			s.Conffiles = append(s.Conffiles, f.Path)
+		}
+		if strings.HasSuffix(path.Dir(f.Path), "/lib/systemd/system") && strings.HasSuffix(f.Path, ".service") {
+			units = append(units, path.Base(f.Path))
+		}
+	}
+	sort.Strings(s.Conffiles)
+	sort.Strings(units)
+
+	for _, name := range []string{deb.PreInst, deb.PostInst, deb.PreRm, deb.PostRm} {
+		script, err := ioutil.ReadFile(filepath.Join(metaDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		generated := ""
+		if name == deb.PostInst && len(units) > 0 {
+			generated = fmt.Sprintf(systemdScript, strings.Join(units, " "))
+		}
+		s.Scripts[name] = bytes.Replace(script, []byte("#DEBHELPER#"), []byte(generated), 1)
+	}
+
+	return s, nil
+}
+
+// docFiles returns the copyright and the compressed changelog of the package
+func (c cfg) docFiles(metaDir, name string) ([]specFile, error) {
+	docDir := path.Join("/usr/share/doc", name)
+	files := []specFile{}
+
+	copyright, err := ioutil.ReadFile(filepath.Join(metaDir, "copyright"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		files = append(files, specFile{Path: path.Join(docDir, "copyright"), Mode: 0644, Content: copyright})
+	}
+
+	changelog, err := ioutil.ReadFile(filepath.Join(metaDir, "changelog"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		if _, err := gz.Write(changelog); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		files = append(files, specFile{Path: path.Join(docDir, "changelog.Debian.gz"), Mode: 0644, Content: buf.Bytes()})
+	}
+	return files, nil
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/release/build/debs/deb"
+)
+
+const testControl = `Source: kubelet
+Section: misc
+Priority: optional
+Maintainer: Kubernetes Authors <kubernetes-dev+release@googlegroups.com>
+Homepage: https://kubernetes.io
+
+Package: kubelet
+Architecture: armhf
+Description: Kubernetes Node Agent
+ The node agent of Kubernetes, the container cluster manager
+`
+
+func TestParseControl(t *testing.T) {
+	testcases := []struct {
+		name      string
+		content   string
+		pkg       string
+		shouldErr bool
+	}{
+		{
+			name:    "source and binary stanza",
+			content: testControl,
+			pkg:     "kubelet",
+		},
+		{
+			name:      "missing binary stanza",
+			content:   "Source: kubectl\nSection: misc\n",
+			shouldErr: true,
+		},
+		{
+			name:      "invalid line",
+			content:   "Source: kubectl\n\nPackage\n",
+			shouldErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl, err := parseControl([]byte(tc.content))
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("did not expect an error: %v", err)
+			}
+			if got := ctrl.binary["Package"]; got != tc.pkg {
+				t.Fatalf("expected package %s but got %s", tc.pkg, got)
+			}
+		})
+	}
+}
+
+func writeTestFile(t *testing.T, dir, name, content string, mode os.FileMode) {
+	file := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackageSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, dir, "debian/control", testControl, 0644)
+	writeTestFile(t, dir, "debian/kubelet.install",
+		"usr/bin/kubelet usr/bin/\nlib/systemd/system/kubelet.service lib/systemd/system/\nbin/ opt/cni\netc/default/kubelet etc/default\n", 0644)
+	writeTestFile(t, dir, "debian/kubelet.dirs", "etc/kubernetes/manifests\n", 0644)
+	writeTestFile(t, dir, "debian/postinst", "#!/bin/sh\n#DEBHELPER#\nexit 0\n", 0755)
+	writeTestFile(t, dir, "debian/copyright", "Apache-2.0\n", 0644)
+	writeTestFile(t, dir, "debian/changelog", "kubelet (1.17.0-0) release; urgency=medium\n", 0644)
+	writeTestFile(t, dir, "usr/bin/kubelet", "binary", 0755)
+	writeTestFile(t, dir, "lib/systemd/system/kubelet.service", "[Service]\n", 0644)
+	writeTestFile(t, dir, "bin/bridge", "cni", 0755)
+	writeTestFile(t, dir, "bin/flannel", "cni", 0755)
+	writeTestFile(t, dir, "etc/default/kubelet", "KUBELET_EXTRA_ARGS=\n", 0644)
+
+	c := cfg{
+		packageDefinition: &packageDefinition{Version: "1.17.0", Revision: "0"},
+		Package:           "kubelet",
+		Arch:              "arm",
+		definition: &catalogPackage{
+			Name:         "kubelet",
+			Dependencies: []dependency{{"iptables", ">= 1.4.21"}, {"kubernetes-cni", ">= 0.7.5"}},
+		},
+	}
+	p, err := c.packageSpec(dir)
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+
+	if p.Name != "kubelet" || p.Version != "1.17.0" || p.Revision != "0" || p.Arch != "arm" {
+		t.Fatalf("unexpected package %s %s-%s %s", p.Name, p.Version, p.Revision, p.Arch)
+	}
+	if p.Maintainer != "Kubernetes Authors <kubernetes-dev+release@googlegroups.com>" {
+		t.Fatalf("unexpected maintainer %s", p.Maintainer)
+	}
+	if p.Summary != "Kubernetes Node Agent" || p.Description != "The node agent of Kubernetes, the container cluster manager" {
+		t.Fatalf("unexpected description %q %q", p.Summary, p.Description)
+	}
+	wantDeps := []dependency{{"iptables", ">= 1.4.21"}, {"kubernetes-cni", ">= 0.7.5"}}
+	if !reflect.DeepEqual(p.Dependencies, wantDeps) {
+		t.Fatalf("expected dependencies %v but got %v", wantDeps, p.Dependencies)
+	}
+	if want := []string{"/etc/kubernetes/manifests"}; !reflect.DeepEqual(p.Dirs, want) {
+		t.Fatalf("expected directories %q but got %q", want, p.Dirs)
+	}
+
+	paths := []string{}
+	for _, f := range p.Files {
+		paths = append(paths, f.Path)
+		if f.Path == "/usr/bin/kubelet" && f.Mode != 0755 {
+			t.Fatalf("expected an executable kubelet but got mode %v", f.Mode)
+		}
+	}
+	wantPaths := []string{
+		"/usr/bin/kubelet",
+		"/lib/systemd/system/kubelet.service",
+		"/opt/cni/bin/bridge",
+		"/opt/cni/bin/flannel",
+		"/etc/default/kubelet",
+		"/usr/share/doc/kubelet/copyright",
+		"/usr/share/doc/kubelet/changelog.Debian.gz",
+	}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Fatalf("expected files %q but got %q", wantPaths, paths)
+	}
+	if want := []string{"/etc/default/kubelet"}; !reflect.DeepEqual(p.Conffiles, want) {
+		t.Fatalf("expected conffiles %q but got %q", want, p.Conffiles)
+	}
+
+	postinst := string(p.Scripts[deb.PostInst])
+	if strings.Contains(postinst, "#DEBHELPER#") || !strings.Contains(postinst, "systemctl enable kubelet.service") {
+		t.Fatalf("unexpected postinst %q", postinst)
+	}
+
+	debPackage, err := p.deb()
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	if err := debPackage.Write(ioutil.Discard); err != nil {
+		t.Fatalf("did not expect an error writing the package: %v", err)
+	}
+	rpmPackage, err := p.rpm()
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	if err := rpmPackage.Validate(); err != nil {
+		t.Fatalf("did not expect an invalid rpm: %v", err)
+	}
+}
+
+func TestInstallFilesMissingSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := installFiles(dir, []byte("usr/bin/kubectl usr/bin/\n")); err == nil {
+		t.Fatalf("expected an error for a missing file")
+	}
+	if _, err := installFiles(dir, []byte("usr/bin/kubectl\n")); err == nil {
+		t.Fatalf("expected an error for an invalid line")
+	}
+}
+
+func TestReadMetaFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, dir, "install", "bin/ opt/cni\n", 0644)
+	writeTestFile(t, dir, "kubelet.install", "usr/bin/kubelet usr/bin/\n", 0644)
+
+	testcases := []struct {
+		name     string
+		expected string
+	}{
+		{name: "kubelet", expected: "usr/bin/kubelet usr/bin/\n"},
+		{name: "kubernetes-cni-plugins", expected: "bin/ opt/cni\n"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := readMetaFile(dir, tc.name, "install")
+			if err != nil {
+				t.Fatalf("did not expect an error: %v", err)
+			}
+			if string(content) != tc.expected {
+				t.Fatalf("expected %q but got %q", tc.expected, content)
+			}
+		})
+	}
+
+	content, err := readMetaFile(dir, "kubelet", "dirs")
+	if err != nil || content != nil {
+		t.Fatalf("expected no content and no error but got %q and %v", content, err)
+	}
+}
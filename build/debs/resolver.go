@@ -0,0 +1,302 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/google/go-github/v28/github"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// githubTokenEnv authenticates requests to the GitHub API if set, which
+	// raises the rate limit
+	githubTokenEnv = "GITHUB_TOKEN"
+
+	// maxVersionMarkerSize limits the size of version markers like
+	// stable.txt, which only contain a version
+	maxVersionMarkerSize = 1024
+
+	resolverTimeout = time.Minute
+)
+
+// versionResolver resolves the versions which are not known before a build:
+// the latest Kubernetes version of a channel and the versions of packages
+// released independently of Kubernetes
+type versionResolver interface {
+	// kubernetesVersion returns the latest Kubernetes version of the channel
+	kubernetesVersion(channel ChannelType) (string, error)
+
+	// packageVersion returns the version of the package for the Kubernetes
+	// version
+	packageVersion(p *catalogPackage, kubeVersion string) (string, error)
+}
+
+// parseVersion parses a version, which may be prefixed with a v like the
+// version markers and the release tags
+func parseVersion(version string) (semver.Version, error) {
+	return semver.Parse(strings.TrimPrefix(strings.TrimSpace(version), "v"))
+}
+
+// httpResolver resolves Kubernetes versions from the version markers of the
+// channels, like https://dl.k8s.io/release/stable.txt
+type httpResolver struct {
+	client *http.Client
+	urls   map[ChannelType]string
+}
+
+func newHTTPResolver(urls map[ChannelType]string) *httpResolver {
+	return &httpResolver{client: &http.Client{Timeout: resolverTimeout}, urls: urls}
+}
+
+func (r *httpResolver) kubernetesVersion(channel ChannelType) (string, error) {
+	url, ok := r.urls[channel]
+	if !ok {
+		return "", fmt.Errorf("no version marker for channel %s", channel)
+	}
+	log.Printf("Retrieving Kubernetes %s version from %s...", channel, url)
+
+	res, err := r.client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: %s", url, res.Status)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(res.Body, maxVersionMarkerSize))
+	if err != nil {
+		return "", err
+	}
+
+	version, err := parseVersion(string(content))
+	if err != nil {
+		return "", fmt.Errorf("invalid version %q in %s: %v", content, url, err)
+	}
+	return version.String(), nil
+}
+
+// githubResolver resolves package versions from the GitHub releases of their
+// repositories
+type githubResolver struct {
+	client *github.Client
+}
+
+func newGitHubResolver() *githubResolver {
+	client := &http.Client{Timeout: resolverTimeout}
+	if token := os.Getenv(githubTokenEnv); token != "" {
+		client.Transport = &tokenTransport{token: token, base: http.DefaultTransport}
+	}
+	return &githubResolver{client: github.NewClient(client)}
+}
+
+// tokenTransport authenticates requests with a GitHub token
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+func (r *githubResolver) packageVersion(p *catalogPackage, kubeVersion string) (string, error) {
+	if p.Version.Source != VersionSourceGitHub {
+		return "", fmt.Errorf("cannot resolve %s versions of %s via GitHub", p.Version.Source, p.Name)
+	}
+	parts := strings.Split(p.Version.Repository, "/")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid GitHub repository %q", p.Version.Repository)
+	}
+	log.Printf("using %s version", p.Version.Repository)
+
+	tags, err := r.releaseTags(parts[0], parts[1])
+	if err != nil {
+		return "", fmt.Errorf("listing releases of %s: %v", p.Version.Repository, err)
+	}
+	return latestRelease(tags, kubeVersion)
+}
+
+// releaseTags returns the tags of all releases of the repository, which are
+// no pre-releases
+func (r *githubResolver) releaseTags(owner, repo string) ([]string, error) {
+	tags := []string{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		releases, res, err := r.client.Repositories.ListReleases(context.Background(), owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, release := range releases {
+			if !release.GetPrerelease() && !release.GetDraft() {
+				tags = append(tags, release.GetTagName())
+			}
+		}
+		if res.NextPage == 0 {
+			return tags, nil
+		}
+		opts.Page = res.NextPage
+	}
+}
+
+// latestRelease returns the latest release tag for the minor version of
+// Kubernetes. Pre-releases like v1.17.0-alpha.0 or builds like
+// v1.17.0-alpha.0.1809+ff8716f4cf6180 use the previous minor version. Without
+// a matching release the first release of the minor version is assumed.
+func latestRelease(tags []string, kubeVersion string) (string, error) {
+	kubeSemver, err := semver.Parse(kubeVersion)
+	if err != nil {
+		return "", fmt.Errorf("could not parse k8s semver: %v", err)
+	}
+
+	minor := kubeSemver.Minor
+	if channelForVersion(kubeSemver) != ChannelRelease && minor > 0 {
+		minor--
+	}
+	version := semver.Version{Major: kubeSemver.Major, Minor: minor}
+
+	for _, tag := range tags {
+		v, err := parseVersion(tag)
+		if err != nil {
+			log.Printf("skipping release %s: %v", tag, err)
+			continue
+		}
+		if v.Major == version.Major && v.Minor == version.Minor && v.GTE(version) {
+			version = v
+		}
+	}
+
+	log.Printf("latest release for Kubernetes %s is %s", kubeVersion, version)
+	return version.String(), nil
+}
+
+// onlineResolver resolves Kubernetes versions via HTTP and package versions
+// via GitHub
+type onlineResolver struct {
+	http   *httpResolver
+	github *githubResolver
+}
+
+func (r *onlineResolver) kubernetesVersion(channel ChannelType) (string, error) {
+	return r.http.kubernetesVersion(channel)
+}
+
+func (r *onlineResolver) packageVersion(p *catalogPackage, kubeVersion string) (string, error) {
+	return r.github.packageVersion(p, kubeVersion)
+}
+
+// staticResolver resolves all versions from a versions file, which allows to
+// build packages without network access to the version sources and pins the
+// versions for reproducible builds
+type staticResolver struct {
+	// Kubernetes are the Kubernetes versions by channel
+	Kubernetes map[ChannelType]string `yaml:"kubernetes"`
+
+	// Packages are the package versions by package name and Kubernetes
+	// minor version, like 1.17, which also applies to the pre-releases and
+	// builds of that minor version. Static packages without a version use
+	// the one of the catalog.
+	Packages map[string]map[string]string `yaml:"packages"`
+}
+
+// kubernetesMinor returns the minor version of Kubernetes as used by the
+// versions file, like 1.17
+func kubernetesMinor(v semver.Version) string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// loadVersionsFile reads and validates a versions file
+func loadVersionsFile(path string) (*staticResolver, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &staticResolver{}
+	if err := yaml.UnmarshalStrict(content, r); err != nil {
+		return nil, fmt.Errorf("parsing versions file %s: %v", path, err)
+	}
+	for channel, version := range r.Kubernetes {
+		if _, err := parseVersion(version); err != nil {
+			return nil, fmt.Errorf("invalid Kubernetes %s version %q in %s: %v", channel, version, path, err)
+		}
+	}
+	for name, versions := range r.Packages {
+		for minor, version := range versions {
+			v, err := parseVersion(minor + ".0")
+			if err != nil || kubernetesMinor(v) != minor {
+				return nil, fmt.Errorf("invalid Kubernetes minor version %q of %s in %s", minor, name, path)
+			}
+			if _, err := parseVersion(version); err != nil {
+				return nil, fmt.Errorf("invalid %s version %q for Kubernetes %s in %s: %v", name, version, minor, path, err)
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r *staticResolver) kubernetesVersion(channel ChannelType) (string, error) {
+	version, ok := r.Kubernetes[channel]
+	if !ok {
+		return "", fmt.Errorf("no Kubernetes %s version in versions file", channel)
+	}
+	v, err := parseVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+func (r *staticResolver) packageVersion(p *catalogPackage, kubeVersion string) (string, error) {
+	version, ok, err := r.lookupPackageVersion(p.Name, kubeVersion)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("no %s version for Kubernetes %s in versions file", p.Name, kubeVersion)
+	}
+	return version, nil
+}
+
+// lookupPackageVersion returns the version of the package for the minor of
+// the Kubernetes version and whether the versions file contains it
+func (r *staticResolver) lookupPackageVersion(name, kubeVersion string) (string, bool, error) {
+	kubeSemver, err := semver.Parse(kubeVersion)
+	if err != nil {
+		return "", false, fmt.Errorf("could not parse k8s semver: %v", err)
+	}
+	version, ok := r.Packages[name][kubernetesMinor(kubeSemver)]
+	if !ok {
+		return "", false, nil
+	}
+	v, err := parseVersion(version)
+	if err != nil {
+		return "", false, err
+	}
+	return v.String(), true, nil
+}
@@ -0,0 +1,277 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTTPResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stable.txt":
+			fmt.Fprint(w, "v1.17.0\n")
+		case "/k8s-master.txt":
+			fmt.Fprint(w, "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0")
+		case "/garbage.txt":
+			fmt.Fprint(w, "<html>not found</html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	testcases := []struct {
+		name      string
+		marker    string
+		expected  string
+		shouldErr bool
+	}{
+		{name: "release", marker: "/stable.txt", expected: "1.17.0"},
+		{name: "build", marker: "/k8s-master.txt", expected: "1.18.0-alpha.1.123+5a1ae3a2aaa3c0"},
+		{name: "not found", marker: "/latest.txt", shouldErr: true},
+		{name: "no version", marker: "/garbage.txt", shouldErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newHTTPResolver(map[ChannelType]string{ChannelRelease: server.URL + tc.marker})
+			actual, err := r.kubernetesVersion(ChannelRelease)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("did not expect an error: %v", err)
+			}
+			if actual != tc.expected {
+				t.Fatalf("expected %s but got %s", tc.expected, actual)
+			}
+		})
+	}
+
+	r := newHTTPResolver(map[ChannelType]string{})
+	if _, err := r.kubernetesVersion(ChannelNightly); err == nil {
+		t.Fatalf("expected an error for a channel without version marker")
+	}
+}
+
+func TestGitHubResolver(t *testing.T) {
+	var authorization string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/kubernetes-sigs/cri-tools/releases", func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"tag_name": "v1.16.1"}, {"tag_name": "v1.15.0"}]`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s?page=2>; rel="next"`, "http://"+r.Host+r.URL.Path))
+		fmt.Fprint(w, `[
+			{"tag_name": "v1.17.0-beta.0", "prerelease": true},
+			{"tag_name": "v1.17.1", "draft": true},
+			{"tag_name": "v1.17.0"},
+			{"tag_name": "latest"}
+		]`)
+	})
+	mux.HandleFunc("/repos/kubernetes-sigs/broken/releases", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limit exceeded", http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	defer os.Setenv(githubTokenEnv, os.Getenv(githubTokenEnv))
+	os.Setenv(githubTokenEnv, "secret")
+
+	r := newGitHubResolver()
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.client.BaseURL = baseURL
+
+	testcases := []struct {
+		name        string
+		repository  string
+		kubeVersion string
+		expected    string
+		shouldErr   bool
+	}{
+		{name: "release", repository: "kubernetes-sigs/cri-tools", kubeVersion: "1.17.0", expected: "1.17.0"},
+		{name: "previous page", repository: "kubernetes-sigs/cri-tools", kubeVersion: "1.16.3", expected: "1.16.1"},
+		{name: "pre-release", repository: "kubernetes-sigs/cri-tools", kubeVersion: "1.17.0-rc.1", expected: "1.16.1"},
+		{name: "error status", repository: "kubernetes-sigs/broken", kubeVersion: "1.17.0", shouldErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &catalogPackage{
+				Name:    "cri-tools",
+				Version: versionSource{Source: VersionSourceGitHub, Repository: tc.repository},
+			}
+			actual, err := r.packageVersion(p, tc.kubeVersion)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("did not expect an error: %v", err)
+			}
+			if actual != tc.expected {
+				t.Fatalf("expected %s but got %s", tc.expected, actual)
+			}
+		})
+	}
+
+	if authorization != "token secret" {
+		t.Fatalf("expected requests to be authenticated but got %q", authorization)
+	}
+	if _, err := r.packageVersion(&catalogPackage{Name: "kubelet", Version: versionSource{Source: VersionSourceKubernetes}}, "1.17.0"); err == nil {
+		t.Fatalf("expected an error for a package without GitHub version source")
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	tags := []string{"v1.16.0", "v1.16.1", "v1.17.0", "v1.17.2", "v1.18.0-alpha.0"}
+
+	testcases := []struct {
+		kubeVersion string
+		expected    string
+		shouldErr   bool
+	}{
+		{kubeVersion: "1.17.3", expected: "1.17.2"},
+		{kubeVersion: "1.16.0", expected: "1.16.1"},
+		{kubeVersion: "1.17.0-alpha.0", expected: "1.16.1"},
+		{kubeVersion: "1.18.0-alpha.1.123+5a1ae3a2aaa3c0", expected: "1.17.2"},
+		{kubeVersion: "1.19.0", expected: "1.19.0"},
+		{kubeVersion: "latest", shouldErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.kubeVersion, func(t *testing.T) {
+			actual, err := latestRelease(tags, tc.kubeVersion)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("did not expect an error: %v", err)
+			}
+			if actual != tc.expected {
+				t.Fatalf("expected %s but got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLoadVersionsFile(t *testing.T) {
+	testcases := []struct {
+		name      string
+		content   string
+		shouldErr bool
+	}{
+		{
+			name:    "all versions",
+			content: "kubernetes:\n  release: v1.17.0\n  nightly: 1.18.0-alpha.1.123+5a1ae3a2aaa3c0\npackages:\n  cri-tools:\n    \"1.17\": 1.17.0\n    \"1.18\": v1.18.0\n",
+		},
+		{
+			name:      "invalid Kubernetes version",
+			content:   "kubernetes:\n  release: stable\n",
+			shouldErr: true,
+		},
+		{
+			name:      "invalid package version",
+			content:   "packages:\n  cri-tools:\n    \"1.17\": 1.17\n",
+			shouldErr: true,
+		},
+		{
+			name:      "invalid Kubernetes minor version",
+			content:   "packages:\n  cri-tools:\n    \"1.17.0\": 1.17.0\n",
+			shouldErr: true,
+		},
+		{
+			name:      "unversioned package",
+			content:   "packages:\n  cri-tools: 1.17.0\n",
+			shouldErr: true,
+		},
+		{
+			name:      "unknown field",
+			content:   "kubernetes-cni: 0.8.2\n",
+			shouldErr: true,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "versions-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(dir, fmt.Sprintf("versions-%d.yaml", i))
+			if err := ioutil.WriteFile(file, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			r, err := loadVersionsFile(file)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("did not expect an error: %v", err)
+			}
+
+			if v, err := r.kubernetesVersion(ChannelRelease); err != nil || v != "1.17.0" {
+				t.Fatalf("expected release version 1.17.0 but got %s: %v", v, err)
+			}
+			if v, err := r.kubernetesVersion(ChannelNightly); err != nil || !strings.HasSuffix(v, "+5a1ae3a2aaa3c0") {
+				t.Fatalf("unexpected nightly version %s: %v", v, err)
+			}
+			if _, err := r.kubernetesVersion(ChannelTesting); err == nil {
+				t.Fatalf("expected an error for a missing channel")
+			}
+			if v, err := r.packageVersion(&catalogPackage{Name: "cri-tools"}, "1.17.0"); err != nil || v != "1.17.0" {
+				t.Fatalf("expected cri-tools version 1.17.0 but got %s: %v", v, err)
+			}
+			if v, err := r.packageVersion(&catalogPackage{Name: "cri-tools"}, "1.18.0-alpha.1.123+5a1ae3a2aaa3c0"); err != nil || v != "1.18.0" {
+				t.Fatalf("expected cri-tools version 1.18.0 but got %s: %v", v, err)
+			}
+			if _, err := r.packageVersion(&catalogPackage{Name: "cri-tools"}, "1.16.4"); err == nil {
+				t.Fatalf("expected an error for a missing Kubernetes minor version")
+			}
+			if _, err := r.packageVersion(&catalogPackage{Name: "kubernetes-cni"}, "1.17.0"); err == nil {
+				t.Fatalf("expected an error for a missing package")
+			}
+		})
+	}
+}
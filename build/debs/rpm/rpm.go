@@ -0,0 +1,263 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rpm builds rpm packages from prebuilt files. The package gets
+// described by a generated spec file, which rpmbuild turns into the package
+// without compiling anything.
+package rpm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// File is a file installed by a package
+type File struct {
+	// Path is the absolute installation path, like /usr/bin/kubelet
+	Path string
+
+	// Mode are the permission bits of the file
+	Mode os.FileMode
+
+	// Content is the content of the file if Source is not set
+	Content []byte
+
+	// Source is a local file providing the content
+	Source string
+}
+
+// Package is the definition of a binary rpm package
+type Package struct {
+	Name string
+
+	// Version must not contain dashes, pre-releases use a tilde instead, like
+	// 1.17.0~rc.1
+	Version string
+
+	Release      string
+	Architecture string
+	Summary      string
+	Description  string
+	License      string
+	URL          string
+	Packager     string
+
+	// Requires are the dependencies including their version constraints,
+	// like "kubelet >= 1.13.0"
+	Requires []string
+
+	// Files are the files installed by the package
+	Files []File
+
+	// ConfigFiles are the paths of files which are not replaced on upgrades
+	// if they have been modified
+	ConfigFiles []string
+
+	// Dirs are directories owned by the package, which may be empty
+	Dirs []string
+}
+
+// Filename returns the conventional file name of the package, like
+// kubelet-1.17.0-0.x86_64.rpm
+func (p *Package) Filename() string {
+	return fmt.Sprintf("%s-%s-%s.%s.rpm", p.Name, p.Version, p.Release, p.Architecture)
+}
+
+// Validate checks that the package can be built
+func (p *Package) Validate() error {
+	if p.Name == "" || p.Version == "" || p.Release == "" || p.Architecture == "" {
+		return fmt.Errorf("package name, version, release and architecture are required")
+	}
+	if strings.Contains(p.Version, "-") || strings.Contains(p.Release, "-") {
+		return fmt.Errorf("version %s-%s of package %s must not contain dashes", p.Version, p.Release, p.Name)
+	}
+	if p.Summary == "" || p.License == "" {
+		return fmt.Errorf("package %s needs a summary and a license", p.Name)
+	}
+	paths := map[string]bool{}
+	for _, f := range p.Files {
+		if !path.IsAbs(f.Path) || path.Clean(f.Path) != f.Path {
+			return fmt.Errorf("file path %q is not a clean absolute path", f.Path)
+		}
+		if paths[f.Path] {
+			return fmt.Errorf("duplicate file %s", f.Path)
+		}
+		paths[f.Path] = true
+	}
+	for _, c := range p.ConfigFiles {
+		if !paths[c] {
+			return fmt.Errorf("config file %s is not part of the package", c)
+		}
+	}
+	for _, d := range p.Dirs {
+		if !path.IsAbs(d) || path.Clean(d) != d {
+			return fmt.Errorf("directory %q is not a clean absolute path", d)
+		}
+	}
+	return nil
+}
+
+// Spec returns the spec file of the package. The files are expected to be
+// staged within the source directory of rpmbuild.
+func (p *Package) Spec() []byte {
+	b := &strings.Builder{}
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(b, "%s: %s\n", name, escape(value))
+		}
+	}
+
+	// The files are prebuilt, which means that there is nothing to strip
+	// and no debug information to extract. The build time and file times
+	// are taken from SOURCE_DATE_EPOCH if set.
+	b.WriteString(`%define debug_package %{nil}
+%define __os_install_post %{nil}
+%define _build_id_links none
+%define use_source_date_epoch_as_buildtime 1
+%define clamp_mtime_to_source_date_epoch 1
+
+`)
+	field("Name", p.Name)
+	field("Version", p.Version)
+	field("Release", p.Release)
+	field("Summary", p.Summary)
+	field("License", p.License)
+	field("URL", p.URL)
+	field("Packager", p.Packager)
+	b.WriteString("AutoReqProv: no\n")
+	for _, r := range p.Requires {
+		field("Requires", r)
+	}
+
+	description := strings.TrimSpace(p.Description)
+	if description == "" {
+		description = p.Summary
+	}
+	fmt.Fprintf(b, "\n%%description\n%s\n", escape(description))
+
+	b.WriteString("\n%prep\n\n%build\n\n%install\nmkdir -p %{buildroot}\ncp -a %{_sourcedir}/. %{buildroot}/\n")
+
+	config := map[string]bool{}
+	for _, c := range p.ConfigFiles {
+		config[c] = true
+	}
+	files := append([]File{}, p.Files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	dirs := append([]string{}, p.Dirs...)
+	sort.Strings(dirs)
+
+	b.WriteString("\n%files\n")
+	for _, d := range dirs {
+		fmt.Fprintf(b, "%%dir %%attr(0755, root, root) %s\n", escape(d))
+	}
+	for _, f := range files {
+		if config[f.Path] {
+			b.WriteString("%config(noreplace) ")
+		}
+		fmt.Fprintf(b, "%%attr(%04o, root, root) %s\n", f.Mode.Perm(), escape(f.Path))
+	}
+	return []byte(b.String())
+}
+
+// Build builds the package via rpmbuild into the directory and returns the
+// path of the written rpm
+func (p *Package) Build(dir string) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
+	topdir, err := ioutil.TempDir("", "rpm-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(topdir)
+	sourcedir := filepath.Join(topdir, "SOURCES")
+	if err := p.stage(sourcedir); err != nil {
+		return "", err
+	}
+	spec := filepath.Join(topdir, "SPECS", p.Name+".spec")
+	if err := os.MkdirAll(filepath.Dir(spec), 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(spec, p.Spec(), 0644); err != nil {
+		return "", err
+	}
+
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	cmd := exec.Command(
+		"rpmbuild", "-bb",
+		"--target", p.Architecture,
+		"--define", "_topdir "+topdir,
+		"--define", "_sourcedir "+sourcedir,
+		"--define", "_rpmdir "+dir,
+		"--define", "_build_name_fmt %%{NAME}-%%{VERSION}-%%{RELEASE}.%%{ARCH}.rpm",
+		spec,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("building %s: %v", p.Filename(), err)
+	}
+
+	written := filepath.Join(dir, p.Filename())
+	if _, err := os.Stat(written); err != nil {
+		return "", fmt.Errorf("rpmbuild did not write %s: %v", written, err)
+	}
+	return written, nil
+}
+
+// stage writes the files of the package into the directory
+func (p *Package) stage(dir string) error {
+	for _, d := range p.Dirs {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0755); err != nil {
+			return err
+		}
+	}
+	for _, f := range p.Files {
+		dst := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		content := f.Content
+		if f.Source != "" {
+			var err error
+			if content, err = ioutil.ReadFile(f.Source); err != nil {
+				return err
+			}
+		}
+		if err := ioutil.WriteFile(dst, content, f.Mode.Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escape escapes macros within values of the spec file
+func escape(value string) string {
+	return strings.Replace(value, "%", "%%", -1)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rpm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testPackage() *Package {
+	return &Package{
+		Name:         "kubelet",
+		Version:      "1.17.0~rc.1",
+		Release:      "0",
+		Architecture: "x86_64",
+		Summary:      "Kubernetes Node Agent",
+		Description:  "The node agent of Kubernetes, 100% open source",
+		License:      "ASL 2.0",
+		URL:          "https://kubernetes.io",
+		Requires:     []string{"iptables >= 1.4.21", "socat"},
+		Files: []File{
+			{Path: "/usr/bin/kubelet", Mode: 0755, Content: []byte("binary")},
+			{Path: "/etc/sysconfig/kubelet", Mode: 0644, Content: []byte("KUBELET_EXTRA_ARGS=\n")},
+		},
+		ConfigFiles: []string{"/etc/sysconfig/kubelet"},
+		Dirs:        []string{"/etc/kubernetes/manifests"},
+	}
+}
+
+func TestSpec(t *testing.T) {
+	expected := `%define debug_package %{nil}
+%define __os_install_post %{nil}
+%define _build_id_links none
+%define use_source_date_epoch_as_buildtime 1
+%define clamp_mtime_to_source_date_epoch 1
+
+Name: kubelet
+Version: 1.17.0~rc.1
+Release: 0
+Summary: Kubernetes Node Agent
+License: ASL 2.0
+URL: https://kubernetes.io
+AutoReqProv: no
+Requires: iptables >= 1.4.21
+Requires: socat
+
+%description
+The node agent of Kubernetes, 100%% open source
+
+%prep
+
+%build
+
+%install
+mkdir -p %{buildroot}
+cp -a %{_sourcedir}/. %{buildroot}/
+
+%files
+%dir %attr(0755, root, root) /etc/kubernetes/manifests
+%config(noreplace) %attr(0644, root, root) /etc/sysconfig/kubelet
+%attr(0755, root, root) /usr/bin/kubelet
+`
+	if got := string(testPackage().Spec()); got != expected {
+		t.Fatalf("expected spec\n%s\nbut got\n%s", expected, got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testcases := []struct {
+		name   string
+		modify func(p *Package)
+	}{
+		{name: "no release", modify: func(p *Package) { p.Release = "" }},
+		{name: "dash in version", modify: func(p *Package) { p.Version = "1.17.0-rc.1" }},
+		{name: "no license", modify: func(p *Package) { p.License = "" }},
+		{name: "relative path", modify: func(p *Package) { p.Files[0].Path = "usr/bin/kubelet" }},
+		{name: "duplicate file", modify: func(p *Package) { p.Files[1].Path = p.Files[0].Path }},
+		{name: "unknown config file", modify: func(p *Package) { p.ConfigFiles = []string{"/etc/missing"} }},
+		{name: "unclean directory", modify: func(p *Package) { p.Dirs = []string{"/etc/kubernetes/"} }},
+	}
+
+	if err := testPackage().Validate(); err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := testPackage()
+			tc.modify(p)
+			if err := p.Validate(); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The fake rpmbuild checks the staged files and writes the rpm named by
+	// the build name format
+	bin := filepath.Join(dir, "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	rpmbuild := `#!/bin/sh
+set -e
+echo "$@" > "` + filepath.Join(dir, "args") + `"
+while [ $# -gt 1 ]; do
+	case "$2" in
+	_sourcedir*) sourcedir="${2#_sourcedir }" ;;
+	_rpmdir*) rpmdir="${2#_rpmdir }" ;;
+	esac
+	shift
+done
+test -x "$sourcedir/usr/bin/kubelet"
+test -d "$sourcedir/etc/kubernetes/manifests"
+grep -q "^Name: kubelet$" "$1"
+touch "$rpmdir/kubelet-1.17.0~rc.1-0.x86_64.rpm"
+`
+	if err := ioutil.WriteFile(filepath.Join(bin, "rpmbuild"), []byte(rpmbuild), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	written, err := testPackage().Build(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	if want := filepath.Join(dir, "out", "kubelet-1.17.0~rc.1-0.x86_64.rpm"); written != want {
+		t.Fatalf("expected %s but got %s", want, written)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "-bb --target x86_64") {
+		t.Fatalf("unexpected rpmbuild arguments %s", args)
+	}
+
+	// Packages which rpmbuild did not write are an error
+	p := testPackage()
+	p.Release = "1"
+	if _, err := p.Build(filepath.Join(dir, "out")); err == nil {
+		t.Fatalf("expected an error for a missing rpm")
+	}
+}
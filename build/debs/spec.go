@@ -0,0 +1,206 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/release/build/debs/deb"
+	"k8s.io/release/build/debs/rpm"
+)
+
+// The package formats which can be built
+const (
+	FormatDeb = "deb"
+	FormatRPM = "rpm"
+
+	// rpmLicense is the license of all packages in the rpm notation
+	rpmLicense = "ASL 2.0"
+)
+
+// packageArchitectures maps the Kubernetes architectures to their names in
+// the package formats
+var packageArchitectures = map[string]map[string]string{
+	"amd64":   {FormatDeb: "amd64", FormatRPM: "x86_64"},
+	"arm":     {FormatDeb: "armhf", FormatRPM: "armhfp"},
+	"arm64":   {FormatDeb: "arm64", FormatRPM: "aarch64"},
+	"ppc64le": {FormatDeb: "ppc64el", FormatRPM: "ppc64le"},
+	"s390x":   {FormatDeb: "s390x", FormatRPM: "s390x"},
+}
+
+// rpmDependencies maps dependencies which are named differently in rpm
+// based distributions. Dependencies mapped to an empty name are part of
+// another package there.
+var rpmDependencies = map[string]string{
+	"iproute2": "iproute",
+	"mount":    "",
+}
+
+// packageArch returns the name of the Kubernetes architecture in the format
+func packageArch(arch, format string) (string, error) {
+	names, ok := packageArchitectures[arch]
+	if !ok {
+		return "", fmt.Errorf("unsupported architecture %s", arch)
+	}
+	name, ok := names[format]
+	if !ok {
+		return "", fmt.Errorf("unsupported package format %s", format)
+	}
+	return name, nil
+}
+
+// dependency is a dependency on another package with an optional version
+// constraint, like ">= 1.13.0"
+type dependency struct {
+	Name       string `yaml:"name"`
+	Constraint string `yaml:"constraint"`
+}
+
+// validate checks the name and the constraint of the dependency, which
+// uses the Debian relations <<, <=, =, >= and >>
+func (d dependency) validate() error {
+	if d.Name == "" || strings.ContainsAny(d.Name, " ,|()") {
+		return fmt.Errorf("invalid dependency name %q", d.Name)
+	}
+	if d.Constraint == "" {
+		return nil
+	}
+	parts := strings.Fields(d.Constraint)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid version constraint %q of dependency %s", d.Constraint, d.Name)
+	}
+	switch parts[0] {
+	case "<<", "<=", "=", ">=", ">>":
+	default:
+		return fmt.Errorf("invalid relation %q of dependency %s", parts[0], d.Name)
+	}
+	return nil
+}
+
+// specFile is a file installed by a package
+type specFile struct {
+	Path    string
+	Mode    os.FileMode
+	Content []byte
+	Source  string
+}
+
+// packageSpec is the format neutral definition of a package
+type packageSpec struct {
+	Name     string
+	Version  string
+	Revision string
+
+	// Arch is the Kubernetes architecture, like arm
+	Arch string
+
+	Maintainer  string
+	Section     string
+	Priority    string
+	Homepage    string
+	Summary     string
+	Description string
+
+	Dependencies []dependency
+	Files        []specFile
+	Dirs         []string
+	Conffiles    []string
+
+	// Scripts are Debian maintainer scripts by name, like postinst
+	Scripts map[string][]byte
+}
+
+// deb returns the Debian package of the spec
+func (s *packageSpec) deb() (*deb.Package, error) {
+	arch, err := packageArch(s.Arch, FormatDeb)
+	if err != nil {
+		return nil, err
+	}
+	p := &deb.Package{
+		Name:         s.Name,
+		Version:      fmt.Sprintf("%s-%s", s.Version, s.Revision),
+		Architecture: arch,
+		Maintainer:   s.Maintainer,
+		Section:      s.Section,
+		Priority:     s.Priority,
+		Homepage:     s.Homepage,
+		Description:  s.Summary,
+		Dirs:         s.Dirs,
+		Conffiles:    s.Conffiles,
+		Scripts:      s.Scripts,
+	}
+	if s.Description != "" {
+		p.Description += "\n" + s.Description
+	}
+	for _, d := range s.Dependencies {
+		dep := d.Name
+		if d.Constraint != "" {
+			dep = fmt.Sprintf("%s (%s)", d.Name, d.Constraint)
+		}
+		p.Depends = append(p.Depends, dep)
+	}
+	for _, f := range s.Files {
+		p.Files = append(p.Files, deb.File{Path: f.Path, Mode: f.Mode, Content: f.Content, Source: f.Source})
+	}
+	return p, nil
+}
+
+// rpm returns the rpm package of the spec. Dashes are not allowed within
+// rpm versions, which means that pre-releases like 1.17.0-rc.1 become
+// 1.17.0~rc.1 and still sort before the final release. The Debian
+// maintainer scripts are not part of the rpm package.
+func (s *packageSpec) rpm() (*rpm.Package, error) {
+	arch, err := packageArch(s.Arch, FormatRPM)
+	if err != nil {
+		return nil, err
+	}
+	p := &rpm.Package{
+		Name:         s.Name,
+		Version:      strings.Replace(s.Version, "-", "~", -1),
+		Release:      s.Revision,
+		Architecture: arch,
+		Summary:      s.Summary,
+		Description:  s.Description,
+		License:      rpmLicense,
+		URL:          s.Homepage,
+		Packager:     s.Maintainer,
+		ConfigFiles:  s.Conffiles,
+		Dirs:         s.Dirs,
+	}
+	for _, d := range s.Dependencies {
+		name := d.Name
+		if mapped, ok := rpmDependencies[name]; ok {
+			if mapped == "" {
+				continue
+			}
+			name = mapped
+		}
+		dep := name
+		if d.Constraint != "" {
+			// Debian uses << and >> for strict comparisons
+			constraint := strings.NewReplacer("<<", "<", ">>", ">").Replace(d.Constraint)
+			dep = fmt.Sprintf("%s %s", name, constraint)
+		}
+		p.Requires = append(p.Requires, dep)
+	}
+	for _, f := range s.Files {
+		p.Files = append(p.Files, rpm.File{Path: f.Path, Mode: f.Mode, Content: f.Content, Source: f.Source})
+	}
+	return p, nil
+}
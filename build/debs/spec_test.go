@@ -0,0 +1,146 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPackageArch(t *testing.T) {
+	testcases := []struct {
+		arch      string
+		format    string
+		expected  string
+		shouldErr bool
+	}{
+		{arch: "amd64", format: FormatDeb, expected: "amd64"},
+		{arch: "amd64", format: FormatRPM, expected: "x86_64"},
+		{arch: "arm", format: FormatDeb, expected: "armhf"},
+		{arch: "arm", format: FormatRPM, expected: "armhfp"},
+		{arch: "arm64", format: FormatRPM, expected: "aarch64"},
+		{arch: "ppc64le", format: FormatDeb, expected: "ppc64el"},
+		{arch: "ppc64le", format: FormatRPM, expected: "ppc64le"},
+		{arch: "s390x", format: FormatRPM, expected: "s390x"},
+		{arch: "mips", format: FormatDeb, shouldErr: true},
+		{arch: "amd64", format: "apk", shouldErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.arch+"/"+tc.format, func(t *testing.T) {
+			arch, err := packageArch(tc.arch, tc.format)
+			if tc.shouldErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if arch != tc.expected {
+				t.Fatalf("expected %s but got %s", tc.expected, arch)
+			}
+		})
+	}
+}
+
+func TestDependencyValidate(t *testing.T) {
+	testcases := []struct {
+		dep       dependency
+		shouldErr bool
+	}{
+		{dep: dependency{Name: "socat"}},
+		{dep: dependency{Name: "kubelet", Constraint: ">= 1.13.0"}},
+		{dep: dependency{Name: "kubernetes-cni", Constraint: "<< 0.8.0"}},
+		{dep: dependency{Name: ""}, shouldErr: true},
+		{dep: dependency{Name: "iptables | nftables"}, shouldErr: true},
+		{dep: dependency{Name: "kubelet", Constraint: ">= "}, shouldErr: true},
+		{dep: dependency{Name: "kubelet", Constraint: "~> 1.13.0"}, shouldErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.dep.Name+" "+tc.dep.Constraint, func(t *testing.T) {
+			err := tc.dep.validate()
+			if tc.shouldErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func testSpec() *packageSpec {
+	return &packageSpec{
+		Name:        "kubelet",
+		Version:     "1.18.0-alpha.1.123-5a1ae3a2aaa3c0",
+		Revision:    "0",
+		Arch:        "arm64",
+		Maintainer:  "Kubernetes Authors <kubernetes-dev+release@googlegroups.com>",
+		Homepage:    "https://kubernetes.io",
+		Summary:     "Kubernetes Node Agent",
+		Description: "The node agent of Kubernetes",
+		Dependencies: []dependency{
+			{Name: "iptables", Constraint: ">= 1.4.21"},
+			{Name: "kubernetes-cni", Constraint: "<< 0.8.0"},
+			{Name: "iproute2"},
+			{Name: "mount"},
+		},
+		Files:     []specFile{{Path: "/etc/default/kubelet", Mode: 0644}},
+		Conffiles: []string{"/etc/default/kubelet"},
+		Scripts:   map[string][]byte{"postinst": []byte("#!/bin/sh\n")},
+	}
+}
+
+func TestSpecDeb(t *testing.T) {
+	p, err := testSpec().deb()
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	if p.Version != "1.18.0-alpha.1.123-5a1ae3a2aaa3c0-0" || p.Architecture != "arm64" {
+		t.Fatalf("unexpected version %s or architecture %s", p.Version, p.Architecture)
+	}
+	if p.Description != "Kubernetes Node Agent\nThe node agent of Kubernetes" {
+		t.Fatalf("unexpected description %q", p.Description)
+	}
+	want := []string{"iptables (>= 1.4.21)", "kubernetes-cni (<< 0.8.0)", "iproute2", "mount"}
+	if !reflect.DeepEqual(p.Depends, want) {
+		t.Fatalf("expected dependencies %q but got %q", want, p.Depends)
+	}
+	if len(p.Scripts) != 1 || len(p.Conffiles) != 1 {
+		t.Fatalf("expected scripts and conffiles to be kept")
+	}
+}
+
+func TestSpecRPM(t *testing.T) {
+	p, err := testSpec().rpm()
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	if p.Version != "1.18.0~alpha.1.123~5a1ae3a2aaa3c0" || p.Release != "0" || p.Architecture != "aarch64" {
+		t.Fatalf("unexpected version %s-%s or architecture %s", p.Version, p.Release, p.Architecture)
+	}
+	want := []string{"iptables >= 1.4.21", "kubernetes-cni < 0.8.0", "iproute"}
+	if !reflect.DeepEqual(p.Requires, want) {
+		t.Fatalf("expected requirements %q but got %q", want, p.Requires)
+	}
+	if p.License != rpmLicense || p.Summary != "Kubernetes Node Agent" {
+		t.Fatalf("unexpected license %s or summary %s", p.License, p.Summary)
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("did not expect an invalid package: %v", err)
+	}
+
+	s := testSpec()
+	s.Arch = "mips"
+	if _, err := s.rpm(); err == nil {
+		t.Fatalf("expected an error for an unsupported architecture")
+	}
+}
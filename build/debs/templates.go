@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// latestTemplates is the directory of the templates used for every
+// Kubernetes version no other template set matches
+const latestTemplates = "latest"
+
+// templateSet is a directory of package templates for a range of Kubernetes
+// versions, like packages/>=1.17
+type templateSet struct {
+	dir      string
+	versions semver.Range
+}
+
+// parseVersionRange parses the name of a template set directory. Versions
+// without patch version, like >=1.17, cover all releases of the minor
+// version including its pre-releases.
+func parseVersionRange(name string) (semver.Range, error) {
+	parts := strings.Fields(name)
+	for i, part := range parts {
+		if part == "||" {
+			continue
+		}
+		version := strings.TrimLeft(part, "<>=!")
+		if strings.Count(version, ".") == 1 {
+			parts[i] = part + ".0-0"
+		}
+	}
+	return semver.ParseRange(strings.Join(parts, " "))
+}
+
+// templateSets returns the versioned template sets of the packages
+// directory, sorted by directory name
+func templateSets(root string) ([]templateSet, error) {
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	sets := []templateSet{}
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == latestTemplates {
+			continue
+		}
+		versions, err := parseVersionRange(e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("template directory %s is no Kubernetes version range: %v", e.Name(), err)
+		}
+		sets = append(sets, templateSet{dir: filepath.Join(root, e.Name()), versions: versions})
+	}
+	sort.Slice(sets, func(i, j int) bool { return sets[i].dir < sets[j].dir })
+	return sets, nil
+}
+
+// resolveTemplateDir returns the template directory of the package for the
+// Kubernetes version. Only one template set matching the version may contain
+// the package, otherwise the templates of latest are used.
+func resolveTemplateDir(root, name, kubeVersion string) (string, error) {
+	version, err := semver.Parse(kubeVersion)
+	if err != nil {
+		return "", fmt.Errorf("could not parse k8s semver: %v", err)
+	}
+	sets, err := templateSets(root)
+	if err != nil {
+		return "", err
+	}
+
+	matches := []string{}
+	for _, set := range sets {
+		if !set.versions(version) {
+			continue
+		}
+		dir := filepath.Join(set.dir, name)
+		if isDir(dir) {
+			matches = append(matches, dir)
+		}
+	}
+	switch len(matches) {
+	case 0:
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("ambiguous templates of %s for Kubernetes %s: %s", name, kubeVersion, strings.Join(matches, ", "))
+	}
+
+	dir := filepath.Join(root, latestTemplates, name)
+	if !isDir(dir) {
+		return "", fmt.Errorf("no templates of %s for Kubernetes %s", name, kubeVersion)
+	}
+	return dir, nil
+}
+
+// validateTemplates checks that the templates of every package can be
+// resolved for every supported Kubernetes minor version
+func validateTemplates(root string, cat *catalog) error {
+	minors, err := cat.Kubernetes.supportedMinors()
+	if err != nil {
+		return err
+	}
+	for _, minor := range minors {
+		// The first pre-release and the release of a minor version may
+		// resolve to different template sets, so both need to resolve
+		prerelease := minor
+		prerelease.Pre = []semver.PRVersion{{VersionStr: "alpha"}, {VersionNum: 0, IsNum: true}}
+		for _, version := range []semver.Version{prerelease, minor} {
+			for _, p := range cat.Packages {
+				if _, err := resolveTemplateDir(root, p.templateDir(), version.String()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+func TestParseVersionRange(t *testing.T) {
+	testcases := []struct {
+		name      string
+		matches   []string
+		misses    []string
+		shouldErr bool
+	}{
+		{
+			name:    ">=1.17",
+			matches: []string{"1.17.0-alpha.0", "1.17.0", "1.18.3"},
+			misses:  []string{"1.16.4", "1.16.0-rc.1"},
+		},
+		{
+			name:    ">=1.13 <1.17",
+			matches: []string{"1.13.0-alpha.0", "1.16.4"},
+			misses:  []string{"1.12.10", "1.17.0-alpha.0", "1.17.0"},
+		},
+		{
+			name:    ">=1.16.2",
+			matches: []string{"1.16.2", "1.17.0"},
+			misses:  []string{"1.16.1", "1.16.2-rc.1"},
+		},
+		{
+			name:    "<1.14 || >=1.17",
+			matches: []string{"1.13.5", "1.17.0"},
+			misses:  []string{"1.15.0"},
+		},
+		{name: "newer", shouldErr: true},
+		{name: ">=1", shouldErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := parseVersionRange(tc.name)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("did not expect an error: %v", err)
+			}
+			for _, v := range tc.matches {
+				if !r(semver.MustParse(v)) {
+					t.Fatalf("expected %s to match", v)
+				}
+			}
+			for _, v := range tc.misses {
+				if r(semver.MustParse(v)) {
+					t.Fatalf("expected %s not to match", v)
+				}
+			}
+		})
+	}
+}
+
+func writeTestTemplates(t *testing.T, dirs ...string) (string, func()) {
+	root, err := ioutil.TempDir("", "templates-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, func() { os.RemoveAll(root) }
+}
+
+func TestResolveTemplateDir(t *testing.T) {
+	root, cleanup := writeTestTemplates(t,
+		"latest/kubeadm",
+		"latest/kubelet",
+		">=1.17/kubeadm",
+		"<1.15/kubeadm",
+		"<1.15/kubectl",
+	)
+	defer cleanup()
+
+	testcases := []struct {
+		name        string
+		kubeVersion string
+		expected    string
+		shouldErr   bool
+	}{
+		{name: "kubeadm", kubeVersion: "1.17.0", expected: ">=1.17/kubeadm"},
+		{name: "kubeadm", kubeVersion: "1.18.0-alpha.1.123-5a1ae3a2aaa3c0", expected: ">=1.17/kubeadm"},
+		{name: "kubeadm", kubeVersion: "1.16.4", expected: "latest/kubeadm"},
+		{name: "kubeadm", kubeVersion: "1.14.10", expected: "<1.15/kubeadm"},
+		{name: "kubelet", kubeVersion: "1.17.0", expected: "latest/kubelet"},
+		{name: "kubectl", kubeVersion: "1.14.0", expected: "<1.15/kubectl"},
+		{name: "kubectl", kubeVersion: "1.17.0", shouldErr: true},
+		{name: "kubelet", kubeVersion: "latest", shouldErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name+"@"+tc.kubeVersion, func(t *testing.T) {
+			dir, err := resolveTemplateDir(root, tc.name, tc.kubeVersion)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("did not expect an error: %v", err)
+			}
+			if expected := filepath.Join(root, tc.expected); dir != expected {
+				t.Fatalf("expected %s but got %s", expected, dir)
+			}
+		})
+	}
+}
+
+func TestResolveTemplateDirInvalid(t *testing.T) {
+	testcases := []struct {
+		name string
+		dirs []string
+	}{
+		{name: "ambiguous", dirs: []string{">=1.16/kubeadm", ">=1.17/kubeadm"}},
+		{name: "no version range", dirs: []string{"latest/kubeadm", "old/kubeadm"}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, cleanup := writeTestTemplates(t, tc.dirs...)
+			defer cleanup()
+
+			if _, err := resolveTemplateDir(root, "kubeadm", "1.17.0"); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	cat, err := loadCatalog(defaultCatalog)
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	if err := validateTemplates(packagesRootDir, cat); err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+
+	// Templates which only cover some of the supported minor versions are an
+	// error
+	root, cleanup := writeTestTemplates(t, ">=1.17/kubernetes-cni")
+	defer cleanup()
+	file, cleanupCatalog := writeTestCatalog(t, testCatalog)
+	defer cleanupCatalog()
+	cat, err = loadCatalog(file)
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	if err := validateTemplates(root, cat); err == nil {
+		t.Fatalf("expected an error for Kubernetes versions before 1.17")
+	}
+	if err := os.MkdirAll(filepath.Join(root, latestTemplates, "kubernetes-cni"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateTemplates(root, cat); err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+}
+
+// TestRenderAllTemplates renders the templates of every package for the
+// release and the first alpha of every supported Kubernetes minor version,
+// architecture and format
+func TestRenderAllTemplates(t *testing.T) {
+	cat, err := loadCatalog(defaultCatalog)
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+	minors, err := cat.Kubernetes.supportedMinors()
+	if err != nil {
+		t.Fatalf("did not expect an error: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "templates-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The first alpha of a minor selects the same templates as its release,
+	// like the nightly builds right after the release branch was cut
+	kubeVersions := []string{}
+	for _, minor := range minors {
+		kubeVersions = append(kubeVersions, minor.String(), minor.String()+"-alpha.0")
+	}
+
+	for _, kubeVersion := range kubeVersions {
+		for arch := range packageArchitectures {
+			for _, format := range []string{FormatDeb, FormatRPM} {
+				for _, p := range cat.Packages {
+					c := cfg{
+						packageDefinition: &packageDefinition{
+							Name:                     p.Name,
+							Version:                  kubeVersion,
+							Revision:                 defaultRevision,
+							Channel:                  ChannelRelease,
+							KubernetesVersion:        kubeVersion,
+							DownloadLinkBase:         releaseDownloadLinkBase + "/v" + kubeVersion,
+							KubeadmKubeletConfigFile: kubeadmConf,
+						},
+						Package:    p.Name,
+						Arch:       arch,
+						Format:     format,
+						definition: p,
+					}
+					if err := c.setFormat(); err != nil {
+						t.Fatalf("did not expect an error: %v", err)
+					}
+
+					srcdir, err := resolveTemplateDir(packagesRootDir, p.templateDir(), kubeVersion)
+					if err != nil {
+						t.Fatalf("did not expect an error: %v", err)
+					}
+					dstdir := filepath.Join(dir, kubeVersion, arch, format, p.Name)
+					if err := os.MkdirAll(dstdir, 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := c.render(srcdir, dstdir); err != nil {
+						t.Fatalf("rendering %s for Kubernetes %s on %s as %s: %v", p.Name, kubeVersion, arch, format, err)
+					}
+
+					content, err := ioutil.ReadFile(filepath.Join(dstdir, debianDir, "control"))
+					if err != nil {
+						t.Fatal(err)
+					}
+					ctrl, err := parseControl(content)
+					if err != nil {
+						t.Fatalf("did not expect an invalid control file of %s: %v", p.Name, err)
+					}
+					if ctrl.binary["Package"] != p.Name || ctrl.binary["Architecture"] != c.PackageArch {
+						t.Fatalf("unexpected package %s for %s on %s", ctrl.binary["Package"], p.Name, c.PackageArch)
+					}
+				}
+			}
+		}
+	}
+}
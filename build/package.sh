@@ -50,11 +50,7 @@ declare -r GCS_BUCKET="${GCS_BUCKET:-"kubernetes-release-dev"}"
 declare -r OUTPUT_DIR="${OUTPUT_DIR:-"${PWD}/_output/${PACKAGE_TYPE}"}"
 
 case "${PACKAGE_TYPE}" in
-"debs")
-  declare -r IMG_NAME="deb-builder:${BUILD_TAG}"
-;;
-"rpms")
-  declare -r IMG_NAME="rpm-builder:${BUILD_TAG}"
+"debs"|"rpms")
 ;;
 *)
   echo >&2 "'${PACKAGE_TYPE}' is an invalid PACKAGE_TYPE, only 'debs' and 'rpms' supported"
@@ -62,7 +58,10 @@ case "${PACKAGE_TYPE}" in
 ;;
 esac
 
-docker build -t "${IMG_NAME}" "$( cd "$( dirname "${BASH_SOURCE[0]}" )" >/dev/null 2>&1 && pwd )/${PACKAGE_TYPE}"
+# Both debs and rpms are built by build/debs from the same package definitions
+declare -r IMG_NAME="deb-builder:${BUILD_TAG}"
+
+docker build -t "${IMG_NAME}" "$( cd "$( dirname "${BASH_SOURCE[0]}" )" >/dev/null 2>&1 && pwd )/debs"
 echo "Cleaning output directory..."
 [[ ! -d "${OUTPUT_DIR}" ]] \
   || find "${OUTPUT_DIR}" -maxdepth 1 -mindepth 1 -print0 | xargs -0 rm -rf --
@@ -79,7 +78,12 @@ case "${PACKAGE_TYPE}" in
   ls -alth "${OUTPUT_DIR}"
 ;;
 "rpms")
-  "${docker_run_cmd[@]}" --rm -v "${OUTPUT_DIR}:/home/builder/rpmbuild/RPMS" "${IMG_NAME}" "$@"
+  "${docker_run_cmd[@]}" --rm -v "${OUTPUT_DIR}:/home/builder/workspace/bin" "${IMG_NAME}" --formats rpm "$@"
+  # Every channel is a yum repository of its own
+  for CHANNEL_DIR in "${OUTPUT_DIR}"/*/; do
+    "${docker_run_cmd[@]}" --rm -v "${OUTPUT_DIR}:/home/builder/workspace/bin" \
+      --entrypoint createrepo "${IMG_NAME}" "bin/$(basename "${CHANNEL_DIR}")"
+  done
   echo
   echo "----------------------------------------"
   echo
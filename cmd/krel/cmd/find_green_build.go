@@ -0,0 +1,191 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"k8s.io/release/pkg/object"
+	"k8s.io/release/pkg/release"
+)
+
+type findGreenBuildOptions struct {
+	branch         string
+	testgridConfig string
+	jobResults     string
+	excludeSuites  []string
+	contiguous     int
+	limit          int
+	official       bool
+	rc             bool
+}
+
+var findGreenBuildOpts = &findGreenBuildOptions{}
+
+var findGreenBuildCmd = &cobra.Command{
+	Use:   "find-green-build --branch <branch>",
+	Short: "find-green-build finds the newest build which passed all release blocking jobs",
+	Long: `find-green-build reads the release blocking jobs of the branch from the
+testgrid config and checks the results of their runs. The first blocking job is
+the primary one: its passing runs are the candidate builds, newest first. A
+candidate is green if every other blocking job passed it, either by a passing
+run of exactly that build or by contiguous passing runs whose builds surround
+it. Jobs without any results are skipped.
+
+The job results are read from the jobResultsCache.json files of the CI jobs,
+either from GCS or from a local directory containing <job>/jobResultsCache.json.
+
+The green build version and the version to release from it get printed.`,
+	Example: `krel find-green-build --branch release-1.17
+krel find-green-build --branch master --exclude-suites 'kubemark|scalability'
+krel find-green-build --branch release-1.17 --job-results ./logs --testgrid-config ./config`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE:       initLogging,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runFindGreenBuild(findGreenBuildOpts)
+	},
+}
+
+func init() {
+	findGreenBuildCmd.PersistentFlags().StringVar(
+		&findGreenBuildOpts.branch,
+		"branch",
+		"",
+		"branch to find a green build for, like master or release-1.17",
+	)
+	findGreenBuildCmd.PersistentFlags().StringVar(
+		&findGreenBuildOpts.testgridConfig,
+		"testgrid-config",
+		release.TestgridConfigURL,
+		"URL or local path of the serialized testgrid config",
+	)
+	findGreenBuildCmd.PersistentFlags().StringVar(
+		&findGreenBuildOpts.jobResults,
+		"job-results",
+		"gs://"+release.JobResultsBucket+"/"+release.JobResultsPrefix,
+		"GCS location (gs://bucket/path) or local directory of the job results",
+	)
+	findGreenBuildCmd.PersistentFlags().StringSliceVar(
+		&findGreenBuildOpts.excludeSuites,
+		"exclude-suites",
+		[]string{},
+		"regular expressions of blocking jobs to ignore, except for the primary job",
+	)
+	findGreenBuildCmd.PersistentFlags().IntVar(
+		&findGreenBuildOpts.contiguous,
+		"contiguous",
+		release.DefaultContiguous,
+		"amount of contiguous passing runs of a job which prove that builds in between passed",
+	)
+	findGreenBuildCmd.PersistentFlags().IntVar(
+		&findGreenBuildOpts.limit,
+		"limit",
+		release.DefaultGreenBuildLimit,
+		"maximum amount of builds to check, 0 for no limit",
+	)
+	findGreenBuildCmd.PersistentFlags().BoolVar(
+		&findGreenBuildOpts.official,
+		"official",
+		false,
+		"derive the release version of an official release",
+	)
+	findGreenBuildCmd.PersistentFlags().BoolVar(
+		&findGreenBuildOpts.rc,
+		"rc",
+		false,
+		"derive the release version of a release candidate",
+	)
+
+	rootCmd.AddCommand(findGreenBuildCmd)
+}
+
+func runFindGreenBuild(opts *findGreenBuildOptions) error {
+	if opts.branch == "" {
+		return errors.New("Please specify the branch via --branch")
+	}
+	if opts.official && opts.rc {
+		return errors.New("Only one of --official and --rc can be specified")
+	}
+	ctx := context.Background()
+
+	conf, err := release.ReadTestgridConfig(ctx, opts.testgridConfig)
+	if err != nil {
+		return errors.Wrap(err, "Unable to read the testgrid config")
+	}
+	jobs, err := release.BlockingJobs(conf, opts.branch)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Found %d blocking jobs with primary job %s", len(jobs), jobs[0])
+
+	source, err := jobResultSource(ctx, opts.jobResults)
+	if err != nil {
+		return err
+	}
+	green, err := release.FindGreenBuild(ctx, source, &release.GreenBuildOptions{
+		Jobs:       jobs,
+		Exclude:    opts.excludeSuites,
+		Contiguous: opts.contiguous,
+		Limit:      opts.limit,
+	})
+	if err != nil {
+		return err
+	}
+	releaseVersion, err := release.GreenBuildReleaseVersion(
+		green.Version, opts.branch, opts.official, opts.rc,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to derive release version from %s", green.Version)
+	}
+
+	logrus.Infof("Build %s passed %s run %d and all other blocking jobs", green.Version, jobs[0], green.Run)
+	fmt.Printf("build version: %s\n", green.Version)
+	fmt.Printf("release version: %s\n", releaseVersion)
+	return nil
+}
+
+// jobResultSource returns the job results of a GCS location or a local
+// directory
+func jobResultSource(ctx context.Context, location string) (release.JobResultSource, error) {
+	if !strings.HasPrefix(location, "gs://") {
+		store, err := object.NewLocal(location)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to open job results in %s", location)
+		}
+		return release.NewStoreJobResults(store, ""), nil
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching gcloud credentials... try running \"gcloud auth application-default login\"")
+	}
+	parts := strings.SplitN(strings.TrimPrefix(location, "gs://"), "/", 2)
+	prefix := ""
+	if len(parts) == 2 {
+		prefix = parts[1]
+	}
+	return release.NewStoreJobResults(object.NewGCS(client, parts[0]), prefix), nil
+}
@@ -0,0 +1,394 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	cloudbuild "google.golang.org/api/cloudbuild/v1"
+
+	"k8s.io/release/pkg/command"
+	"k8s.io/release/pkg/gcb"
+	"k8s.io/release/pkg/object"
+	"k8s.io/release/pkg/release"
+	"k8s.io/release/pkg/util"
+)
+
+const (
+	gcbmgrListLimit     = 5
+	gcbmgrReleaseBucket = "kubernetes-release"
+)
+
+type gcbmgrOptions struct {
+	project           string
+	toolRoot          string
+	gcpUser           string
+	buildVersion      string
+	releaseToolRepo   string
+	releaseToolBranch string
+	buildAtHead       bool
+	official          bool
+	rc                bool
+}
+
+var gcbmgrOpts = &gcbmgrOptions{}
+
+var gcbmgrCmd = &cobra.Command{
+	Use:   "gcbmgr [list|staged|tail|stage|release]",
+	Short: "gcbmgr submits and tracks Kubernetes staging and release builds on Cloud Build",
+	Long: `gcbmgr submits the gcb/stage and gcb/release Cloud Build jobs of this
+repository and tracks them. Releases can only be done from staged builds.
+
+The substitutions of the jobs are built from the --official, --rc,
+--buildversion, --build-at-head and --nomock flags. Without --buildversion,
+stage jobs find a green build or build at the head of the branch with
+--build-at-head.
+
+Without a subcommand the last jobs are listed.`,
+	Example: `krel gcbmgr list success
+krel gcbmgr tail
+krel gcbmgr staged
+krel gcbmgr stage master --build-at-head
+krel gcbmgr stage release-1.17 --rc
+krel gcbmgr release release-1.17 --official --buildversion=v1.17.1-beta.0.52+d56fafdc081d5f`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE:       initLogging,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGcbmgrList(gcbmgrOpts, "")
+	},
+}
+
+var gcbmgrListCmd = &cobra.Command{
+	Use:           "list [WORKING|SUCCESS|FAILURE|CANCELLED]",
+	Short:         "list the last jobs, optionally with the provided status",
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE:       initLogging,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		status := ""
+		if len(args) > 0 {
+			status = args[0]
+		}
+		return runGcbmgrList(gcbmgrOpts, status)
+	},
+}
+
+var gcbmgrStagedCmd = &cobra.Command{
+	Use:           "staged",
+	Short:         "list the staged builds available for release",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE:       initLogging,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGcbmgrStaged(gcbmgrOpts)
+	},
+}
+
+var gcbmgrTailCmd = &cobra.Command{
+	Use:           "tail [BUILD_ID]",
+	Aliases:       []string{"stream"},
+	Short:         "stream the log of the build or the latest running one",
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE:       initLogging,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := ""
+		if len(args) > 0 {
+			id = args[0]
+		}
+		return runGcbmgrTail(gcbmgrOpts, id)
+	},
+}
+
+var gcbmgrStageCmd = &cobra.Command{
+	Use:           "stage <branch>",
+	Short:         "submit a job staging a build of the branch",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE:       initLogging,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGcbmgrSubmit(gcbmgrOpts, gcb.JobStage, args[0])
+	},
+}
+
+var gcbmgrReleaseCmd = &cobra.Command{
+	Use:           "release <branch> --buildversion=<staged build>",
+	Short:         "submit a job releasing a staged build of the branch",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE:       initLogging,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGcbmgrSubmit(gcbmgrOpts, gcb.JobRelease, args[0])
+	},
+}
+
+func init() {
+	gcbmgrCmd.PersistentFlags().StringVar(
+		&gcbmgrOpts.project,
+		"project",
+		gcb.DefaultProject,
+		"GCP project to run the Cloud Build jobs in",
+	)
+	gcbmgrCmd.PersistentFlags().StringVar(
+		&gcbmgrOpts.toolRoot,
+		"tool-root",
+		".",
+		"root of the release repository containing the gcb job configs",
+	)
+	gcbmgrCmd.PersistentFlags().StringVar(
+		&gcbmgrOpts.gcpUser,
+		"gcp-user",
+		"",
+		"GCP account submitting the jobs, defaults to the active gcloud account",
+	)
+	gcbmgrCmd.PersistentFlags().StringVar(
+		&gcbmgrOpts.buildVersion,
+		"buildversion",
+		"",
+		"build version to stage or staged build version to release",
+	)
+	gcbmgrCmd.PersistentFlags().StringVar(
+		&gcbmgrOpts.releaseToolRepo,
+		"release-tool-repo",
+		util.EnvDefault("RELEASE_TOOL_REPO", gcb.DefaultReleaseToolRepo),
+		"repository of the release tools used by the jobs",
+	)
+	gcbmgrCmd.PersistentFlags().StringVar(
+		&gcbmgrOpts.releaseToolBranch,
+		"release-tool-branch",
+		util.EnvDefault("RELEASE_TOOL_BRANCH", gcb.DefaultReleaseToolBranch),
+		"branch of the release tools used by the jobs",
+	)
+	gcbmgrCmd.PersistentFlags().BoolVar(
+		&gcbmgrOpts.buildAtHead,
+		"build-at-head",
+		false,
+		"stage the head of the branch instead of analyzing the test results for a green build",
+	)
+	gcbmgrCmd.PersistentFlags().BoolVar(
+		&gcbmgrOpts.official,
+		"official",
+		false,
+		"stage or release an official X.Y.Z release of a release branch",
+	)
+	gcbmgrCmd.PersistentFlags().BoolVar(
+		&gcbmgrOpts.rc,
+		"rc",
+		false,
+		"stage or release a release candidate of a release branch",
+	)
+
+	gcbmgrCmd.AddCommand(
+		gcbmgrListCmd, gcbmgrStagedCmd, gcbmgrTailCmd, gcbmgrStageCmd, gcbmgrReleaseCmd,
+	)
+	rootCmd.AddCommand(gcbmgrCmd)
+}
+
+// newGcbClient creates a Cloud Build client for the project
+func newGcbClient(ctx context.Context, project string) (gcb.Client, error) {
+	service, err := cloudbuild.NewService(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to create Cloud Build client")
+	}
+	storageClient, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching gcloud credentials... try running \"gcloud auth application-default login\"")
+	}
+	return gcb.NewCloudBuild(service, storageClient, project), nil
+}
+
+// gcpUser returns the GCP account from the options or the active gcloud
+// account
+func gcpUser(opts *gcbmgrOptions) (string, error) {
+	if opts.gcpUser != "" {
+		return opts.gcpUser, nil
+	}
+	status, err := command.New(
+		"gcloud", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)",
+	).RunSilent()
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to get the active gcloud account")
+	}
+	if !status.Success() {
+		return "", errors.Errorf("Unable to get the active gcloud account: %s", status.Error())
+	}
+	account := strings.TrimSpace(status.Output())
+	if account == "" {
+		return "", errors.New("No active gcloud account found, please specify it via --gcp-user")
+	}
+	return account, nil
+}
+
+func runGcbmgrSubmit(opts *gcbmgrOptions, job gcb.Job, branch string) error {
+	ctx := context.Background()
+	user, err := gcpUser(opts)
+	if err != nil {
+		return err
+	}
+	submitOpts := &gcb.Options{
+		Job:               job,
+		Branch:            branch,
+		BuildVersion:      opts.buildVersion,
+		BuildAtHead:       opts.buildAtHead,
+		Official:          opts.official,
+		RC:                opts.rc,
+		NoMock:            rootOpts.nomock,
+		GCPUser:           user,
+		ReleaseToolRepo:   opts.releaseToolRepo,
+		ReleaseToolBranch: opts.releaseToolBranch,
+	}
+
+	switch job {
+	case gcb.JobStage:
+		submitOpts.KubeCrossVersion, err = release.KubeCrossVersion(
+			ctx, release.KubeCrossVersionURL, branch, "master",
+		)
+		if err != nil {
+			return err
+		}
+	case gcb.JobRelease:
+		if err := submitOpts.Validate(); err != nil {
+			return err
+		}
+		if rootOpts.nomock {
+			_, ok, err := util.Ask(fmt.Sprintf(
+				"Really submit a --nomock release job against the %s branch? (yes/no)", branch,
+			), "yes", 1)
+			if !ok {
+				return errors.Wrap(err, "Not submitting release job")
+			}
+		}
+	}
+
+	client, err := newGcbClient(ctx, opts.project)
+	if err != nil {
+		return err
+	}
+	build, err := gcb.Submit(ctx, client, opts.toolRoot, submitOpts)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("%s job %s submitted successfully", strings.ToUpper(string(job)), build.ID)
+	fmt.Printf("To view this build:\n$ krel gcbmgr tail %s\n", build.ID)
+	if build.LogURL != "" {
+		fmt.Printf("-OR-\n%s\n", build.LogURL)
+	}
+	return nil
+}
+
+func runGcbmgrList(opts *gcbmgrOptions, status string) error {
+	ctx := context.Background()
+	client, err := newGcbClient(ctx, opts.project)
+	if err != nil {
+		return err
+	}
+	// Accept any case as a convenience
+	status = strings.ToUpper(status)
+	builds, err := client.List(ctx, status, gcbmgrListLimit)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Last %d %s jobs:", gcbmgrListLimit, status)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "TAGS\tSTATUS\tID\tSTART(%s)\n", time.Now().Format("MST"))
+	for _, build := range builds {
+		start := ""
+		if !build.StartTime.IsZero() {
+			start = build.StartTime.Local().Format("2006-Jan-02+15:04:05")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", strings.Join(build.Tags, " "), build.Status, build.ID, start)
+	}
+	return w.Flush()
+}
+
+func runGcbmgrTail(opts *gcbmgrOptions, id string) error {
+	ctx := context.Background()
+	client, err := newGcbClient(ctx, opts.project)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		build, err := gcb.Latest(ctx, client, gcb.StatusWorking)
+		if err != nil {
+			return err
+		}
+		id = build.ID
+	}
+	logrus.Infof("Streaming log of build %s", id)
+	return client.Stream(ctx, id, os.Stdout)
+}
+
+func runGcbmgrStaged(opts *gcbmgrOptions) error {
+	buckets := []string{gcbmgrReleaseBucket}
+	if !rootOpts.nomock {
+		user, err := gcpUser(opts)
+		if err != nil {
+			return err
+		}
+		buckets = []string{
+			gcbmgrReleaseBucket + "-gcb",
+			gcbmgrReleaseBucket + "-" + gcb.GCPUserTag(user),
+		}
+	}
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error fetching gcloud credentials... try running \"gcloud auth application-default login\"")
+	}
+	for _, bucket := range buckets {
+		store := object.NewGCS(client, bucket)
+		builds, err := release.ListStagedBuilds(ctx, store)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to list staged builds of %s", bucket)
+		}
+		fmt.Printf("Staged builds on %s:\n", bucket)
+		for _, build := range builds {
+			state := "complete"
+			if err := release.ValidateStagedBuild(ctx, store, build.BuildVersion); err != nil {
+				logrus.Debug(err)
+				state = "incomplete"
+			}
+			fmt.Printf(
+				"  %s (%s, %d MiB, staged %s) %s\n",
+				build.BuildVersion, strings.Join(build.Versions, " "),
+				build.Size>>20, build.Updated.Format(time.RFC3339), state,
+			)
+		}
+	}
+	fmt.Println("\nYou may use one of these staged builds to release by passing it as --buildversion, like:")
+	fmt.Println("$ krel gcbmgr release release-1.17 --official --buildversion=v1.17.1-beta.0.52+d56fafdc081d5f")
+	return nil
+}
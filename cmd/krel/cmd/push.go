@@ -20,12 +20,19 @@ import (
 	"context"
 	"os"
 	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"cloud.google.com/go/storage"
+	"github.com/google/go-containerregistry/pkg/v1/google"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	"k8s.io/release/pkg/object"
+	"k8s.io/release/pkg/registry"
 	"k8s.io/release/pkg/release"
 )
 
@@ -33,8 +40,9 @@ const description = `
 Used for pushing developer builds and Jenkins' continuous builds.
 
 Developer pushes simply run as they do pushing to devel/ on GCS.
-In --ci mode, 'push' runs in mock mode by default. Use --nomock to do
-a real push.
+'push' runs in mock mode by default, which only logs the writes to GCS and
+the container registry and summarizes them at the end. Use --nomock to do a
+real push.
 
 Federation values are just passed through as exported global vars still
 due to the fact that we're still leveraging the existing federation
@@ -43,7 +51,7 @@ interface in kubernetes proper.
 push                       - Do a developer push
 push --nomock --federation --ci
                            - Do a (non-mocked) CI push with federation
-push --bucket=kubernetes-release-$USER
+push --nomock --bucket=kubernetes-release-$USER
                            - Do a developer push to kubernetes-release-$USER`
 
 type pushBuildOptions struct {
@@ -53,6 +61,9 @@ type pushBuildOptions struct {
 	gcsSuffix        string
 	releaseKind      string
 	releaseType      string
+	signingKey       string
+	variant          string
+	variantsFile     string
 	versionSuffix    string
 	allowDup         bool
 	ci               bool
@@ -68,6 +79,9 @@ var pushBuildCmd = &cobra.Command{
 	Short:   "push kubernetes release artifacts to GCS",
 	Example: description,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyBuildVariant(cmd, pushBuildOpts); err != nil {
+			return err
+		}
 		if err := runPushBuild(pushBuildOpts); err != nil {
 			return err
 		}
@@ -142,6 +156,24 @@ func init() {
 		"devel",
 		"Specify an alternate bucket for pushes (normally 'devel' or 'ci')",
 	)
+	pushBuildCmd.PersistentFlags().StringVar(
+		&pushBuildOpts.signingKey,
+		"signing-key",
+		"",
+		"Sign the provenance of the build with the ed25519 private key (PEM) or PGP private keyring (armored) at this path",
+	)
+	pushBuildCmd.PersistentFlags().StringVar(
+		&pushBuildOpts.variant,
+		"variant",
+		"",
+		"Apply the flags of the build variant, like build-ci, from the variants file",
+	)
+	pushBuildCmd.PersistentFlags().StringVar(
+		&pushBuildOpts.variantsFile,
+		"variants-file",
+		filepath.Join("..", "release", release.BuildVariantsPath),
+		"Path of the build variants file, which defaults to the release repository next to the kubernetes one",
+	)
 	pushBuildCmd.PersistentFlags().StringVar(
 		&pushBuildOpts.versionSuffix,
 		"version-suffix",
@@ -152,6 +184,57 @@ func init() {
 	rootCmd.AddCommand(pushBuildCmd)
 }
 
+// applyBuildVariant sets the flags of the build variant, which must not
+// conflict with explicitly set flags, and prints the effective configuration
+func applyBuildVariant(cmd *cobra.Command, opts *pushBuildOptions) error {
+	if opts.variant == "" {
+		return nil
+	}
+	variants, err := release.LoadBuildVariants(opts.variantsFile)
+	if err != nil {
+		return err
+	}
+	variant, ok := variants[opts.variant]
+	if !ok {
+		return errors.Errorf(
+			"Unknown build variant %q, available are: %s",
+			opts.variant, strings.Join(release.BuildVariantNames(variants), ", "),
+		)
+	}
+	if variant.Hyperkube {
+		logrus.Infof("Build variant %s builds hyperkube, which does not affect the push", variant.Name)
+	}
+
+	flags := cmd.Flags()
+	for name, value := range variant.Flags() {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			return errors.Errorf("Build variant %s uses unknown flag --%s", variant.Name, name)
+		}
+		if flag.Changed && flag.Value.String() != value {
+			return errors.Errorf(
+				"Flag --%s=%s conflicts with --%s=%s of build variant %s",
+				name, flag.Value.String(), name, value, variant.Name,
+			)
+		}
+		if err := flags.Set(name, value); err != nil {
+			return errors.Wrapf(err, "Unable to apply --%s of build variant %s", name, variant.Name)
+		}
+	}
+
+	// The variant may set --nomock, which initConfig has already evaluated
+	setDryRunPolicy()
+
+	logrus.Infof("Effective configuration of build variant %s:", variant.Name)
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == "help" {
+			return
+		}
+		logrus.Infof("  --%s=%s", flag.Name, flag.Value.String())
+	})
+	return nil
+}
+
 func runPushBuild(opts *pushBuildOptions) error {
 	var latest string
 	releaseKind := opts.releaseKind
@@ -162,42 +245,40 @@ func runPushBuild(opts *pushBuildOptions) error {
 		return errors.Wrap(err, "Unable to get working directory")
 	}
 
-	isBazel, err := release.BuiltWithBazel(dir, releaseKind)
+	buildInfo, err := release.DiscoverBuild(dir, releaseKind)
 	if err != nil {
-		return errors.Wrap(err, "Unable to identify if release built with Bazel")
+		return errors.Wrap(err, "Unable to discover release build")
 	}
+	build, err := buildInfo.Latest()
+	if err != nil {
+		return errors.Wrap(err, "Unable to identify the latest release build")
+	}
+	isBazel := build.Builder == release.BuilderBazel
 
-	if isBazel {
-		logrus.Info("Using Bazel build version")
-		version, err := release.ReadBazelVersion(dir)
-		if err != nil {
-			return errors.Wrap(err, "Unable to read Bazel build version")
-		}
-		latest = version
-	} else {
-		logrus.Info("Using Dockerized build version")
-		version, err := release.ReadDockerizedVersion(dir, releaseKind)
-		if err != nil {
-			return errors.Wrap(err, "Unable to read Dockerized build version")
-		}
-		latest = version
+	logrus.Infof("Using %s build version", build.Builder)
+	latest, err = build.Version()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read %s build version", build.Builder)
 	}
 
 	logrus.Infof("Found build version: %s", latest)
 
-	valid, err := release.IsValidReleaseBuild(latest)
+	version, err := release.ParseVersion(latest)
 	if err != nil {
-		return errors.Wrap(err, "Unable to determine if release build version is valid")
-	}
-	if !valid {
-		return errors.Errorf("Build version %s is not valid for release", latest)
+		return errors.Wrapf(err, "Build version %s is not valid for release", latest)
 	}
 
-	if opts.ci && release.IsDirtyBuild(latest) {
+	if opts.ci && version.Dirty {
 		return errors.New(`Refusing to push dirty build with --ci flag given.\n
 			CI builds should always be performed from clean commits`)
 	}
 
+	commit, err := release.BuildCommit(dir, version)
+	if err != nil {
+		return errors.Wrap(err, "Unable to determine the commit of the build")
+	}
+
+	latest = version.String()
 	if opts.versionSuffix != "" {
 		latest += "-" + opts.versionSuffix
 	}
@@ -212,29 +293,139 @@ func runPushBuild(opts *pushBuildOptions) error {
 	gcsDest += opts.gcsSuffix
 
 	releaseBucket := opts.bucket
-	if !rootOpts.nomock {
-		u, err := user.Current()
+
+	var signer release.Signer
+	if opts.signingKey != "" {
+		signer, err = release.LoadSigner(opts.signingKey)
 		if err != nil {
-			return errors.Wrap(err, "Unable to identify current user")
+			return errors.Wrap(err, "Unable to load signing key")
 		}
-
-		releaseBucket += "-" + u.Username
 	}
 
-	client, err := storage.NewClient(context.Background())
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return errors.Wrap(err, "error fetching gcloud credentials... try running \"gcloud auth application-default login\"")
 	}
 
-	bucket := client.Bucket(releaseBucket)
-	if bucket == nil {
-		return errors.Errorf("unable to identify specified bucket for artifacts: %s", releaseBucket)
-	}
-
 	// Check if bucket exists.
-	if _, err = bucket.Attrs(context.Background()); err != nil {
+	bucket := object.NewGCS(client, releaseBucket)
+	bucketPolicyOnly, err := bucket.BucketPolicyOnly(ctx)
+	if err != nil {
 		return errors.Wrap(err, "Unable to find release artifact bucket")
 	}
 
+	// Without --nomock all writes to the bucket are skipped by the dry run
+	// policy, while they are still visible to the following reads
+	store, err := object.NewDryRunStore(bucket)
+	if err != nil {
+		return errors.Wrap(err, "Unable to create dry run store")
+	}
+	defer store.Close() // nolint: errcheck
+
+	stageDir, err := release.StageLocalArtifacts(&release.StageOptions{
+		BuildOutput: filepath.Join(dir, release.BuildOutputPath),
+		ReleaseTars: build.ReleaseTarsPath,
+		Version:     latest,
+		ReleaseKind: releaseKind,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Unable to stage release artifacts locally")
+	}
+
+	builtBy := ""
+	if u, err := user.Current(); err == nil {
+		builtBy = u.Username
+	}
+	if _, err := release.WriteProvenance(stageDir, &release.ProvenanceOptions{
+		Version:     latest,
+		Commit:      commit,
+		Bazel:       isBazel,
+		BuiltBy:     builtBy,
+		ToolVersion: toolVersion(),
+	}, signer); err != nil {
+		return errors.Wrap(err, "Unable to write build provenance")
+	}
+
+	// Buckets with a bucket-only ACL policy are already publicly readable and
+	// fail on setting object ACLs.
+	public := !opts.privateBucket && !bucketPolicyOnly
+	gcsPath := path.Join(gcsDest, latest)
+	if err := release.PushArtifacts(
+		ctx,
+		store,
+		stageDir,
+		gcsPath,
+		&release.PushOptions{
+			AllowDup:         opts.allowDup,
+			CheckDestination: true,
+			Public:           public,
+		},
+	); err != nil {
+		return errors.Wrapf(err, "Unable to push artifacts to gs://%s/%s", releaseBucket, gcsPath)
+	}
+
+	logrus.Infof("Pushed release artifacts to gs://%s/%s", releaseBucket, gcsPath)
+
+	if opts.dockerRegistry != "" {
+		if err := pushImages(ctx, dir, opts.dockerRegistry, latest); err != nil {
+			return errors.Wrapf(err, "Unable to push container images to %s", opts.dockerRegistry)
+		}
+	}
+
+	if !opts.ci {
+		logrus.Info("Not updating version markers for non CI pushes")
+		return nil
+	}
+	if opts.noUpdateLatest {
+		logrus.Info("Not updating version markers because of --noupdatelatest")
+		return nil
+	}
+
+	updated, err := release.PublishVersion(ctx, store, &release.PublishOptions{
+		BuildType:        gcsDest,
+		Version:          latest,
+		ExtraPublishFile: opts.extraPublishFile,
+		Public:           public,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Unable to publish version markers to gs://%s", releaseBucket)
+	}
+	logrus.Infof("Updated version markers: %v", updated)
+	return nil
+}
+
+// pushImages pushes the release images of the build output to the registry,
+// authenticated with the application default credentials for GCR
+func pushImages(ctx context.Context, dir, dockerRegistry, version string) error {
+	repo, err := registry.ParseRepository(release.PushImageRepository(dockerRegistry))
+	if err != nil {
+		return err
+	}
+
+	clientOpts := &registry.ClientOptions{}
+	host := strings.Split(repo.Registry, ":")[0]
+	switch {
+	case host == "localhost" || host == "127.0.0.1":
+		clientOpts.Insecure = true
+	case strings.HasSuffix(host, "gcr.io"):
+		auth, err := google.NewEnvAuthenticator()
+		if err != nil {
+			return errors.Wrap(err, "error fetching gcloud credentials... try running \"gcloud auth application-default login\"")
+		}
+		clientOpts.Auth = auth
+	}
+
+	lists, err := release.PushImages(
+		ctx, registry.NewClient(repo.Registry, clientOpts), &release.ImagePushOptions{
+			BuildOutput: filepath.Join(dir, release.BuildOutputPath),
+			Registry:    dockerRegistry,
+			Version:     version,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Pushed container images: %v", lists)
 	return nil
 }
@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/release/pkg/command"
+)
+
+const testVariants = `variants:
+  build-ci:
+    CI: '--ci'
+  build-ci-nomock:
+    CI: '--ci'
+    NOMOCK: '--nomock'
+`
+
+func TestApplyBuildVariantDryRunPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krel-variants-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	variantsFile := filepath.Join(dir, "variants.yaml")
+	require.Nil(t, ioutil.WriteFile(variantsFile, []byte(testVariants), 0644))
+
+	cases := map[string]struct {
+		variant string
+		want    command.DryRunPolicy
+	}{
+		"NoVariant":     {variant: "", want: command.DryRunMutating},
+		"MockVariant":   {variant: "build-ci", want: command.DryRunMutating},
+		"NomockVariant": {variant: "build-ci-nomock", want: command.DryRunDisabled},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				for _, flag := range []string{"nomock", "ci"} {
+					require.Nil(t, pushBuildCmd.Flags().Set(flag, "false"))
+					pushBuildCmd.Flags().Lookup(flag).Changed = false
+				}
+				command.SetGlobalDryRunPolicy(command.DryRunMutating)
+			}()
+
+			require.Nil(t, pushBuildCmd.ParseFlags([]string{
+				"--variant=" + tc.variant, "--variants-file=" + variantsFile,
+			}))
+			initConfig()
+			require.Equal(t, command.DryRunMutating, command.GlobalDryRunPolicy())
+
+			require.Nil(t, applyBuildVariant(pushBuildCmd, pushBuildOpts))
+			require.Equal(t, tc.want, command.GlobalDryRunPolicy())
+		})
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"k8s.io/release/pkg/command"
+	"k8s.io/release/pkg/object"
+	"k8s.io/release/pkg/plan"
+	"k8s.io/release/pkg/release"
+)
+
+// The options of a release which are persisted to the state, so that
+// resuming does not need them again
+const (
+	releaseStateBranch       = "branch"
+	releaseStateBuildVersion = "build_version"
+	releaseStateOfficial     = "official"
+	releaseStateRC           = "rc"
+)
+
+type releaseOptions struct {
+	branch       string
+	buildVersion string
+	bucket       string
+	repoURL      string
+	workdir      string
+	stateFile    string
+	from         string
+	official     bool
+	rc           bool
+	plan         bool
+	resume       bool
+}
+
+var releaseOpts = &releaseOptions{}
+
+var releaseCmd = &cobra.Command{
+	Use:   "release --branch <branch> --buildversion <build version>",
+	Short: "release a green build in resumable steps",
+	Long: `release tags, builds and stages a green build and pushes the tag, like
+anago does. The release consists of steps with dependencies, whose progress is
+persisted to a state file after every step. A failed or interrupted release
+continues from the last successful step with --resume, while --from runs a
+step and all steps depending on it again.
+
+Without --nomock, the tag does not get pushed and the build gets staged to a
+mock bucket.`,
+	Example: `krel release --plan
+krel release --branch release-1.17 --buildversion v1.17.1-beta.0.20+cce11c6a185279
+krel release --resume
+krel release --from stage`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE:       initLogging,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRelease(releaseOpts)
+	},
+}
+
+func init() {
+	releaseCmd.PersistentFlags().StringVar(
+		&releaseOpts.branch,
+		"branch",
+		"",
+		"branch to release from, like master or release-1.17",
+	)
+	releaseCmd.PersistentFlags().StringVar(
+		&releaseOpts.buildVersion,
+		"buildversion",
+		"",
+		"green build version to release, see krel find-green-build",
+	)
+	releaseCmd.PersistentFlags().StringVar(
+		&releaseOpts.bucket,
+		"bucket",
+		"",
+		"GCS bucket or local directory to stage to, defaults to "+gcbmgrReleaseBucket+
+			" with --nomock and to "+gcbmgrReleaseBucket+"-gcb otherwise",
+	)
+	releaseCmd.PersistentFlags().StringVar(
+		&releaseOpts.repoURL,
+		"repo-url",
+		release.DefaultKubernetesRepoURL,
+		"URL of the repository to release",
+	)
+	releaseCmd.PersistentFlags().StringVar(
+		&releaseOpts.workdir,
+		"workdir",
+		filepath.Join(os.TempDir(), "krel-release"),
+		"directory containing the source tree and the outputs of the release",
+	)
+	releaseCmd.PersistentFlags().StringVar(
+		&releaseOpts.stateFile,
+		"state-file",
+		"",
+		"file persisting the progress of the release, defaults to release-state.json within the workdir",
+	)
+	releaseCmd.PersistentFlags().StringVar(
+		&releaseOpts.from,
+		"from",
+		"",
+		"run the step and all steps depending on it again, and continue the release",
+	)
+	releaseCmd.PersistentFlags().BoolVar(
+		&releaseOpts.official,
+		"official",
+		false,
+		"release an official version",
+	)
+	releaseCmd.PersistentFlags().BoolVar(
+		&releaseOpts.rc,
+		"rc",
+		false,
+		"release a release candidate",
+	)
+	releaseCmd.PersistentFlags().BoolVar(
+		&releaseOpts.plan,
+		"plan",
+		false,
+		"print the steps of the release and their progress without running them",
+	)
+	releaseCmd.PersistentFlags().BoolVar(
+		&releaseOpts.resume,
+		"resume",
+		false,
+		"continue the release from the last successful step",
+	)
+
+	rootCmd.AddCommand(releaseCmd)
+}
+
+func runRelease(opts *releaseOptions) error {
+	stateFile := opts.stateFile
+	if stateFile == "" {
+		stateFile = filepath.Join(opts.workdir, "release-state.json")
+	}
+	state, err := plan.LoadState(stateFile)
+	if err != nil {
+		return err
+	}
+	if err := releaseOptionsFromState(opts, state); err != nil {
+		return err
+	}
+	if opts.official && opts.rc {
+		return errors.New("Only one of --official and --rc can be specified")
+	}
+
+	planOpts := &release.ReleasePlanOptions{
+		Branch:   opts.branch,
+		Official: opts.official,
+		RC:       opts.rc,
+		RepoURL:  opts.repoURL,
+		Workdir:  opts.workdir,
+	}
+	releasePlan, err := release.NewReleasePlan(planOpts)
+	if err != nil {
+		return err
+	}
+	if opts.plan {
+		return releasePlan.Print(os.Stdout, state)
+	}
+
+	if opts.branch == "" || opts.buildVersion == "" {
+		return errors.New("Please specify the release via --branch and --buildversion")
+	}
+	planOpts.BuildVersion, err = release.ParseVersion(opts.buildVersion)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid build version %s", opts.buildVersion)
+	}
+	if err := planOpts.Validate(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	planOpts.Store, err = releaseStore(ctx, opts.bucket)
+	if err != nil {
+		return err
+	}
+	state.SetValue(releaseStateBranch, opts.branch)
+	state.SetValue(releaseStateBuildVersion, opts.buildVersion)
+	state.SetValue(releaseStateOfficial, strconv.FormatBool(opts.official))
+	state.SetValue(releaseStateRC, strconv.FormatBool(opts.rc))
+
+	logrus.Infof(
+		"Releasing %s of %s to %s with state %s",
+		opts.buildVersion, opts.branch, planOpts.Store, state.Path(),
+	)
+	if err := releasePlan.Run(command.DefaultContext(), state, &plan.RunOptions{
+		Resume: opts.resume,
+		From:   opts.from,
+	}); err != nil {
+		return errors.Wrapf(
+			err, "Release incomplete, continue it with --resume after fixing the cause",
+		)
+	}
+	logrus.Infof("Released %s, see %s", state.Value(release.StateReleaseVersion), state.Value(release.StateAnnouncement))
+	return nil
+}
+
+// releaseOptionsFromState takes the release options from a previous run if
+// they are not provided, and fails if they differ
+func releaseOptionsFromState(opts *releaseOptions, state *plan.State) error {
+	for _, o := range []struct {
+		key   string
+		value *string
+		flag  string
+	}{
+		{releaseStateBranch, &opts.branch, "--branch"},
+		{releaseStateBuildVersion, &opts.buildVersion, "--buildversion"},
+	} {
+		previous := state.Value(o.key)
+		switch {
+		case previous == "":
+		case *o.value == "":
+			*o.value = previous
+		case *o.value != previous:
+			return errors.Errorf(
+				"%s %s differs from %s of the release in %s, use a different --state-file",
+				o.flag, *o.value, previous, state.Path(),
+			)
+		}
+	}
+	if state.Value(releaseStateOfficial) == "true" {
+		opts.official = true
+	}
+	if state.Value(releaseStateRC) == "true" {
+		opts.rc = true
+	}
+	return nil
+}
+
+// releaseStore returns the bucket or local directory to stage to
+func releaseStore(ctx context.Context, bucket string) (object.Store, error) {
+	if bucket == "" {
+		bucket = gcbmgrReleaseBucket + "-gcb"
+		if rootOpts.nomock {
+			bucket = gcbmgrReleaseBucket
+		}
+	}
+	if strings.HasPrefix(bucket, "/") || strings.HasPrefix(bucket, ".") {
+		return object.NewLocal(bucket)
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching gcloud credentials... try running \"gcloud auth application-default login\"")
+	}
+	return object.NewGCS(client, strings.TrimPrefix(bucket, "gs://")), nil
+}
@@ -17,11 +17,17 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"syscall"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"k8s.io/release/pkg/command"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -36,6 +42,7 @@ type rootOptions struct {
 	cleanup  bool
 	repoPath string
 	logLevel string
+	auditLog string
 }
 
 var rootOpts = &rootOptions{}
@@ -43,7 +50,21 @@ var rootOpts = &rootOptions{}
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Interrupting krel should also interrupt all running child processes
+	ctx, cancel := command.SignalContext(
+		context.Background(), os.Interrupt, syscall.SIGTERM,
+	)
+	defer cancel()
+	command.SetDefaultContext(ctx)
+
+	err := rootCmd.Execute()
+	command.LogDryRunSummary()
+	if auditLogger := command.GlobalAuditLogger(); auditLogger != nil {
+		if closeErr := auditLogger.Close(); closeErr != nil {
+			logrus.Warnf("Unable to close audit log: %v", closeErr)
+		}
+	}
+	if err != nil {
 		logrus.Fatal(err)
 	}
 }
@@ -55,10 +76,55 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&rootOpts.cleanup, "cleanup", false, "cleanup flag")
 	rootCmd.PersistentFlags().StringVar(&rootOpts.repoPath, "repo", filepath.Join(os.TempDir(), "k8s"), "the local path to the repository to be used")
 	rootCmd.PersistentFlags().StringVar(&rootOpts.logLevel, "log-level", "info", "the logging verbosity, either 'panic', 'fatal', 'error', 'warn', 'warning', 'info', 'debug' or 'trace'")
+	rootCmd.PersistentFlags().StringVar(&rootOpts.auditLog, "audit-log", "", "the path to a JSON lines file where every executed command gets recorded with secrets redacted")
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
+	setDryRunPolicy()
+	registerSecrets()
+
+	if rootOpts.auditLog != "" && command.GlobalAuditLogger() == nil {
+		auditLogger, err := command.OpenAuditLog(rootOpts.auditLog)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		command.SetGlobalAuditLogger(auditLogger)
+	}
+}
+
+// setDryRunPolicy only allows commands with side effects if --nomock is
+// given. It has to be called again whenever --nomock changes after
+// initConfig, like for build variants.
+func setDryRunPolicy() {
+	if rootOpts.nomock {
+		command.SetGlobalDryRunPolicy(command.DryRunDisabled)
+	} else {
+		command.SetGlobalDryRunPolicy(command.DryRunMutating)
+	}
+}
+
+// registerSecrets redacts the values of all token and password flags set
+// for krel, as well as $GITHUB_TOKEN, from everything pkg/command logs
+func registerSecrets() {
+	command.GlobalRedactor().WithValues(
+		append(sensitiveFlagValues(rootCmd), os.Getenv("GITHUB_TOKEN"))...,
+	)
+}
+
+// sensitiveFlagValues returns the values of all token and password flags set
+// for the command and its subcommands
+func sensitiveFlagValues(cmd *cobra.Command) []string {
+	values := []string{}
+	cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Changed && command.IsSensitiveFlag("--"+flag.Name) {
+			values = append(values, flag.Value.String())
+		}
+	})
+	for _, subCmd := range cmd.Commands() {
+		values = append(values, sensitiveFlagValues(subCmd)...)
+	}
+	return values
 }
 
 func initLogging(*cobra.Command, []string) error {
@@ -71,3 +137,11 @@ func initLogging(*cobra.Command, []string) error {
 	logrus.Debugf("Using log level %q", lvl)
 	return nil
 }
+
+// toolVersion returns the module version krel was built from
+func toolVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
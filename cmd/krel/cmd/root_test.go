@@ -0,0 +1,44 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/release/pkg/command"
+)
+
+func TestRegisterSecrets(t *testing.T) {
+	defer command.SetGlobalRedactor(nil)
+	defer os.Setenv("GITHUB_TOKEN", os.Getenv("GITHUB_TOKEN"))
+	require.Nil(t, os.Setenv("GITHUB_TOKEN", "env-token"))
+
+	require.Nil(t, changelogCmd.ParseFlags([]string{"--token", "flag-token"}))
+	defer func() {
+		changelogOpts.token = ""
+		changelogCmd.Flags().Lookup("token").Changed = false
+	}()
+
+	registerSecrets()
+	require.Equal(t,
+		"echo [REDACTED] [REDACTED] other",
+		command.GlobalRedactor().Redact("echo flag-token env-token other"),
+	)
+}
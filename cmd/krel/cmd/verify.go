@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"k8s.io/release/pkg/release"
+)
+
+type verifyOptions struct {
+	key string
+}
+
+var verifyOpts = &verifyOptions{}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify --key <public key> <release directory>",
+	Short: "verify checks a downloaded release against its signed provenance",
+	Long: `verify checks the signature of the provenance document of a downloaded
+release directory and afterwards that the directory contains exactly the
+artifacts recorded in the provenance. The artifacts are checked against the
+SHA256SUMS and SHA512SUMS manifests and the hash files as well.`,
+	Example:       "krel verify --key release.pub ./v1.18.0",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE:       initLogging,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVerify(verifyOpts, args[0])
+	},
+}
+
+func init() {
+	verifyCmd.PersistentFlags().StringVar(
+		&verifyOpts.key,
+		"key",
+		"",
+		"ed25519 public key (PEM) or PGP keyring (armored) to verify the provenance signature",
+	)
+
+	rootCmd.AddCommand(verifyCmd)
+}
+
+func runVerify(opts *verifyOptions, dir string) error {
+	if opts.key == "" {
+		return errors.New("Please specify the verification key via --key")
+	}
+	verifier, err := release.LoadVerifier(opts.key)
+	if err != nil {
+		return errors.Wrap(err, "Unable to load verification key")
+	}
+
+	provenance, err := release.VerifyProvenance(dir, verifier)
+	if err != nil {
+		return err
+	}
+	logrus.Infof(
+		"Verified provenance of %s built by %s from commit %q with %d artifacts",
+		provenance.Version, provenance.Builder, provenance.Commit, len(provenance.Artifacts),
+	)
+
+	if err := release.Verify(dir); err != nil {
+		return err
+	}
+	logrus.Infof("Verified checksums of %s", dir)
+	return nil
+}
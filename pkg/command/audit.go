@@ -0,0 +1,155 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultAuditOutputSize is the default amount of bytes of stdout and stderr
+// which are retained for every audit event.
+const DefaultAuditOutputSize = 4096
+
+// AuditEvent is a single command execution recorded by the AuditLogger
+type AuditEvent struct {
+	Time       time.Time  `json:"time"`
+	Args       [][]string `json:"args"`
+	Dir        string     `json:"dir,omitempty"`
+	Env        []string   `json:"env,omitempty"`
+	DurationMs int64      `json:"durationMs"`
+	ExitCode   int        `json:"exitCode"`
+	PipeStatus []int      `json:"pipeStatus,omitempty"`
+	DryRun     bool       `json:"dryRun,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Stdout     string     `json:"stdout,omitempty"`
+	Stderr     string     `json:"stderr,omitempty"`
+	Truncated  bool       `json:"truncated,omitempty"`
+}
+
+// AuditLogger writes every executed command as JSON line to a sink
+type AuditLogger struct {
+	mu            sync.Mutex
+	writer        io.Writer
+	redactor      *Redactor
+	maxOutputSize int
+	closeFn       func() error
+}
+
+// NewAuditLogger creates a new AuditLogger writing to the provided writer
+// using the GlobalRedactor and the DefaultAuditOutputSize.
+func NewAuditLogger(writer io.Writer) *AuditLogger {
+	return &AuditLogger{
+		writer:        writer,
+		redactor:      &Redactor{},
+		maxOutputSize: DefaultAuditOutputSize,
+		closeFn:       func() error { return nil },
+	}
+}
+
+// OpenAuditLog creates a new AuditLogger which appends to the file at the
+// provided path. The file is created if it does not exist.
+func OpenAuditLog(path string) (*AuditLogger, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening audit log %s", path)
+	}
+	logger := NewAuditLogger(file)
+	logger.closeFn = file.Close
+	return logger, nil
+}
+
+// WithRedactionPatterns adds additional patterns used to redact secrets
+func (a *AuditLogger) WithRedactionPatterns(patterns ...*regexp.Regexp) *AuditLogger {
+	a.redactor.WithPatterns(patterns...)
+	return a
+}
+
+// WithRedactedValues adds literal values, like tokens passed via flags, which
+// should always be redacted.
+func (a *AuditLogger) WithRedactedValues(values ...string) *AuditLogger {
+	a.redactor.WithValues(values...)
+	return a
+}
+
+// WithMaxOutputSize sets the amount of bytes of stdout and stderr which are
+// retained for every event. Only the last bytes of the output are retained.
+// A value less or equal to zero disables recording the output.
+func (a *AuditLogger) WithMaxOutputSize(size int) *AuditLogger {
+	a.maxOutputSize = size
+	return a
+}
+
+// Log redacts and writes the event to the sink
+func (a *AuditLogger) Log(event *AuditEvent) error {
+	redactedEvent := *event
+	redactedEvent.Args = redactArgs(event.Args, a.Redact)
+	redactedEvent.Env = redactEnvs(event.Env, a.Redact)
+	redactedEvent.Error = a.Redact(event.Error)
+	redactedEvent.Stdout = a.Redact(event.Stdout)
+	redactedEvent.Stderr = a.Redact(event.Stderr)
+
+	line, err := json.Marshal(&redactedEvent)
+	if err != nil {
+		return errors.Wrap(err, "marshaling audit event")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.writer.Write(append(line, '\n'))
+	return errors.Wrap(err, "writing audit event")
+}
+
+// Redact replaces all secrets in the provided string, using the
+// GlobalRedactor and the patterns and values of the audit logger
+func (a *AuditLogger) Redact(s string) string {
+	return a.redactor.Redact(GlobalRedactor().Redact(s))
+}
+
+// Close closes the underlying sink if it has been opened by OpenAuditLog
+func (a *AuditLogger) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.closeFn()
+}
+
+var (
+	auditLogger   *AuditLogger
+	auditLoggerMu sync.RWMutex
+)
+
+// GlobalAuditLogger returns the audit logger used for all commands, which is
+// nil if audit logging is disabled.
+func GlobalAuditLogger() *AuditLogger {
+	auditLoggerMu.RLock()
+	defer auditLoggerMu.RUnlock()
+	return auditLogger
+}
+
+// SetGlobalAuditLogger sets the audit logger used for all commands. Audit
+// logging is disabled if the logger is nil.
+func SetGlobalAuditLogger(logger *AuditLogger) {
+	auditLoggerMu.Lock()
+	defer auditLoggerMu.Unlock()
+	auditLogger = logger
+}
@@ -18,11 +18,16 @@ package command
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
-	"syscall"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -30,20 +35,119 @@ import (
 
 // A generic command abstraction
 type Command struct {
-	cmds []*command
+	cmds          []*command
+	dir           string
+	executor      Executor
+	ctx           context.Context
+	timeout       time.Duration
+	env           []string
+	envClear      bool
+	stdin         io.Reader
+	stdOutWriter  io.Writer
+	stdErrWriter  io.Writer
+	linePrefix    string
+	maxBufferSize int
+	mutating      bool
+	dryRunPolicy  *DryRunPolicy
+	dryRunResult  *dryRunExecutor
+	retryPolicy   *RetryPolicy
 }
 
 // The internal command representation
 type command struct {
-	*exec.Cmd
-	pipeWriter *io.PipeWriter
+	args []string
 }
 
 // A generic command exit status
 type Status struct {
-	exitCode syscall.WaitStatus
-	stdOut   string
-	stdErr   string
+	exitCode       int
+	pipeStatus     []int
+	stdOut         string
+	stdErr         string
+	combinedOutput string
+	attempts       int
+}
+
+// TimeoutError is returned if a command has been killed because its timeout
+// or the deadline of its context has been exceeded.
+type TimeoutError struct {
+	command string
+	timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.timeout > 0 {
+		return fmt.Sprintf("command %q timed out after %v", e.command, e.timeout)
+	}
+	return fmt.Sprintf("command %q exceeded its context deadline", e.command)
+}
+
+// CanceledError is returned if a command has been killed because its context
+// has been canceled.
+type CanceledError struct {
+	command string
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("command %q has been canceled", e.command)
+}
+
+// IsTimeout returns true if the provided error is a TimeoutError
+func IsTimeout(err error) bool {
+	_, ok := errors.Cause(err).(*TimeoutError)
+	return ok
+}
+
+// IsCanceled returns true if the provided error is a CanceledError
+func IsCanceled(err error) bool {
+	_, ok := errors.Cause(err).(*CanceledError)
+	return ok
+}
+
+var (
+	defaultCtx   = context.Background()
+	defaultCtxMu sync.RWMutex
+)
+
+// DefaultContext returns the context used for all commands which do not have
+// a dedicated context set.
+func DefaultContext() context.Context {
+	defaultCtxMu.RLock()
+	defer defaultCtxMu.RUnlock()
+	return defaultCtx
+}
+
+// SetDefaultContext sets the context used for all commands which do not have
+// a dedicated context set.
+func SetDefaultContext(ctx context.Context) {
+	defaultCtxMu.Lock()
+	defer defaultCtxMu.Unlock()
+	defaultCtx = ctx
+}
+
+// SignalContext returns a copy of the parent context which gets canceled if
+// one of the provided signals has been received. This can be used together
+// with SetDefaultContext to propagate interrupts to all running commands.
+// Note that commands with a cancelable context run in their own process
+// group, which means that they cannot read from the terminal, like for
+// password prompts. The default signal handling gets restored after the first signal, so that
+// a second one terminates the process as usual.
+func SignalContext(
+	parent context.Context, signals ...os.Signal,
+) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, signals...)
+	go func() {
+		defer signal.Stop(sigChan)
+		select {
+		case sig := <-sigChan:
+			logrus.Warnf("Received %v signal, canceling running commands", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
 
 // New creates a new command from the provided arguments.
@@ -55,31 +159,30 @@ func New(cmd string, args ...string) *Command {
 // arguments.
 func NewWithWorkDir(workDir, cmd string, args ...string) *Command {
 	return &Command{
-		cmds: []*command{{
-			Cmd:        cmdWithDir(workDir, cmd, args...),
-			pipeWriter: nil,
-		}},
+		cmds: []*command{{args: append([]string{cmd}, args...)}},
+		dir:  workDir,
 	}
 }
 
-func cmdWithDir(dir, cmd string, args ...string) *exec.Cmd {
-	c := exec.Command(cmd, args...)
-	c.Dir = dir
+// WithContext sets the context of the command. The whole command including
+// all of its pipes will be killed if the context gets done before the command
+// finishes. If no context is set, then the default context will be used.
+func (c *Command) WithContext(ctx context.Context) *Command {
+	c.ctx = ctx
+	return c
+}
+
+// WithTimeout sets a timeout for the command. The whole command including all
+// of its pipes will be killed if it does not finish within the provided
+// duration. A zero timeout disables the timeout.
+func (c *Command) WithTimeout(timeout time.Duration) *Command {
+	c.timeout = timeout
 	return c
 }
 
 // Pipe creates a new command where the previous should be piped to
 func (c *Command) Pipe(cmd string, args ...string) *Command {
-	pipeCmd := cmdWithDir(c.cmds[0].Dir, cmd, args...)
-
-	reader, writer := io.Pipe()
-	c.cmds[len(c.cmds)-1].Stdout = writer
-	pipeCmd.Stdin = reader
-
-	c.cmds = append(c.cmds, &command{
-		Cmd:        pipeCmd,
-		pipeWriter: writer,
-	})
+	c.cmds = append(c.cmds, &command{args: append([]string{cmd}, args...)})
 	return c
 }
 
@@ -98,7 +201,7 @@ func (c *Command) RunSuccess() (err error) {
 		return err
 	}
 	if !res.Success() {
-		return errors.Errorf("command %v did not succeed", c.String())
+		return errors.Errorf("command %v did not succeed", redact(c.String()))
 	}
 	return nil
 }
@@ -107,7 +210,7 @@ func (c *Command) RunSuccess() (err error) {
 func (c *Command) String() string {
 	str := []string{}
 	for _, x := range c.cmds {
-		str = append(str, x.String())
+		str = append(str, strings.Join(x.args, " "))
 	}
 	return strings.Join(str, " | ")
 }
@@ -128,103 +231,385 @@ func (c *Command) RunSilentSuccess() (err error) {
 		return err
 	}
 	if !res.Success() {
-		return errors.Errorf("command %v did not succeed", c.String())
+		return errors.Errorf("command %v did not succeed", redact(c.String()))
 	}
 	return nil
 }
 
+// WithEnv adds the provided environment variables in the form "KEY=value" to
+// all commands of the pipe. The variables take precedence over inherited ones.
+func (c *Command) WithEnv(env ...string) *Command {
+	c.env = append(c.env, env...)
+	return c
+}
+
+// WithEnvClear does not inherit the environment of the current process, so
+// that only the variables added via WithEnv are available to the command.
+func (c *Command) WithEnvClear() *Command {
+	c.envClear = true
+	return c
+}
+
+// WithEnvInherit inherits the environment of the current process, which is
+// the default behavior.
+func (c *Command) WithEnvInherit() *Command {
+	c.envClear = false
+	return c
+}
+
+// WithStdin sets the reader used as standard input for the first command of
+// the pipe.
+func (c *Command) WithStdin(stdin io.Reader) *Command {
+	c.stdin = stdin
+	return c
+}
+
+// WithStdinString sets the provided string as standard input for the first
+// command of the pipe.
+func (c *Command) WithStdinString(stdin string) *Command {
+	return c.WithStdin(strings.NewReader(stdin))
+}
+
+// WithStdout sets the writer where the standard output gets printed to during
+// execution. Defaults to os.Stdout. The writer is not used for the silent
+// run methods.
+func (c *Command) WithStdout(writer io.Writer) *Command {
+	c.stdOutWriter = writer
+	return c
+}
+
+// WithStderr sets the writer where the standard error gets printed to during
+// execution. Defaults to os.Stderr. The writer is not used for the silent run
+// methods.
+func (c *Command) WithStderr(writer io.Writer) *Command {
+	c.stdErrWriter = writer
+	return c
+}
+
+// WithLinePrefix prefixes every printed line of the command output with the
+// provided string. The output stored in the Status is not prefixed.
+func (c *Command) WithLinePrefix(prefix string) *Command {
+	c.linePrefix = prefix
+	return c
+}
+
+// WithMaxBufferSize limits the amount of bytes of stdout and stderr which are
+// kept in memory for the resulting Status. Only the last bytes of the output
+// are retained if the limit is exceeded. A value less or equal to zero means
+// no limit.
+func (c *Command) WithMaxBufferSize(size int) *Command {
+	c.maxBufferSize = size
+	return c
+}
+
+// Mutating marks the command as having side effects, like pushing to a
+// remote location. Mutating commands are not executed if the dry run policy
+// is DryRunMutating.
+func (c *Command) Mutating() *Command {
+	c.mutating = true
+	return c
+}
+
+// WithDryRunPolicy sets the dry run policy of the command, which overrides the
+// global dry run policy.
+func (c *Command) WithDryRunPolicy(policy DryRunPolicy) *Command {
+	c.dryRunPolicy = &policy
+	return c
+}
+
+// WithDryRunResult sets the exit code and output returned by the command if
+// it does not get executed because of its dry run policy. Per default a
+// successful Status without any output is returned.
+func (c *Command) WithDryRunResult(exitCode int, stdout, stderr string) *Command {
+	c.dryRunResult = &dryRunExecutor{
+		exitCode: exitCode,
+		stdout:   stdout,
+		stderr:   stderr,
+	}
+	return c
+}
+
+// WithRetry sets the retry policy of the command. Unsuccessful executions are
+// repeated according to the policy. The timeout of the command applies to
+// every single attempt. Every attempt reads the same standard input, which
+// gets buffered if the reader set via WithStdin is not seekable.
+func (c *Command) WithRetry(policy *RetryPolicy) *Command {
+	c.retryPolicy = policy
+	return c
+}
+
+// WithExecutor sets the executor of the command. If no executor is set, then
+// the default executor will be used.
+func (c *Command) WithExecutor(executor Executor) *Command {
+	c.executor = executor
+	return c
+}
+
+// outputWriters returns the writers where the command output gets printed
+// to. The returned function has to be called after the command execution to
+// flush possibly pending output.
+func (c *Command) outputWriters() (stdout, stderr io.Writer, flush func()) {
+	stdout, stderr = os.Stdout, os.Stderr
+	if c.stdOutWriter != nil {
+		stdout = c.stdOutWriter
+	}
+	if c.stdErrWriter != nil {
+		stderr = c.stdErrWriter
+	}
+	if c.linePrefix == "" {
+		return stdout, stderr, func() {}
+	}
+
+	prefixedStdout := newPrefixWriter(stdout, c.linePrefix)
+	prefixedStderr := newPrefixWriter(stderr, c.linePrefix)
+	return prefixedStdout, prefixedStderr, func() {
+		prefixedStdout.Flush() // nolint: errcheck
+		prefixedStderr.Flush() // nolint: errcheck
+	}
+}
+
+// parentContext returns the context of the command without the timeout
+func (c *Command) parentContext() context.Context {
+	if c.ctx == nil {
+		return DefaultContext()
+	}
+	return c.ctx
+}
+
+// context returns the context of the command with the timeout applied
+func (c *Command) context() (context.Context, context.CancelFunc) {
+	ctx := c.parentContext()
+	if c.timeout > 0 {
+		return context.WithTimeout(ctx, c.timeout)
+	}
+	// Commands which can never be canceled stay in the process group of the
+	// caller, see newPipeline
+	if ctx.Done() == nil {
+		return ctx, func() {}
+	}
+	return context.WithCancel(ctx)
+}
+
 // run is the internal run method
-func (c *Command) run(printOutput bool) (res *Status, err error) {
-	logrus.Debugf("Running command: %v", c.String())
-	var runErr error
-	stdOutBuffer := &bytes.Buffer{}
-	stdErrBuffer := &bytes.Buffer{}
-	status := &Status{}
-
-	type done struct {
-		stdout error
-		stderr error
-	}
-	doneChan := make(chan done, 1)
-
-	for i, cmd := range c.cmds {
-		// Last command handling
-		if i+1 == len(c.cmds) {
-			stdout, err := cmd.StdoutPipe()
-			if err != nil {
-				return nil, err
-			}
-			stderr, err := cmd.StderrPipe()
-			if err != nil {
-				return nil, err
-			}
-
-			var stdOutWriter, stdErrWriter io.Writer
-			if printOutput {
-				stdOutWriter = io.MultiWriter(os.Stdout, stdOutBuffer)
-				stdErrWriter = io.MultiWriter(os.Stderr, stdErrBuffer)
-			} else {
-				stdOutWriter = stdOutBuffer
-				stdErrWriter = stdErrBuffer
-			}
-			go func() {
-				_, stdoutErr := io.Copy(stdOutWriter, stdout)
-				_, stderrErr := io.Copy(stdErrWriter, stderr)
-				doneChan <- done{stdoutErr, stderrErr}
-			}()
+func (c *Command) run(printOutput bool) (*Status, error) {
+	if c.retryPolicy == nil {
+		res, err := c.runAttempt(printOutput)
+		if res != nil {
+			res.attempts = 1
 		}
-
-		if err := cmd.Start(); err != nil {
+		return res, err
+	}
+	rewind, err := c.rewindableStdin()
+	if err != nil {
+		return nil, err
+	}
+	ctx := c.parentContext()
+	res, err := c.retryPolicy.run(ctx, c.String(), func() (*Status, error) {
+		if err := rewind(); err != nil {
 			return nil, err
 		}
+		return c.runAttempt(printOutput)
+	})
+	if err != nil {
+		if ctxErr := c.contextError(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return res, nil
+}
 
-		if i > 0 {
-			if err := c.cmds[i-1].Wait(); err != nil {
-				return nil, err
-			}
+// rewindableStdin makes sure that every attempt of a retried command reads
+// the same standard input. Seekable readers are rewound to their current
+// offset, while all other readers get buffered once. The returned function
+// has to be called before every attempt.
+func (c *Command) rewindableStdin() (rewind func() error, err error) {
+	if c.stdin == nil {
+		return func() error { return nil }, nil
+	}
+	seeker, ok := c.stdin.(io.ReadSeeker)
+	if !ok {
+		content, err := ioutil.ReadAll(c.stdin)
+		if err != nil {
+			return nil, errors.Wrap(err, "buffering stdin for retries")
 		}
+		seeker = bytes.NewReader(content)
+		c.stdin = seeker
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting stdin offset for retries")
+	}
+	return func() error {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return errors.Wrap(err, "rewinding stdin for retry")
+	}, nil
+}
+
+// runAttempt executes the command a single time
+func (c *Command) runAttempt(printOutput bool) (res *Status, err error) {
+	logrus.Debugf("Running command: %v", redact(c.String()))
 
-		if cmd.pipeWriter != nil {
-			if err := cmd.pipeWriter.Close(); err != nil {
-				return nil, err
-			}
+	ctx, cancel := c.context()
+	defer cancel()
+
+	// The global audit logger may be replaced concurrently
+	auditLogger := GlobalAuditLogger()
+
+	stdOutBuffer := newLimitedBuffer(c.maxBufferSize)
+	stdErrBuffer := newLimitedBuffer(c.maxBufferSize)
+	combinedBuffer := newLimitedBuffer(c.maxBufferSize)
+
+	stdOutWriters := []io.Writer{stdOutBuffer, combinedBuffer}
+	stdErrWriters := []io.Writer{stdErrBuffer, combinedBuffer}
+	if printOutput {
+		stdout, stderr, flush := c.outputWriters()
+		defer flush()
+		stdOutWriters = append(stdOutWriters, stdout)
+		stdErrWriters = append(stdErrWriters, stderr)
+	}
+
+	var auditStdout, auditStderr *limitedBuffer
+	if auditLogger != nil && auditLogger.maxOutputSize > 0 {
+		auditStdout = newLimitedBuffer(auditLogger.maxOutputSize)
+		auditStderr = newLimitedBuffer(auditLogger.maxOutputSize)
+		stdOutWriters = append(stdOutWriters, auditStdout)
+		stdErrWriters = append(stdErrWriters, auditStderr)
+	}
+
+	// Both streams of all commands are written concurrently, so we serialize
+	// the writes to keep the combined output consistent
+	mu := &sync.Mutex{}
+	executor := c.selectExecutor()
+	start := time.Now()
+	pipeStatus, err := executor.Execute(ctx, &Invocation{
+		Args:     c.args(),
+		Dir:      c.dir,
+		Env:      c.env,
+		EnvClear: c.envClear,
+		Stdin:    c.stdin,
+		Stdout:   &lockedWriter{mu: mu, writer: io.MultiWriter(stdOutWriters...)},
+		Stderr:   &lockedWriter{mu: mu, writer: io.MultiWriter(stdErrWriters...)},
+	})
+
+	if auditLogger != nil {
+		event := &AuditEvent{
+			Time:       start.UTC(),
+			Args:       c.args(),
+			Dir:        c.dir,
+			Env:        c.env,
+			DurationMs: time.Since(start).Nanoseconds() / int64(time.Millisecond),
+			ExitCode:   pipefail(pipeStatus),
+			PipeStatus: pipeStatus,
 		}
+		if _, ok := executor.(*dryRunExecutor); ok {
+			event.DryRun = true
+		}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		if auditStdout != nil {
+			event.Stdout = auditStdout.String()
+			event.Stderr = auditStderr.String()
+			event.Truncated = auditStdout.Truncated() || auditStderr.Truncated()
+		}
+		if logErr := auditLogger.Log(event); logErr != nil {
+			logrus.Warnf("Unable to write audit event: %v", logErr)
+		}
+	}
 
-		// Wait for last command in the pipe to finish
-		if i+1 == len(c.cmds) {
-			err := <-doneChan
-			if err.stdout != nil && strings.Contains(err.stdout.Error(), os.ErrClosed.Error()) {
-				return nil, errors.Wrap(err.stdout, "unable to copy stdout")
-			}
-			if err.stderr != nil && strings.Contains(err.stderr.Error(), os.ErrClosed.Error()) {
-				return nil, errors.Wrap(err.stderr, "unable to copy stderr")
-			}
-
-			runErr = cmd.Wait()
+	if err != nil {
+		if ctxErr := c.contextError(ctx); ctxErr != nil {
+			return nil, ctxErr
 		}
+		return nil, err
 	}
 
-	status.stdOut = stdOutBuffer.String()
-	status.stdErr = stdErrBuffer.String()
+	if stdOutBuffer.Truncated() || stdErrBuffer.Truncated() {
+		logrus.Debugf(
+			"Output of command %v has been truncated to the last %d bytes",
+			redact(c.String()), c.maxBufferSize,
+		)
+	}
 
-	if exitErr, ok := runErr.(*exec.ExitError); ok {
-		if exitCode, ok := exitErr.Sys().(syscall.WaitStatus); ok {
-			status.exitCode = exitCode
-			return status, nil
+	return &Status{
+		exitCode:       pipefail(pipeStatus),
+		pipeStatus:     pipeStatus,
+		stdOut:         stdOutBuffer.String(),
+		stdErr:         stdErrBuffer.String(),
+		combinedOutput: combinedBuffer.String(),
+	}, nil
+}
+
+// selectExecutor returns the executor for the command, taking the dry run
+// policy into account
+func (c *Command) selectExecutor() Executor {
+	policy := GlobalDryRunPolicy()
+	if c.dryRunPolicy != nil {
+		policy = *c.dryRunPolicy
+	}
+	if policy.skips(c.mutating) {
+		if c.dryRunResult != nil {
+			return c.dryRunResult
 		}
+		return &dryRunExecutor{}
+	}
+	if c.executor != nil {
+		return c.executor
 	}
+	return DefaultExecutor()
+}
+
+// args returns the arguments of all commands of the pipe
+func (c *Command) args() [][]string {
+	res := [][]string{}
+	for _, cmd := range c.cmds {
+		res = append(res, append([]string{}, cmd.args...))
+	}
+	return res
+}
 
-	return status, runErr
+// contextError returns a typed error if the provided context has been
+// exceeded or canceled, otherwise nil.
+func (c *Command) contextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return &TimeoutError{command: redact(c.String()), timeout: c.timeout}
+	case context.Canceled:
+		return &CanceledError{command: redact(c.String())}
+	}
+	return nil
 }
 
-// Success returns if a Status was successful
+// Success returns if a Status was successful. A piped command is only
+// successful if all of its commands succeeded.
 func (s *Status) Success() bool {
 	return s.exitCode == 0
 }
 
-// ExitCode returns the exit status of the command status
+// ExitCode returns the exit status of the command status. For piped commands
+// this is the exit status of the last command which did not succeed, or zero
+// if all commands succeeded (like bash `set -o pipefail`).
 func (s *Status) ExitCode() int {
-	return s.exitCode.ExitStatus()
+	return s.exitCode
+}
+
+// PipeStatus returns the exit status of every command of the pipe in order
+// of their execution (like bash `$PIPESTATUS`).
+func (s *Status) PipeStatus() []int {
+	return append([]int{}, s.pipeStatus...)
+}
+
+// Attempts returns how often the command has been executed to retrieve the
+// status, which is greater than one if the command has been retried.
+func (s *Status) Attempts() int {
+	return s.attempts
+}
+
+// CombinedOutput returns stdout and stderr of the command status interleaved
+// in the order they have been written.
+func (s *Status) CombinedOutput() string {
+	return s.combinedOutput
 }
 
 // Output returns stdout of the command status
@@ -17,7 +17,14 @@ limitations under the License.
 package command
 
 import (
+	"bytes"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -167,3 +174,219 @@ func TestSuccessRunSilentSuccess(t *testing.T) {
 func TestFailureRunSuccessSilent(t *testing.T) {
 	require.NotNil(t, New("cat", "/not/available").RunSilentSuccess())
 }
+
+func TestSuccessWithTimeout(t *testing.T) {
+	res, err := New("echo", "hi").WithTimeout(10 * time.Second).RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+}
+
+func TestFailureTimeout(t *testing.T) {
+	start := time.Now()
+	res, err := New("sleep", "10").WithTimeout(100 * time.Millisecond).Run()
+	require.NotNil(t, err)
+	require.Nil(t, res)
+	require.True(t, IsTimeout(err))
+	require.False(t, IsCanceled(err))
+	require.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestFailureTimeoutKillsChildren(t *testing.T) {
+	// The shell forks sleep which inherits the stdout pipe, so the command
+	// would block until sleep exits if only the shell gets killed
+	start := time.Now()
+	_, err := New("sh", "-c", "sleep 10; echo done").
+		WithTimeout(100 * time.Millisecond).
+		RunSilent()
+	require.True(t, IsTimeout(err))
+	require.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestFailureTimeoutPipe(t *testing.T) {
+	start := time.Now()
+	res, err := New("sleep", "10").
+		Pipe("cat").
+		Pipe("sleep", "10").
+		WithTimeout(100 * time.Millisecond).
+		RunSilent()
+	require.NotNil(t, err)
+	require.Nil(t, res)
+	require.True(t, IsTimeout(err))
+	require.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestSuccessProcessGroup(t *testing.T) {
+	// The fifth field of /proc/<pid>/stat is the process group of the shell
+	processGroup := func(cmd *Command) string {
+		res, err := cmd.RunSilent()
+		require.Nil(t, err)
+		require.True(t, res.Success())
+		return strings.TrimSpace(res.Output())
+	}
+	stat := `cut -d" " -f5 /proc/$$/stat`
+	callerGroup := strconv.Itoa(syscall.Getpgrp())
+
+	// Commands which cannot be canceled stay in the foreground process group,
+	// which allows them to read from the terminal
+	require.Equal(t, callerGroup, processGroup(New("sh", "-c", stat)))
+
+	// Cancelable commands get their own process group to kill their children
+	require.NotEqual(t, callerGroup, processGroup(
+		New("sh", "-c", stat).WithTimeout(10*time.Second),
+	))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NotEqual(t, callerGroup, processGroup(
+		New("sh", "-c", stat).WithContext(ctx),
+	))
+}
+
+func TestFailureContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	res, err := New("sleep", "10").WithContext(ctx).RunSilent()
+	require.NotNil(t, err)
+	require.Nil(t, res)
+	require.True(t, IsCanceled(err))
+	require.False(t, IsTimeout(err))
+	require.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestFailureContextAlreadyCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := New("sleep", "10").WithContext(ctx).RunSilentSuccess()
+	require.True(t, IsCanceled(err))
+}
+
+func TestFailureDefaultContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	SetDefaultContext(ctx)
+	defer SetDefaultContext(context.Background())
+	cancel()
+	_, err := New("sleep", "10").RunSilent()
+	require.True(t, IsCanceled(err))
+}
+
+func TestSuccessSignalContext(t *testing.T) {
+	ctx, cancel := SignalContext(context.Background(), syscall.SIGUSR1)
+	defer cancel()
+	require.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context has not been canceled by the signal")
+	}
+}
+
+func TestSuccessWithEnv(t *testing.T) {
+	res, err := New("sh", "-c", "echo -n $TEST_VAR").
+		WithEnv("TEST_VAR=hello").
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "hello", res.Output())
+}
+
+func TestSuccessWithEnvInherited(t *testing.T) {
+	require.Nil(t, os.Setenv("TEST_INHERITED", "inherited"))
+	defer os.Unsetenv("TEST_INHERITED")
+
+	res, err := New("sh", "-c", "echo -n $TEST_INHERITED $TEST_VAR").
+		WithEnv("TEST_VAR=added").
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "inherited added", res.Output())
+}
+
+func TestSuccessWithEnvClear(t *testing.T) {
+	require.Nil(t, os.Setenv("TEST_INHERITED", "inherited"))
+	defer os.Unsetenv("TEST_INHERITED")
+
+	res, err := New("/bin/sh", "-c", "echo -n $TEST_INHERITED$TEST_VAR").
+		WithEnvClear().
+		WithEnv("TEST_VAR=added").
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "added", res.Output())
+}
+
+func TestSuccessWithEnvPipe(t *testing.T) {
+	res, err := New("echo", "-n", "hi").
+		Pipe("sh", "-c", "cat; echo -n $TEST_VAR").
+		WithEnv("TEST_VAR=ho").
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "hiho", res.Output())
+}
+
+func TestSuccessWithStdin(t *testing.T) {
+	res, err := New("cat").
+		WithStdin(bytes.NewBufferString("hello")).
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "hello", res.Output())
+}
+
+func TestSuccessWithStdinStringPipe(t *testing.T) {
+	res, err := New("cat").
+		Pipe("tr", "a-z", "A-Z").
+		WithStdinString("hello").
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "HELLO", res.Output())
+}
+
+func TestSuccessWithWriters(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	res, err := New("sh", "-c", "echo -n out; echo -n err >&2").
+		WithStdout(stdout).
+		WithStderr(stderr).
+		Run()
+	require.Nil(t, err)
+	require.Equal(t, "out", res.Output())
+	require.Equal(t, "err", res.Error())
+	require.Equal(t, "out", stdout.String())
+	require.Equal(t, "err", stderr.String())
+}
+
+func TestSuccessWithWritersSilent(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	res, err := New("echo", "-n", "out").WithStdout(stdout).RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "out", res.Output())
+	require.Empty(t, stdout.String())
+}
+
+func TestSuccessWithLinePrefix(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	res, err := New("printf", "first\nsecond\nthird").
+		WithStdout(stdout).
+		WithLinePrefix("[test] ").
+		Run()
+	require.Nil(t, err)
+	require.Equal(t, "first\nsecond\nthird", res.Output())
+	require.Equal(t,
+		"[test] first\n[test] second\n[test] third", stdout.String(),
+	)
+}
+
+func TestSuccessWithMaxBufferSize(t *testing.T) {
+	res, err := New("echo", "-n", "hello world").
+		WithMaxBufferSize(5).
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "world", res.Output())
+}
+
+func TestSuccessWithMaxBufferSizeChatty(t *testing.T) {
+	res, err := New("seq", "1", "100000").
+		WithMaxBufferSize(7).
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "100000\n", res.Output())
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DryRunPolicy specifies which commands should not be executed
+type DryRunPolicy int
+
+const (
+	// DryRunDisabled executes all commands
+	DryRunDisabled DryRunPolicy = iota
+
+	// DryRunMutating does not execute commands which are marked as mutating
+	DryRunMutating
+
+	// DryRunAll does not execute any command
+	DryRunAll
+)
+
+func (p DryRunPolicy) String() string {
+	switch p {
+	case DryRunDisabled:
+		return "disabled"
+	case DryRunMutating:
+		return "mutating"
+	case DryRunAll:
+		return "all"
+	}
+	return fmt.Sprintf("unknown (%d)", int(p))
+}
+
+// skips returns true if the policy does not execute the command
+func (p DryRunPolicy) skips(mutating bool) bool {
+	return p == DryRunAll || (p == DryRunMutating && mutating)
+}
+
+var (
+	dryRunPolicy   = DryRunDisabled
+	dryRunSummary  []string
+	dryRunPolicyMu sync.RWMutex
+	dryRunMu       sync.Mutex
+)
+
+// GlobalDryRunPolicy returns the dry run policy used for all commands which do
+// not have a dedicated policy set.
+func GlobalDryRunPolicy() DryRunPolicy {
+	dryRunPolicyMu.RLock()
+	defer dryRunPolicyMu.RUnlock()
+	return dryRunPolicy
+}
+
+// SetGlobalDryRunPolicy sets the dry run policy used for all commands which
+// do not have a dedicated policy set.
+func SetGlobalDryRunPolicy(policy DryRunPolicy) {
+	dryRunPolicyMu.Lock()
+	defer dryRunPolicyMu.Unlock()
+	dryRunPolicy = policy
+}
+
+// DryRunSummary returns all commands which have not been executed because of
+// their dry run policy in order of their occurrence.
+func DryRunSummary() []string {
+	dryRunMu.Lock()
+	defer dryRunMu.Unlock()
+	return append([]string{}, dryRunSummary...)
+}
+
+// ResetDryRunSummary removes all commands from the dry run summary
+func ResetDryRunSummary() {
+	dryRunMu.Lock()
+	defer dryRunMu.Unlock()
+	dryRunSummary = nil
+}
+
+// LogDryRunSummary logs all commands which have not been executed because of
+// their dry run policy. Nothing is logged if no command has been skipped.
+func LogDryRunSummary() {
+	summary := DryRunSummary()
+	if len(summary) == 0 {
+		return
+	}
+	logrus.Infof("The following %d command(s) would have run without dry run:", len(summary))
+	for i, cmd := range summary {
+		logrus.Infof("%d. %s", i+1, cmd)
+	}
+}
+
+// SkipMutation returns true if the mutating operation, which does not run as
+// a command like a storage upload, must not be executed because of the global
+// dry run policy. Skipped operations are logged and added to the dry run
+// summary like commands.
+func SkipMutation(operation string) bool {
+	if !GlobalDryRunPolicy().skips(true) {
+		return false
+	}
+	operation = redact(operation)
+	logrus.Infof("Dry run, not executing: %s", operation)
+	addToDryRunSummary(operation)
+	return true
+}
+
+func addToDryRunSummary(cmd string) {
+	dryRunMu.Lock()
+	defer dryRunMu.Unlock()
+	dryRunSummary = append(dryRunSummary, cmd)
+}
+
+// dryRunExecutor is an executor which does not run anything and returns a
+// fake result instead
+type dryRunExecutor struct {
+	exitCode int
+	stdout   string
+	stderr   string
+}
+
+// Execute logs and records the invocation without executing it
+func (d *dryRunExecutor) Execute(
+	ctx context.Context, invocation *Invocation,
+) ([]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cmd := redact((&Record{Args: invocation.Args}).String())
+	if invocation.Dir != "" {
+		cmd = fmt.Sprintf("%s (in %s)", cmd, invocation.Dir)
+	}
+	logrus.Infof("Dry run, not executing: %s", cmd)
+	addToDryRunSummary(cmd)
+
+	if _, err := io.WriteString(invocation.Stdout, d.stdout); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(invocation.Stderr, d.stderr); err != nil {
+		return nil, err
+	}
+
+	exitCodes := make([]int, len(invocation.Args))
+	exitCodes[len(exitCodes)-1] = d.exitCode
+	return exitCodes, nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuccessDryRunMutating(t *testing.T) {
+	ResetDryRunSummary()
+	SetGlobalDryRunPolicy(DryRunMutating)
+	defer SetGlobalDryRunPolicy(DryRunDisabled)
+
+	// Non mutating commands still get executed
+	res, err := New("echo", "-n", "hi").RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "hi", res.Output())
+
+	res, err = NewWithWorkDir("/some/dir", "cat", "/not/valid").
+		Pipe("cat").
+		Mutating().
+		RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+	require.Empty(t, res.Output())
+	require.Equal(t, []int{0, 0}, res.PipeStatus())
+
+	require.Equal(t,
+		[]string{"cat /not/valid | cat (in /some/dir)"}, DryRunSummary(),
+	)
+}
+
+func TestSuccessDryRunAll(t *testing.T) {
+	ResetDryRunSummary()
+	SetGlobalDryRunPolicy(DryRunAll)
+	defer SetGlobalDryRunPolicy(DryRunDisabled)
+
+	require.Nil(t, New("cat", "/not/valid").RunSuccess())
+	require.Nil(t, New("cat", "/not/valid").Mutating().RunSilentSuccess())
+	require.Len(t, DryRunSummary(), 2)
+
+	ResetDryRunSummary()
+	require.Empty(t, DryRunSummary())
+}
+
+func TestSuccessDryRunDisabled(t *testing.T) {
+	ResetDryRunSummary()
+
+	res, err := New("echo", "-n", "hi").Mutating().RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "hi", res.Output())
+	require.Empty(t, DryRunSummary())
+}
+
+func TestSuccessDryRunCommandPolicy(t *testing.T) {
+	ResetDryRunSummary()
+	SetGlobalDryRunPolicy(DryRunAll)
+	defer SetGlobalDryRunPolicy(DryRunDisabled)
+
+	res, err := New("echo", "-n", "hi").
+		WithDryRunPolicy(DryRunMutating).
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "hi", res.Output())
+	require.Empty(t, DryRunSummary())
+
+	SetGlobalDryRunPolicy(DryRunDisabled)
+	res, err = New("echo", "-n", "hi").
+		Mutating().
+		WithDryRunPolicy(DryRunMutating).
+		RunSilent()
+	require.Nil(t, err)
+	require.Empty(t, res.Output())
+	require.Len(t, DryRunSummary(), 1)
+}
+
+func TestSuccessDryRunResult(t *testing.T) {
+	ResetDryRunSummary()
+
+	res, err := New("git", "push").
+		Mutating().
+		WithDryRunPolicy(DryRunMutating).
+		WithDryRunResult(1, "out", "err").
+		RunSilent()
+	require.Nil(t, err)
+	require.False(t, res.Success())
+	require.Equal(t, 1, res.ExitCode())
+	require.Equal(t, "out", res.Output())
+	require.Equal(t, "err", res.Error())
+	require.Equal(t, []string{"git push"}, DryRunSummary())
+}
+
+func TestSkipMutation(t *testing.T) {
+	ResetDryRunSummary()
+	require.False(t, SkipMutation("upload gs://bucket/object"))
+	require.Empty(t, DryRunSummary())
+
+	SetGlobalDryRunPolicy(DryRunMutating)
+	defer SetGlobalDryRunPolicy(DryRunDisabled)
+	require.True(t, SkipMutation("upload gs://bucket/object"))
+	require.True(t, SkipMutation("push token="+testToken))
+	require.Equal(t,
+		[]string{"upload gs://bucket/object", "push token=[REDACTED]"}, DryRunSummary(),
+	)
+}
+
+func TestDryRunPolicyString(t *testing.T) {
+	require.Equal(t, "disabled", DryRunDisabled.String())
+	require.Equal(t, "mutating", DryRunMutating.String())
+	require.Equal(t, "all", DryRunAll.String())
+	require.Equal(t, "unknown (10)", DryRunPolicy(10).String())
+}
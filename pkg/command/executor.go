@@ -0,0 +1,111 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// Executor is the interface for everything which is able to execute a
+// command invocation
+type Executor interface {
+	// Execute runs the invocation and returns the exit status of every
+	// command of the pipe. The output has to be written to the writers of the
+	// invocation. An error is returned if the invocation could not be
+	// executed at all.
+	Execute(ctx context.Context, invocation *Invocation) ([]int, error)
+}
+
+// Invocation describes a single execution of a Command
+type Invocation struct {
+	// Args contains the arguments of every command of the pipe, where the
+	// first argument is the command itself
+	Args [][]string
+
+	// Dir is the working directory of the invocation
+	Dir string
+
+	// Env contains the additional environment variables in the form
+	// "KEY=value"
+	Env []string
+
+	// EnvClear indicates that the environment of the current process should
+	// not be inherited
+	EnvClear bool
+
+	// Stdin is the standard input of the first command, which can be nil
+	Stdin io.Reader
+
+	// Stdout is the writer for the standard output of the last command
+	Stdout io.Writer
+
+	// Stderr is the writer for the standard error of all commands
+	Stderr io.Writer
+}
+
+// environment returns the environment for the invocation or nil if the
+// default environment should be used.
+func (i *Invocation) environment() []string {
+	if i.EnvClear {
+		return append([]string{}, i.Env...)
+	}
+	if len(i.Env) == 0 {
+		return nil
+	}
+	return append(os.Environ(), i.Env...)
+}
+
+// LocalExecutor executes commands on the local machine
+type LocalExecutor struct{}
+
+// NewLocalExecutor creates a new executor which runs commands on the local
+// machine
+func NewLocalExecutor() *LocalExecutor {
+	return &LocalExecutor{}
+}
+
+// Execute runs the invocation on the local machine
+func (*LocalExecutor) Execute(
+	ctx context.Context, invocation *Invocation,
+) ([]int, error) {
+	return newPipeline(invocation, ctx.Done() != nil).run(ctx)
+}
+
+var (
+	defaultExecutor   Executor = NewLocalExecutor()
+	defaultExecutorMu sync.RWMutex
+)
+
+// DefaultExecutor returns the executor used for all commands which do not
+// have a dedicated executor set.
+func DefaultExecutor() Executor {
+	defaultExecutorMu.RLock()
+	defer defaultExecutorMu.RUnlock()
+	return defaultExecutor
+}
+
+// SetDefaultExecutor sets the executor used for all commands which do not
+// have a dedicated executor set. This can be used to record or replay all
+// commands of a test.
+func SetDefaultExecutor(executor Executor) {
+	defaultExecutorMu.Lock()
+	defer defaultExecutorMu.Unlock()
+	defaultExecutor = executor
+}
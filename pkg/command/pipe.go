@@ -0,0 +1,267 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// pipeline executes a set of commands where the stdout of every command is
+// connected to the stdin of the next one. The stderr of all commands and the
+// stdout of the last command are written to the provided writers.
+type pipeline struct {
+	stages []*exec.Cmd
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	procs  *processGroups
+
+	// files contains the parent side of all pipes, which have to be closed
+	// after the stages have been started
+	files []*os.File
+}
+
+// newPipeline creates a new pipeline for the provided invocation. Cancelable
+// pipelines run every command in its own process group, which allows us to
+// kill all of its children on cancellation as well. Otherwise the commands
+// stay in the foreground process group of the caller, which allows them to
+// read from the terminal and receive its signals.
+func newPipeline(invocation *Invocation, cancelable bool) *pipeline {
+	env := invocation.environment()
+	stages := []*exec.Cmd{}
+	for _, args := range invocation.Args {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = invocation.Dir
+		cmd.Env = env
+		if cancelable {
+			cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		}
+		stages = append(stages, cmd)
+	}
+	return &pipeline{
+		stages: stages,
+		stdin:  invocation.Stdin,
+		stdout: invocation.Stdout,
+		stderr: invocation.Stderr,
+		procs:  &processGroups{groups: cancelable},
+	}
+}
+
+// run executes the pipeline and returns the exit status of every stage. An
+// error is returned if any stage could not be executed at all.
+func (p *pipeline) run(ctx context.Context) ([]int, error) {
+	// Kill all started processes as soon as the context is done
+	finished := make(chan struct{})
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+		select {
+		case <-ctx.Done():
+			p.procs.kill()
+		case <-finished:
+		}
+	}()
+	stopWatcher := func() {
+		close(finished)
+		<-watcherDone
+	}
+
+	if err := p.connect(); err != nil {
+		stopWatcher()
+		p.closeFiles()
+		return nil, err
+	}
+
+	for i, stage := range p.stages {
+		if err := stage.Start(); err != nil {
+			stopWatcher()
+			p.abort(i)
+			return nil, p.stageError(i, err)
+		}
+		p.procs.add(stage.Process)
+	}
+
+	// The pipe ends are now owned by the child processes. Closing them in the
+	// parent is required to make the stages see EOF.
+	p.closeFiles()
+
+	// Every stage has to be waited for, even if a previous one failed
+	pipeStatus := make([]int, len(p.stages))
+	var runErr error
+	for i, stage := range p.stages {
+		err := stage.Wait()
+		if err == nil {
+			continue
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if waitStatus, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				pipeStatus[i] = waitStatus.ExitStatus()
+				continue
+			}
+		}
+		if runErr == nil {
+			runErr = p.stageError(i, err)
+		}
+	}
+
+	stopWatcher()
+	if p.procs.wasKilled() {
+		return nil, errors.New("command has been killed")
+	}
+	return pipeStatus, runErr
+}
+
+// connect wires up the standard streams of all stages
+func (p *pipeline) connect() error {
+	p.stages[0].Stdin = p.stdin
+	for i, stage := range p.stages {
+		stage.Stderr = p.stderr
+		if i+1 == len(p.stages) {
+			stage.Stdout = p.stdout
+			break
+		}
+
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return errors.Wrap(err, "unable to create pipe")
+		}
+		p.files = append(p.files, reader, writer)
+		stage.Stdout = writer
+		p.stages[i+1].Stdin = reader
+	}
+	return nil
+}
+
+// abort kills and waits for the first n stages, which have been started
+// already.
+func (p *pipeline) abort(n int) {
+	p.procs.kill()
+	p.closeFiles()
+	for _, stage := range p.stages[:n] {
+		stage.Wait() // nolint: errcheck
+	}
+}
+
+// closeFiles closes the parent side of all pipes
+func (p *pipeline) closeFiles() {
+	for _, file := range p.files {
+		file.Close() // nolint: errcheck
+	}
+	p.files = nil
+}
+
+// stageError adds the failed stage to the error if the pipeline consists of
+// multiple stages
+func (p *pipeline) stageError(i int, err error) error {
+	if len(p.stages) == 1 {
+		return err
+	}
+	return errors.Wrapf(
+		err, "pipe stage %d (%s) failed", i+1, redact(p.stages[i].String()),
+	)
+}
+
+// pipefail returns the last unsuccessful exit status of the provided ones or
+// zero if all of them succeeded.
+func pipefail(pipeStatus []int) int {
+	for i := len(pipeStatus) - 1; i >= 0; i-- {
+		if pipeStatus[i] != 0 {
+			return pipeStatus[i]
+		}
+	}
+	return 0
+}
+
+// lockedWriter is a writer which serializes all writes on a shared mutex
+type lockedWriter struct {
+	mu     *sync.Mutex
+	writer io.Writer
+}
+
+func (l *lockedWriter) Write(data []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.writer.Write(data)
+}
+
+// processGroups tracks the process groups of all started commands. Without
+// groups only the started processes themselves get killed.
+type processGroups struct {
+	mu     sync.Mutex
+	groups bool
+	pids   []int
+	killed bool
+}
+
+// add registers a started process. The process gets killed immediately if
+// the groups have been killed already.
+func (p *processGroups) add(process *os.Process) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pids = append(p.pids, process.Pid)
+	if p.killed {
+		p.killPid(process.Pid)
+	}
+}
+
+// kill sends SIGKILL to all registered process groups
+func (p *processGroups) kill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.killed = true
+	for _, pid := range p.pids {
+		p.killPid(pid)
+	}
+}
+
+// killPid kills the process group of the pid or only the process itself if
+// it does not have its own group
+func (p *processGroups) killPid(pid int) {
+	if p.groups {
+		killProcessGroup(pid)
+		return
+	}
+	logrus.Debugf("Killing process %d", pid)
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil &&
+		err != syscall.ESRCH {
+		logrus.Warnf("Unable to kill process %d: %v", pid, err)
+	}
+}
+
+// wasKilled returns true if the groups have been killed
+func (p *processGroups) wasKilled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.killed
+}
+
+func killProcessGroup(pid int) {
+	logrus.Debugf("Killing process group %d", pid)
+	// A negative pid addresses the whole process group
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil &&
+		err != syscall.ESRCH {
+		logrus.Warnf("Unable to kill process group %d: %v", pid, err)
+	}
+}
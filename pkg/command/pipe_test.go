@@ -0,0 +1,179 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Larger than any common pipe buffer, which would block the writer if the
+// other end is not drained
+const floodSize = 1 << 20
+
+func TestSuccessNoDeadlockStderrFlood(t *testing.T) {
+	res, err := New("sh", "-c", "head -c 1048576 /dev/zero >&2; echo -n done").
+		WithTimeout(30 * time.Second).
+		RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+	require.Equal(t, "done", res.Output())
+	require.Len(t, res.Error(), floodSize)
+}
+
+func TestSuccessNoDeadlockStdoutAndStderrFlood(t *testing.T) {
+	res, err := New(
+		"sh", "-c", "head -c 1048576 /dev/zero >&2 & head -c 1048576 /dev/zero; wait",
+	).
+		WithTimeout(30 * time.Second).
+		RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+	require.Len(t, res.Output(), floodSize)
+	require.Len(t, res.Error(), floodSize)
+	require.Len(t, res.CombinedOutput(), 2*floodSize)
+}
+
+func TestSuccessNoDeadlockPipeStderrFlood(t *testing.T) {
+	res, err := New("sh", "-c", "head -c 1048576 /dev/zero >&2; echo -n hi").
+		Pipe("cat").
+		WithTimeout(30 * time.Second).
+		RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+	require.Equal(t, "hi", res.Output())
+	require.Len(t, res.Error(), floodSize)
+}
+
+func TestSuccessPipeStatus(t *testing.T) {
+	res, err := New("echo", "-n", "hi").Pipe("cat").Pipe("cat").RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+	require.Equal(t, []int{0, 0, 0}, res.PipeStatus())
+}
+
+func TestSuccessPipeStatusSingleCommand(t *testing.T) {
+	res, err := New("sh", "-c", "exit 3").RunSilent()
+	require.Nil(t, err)
+	require.False(t, res.Success())
+	require.Equal(t, 3, res.ExitCode())
+	require.Equal(t, []int{3}, res.PipeStatus())
+}
+
+func TestFailurePipeMiddleStage(t *testing.T) {
+	res, err := New("echo", "-n", "hi").
+		Pipe("sh", "-c", "cat; exit 2").
+		Pipe("cat").
+		RunSilent()
+	require.Nil(t, err)
+	require.False(t, res.Success())
+	require.Equal(t, 2, res.ExitCode())
+	require.Equal(t, []int{0, 2, 0}, res.PipeStatus())
+	require.Equal(t, "hi", res.Output())
+}
+
+func TestFailurePipeMiddleStageStderr(t *testing.T) {
+	res, err := New("echo", "-n", "hi").
+		Pipe("cat", "/not/valid").
+		Pipe("cat").
+		RunSilent()
+	require.Nil(t, err)
+	require.False(t, res.Success())
+	require.Equal(t, 1, res.ExitCode())
+	require.Contains(t, res.Error(), "No such file")
+	require.NotContains(t, res.Output(), "No such file")
+}
+
+func TestFailurePipeLastFailureWins(t *testing.T) {
+	res, err := New("sh", "-c", "exit 3").
+		Pipe("sh", "-c", "exit 4").
+		Pipe("cat").
+		RunSilent()
+	require.Nil(t, err)
+	require.False(t, res.Success())
+	require.Equal(t, 4, res.ExitCode())
+	require.Equal(t, []int{3, 4, 0}, res.PipeStatus())
+}
+
+func TestFailurePipeFirstStage(t *testing.T) {
+	res, err := New("cat", "/not/valid").Pipe("cat").RunSilent()
+	require.Nil(t, err)
+	require.False(t, res.Success())
+	require.Equal(t, []int{1, 0}, res.PipeStatus())
+}
+
+func TestFailurePipeWrongCommandMiddleStage(t *testing.T) {
+	res, err := New("sleep", "10").
+		Pipe("wrong").
+		Pipe("cat").
+		WithTimeout(30 * time.Second).
+		RunSilent()
+	require.NotNil(t, err)
+	require.Nil(t, res)
+	require.Contains(t, err.Error(), "pipe stage 2")
+	require.False(t, IsTimeout(err))
+}
+
+func TestSuccessCombinedOutput(t *testing.T) {
+	res, err := New("sh", "-c", "echo 1; sleep 0.1; echo 2 >&2; sleep 0.1; echo 3").
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "1\n3\n", res.Output())
+	require.Equal(t, "2\n", res.Error())
+	require.Equal(t, "1\n2\n3\n", res.CombinedOutput())
+}
+
+func TestSuccessCombinedOutputPipe(t *testing.T) {
+	res, err := New("sh", "-c", "echo err1 >&2; echo out").
+		Pipe("sh", "-c", "cat; sleep 0.1; echo err2 >&2").
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "out\n", res.Output())
+	require.Contains(t, res.Error(), "err1\n")
+	require.Contains(t, res.Error(), "err2\n")
+	require.True(t, strings.HasSuffix(res.CombinedOutput(), "err2\n"))
+}
+
+func TestSuccessRunTwice(t *testing.T) {
+	cmd := New("echo", "-n", "hi").Pipe("cat")
+	for i := 0; i < 2; i++ {
+		res, err := cmd.RunSilent()
+		require.Nil(t, err)
+		require.True(t, res.Success())
+		require.Equal(t, "hi", res.Output())
+	}
+}
+
+func TestPipefail(t *testing.T) {
+	for _, tc := range []struct {
+		pipeStatus []int
+		expected   int
+	}{
+		{nil, 0},
+		{[]int{0}, 0},
+		{[]int{0, 0}, 0},
+		{[]int{1, 0}, 1},
+		{[]int{1, 2, 0}, 2},
+		{[]int{0, 0, 3}, 3},
+		{[]int{-1, 0}, -1},
+	} {
+		require.Equal(t, tc.expected, pipefail(tc.pipeStatus))
+	}
+}
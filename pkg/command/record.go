@@ -0,0 +1,252 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Record is a single recorded command invocation
+type Record struct {
+	Args      [][]string `json:"args"`
+	Dir       string     `json:"dir,omitempty"`
+	Env       []string   `json:"env,omitempty"`
+	Stdin     string     `json:"stdin,omitempty"`
+	Stdout    string     `json:"stdout,omitempty"`
+	Stderr    string     `json:"stderr,omitempty"`
+	ExitCodes []int      `json:"exitCodes,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// String returns a string representation of the recorded command
+func (r *Record) String() string {
+	str := []string{}
+	for _, args := range r.Args {
+		str = append(str, strings.Join(args, " "))
+	}
+	return strings.Join(str, " | ")
+}
+
+// LoadRecords reads the records from the provided fixture file
+func LoadRecords(path string) ([]*Record, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading fixture file %s", path)
+	}
+	records := []*Record{}
+	if err := json.Unmarshal(content, &records); err != nil {
+		return nil, errors.Wrapf(err, "parsing fixture file %s", path)
+	}
+	return records, nil
+}
+
+// SaveRecords writes the records to the provided fixture file
+func SaveRecords(path string, records []*Record) error {
+	content, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshaling records")
+	}
+	return errors.Wrapf(
+		ioutil.WriteFile(path, append(content, '\n'), 0o644),
+		"writing fixture file %s", path,
+	)
+}
+
+// Recorder is an executor which records all invocations passed through to
+// another executor. Secrets are redacted from the records like from the
+// audit log, since fixtures are meant to be committed as test data.
+type Recorder struct {
+	mu       sync.Mutex
+	executor Executor
+	records  []*Record
+}
+
+// NewRecorder creates a new Recorder for the provided executor. The local
+// executor is used if the provided one is nil.
+func NewRecorder(executor Executor) *Recorder {
+	if executor == nil {
+		executor = NewLocalExecutor()
+	}
+	return &Recorder{executor: executor}
+}
+
+// Execute runs and records the invocation
+func (r *Recorder) Execute(
+	ctx context.Context, invocation *Invocation,
+) ([]int, error) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	recorded := *invocation
+	if invocation.Stdin != nil {
+		recorded.Stdin = io.TeeReader(invocation.Stdin, stdin)
+	}
+	recorded.Stdout = io.MultiWriter(invocation.Stdout, stdout)
+	recorded.Stderr = io.MultiWriter(invocation.Stderr, stderr)
+
+	exitCodes, err := r.executor.Execute(ctx, &recorded)
+
+	record := &Record{
+		Args:      redactArgs(invocation.Args, redact),
+		Dir:       invocation.Dir,
+		Env:       redactEnvs(invocation.Env, redact),
+		Stdin:     redact(stdin.String()),
+		Stdout:    redact(stdout.String()),
+		Stderr:    redact(stderr.String()),
+		ExitCodes: exitCodes,
+	}
+	if err != nil {
+		record.Error = redact(err.Error())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+	return exitCodes, err
+}
+
+// Records returns all recorded invocations
+func (r *Recorder) Records() []*Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Record{}, r.records...)
+}
+
+// Save writes all recorded invocations to the provided fixture file
+func (r *Recorder) Save(path string) error {
+	return SaveRecords(path, r.Records())
+}
+
+// Replayer is an executor which serves previously recorded invocations
+// instead of running any command.
+//
+// Every record is served exactly once. Invocations are matched against the
+// records by their arguments and environment in order of the records, where
+// secrets redacted by the Recorder match the secrets of the invocation. The
+// working directory is only matched if the record contains one, which allows
+// using fixtures independently of temporary directories.
+type Replayer struct {
+	mu      sync.Mutex
+	records []*Record
+	used    []bool
+}
+
+// NewReplayer creates a new Replayer for the provided records
+func NewReplayer(records ...*Record) *Replayer {
+	return &Replayer{records: records, used: make([]bool, len(records))}
+}
+
+// LoadReplayer creates a new Replayer from the provided fixture file
+func LoadReplayer(path string) (*Replayer, error) {
+	records, err := LoadRecords(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(records...), nil
+}
+
+// Execute serves the first unused record matching the invocation
+func (r *Replayer) Execute(
+	ctx context.Context, invocation *Invocation,
+) ([]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	record := r.next(invocation)
+	if record == nil {
+		return nil, errors.Errorf(
+			"no recorded invocation found for %q in directory %q",
+			redact((&Record{Args: invocation.Args}).String()), invocation.Dir,
+		)
+	}
+	logrus.Debugf("Replaying recorded command: %v", redact(record.String()))
+
+	if _, err := io.WriteString(invocation.Stdout, record.Stdout); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(invocation.Stderr, record.Stderr); err != nil {
+		return nil, err
+	}
+	if record.Error != "" {
+		return nil, errors.New(record.Error)
+	}
+	if len(record.ExitCodes) == 0 {
+		return make([]int, len(record.Args)), nil
+	}
+	return append([]int{}, record.ExitCodes...), nil
+}
+
+// next returns the next unused record matching the invocation or nil
+func (r *Replayer) next(invocation *Invocation) *Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, record := range r.records {
+		if r.used[i] || !record.matches(invocation) {
+			continue
+		}
+		r.used[i] = true
+		return record
+	}
+	return nil
+}
+
+// Unused returns all records which have not been served yet
+func (r *Replayer) Unused() []*Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := []*Record{}
+	for i, record := range r.records {
+		if !r.used[i] {
+			res = append(res, record)
+		}
+	}
+	return res
+}
+
+// matches returns true if the record matches the provided invocation
+func (r *Record) matches(invocation *Invocation) bool {
+	if r.Dir != "" && r.Dir != invocation.Dir {
+		return false
+	}
+	return r.matchesArgs(invocation.Args, invocation.Env) ||
+		r.matchesArgs(redactArgs(invocation.Args, redact), redactEnvs(invocation.Env, redact))
+}
+
+// matchesArgs returns true if the record has the provided arguments and
+// environment
+func (r *Record) matchesArgs(args [][]string, env []string) bool {
+	if len(r.Env) > 0 || len(env) > 0 {
+		if !reflect.DeepEqual(r.Env, env) {
+			return false
+		}
+	}
+	return reflect.DeepEqual(r.Args, args)
+}
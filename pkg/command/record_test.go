@@ -0,0 +1,204 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuccessRecordAndReplay(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "command-test-")
+	require.Nil(t, err)
+	defer os.RemoveAll(tempDir)
+	fixture := filepath.Join(tempDir, "fixture.json")
+
+	// Record
+	recorder := NewRecorder(nil)
+	res, err := New("cat").
+		Pipe("tr", "a-z", "A-Z").
+		WithStdinString("hello").
+		WithExecutor(recorder).
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "HELLO", res.Output())
+
+	res, err = New("sh", "-c", "echo -n $TEST_VAR >&2; exit 2").
+		WithEnv("TEST_VAR=err").
+		WithExecutor(recorder).
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, 2, res.ExitCode())
+
+	records := recorder.Records()
+	require.Len(t, records, 2)
+	require.Equal(t, [][]string{{"cat"}, {"tr", "a-z", "A-Z"}}, records[0].Args)
+	require.Equal(t, "hello", records[0].Stdin)
+	require.Equal(t, "HELLO", records[0].Stdout)
+	require.Equal(t, []int{0, 0}, records[0].ExitCodes)
+	require.Equal(t, []string{"TEST_VAR=err"}, records[1].Env)
+	require.Equal(t, "err", records[1].Stderr)
+	require.Equal(t, []int{2}, records[1].ExitCodes)
+	require.Nil(t, recorder.Save(fixture))
+
+	// Replay in different order
+	replayer, err := LoadReplayer(fixture)
+	require.Nil(t, err)
+
+	res, err = New("sh", "-c", "echo -n $TEST_VAR >&2; exit 2").
+		WithEnv("TEST_VAR=err").
+		WithExecutor(replayer).
+		RunSilent()
+	require.Nil(t, err)
+	require.False(t, res.Success())
+	require.Equal(t, 2, res.ExitCode())
+	require.Equal(t, "err", res.Error())
+	require.Equal(t, "err", res.CombinedOutput())
+	require.Len(t, replayer.Unused(), 1)
+
+	res, err = New("cat").
+		Pipe("tr", "a-z", "A-Z").
+		WithExecutor(replayer).
+		RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+	require.Equal(t, "HELLO", res.Output())
+	require.Equal(t, []int{0, 0}, res.PipeStatus())
+	require.Empty(t, replayer.Unused())
+}
+
+func TestSuccessRecordError(t *testing.T) {
+	recorder := NewRecorder(nil)
+	res, err := New("/not/valid").WithExecutor(recorder).RunSilent()
+	require.NotNil(t, err)
+	require.Nil(t, res)
+
+	records := recorder.Records()
+	require.Len(t, records, 1)
+	require.NotEmpty(t, records[0].Error)
+
+	res, err = New("/not/valid").
+		WithExecutor(NewReplayer(records...)).
+		RunSilent()
+	require.NotNil(t, err)
+	require.Nil(t, res)
+	require.Equal(t, records[0].Error, err.Error())
+}
+
+func TestSuccessRecordRedaction(t *testing.T) {
+	recorder := NewRecorder(nil)
+	res, err := New("echo", "-n", "token="+testToken).
+		Pipe("cat").
+		WithEnv("GITHUB_TOKEN="+testToken, "TEST_VAR=value").
+		WithStdinString(testToken).
+		WithExecutor(recorder).
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "token="+testToken, res.Output())
+
+	records := recorder.Records()
+	require.Len(t, records, 1)
+	require.Equal(t, [][]string{{"echo", "-n", "token=[REDACTED]"}, {"cat"}}, records[0].Args)
+	require.Equal(t, []string{"GITHUB_TOKEN=[REDACTED]", "TEST_VAR=value"}, records[0].Env)
+	require.Equal(t, "ghp_[REDACTED]", records[0].Stdin)
+	require.Equal(t, "token=[REDACTED]", records[0].Stdout)
+
+	// The redacted record still matches the invocation containing the secret
+	res, err = New("echo", "-n", "token="+testToken).
+		Pipe("cat").
+		WithEnv("GITHUB_TOKEN="+testToken, "TEST_VAR=value").
+		WithExecutor(NewReplayer(records...)).
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, "token=[REDACTED]", res.Output())
+}
+
+func TestSuccessReplayFixture(t *testing.T) {
+	replayer, err := LoadReplayer(filepath.Join("testdata", "replay.json"))
+	require.Nil(t, err)
+	SetDefaultExecutor(replayer)
+	defer SetDefaultExecutor(NewLocalExecutor())
+
+	res, err := NewWithWorkDir(
+		"/some/repo", "git", "describe", "--abbrev=0", "--tags", "invalid",
+	).RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, 128, res.ExitCode())
+	require.Contains(t, res.Error(), "Not a valid object name")
+
+	res, err = NewWithWorkDir(
+		"/other/repo", "git", "describe", "--abbrev=0", "--tags", "origin/master",
+	).RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+	require.Equal(t, "v1.17.0-alpha.3\n", res.Output())
+	require.Empty(t, replayer.Unused())
+}
+
+func TestFailureReplayNoMatch(t *testing.T) {
+	replayer := NewReplayer(&Record{Args: [][]string{{"echo", "hi"}}})
+
+	_, err := New("echo", "ho").WithExecutor(replayer).RunSilent()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "no recorded invocation found")
+
+	_, err = New("echo", "hi").
+		WithEnv("KEY=value").
+		WithExecutor(replayer).
+		RunSilent()
+	require.NotNil(t, err)
+}
+
+func TestFailureReplayUsedOnce(t *testing.T) {
+	replayer := NewReplayer(&Record{Args: [][]string{{"echo", "hi"}}})
+
+	res, err := New("echo", "hi").WithExecutor(replayer).RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+
+	_, err = New("echo", "hi").WithExecutor(replayer).RunSilent()
+	require.NotNil(t, err)
+}
+
+func TestFailureReplayDirMismatch(t *testing.T) {
+	replayer := NewReplayer(
+		&Record{Args: [][]string{{"ls"}}, Dir: "/recorded"},
+	)
+
+	_, err := NewWithWorkDir("/other", "ls").WithExecutor(replayer).RunSilent()
+	require.NotNil(t, err)
+
+	_, err = NewWithWorkDir("/recorded", "ls").WithExecutor(replayer).RunSilent()
+	require.Nil(t, err)
+}
+
+func TestFailureReplayCanceled(t *testing.T) {
+	replayer := NewReplayer(&Record{Args: [][]string{{"echo", "hi"}}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := New("echo", "hi").
+		WithContext(ctx).
+		WithExecutor(replayer).
+		RunSilent()
+	require.True(t, IsCanceled(err))
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RetryPolicy specifies if and how often an unsuccessful command should be
+// executed again
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of executions including the first one
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry, which gets doubled for
+	// every further retry
+	Backoff time.Duration
+
+	// MaxBackoff limits the delay between two attempts if greater than zero
+	MaxBackoff time.Duration
+
+	// ExitCodes restricts retries to commands exiting with one of the codes.
+	// Every unsuccessful exit code is retried if neither ExitCodes nor
+	// StderrPatterns are set.
+	ExitCodes []int
+
+	// StderrPatterns restricts retries to commands whose stderr matches one
+	// of the patterns. Every unsuccessful exit code is retried if neither
+	// ExitCodes nor StderrPatterns are set.
+	StderrPatterns []*regexp.Regexp
+
+	// RetryTimeouts retries commands which have been killed because their
+	// timeout has been exceeded. The deadline of the context is never retried.
+	RetryTimeouts bool
+}
+
+// ShouldRetry returns true if the provided unsuccessful status matches the
+// retry conditions of the policy
+func (r *RetryPolicy) ShouldRetry(status *Status) bool {
+	if status.Success() {
+		return false
+	}
+	if len(r.ExitCodes) == 0 && len(r.StderrPatterns) == 0 {
+		return true
+	}
+	for _, exitCode := range r.ExitCodes {
+		if status.ExitCode() == exitCode {
+			return true
+		}
+	}
+	for _, pattern := range r.StderrPatterns {
+		if pattern.MatchString(status.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the provided retry, starting at one
+func (r *RetryPolicy) backoff(retry int) time.Duration {
+	backoff := r.Backoff
+	for i := 1; i < retry; i++ {
+		backoff *= 2
+		if r.MaxBackoff > 0 && backoff >= r.MaxBackoff {
+			return r.MaxBackoff
+		}
+	}
+	if r.MaxBackoff > 0 && backoff > r.MaxBackoff {
+		return r.MaxBackoff
+	}
+	return backoff
+}
+
+// run executes the attempt until it succeeds, the retry conditions do not
+// match any more or the maximum number of attempts has been reached.
+// Errors are not retried, because they indicate that the command could not be
+// executed at all, except for timeouts if RetryTimeouts is set. The context
+// error is returned if the context gets done while waiting for the next
+// attempt.
+func (r *RetryPolicy) run(
+	ctx context.Context, cmd string, attempt func() (*Status, error),
+) (*Status, error) {
+	for i := 1; ; i++ {
+		logrus.Debugf("Running attempt %d/%d of command: %v", i, r.MaxAttempts, redact(cmd))
+		status, err := attempt()
+		if err != nil {
+			if i >= r.MaxAttempts || !r.RetryTimeouts || !IsTimeout(err) || ctx.Err() != nil {
+				return nil, err
+			}
+			logrus.Warnf(
+				"Command %v timed out (attempt %d/%d), retrying in %v",
+				redact(cmd), i, r.MaxAttempts, r.backoff(i),
+			)
+		} else {
+			status.attempts = i
+			if i >= r.MaxAttempts || !r.ShouldRetry(status) {
+				return status, nil
+			}
+			logrus.Warnf(
+				"Command %v failed with exit code %d (attempt %d/%d), retrying in %v",
+				redact(cmd), status.ExitCode(), i, r.MaxAttempts, r.backoff(i),
+			)
+		}
+
+		if err := r.wait(ctx, i); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Do calls the function until it succeeds, its error does not match the
+// StderrPatterns any more or the maximum number of attempts has been reached.
+// It allows retrying operations which are not executed as command, like
+// network access of libraries. ExitCodes are not taken into account.
+func (r *RetryPolicy) Do(ctx context.Context, operation string, fn func() error) error {
+	for i := 1; ; i++ {
+		logrus.Debugf("Running attempt %d/%d of %s", i, r.MaxAttempts, redact(operation))
+		err := fn()
+		if err == nil || i >= r.MaxAttempts || !r.matchesError(err) {
+			return err
+		}
+		logrus.Warnf(
+			"Unable to %s (attempt %d/%d), retrying in %v: %v",
+			redact(operation), i, r.MaxAttempts, r.backoff(i), redact(err.Error()),
+		)
+		if err := r.wait(ctx, i); err != nil {
+			return err
+		}
+	}
+}
+
+// matchesError returns true if the error matches one of the StderrPatterns or
+// if no patterns are set
+func (r *RetryPolicy) matchesError(err error) bool {
+	if len(r.StderrPatterns) == 0 {
+		return true
+	}
+	for _, pattern := range r.StderrPatterns {
+		if pattern.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// wait blocks for the backoff of the provided retry or until the context is
+// done, in which case the context error is returned
+func (r *RetryPolicy) wait(ctx context.Context, retry int) error {
+	select {
+	case <-time.After(r.backoff(retry)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
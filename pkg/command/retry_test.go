@@ -0,0 +1,289 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyCommand returns a shell script which fails with the provided exit code
+// and stderr until it has been called `failures` times
+func flakyCommand(t *testing.T, failures, exitCode int, stderr string) (string, func()) {
+	tempDir, err := ioutil.TempDir("", "command-test-")
+	require.Nil(t, err)
+	counter := filepath.Join(tempDir, "counter")
+	script := `
+count=$(cat ` + counter + ` 2>/dev/null || echo 0)
+count=$((count+1))
+echo $count > ` + counter + `
+if [ $count -le ` + strconv.Itoa(failures) + ` ]; then
+  echo -n "` + stderr + `" >&2
+  exit ` + strconv.Itoa(exitCode) + `
+fi
+echo -n success
+`
+	return script, func() { os.RemoveAll(tempDir) }
+}
+
+func TestSuccessRetry(t *testing.T) {
+	script, cleanup := flakyCommand(t, 2, 1, "flake")
+	defer cleanup()
+
+	res, err := New("sh", "-c", script).
+		WithRetry(&RetryPolicy{MaxAttempts: 3}).
+		RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+	require.Equal(t, "success", res.Output())
+	require.Equal(t, 3, res.Attempts())
+}
+
+func TestSuccessRetryStdin(t *testing.T) {
+	for name, stdin := range map[string]func() io.Reader{
+		"seekable": func() io.Reader {
+			reader := strings.NewReader("skipped input")
+			_, err := reader.Seek(int64(len("skipped ")), io.SeekStart)
+			require.Nil(t, err)
+			return reader
+		},
+		"not seekable": func() io.Reader {
+			return io.MultiReader(strings.NewReader("input"))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tempDir, err := ioutil.TempDir("", "command-test-")
+			require.Nil(t, err)
+			defer os.RemoveAll(tempDir)
+			inputs := filepath.Join(tempDir, "inputs")
+
+			// Every attempt records its input and only the second one succeeds
+			script := `
+cat >> ` + inputs + `
+echo >> ` + inputs + `
+[ $(wc -l < ` + inputs + `) -ge 2 ]
+`
+			res, err := New("sh", "-c", script).
+				WithStdin(stdin()).
+				WithRetry(&RetryPolicy{MaxAttempts: 2}).
+				RunSilent()
+			require.Nil(t, err)
+			require.True(t, res.Success())
+			require.Equal(t, 2, res.Attempts())
+
+			content, err := ioutil.ReadFile(inputs)
+			require.Nil(t, err)
+			require.Equal(t, "input\ninput\n", string(content))
+		})
+	}
+}
+
+func TestFailureRetryMaxAttempts(t *testing.T) {
+	script, cleanup := flakyCommand(t, 5, 1, "flake")
+	defer cleanup()
+
+	res, err := New("sh", "-c", script).
+		WithRetry(&RetryPolicy{MaxAttempts: 2}).
+		RunSilent()
+	require.Nil(t, err)
+	require.False(t, res.Success())
+	require.Equal(t, 2, res.Attempts())
+}
+
+func TestSuccessNoRetry(t *testing.T) {
+	res, err := New("echo", "hi").RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, 1, res.Attempts())
+
+	res, err = New("echo", "hi").
+		WithRetry(&RetryPolicy{MaxAttempts: 3}).
+		RunSilent()
+	require.Nil(t, err)
+	require.Equal(t, 1, res.Attempts())
+}
+
+func TestSuccessRetryExitCode(t *testing.T) {
+	script, cleanup := flakyCommand(t, 1, 2, "")
+	defer cleanup()
+
+	res, err := New("sh", "-c", script).
+		WithRetry(&RetryPolicy{MaxAttempts: 3, ExitCodes: []int{1}}).
+		RunSilent()
+	require.Nil(t, err)
+	require.False(t, res.Success())
+	require.Equal(t, 1, res.Attempts())
+
+	script, cleanup = flakyCommand(t, 1, 2, "")
+	defer cleanup()
+
+	res, err = New("sh", "-c", script).
+		WithRetry(&RetryPolicy{MaxAttempts: 3, ExitCodes: []int{2}}).
+		RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+	require.Equal(t, 2, res.Attempts())
+}
+
+func TestSuccessRetryStderrPattern(t *testing.T) {
+	script, cleanup := flakyCommand(t, 1, 1, "fatal: the remote end hung up")
+	defer cleanup()
+
+	res, err := New("sh", "-c", script).
+		WithRetry(&RetryPolicy{
+			MaxAttempts:    3,
+			StderrPatterns: []*regexp.Regexp{regexp.MustCompile("not matching")},
+		}).
+		RunSilent()
+	require.Nil(t, err)
+	require.False(t, res.Success())
+	require.Equal(t, 1, res.Attempts())
+
+	script, cleanup = flakyCommand(t, 1, 1, "fatal: the remote end hung up")
+	defer cleanup()
+
+	res, err = New("sh", "-c", script).
+		WithRetry(&RetryPolicy{
+			MaxAttempts:    3,
+			StderrPatterns: []*regexp.Regexp{regexp.MustCompile("hung up")},
+		}).
+		RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+	require.Equal(t, 2, res.Attempts())
+}
+
+func TestFailureRetryError(t *testing.T) {
+	res, err := New("/not/valid").
+		WithRetry(&RetryPolicy{MaxAttempts: 3}).
+		RunSilent()
+	require.NotNil(t, err)
+	require.Nil(t, res)
+}
+
+func TestFailureRetryCanceledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	res, err := New("sh", "-c", "exit 1").
+		WithContext(ctx).
+		WithRetry(&RetryPolicy{MaxAttempts: 3, Backoff: time.Minute}).
+		RunSilent()
+	require.Nil(t, res)
+	require.True(t, IsCanceled(err))
+	require.True(t, time.Since(start) < 30*time.Second)
+}
+
+func TestSuccessRetryTimeout(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "command-test-")
+	require.Nil(t, err)
+	defer os.RemoveAll(tempDir)
+	// Hangs on the first call only
+	script := `[ -f marker ] || { touch marker; sleep 10; }; echo -n success`
+
+	res, err := NewWithWorkDir(tempDir, "sh", "-c", script).
+		WithTimeout(200 * time.Millisecond).
+		WithRetry(&RetryPolicy{MaxAttempts: 2, RetryTimeouts: true}).
+		RunSilent()
+	require.Nil(t, err)
+	require.True(t, res.Success())
+	require.Equal(t, "success", res.Output())
+	require.Equal(t, 2, res.Attempts())
+
+	// Timeouts are not retried by default
+	require.Nil(t, os.Remove(filepath.Join(tempDir, "marker")))
+	res, err = NewWithWorkDir(tempDir, "sh", "-c", script).
+		WithTimeout(200 * time.Millisecond).
+		WithRetry(&RetryPolicy{MaxAttempts: 2}).
+		RunSilent()
+	require.Nil(t, res)
+	require.True(t, IsTimeout(err))
+}
+
+func TestSuccessRetryDo(t *testing.T) {
+	sut := &RetryPolicy{
+		MaxAttempts:    3,
+		StderrPatterns: []*regexp.Regexp{regexp.MustCompile("connection reset")},
+	}
+
+	calls := 0
+	err := sut.Do(context.Background(), "fetch", func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("read: connection reset by peer")
+		}
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, 3, calls)
+
+	// Errors which do not match the patterns are returned immediately
+	calls = 0
+	err = sut.Do(context.Background(), "fetch", func() error {
+		calls++
+		return errors.New("repository not found")
+	})
+	require.EqualError(t, err, "repository not found")
+	require.Equal(t, 1, calls)
+
+	// The last error is returned if all attempts failed
+	calls = 0
+	err = sut.Do(context.Background(), "fetch", func() error {
+		calls++
+		return errors.New("connection reset")
+	})
+	require.EqualError(t, err, "connection reset")
+	require.Equal(t, 3, calls)
+}
+
+func TestFailureRetryDoCanceledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	sut := &RetryPolicy{MaxAttempts: 3, Backoff: time.Minute}
+	err := sut.Do(ctx, "fetch", func() error { return errors.New("flake") })
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	sut := &RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	require.Equal(t, time.Second, sut.backoff(1))
+	require.Equal(t, 2*time.Second, sut.backoff(2))
+	require.Equal(t, 4*time.Second, sut.backoff(3))
+	require.Equal(t, 5*time.Second, sut.backoff(4))
+	require.Equal(t, 5*time.Second, sut.backoff(100))
+
+	sut = &RetryPolicy{Backoff: 10 * time.Second, MaxBackoff: 5 * time.Second}
+	require.Equal(t, 5*time.Second, sut.backoff(1))
+
+	sut = &RetryPolicy{}
+	require.Zero(t, sut.backoff(3))
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// prefixWriter is a writer which prefixes every line with a static string
+type prefixWriter struct {
+	mu      sync.Mutex
+	writer  io.Writer
+	prefix  []byte
+	pending []byte
+}
+
+func newPrefixWriter(writer io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{writer: writer, prefix: []byte(prefix)}
+}
+
+// Write writes all complete lines of the provided data including their
+// prefix. Incomplete lines are kept until they get completed or flushed.
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending = append(p.pending, data...)
+	for {
+		i := bytes.IndexByte(p.pending, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.pending[:i+1]); err != nil {
+			return 0, err
+		}
+		p.pending = p.pending[i+1:]
+	}
+	return len(data), nil
+}
+
+// Flush writes the pending incomplete line, if any
+func (p *prefixWriter) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.pending) == 0 {
+		return nil
+	}
+	err := p.writeLine(p.pending)
+	p.pending = nil
+	return err
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	_, err := p.writer.Write(append(append([]byte{}, p.prefix...), line...))
+	return err
+}
+
+// limitedBuffer is a buffer which retains only the last written bytes up to
+// its size. A size less or equal to zero means no limit.
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buffer    bytes.Buffer
+	size      int
+	truncated bool
+}
+
+func newLimitedBuffer(size int) *limitedBuffer {
+	return &limitedBuffer{size: size}
+}
+
+// Write appends the data to the buffer and discards the oldest bytes if the
+// buffer size has been exceeded.
+func (l *limitedBuffer) Write(data []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.size <= 0 {
+		return l.buffer.Write(data)
+	}
+
+	n := len(data)
+	if n >= l.size {
+		l.truncated = l.truncated || n > l.size || l.buffer.Len() > 0
+		l.buffer.Reset()
+		l.buffer.Write(data[n-l.size:])
+		return n, nil
+	}
+
+	if overflow := l.buffer.Len() + n - l.size; overflow > 0 {
+		l.buffer.Next(overflow)
+		l.truncated = true
+	}
+	l.buffer.Write(data)
+	return n, nil
+}
+
+// String returns the buffer content
+func (l *limitedBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buffer.String()
+}
+
+// Truncated returns true if bytes have been discarded from the buffer
+func (l *limitedBuffer) Truncated() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.truncated
+}
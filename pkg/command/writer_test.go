@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	sut := newPrefixWriter(buffer, "> ")
+
+	for _, data := range []string{"a", "b\nc", "\n\nd"} {
+		n, err := sut.Write([]byte(data))
+		require.Nil(t, err)
+		require.Equal(t, len(data), n)
+	}
+	require.Equal(t, "> ab\n> c\n> \n", buffer.String())
+
+	require.Nil(t, sut.Flush())
+	require.Equal(t, "> ab\n> c\n> \n> d", buffer.String())
+
+	require.Nil(t, sut.Flush())
+	require.Equal(t, "> ab\n> c\n> \n> d", buffer.String())
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	for _, tc := range []struct {
+		size      int
+		writes    []string
+		expected  string
+		truncated bool
+	}{
+		{0, []string{"abc", "def"}, "abcdef", false},
+		{6, []string{"abc", "def"}, "abcdef", false},
+		{4, []string{"abc", "def"}, "cdef", true},
+		{2, []string{"abc"}, "bc", true},
+		{3, []string{"abc"}, "abc", false},
+		{3, []string{"a", "bcd"}, "bcd", true},
+	} {
+		sut := newLimitedBuffer(tc.size)
+		for _, data := range tc.writes {
+			n, err := sut.Write([]byte(data))
+			require.Nil(t, err)
+			require.Equal(t, len(data), n)
+		}
+		require.Equal(t, tc.expected, sut.String())
+		require.Equal(t, tc.truncated, sut.Truncated())
+	}
+}
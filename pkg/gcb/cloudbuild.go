@@ -0,0 +1,245 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	cloudbuild "google.golang.org/api/cloudbuild/v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const streamPollInterval = 5 * time.Second
+
+// errListLimit stops listing further pages of builds once the limit is
+// reached
+var errListLimit = errors.New("limit reached")
+
+// CloudBuild is a Client for the Cloud Build API of a GCP project
+type CloudBuild struct {
+	service *cloudbuild.Service
+	storage *storage.Client
+	project string
+}
+
+// NewCloudBuild creates a Client for the project. The storage client is used
+// to read the build logs.
+func NewCloudBuild(service *cloudbuild.Service, storageClient *storage.Client, project string) *CloudBuild {
+	return &CloudBuild{service: service, storage: storageClient, project: project}
+}
+
+// Submit implements Client
+func (c *CloudBuild) Submit(
+	ctx context.Context, config *Config, substitutions map[string]string, diskSizeGB int64,
+) (*Build, error) {
+	build, err := config.cloudBuild()
+	if err != nil {
+		return nil, err
+	}
+	build.Substitutions = substitutions
+	if build.Options == nil {
+		build.Options = &cloudbuild.BuildOptions{}
+	}
+	build.Options.DiskSizeGb = diskSizeGB
+
+	op, err := c.service.Projects.Builds.Create(c.project, build).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating build in project %s", c.project)
+	}
+	metadata := cloudbuild.BuildOperationMetadata{}
+	if err := json.Unmarshal(op.Metadata, &metadata); err != nil {
+		return nil, errors.Wrap(err, "parsing build operation metadata")
+	}
+	if metadata.Build == nil {
+		return nil, errors.Errorf("build operation %s contains no build", op.Name)
+	}
+	return fromCloudBuild(metadata.Build), nil
+}
+
+// List implements Client
+func (c *CloudBuild) List(ctx context.Context, status string, limit int) ([]*Build, error) {
+	call := c.service.Projects.Builds.List(c.project)
+	if limit > 0 {
+		call = call.PageSize(int64(limit))
+	}
+	if status != "" {
+		call = call.Filter(fmt.Sprintf("status=%q", status))
+	}
+	builds := []*Build{}
+	if err := call.Pages(ctx, func(res *cloudbuild.ListBuildsResponse) error {
+		for _, build := range res.Builds {
+			if limit > 0 && len(builds) == limit {
+				return errListLimit
+			}
+			builds = append(builds, fromCloudBuild(build))
+		}
+		if limit > 0 && len(builds) == limit {
+			return errListLimit
+		}
+		return nil
+	}); err != nil && err != errListLimit {
+		return nil, errors.Wrapf(err, "listing builds of project %s", c.project)
+	}
+	return builds, nil
+}
+
+// Stream implements Client by polling the build and its log in the logs
+// bucket like `gcloud builds log --stream` does
+func (c *CloudBuild) Stream(ctx context.Context, id string, writer io.Writer) error {
+	offset := int64(0)
+	for {
+		build, err := c.service.Projects.Builds.Get(c.project, id).Context(ctx).Do()
+		if err != nil {
+			return errors.Wrapf(err, "getting build %s", id)
+		}
+		// The log has to be read once more after the build is done to
+		// get its end
+		done := fromCloudBuild(build).Done()
+		n, err := c.copyLog(ctx, build, offset, writer)
+		if err != nil {
+			return err
+		}
+		offset += n
+		if done {
+			if build.Status != StatusSuccess {
+				return errors.Errorf("build %s finished with status %s", id, build.Status)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(streamPollInterval):
+		}
+	}
+}
+
+// copyLog writes the log of the build starting at the offset and returns the
+// amount of written bytes
+func (c *CloudBuild) copyLog(
+	ctx context.Context, build *cloudbuild.Build, offset int64, writer io.Writer,
+) (int64, error) {
+	bucket := strings.TrimPrefix(build.LogsBucket, "gs://")
+	if bucket == "" {
+		return 0, nil
+	}
+	object := c.storage.Bucket(bucket).Object("log-" + build.Id + ".txt")
+
+	// Requesting a range beyond the end of the object fails, so check the
+	// size first
+	attrs, err := object.Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		logrus.Debugf("Log of build %s does not exist yet", build.Id)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "reading log attributes of build %s", build.Id)
+	}
+	if attrs.Size <= offset {
+		return 0, nil
+	}
+
+	reader, err := object.NewRangeReader(ctx, offset, -1)
+	if err != nil {
+		return 0, errors.Wrapf(err, "reading log of build %s", build.Id)
+	}
+	defer reader.Close()
+	n, err := io.Copy(writer, reader)
+	return n, errors.Wrapf(err, "reading log of build %s", build.Id)
+}
+
+// cloudBuild converts the YAML config into a build of the API, whose JSON
+// field names match the config file
+func (c *Config) cloudBuild() (*cloudbuild.Build, error) {
+	var content interface{}
+	if err := yaml.Unmarshal(c.Content, &content); err != nil {
+		return nil, errors.Wrapf(err, "parsing build config %s", c.Path)
+	}
+	converted, err := jsonCompatible(content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "converting build config %s", c.Path)
+	}
+	data, err := json.Marshal(converted)
+	if err != nil {
+		return nil, errors.Wrapf(err, "converting build config %s", c.Path)
+	}
+
+	build := &cloudbuild.Build{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(build); err != nil {
+		return nil, errors.Wrapf(err, "invalid build config %s", c.Path)
+	}
+	return build, nil
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values produced by
+// the YAML parser into map[string]interface{} ones
+func jsonCompatible(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		res := map[string]interface{}{}
+		for key, item := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, errors.Errorf("non string key %v", key)
+			}
+			converted, err := jsonCompatible(item)
+			if err != nil {
+				return nil, err
+			}
+			res[name] = converted
+		}
+		return res, nil
+	case []interface{}:
+		res := []interface{}{}
+		for _, item := range v {
+			converted, err := jsonCompatible(item)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, converted)
+		}
+		return res, nil
+	}
+	return value, nil
+}
+
+func fromCloudBuild(build *cloudbuild.Build) *Build {
+	res := &Build{
+		ID:     build.Id,
+		Status: build.Status,
+		Tags:   build.Tags,
+		LogURL: build.LogUrl,
+	}
+	if build.StartTime != "" {
+		if start, err := time.Parse(time.RFC3339Nano, build.StartTime); err == nil {
+			res.StartTime = start
+		}
+	}
+	return res
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	cloudbuild "google.golang.org/api/cloudbuild/v1"
+)
+
+// fakeBuildsPageSize is the page size of the fake Cloud Build API if the
+// client does not request one
+const fakeBuildsPageSize = 2
+
+// newFakeCloudBuild serves the builds of the project, newest first, in pages
+// like the Cloud Build API does
+func newFakeCloudBuild(t *testing.T, project string, builds int) (*CloudBuild, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/"+project+"/builds" {
+			http.NotFound(w, r)
+			return
+		}
+		pageSize := fakeBuildsPageSize
+		if size := r.URL.Query().Get("pageSize"); size != "" {
+			pageSize, _ = strconv.Atoi(size) // nolint: errcheck
+		}
+		start, _ := strconv.Atoi(r.URL.Query().Get("pageToken")) // nolint: errcheck
+
+		res := &cloudbuild.ListBuildsResponse{}
+		for i := start; i < builds && i < start+pageSize; i++ {
+			res.Builds = append(res.Builds, &cloudbuild.Build{
+				Id: fmt.Sprintf("build-%d", builds-i), Status: StatusSuccess,
+			})
+		}
+		if start+pageSize < builds {
+			res.NextPageToken = strconv.Itoa(start + pageSize)
+		}
+		require.Nil(t, json.NewEncoder(w).Encode(res))
+	}))
+
+	service, err := cloudbuild.New(server.Client())
+	require.Nil(t, err)
+	service.BasePath = server.URL + "/"
+	return NewCloudBuild(service, nil, project), server.Close
+}
+
+func TestCloudBuildList(t *testing.T) {
+	client, stop := newFakeCloudBuild(t, "kubernetes-release-test", 5)
+	defer stop()
+
+	cases := map[string]struct {
+		limit int
+		want  []string
+	}{
+		"NoLimit":       {limit: 0, want: []string{"build-5", "build-4", "build-3", "build-2", "build-1"}},
+		"NegativeLimit": {limit: -1, want: []string{"build-5", "build-4", "build-3", "build-2", "build-1"}},
+		"Limit":         {limit: 3, want: []string{"build-5", "build-4", "build-3"}},
+		"LimitAbove":    {limit: 10, want: []string{"build-5", "build-4", "build-3", "build-2", "build-1"}},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			builds, err := client.List(context.Background(), StatusSuccess, tc.limit)
+			require.Nil(t, err)
+			ids := []string{}
+			for _, build := range builds {
+				ids = append(ids, build.ID)
+			}
+			require.Equal(t, tc.want, ids)
+		})
+	}
+
+	client.project = "missing"
+	_, err := client.List(context.Background(), "", 0)
+	require.NotNil(t, err)
+}
+
+func TestFakeClientListNoLimit(t *testing.T) {
+	ctx := context.Background()
+	client := NewFakeClient()
+	for i := 0; i < 3; i++ {
+		_, err := client.Submit(ctx, &Config{}, nil, 0)
+		require.Nil(t, err)
+	}
+
+	builds, err := client.List(ctx, "", 0)
+	require.Nil(t, err)
+	require.Len(t, builds, 3)
+	builds, err = client.List(ctx, "", 2)
+	require.Nil(t, err)
+	require.Len(t, builds, 2)
+}
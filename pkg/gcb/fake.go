@@ -0,0 +1,164 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FakeSubmission is a build submitted to the FakeClient
+type FakeSubmission struct {
+	Config        *Config
+	Substitutions map[string]string
+	DiskSizeGB    int64
+}
+
+// FakeClient is an in-memory Client for testing. Submitted builds start as
+// working builds, whose tags are the ones of the config with the
+// substitutions applied.
+type FakeClient struct {
+	mu          sync.Mutex
+	builds      []*Build
+	logs        map[string]string
+	submissions map[string]*FakeSubmission
+}
+
+// NewFakeClient creates a new FakeClient without builds
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		logs:        map[string]string{},
+		submissions: map[string]*FakeSubmission{},
+	}
+}
+
+// Submit implements Client
+func (f *FakeClient) Submit(
+	ctx context.Context, config *Config, substitutions map[string]string, diskSizeGB int64,
+) (*Build, error) {
+	build, err := config.cloudBuild()
+	if err != nil {
+		return nil, err
+	}
+	// Cloud Build rejects builds with missing or unused substitutions
+	for _, name := range config.Substitutions() {
+		if _, ok := substitutions[name]; !ok {
+			return nil, errors.Errorf("substitution %s is not set", name)
+		}
+	}
+	if len(substitutions) != len(config.Substitutions()) {
+		return nil, errors.New("unused substitutions provided")
+	}
+
+	tags := []string{}
+	for _, tag := range build.Tags {
+		tag = substitutionRE.ReplaceAllStringFunc(tag, func(s string) string {
+			return substitutions[substitutionRE.FindStringSubmatch(s)[1]]
+		})
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := fmt.Sprintf("%08d-0000-0000-0000-000000000000", len(f.builds)+1)
+	res := &Build{
+		ID:        id,
+		Status:    StatusWorking,
+		Tags:      tags,
+		StartTime: time.Now(),
+		LogURL:    "https://console.cloud.google.com/gcr/builds/" + id,
+	}
+	f.builds = append(f.builds, res)
+	f.submissions[id] = &FakeSubmission{
+		Config: config, Substitutions: substitutions, DiskSizeGB: diskSizeGB,
+	}
+	copied := *res
+	return &copied, nil
+}
+
+// List implements Client
+func (f *FakeClient) List(ctx context.Context, status string, limit int) ([]*Build, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	builds := []*Build{}
+	for i := len(f.builds) - 1; i >= 0 && (limit <= 0 || len(builds) < limit); i-- {
+		if status == "" || f.builds[i].Status == status {
+			copied := *f.builds[i]
+			builds = append(builds, &copied)
+		}
+	}
+	return builds, nil
+}
+
+// Stream implements Client. It writes the log and fails for running builds,
+// which would never finish.
+func (f *FakeClient) Stream(ctx context.Context, id string, writer io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	build := f.build(id)
+	if build == nil {
+		return errors.Errorf("build %s not found", id)
+	}
+	if _, err := io.Copy(writer, strings.NewReader(f.logs[id])); err != nil {
+		return err
+	}
+	if !build.Done() {
+		return errors.Errorf("build %s is still %s", id, build.Status)
+	}
+	if build.Status != StatusSuccess {
+		return errors.Errorf("build %s finished with status %s", id, build.Status)
+	}
+	return nil
+}
+
+// Finish sets the final status and log of the build
+func (f *FakeClient) Finish(id, status, log string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	build := f.build(id)
+	if build == nil {
+		return errors.Errorf("build %s not found", id)
+	}
+	build.Status = status
+	f.logs[id] = log
+	return nil
+}
+
+// Submission returns how the build has been submitted
+func (f *FakeClient) Submission(id string) (*FakeSubmission, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	submission, ok := f.submissions[id]
+	return submission, ok
+}
+
+func (f *FakeClient) build(id string) *Build {
+	for _, build := range f.builds {
+		if build.ID == id {
+			return build
+		}
+	}
+	return nil
+}
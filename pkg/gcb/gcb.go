@@ -0,0 +1,351 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/release/pkg/release"
+)
+
+const (
+	// DefaultProject is the GCP project running the release builds
+	DefaultProject = "kubernetes-release-test"
+
+	// DefaultReleaseToolRepo is the repository of the release tools used by
+	// the builds
+	DefaultReleaseToolRepo = "https://github.com/kubernetes/release"
+
+	// DefaultReleaseToolBranch is the branch of the release tools used by the
+	// builds
+	DefaultReleaseToolBranch = "master"
+
+	// BuildPointHead is the build point of builds at the head of the branch
+	BuildPointHead = "HEAD"
+
+	// BuildPointGreen is the build point of builds which find the build
+	// version by analyzing the CI job results
+	BuildPointGreen = "find_green_build"
+)
+
+// Build statuses of Cloud Build
+const (
+	StatusQueued    = "QUEUED"
+	StatusWorking   = "WORKING"
+	StatusSuccess   = "SUCCESS"
+	StatusFailure   = "FAILURE"
+	StatusCancelled = "CANCELLED"
+	StatusTimeout   = "TIMEOUT"
+)
+
+// Job is the kind of release build
+type Job string
+
+const (
+	// JobStage builds and stages a release
+	JobStage Job = "stage"
+
+	// JobRelease releases a previously staged build
+	JobRelease Job = "release"
+)
+
+// diskSizes are the disk sizes in GB of the jobs, which have to include the
+// size of the base image
+var diskSizes = map[Job]int64{
+	JobStage:   300,
+	JobRelease: 100,
+}
+
+// Build is a submitted Cloud Build
+type Build struct {
+	// ID is the unique ID of the build
+	ID string
+
+	// Status is the status of the build, like WORKING
+	Status string
+
+	// Tags are the tags of the build describing the job
+	Tags []string
+
+	// StartTime is the time the build started or the zero time for queued
+	// builds
+	StartTime time.Time
+
+	// LogURL is the URL of the build log in the Cloud Console
+	LogURL string
+}
+
+// Done returns true if the build is not queued or running anymore
+func (b *Build) Done() bool {
+	return b.Status != StatusQueued && b.Status != StatusWorking
+}
+
+// Client submits and tracks Cloud Builds
+type Client interface {
+	// Submit submits the build config without source with the substitutions
+	// and returns the queued build
+	Submit(ctx context.Context, config *Config, substitutions map[string]string, diskSizeGB int64) (*Build, error)
+
+	// List returns up to limit builds with the status, newest first. An
+	// empty status lists builds of any status and a limit <= 0 lists all
+	// builds.
+	List(ctx context.Context, status string, limit int) ([]*Build, error)
+
+	// Stream writes the log of the build to the writer until the build is
+	// done
+	Stream(ctx context.Context, id string, writer io.Writer) error
+}
+
+// Config is a Cloud Build config file like gcb/stage/cloudbuild.yaml
+type Config struct {
+	// Path is the path the config has been loaded from
+	Path string
+
+	// Content is the YAML content of the config
+	Content []byte
+}
+
+// ConfigPath returns the path of the config of the job within the release
+// tool repository
+func ConfigPath(toolRoot string, job Job) string {
+	return filepath.Join(toolRoot, "gcb", string(job), "cloudbuild.yaml")
+}
+
+// LoadConfig reads the build config file
+func LoadConfig(path string) (*Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading build config %s", path)
+	}
+	return &Config{Path: path, Content: content}, nil
+}
+
+// substitutionRE matches user defined substitutions like ${_RELEASE_BRANCH}
+var substitutionRE = regexp.MustCompile(`\$\{?(_[A-Z0-9_]+)\}?`)
+
+// Substitutions returns the sorted names of the user defined substitutions
+// referenced by the config
+func (c *Config) Substitutions() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, match := range substitutionRE.FindAllSubmatch(c.Content, -1) {
+		name := string(match[1])
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options are the options of a stage or release job
+type Options struct {
+	// Job is the kind of job to submit
+	Job Job
+
+	// Branch is the branch to stage or release, like release-1.17
+	Branch string
+
+	// BuildVersion is the build to stage or the staged build to release. If
+	// empty, stage jobs find a green build or build at the head of the
+	// branch.
+	BuildVersion string
+
+	// BuildAtHead stages the head of the branch instead of a green build
+	BuildAtHead bool
+
+	// Official stages or releases an official release
+	Official bool
+
+	// RC stages or releases a release candidate
+	RC bool
+
+	// NoMock runs the job in non mock mode
+	NoMock bool
+
+	// GCPUser is the GCP account submitting the job
+	GCPUser string
+
+	// KubeCrossVersion is the version of the kube-cross image to build
+	// with, which is only used by stage jobs
+	KubeCrossVersion string
+
+	// ReleaseToolRepo is the repository of the release tools
+	ReleaseToolRepo string
+
+	// ReleaseToolBranch is the branch of the release tools
+	ReleaseToolBranch string
+}
+
+// Validate checks that the options describe a valid job
+func (o *Options) Validate() error {
+	if o.Job != JobStage && o.Job != JobRelease {
+		return errors.Errorf("unknown job %q", o.Job)
+	}
+	if o.Branch == "" {
+		return errors.New("branch not set")
+	}
+	if o.Official && o.RC {
+		return errors.New("a release cannot be an RC and official")
+	}
+	if o.BuildVersion != "" {
+		if _, err := release.ParseVersion(o.BuildVersion); err != nil {
+			return errors.Wrap(err, "parsing build version")
+		}
+	}
+	switch o.Job {
+	case JobStage:
+		if o.BuildVersion != "" && o.BuildAtHead {
+			return errors.New("a build version cannot be staged at head")
+		}
+		if o.KubeCrossVersion == "" {
+			return errors.New("kube-cross version not set")
+		}
+	case JobRelease:
+		if o.BuildVersion == "" {
+			return errors.New("release jobs need the build version of a staged build")
+		}
+		if o.BuildAtHead {
+			return errors.New("release jobs cannot build at head")
+		}
+	}
+	return nil
+}
+
+// GCPUserTag converts the GCP account into a value valid for build tags and
+// bucket names: the domain of google.com accounts is removed, @ becomes -at-
+// and the first dot becomes a dash like in gcbmgr
+func GCPUserTag(account string) string {
+	tag := strings.TrimSuffix(account, "@google.com")
+	tag = strings.Replace(tag, "@", "-at-", 1)
+	return strings.Replace(tag, ".", "-", 1)
+}
+
+// BuildPoint returns the build point tag of the job, which is the build
+// version, HEAD or find_green_build
+func (o *Options) BuildPoint() string {
+	switch {
+	case o.BuildVersion != "":
+		// + is not allowed in tags
+		return strings.Replace(o.BuildVersion, "+", "-", 1)
+	case o.BuildAtHead:
+		return BuildPointHead
+	}
+	return BuildPointGreen
+}
+
+// allSubstitutions returns the values of all substitutions known by gcbmgr
+func (o *Options) allSubstitutions() map[string]string {
+	flag := func(enabled bool, name string) (tag, arg string) {
+		if enabled {
+			return name, "--" + name
+		}
+		return "", ""
+	}
+	officialTag, official := flag(o.Official, "official")
+	rcTag, rc := flag(o.RC, "rc")
+	noMockTag, noMock := flag(o.NoMock, "nomock")
+	_, buildAtHead := flag(o.BuildAtHead, "build-at-head")
+	buildVersion := ""
+	if o.BuildVersion != "" {
+		buildVersion = "--buildversion=" + o.BuildVersion
+	}
+	repo, branch := o.ReleaseToolRepo, o.ReleaseToolBranch
+	if repo == "" {
+		repo = DefaultReleaseToolRepo
+	}
+	if branch == "" {
+		branch = DefaultReleaseToolBranch
+	}
+
+	substitutions := map[string]string{
+		"_OFFICIAL_TAG":        officialTag,
+		"_RC_TAG":              rcTag,
+		"_NOMOCK_TAG":          noMockTag,
+		"_BUILD_POINT":         o.BuildPoint(),
+		"_GCP_USER_TAG":        GCPUserTag(o.GCPUser),
+		"_RELEASE_BRANCH":      o.Branch,
+		"_OFFICIAL":            official,
+		"_RC":                  rc,
+		"_NOMOCK":              noMock,
+		"_BUILDVERSION":        buildVersion,
+		"_RELEASE_TOOL_REPO":   repo,
+		"_RELEASE_TOOL_BRANCH": branch,
+	}
+	if o.Job == JobStage {
+		substitutions["_BUILD_AT_HEAD"] = buildAtHead
+		substitutions["_KUBE_CROSS_VERSION"] = o.KubeCrossVersion
+	}
+	return substitutions
+}
+
+// Substitutions returns the substitutions for the job, which are exactly the
+// ones referenced by the config since Cloud Build rejects unused ones
+func Substitutions(config *Config, opts *Options) (map[string]string, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	all := opts.allSubstitutions()
+	substitutions := map[string]string{}
+	for _, name := range config.Substitutions() {
+		value, ok := all[name]
+		if !ok {
+			return nil, errors.Errorf(
+				"substitution %s of %s is unknown for %s jobs", name, config.Path, opts.Job,
+			)
+		}
+		substitutions[name] = value
+	}
+	return substitutions, nil
+}
+
+// Submit loads the config of the job from the release tool repository and
+// submits it with the substitutions built from the options
+func Submit(ctx context.Context, client Client, toolRoot string, opts *Options) (*Build, error) {
+	config, err := LoadConfig(ConfigPath(toolRoot, opts.Job))
+	if err != nil {
+		return nil, err
+	}
+	substitutions, err := Substitutions(config, opts)
+	if err != nil {
+		return nil, err
+	}
+	build, err := client.Submit(ctx, config, substitutions, diskSizes[opts.Job])
+	return build, errors.Wrapf(err, "submitting %s job", opts.Job)
+}
+
+// Latest returns the most recent build with the status
+func Latest(ctx context.Context, client Client, status string) (*Build, error) {
+	builds, err := client.List(ctx, status, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(builds) == 0 {
+		return nil, errors.Errorf("no %s builds found", strings.ToLower(status))
+	}
+	return builds[0], nil
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// toolRoot is the root of this repository containing the gcb configs
+const toolRoot = "../.."
+
+func TestConfigs(t *testing.T) {
+	cases := map[string]struct {
+		job           Job
+		steps         int
+		substitutions []string
+	}{
+		"Stage": {
+			job:   JobStage,
+			steps: 5,
+			substitutions: []string{
+				"_BUILDVERSION", "_BUILD_AT_HEAD", "_BUILD_POINT", "_GCP_USER_TAG",
+				"_KUBE_CROSS_VERSION", "_NOMOCK", "_NOMOCK_TAG", "_OFFICIAL",
+				"_OFFICIAL_TAG", "_RC", "_RC_TAG", "_RELEASE_BRANCH",
+				"_RELEASE_TOOL_BRANCH", "_RELEASE_TOOL_REPO",
+			},
+		},
+		"Release": {
+			job:   JobRelease,
+			steps: 2,
+			substitutions: []string{
+				"_BUILDVERSION", "_BUILD_POINT", "_GCP_USER_TAG", "_NOMOCK",
+				"_NOMOCK_TAG", "_OFFICIAL", "_OFFICIAL_TAG", "_RC", "_RC_TAG",
+				"_RELEASE_BRANCH", "_RELEASE_TOOL_BRANCH", "_RELEASE_TOOL_REPO",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			config, err := LoadConfig(ConfigPath(toolRoot, tc.job))
+			require.Nil(t, err)
+			require.Equal(t, tc.substitutions, config.Substitutions())
+
+			build, err := config.cloudBuild()
+			require.Nil(t, err)
+			require.Len(t, build.Steps, tc.steps)
+			require.Len(t, build.Secrets, 1)
+			require.Equal(t, "14400s", build.Timeout)
+			require.Equal(t, "N1_HIGHCPU_32", build.Options.MachineType)
+		})
+	}
+
+	_, err := (&Config{Path: "invalid", Content: []byte("steps: {")}).cloudBuild()
+	require.NotNil(t, err)
+	_, err = (&Config{Path: "unknown", Content: []byte("stages: []")}).cloudBuild()
+	require.NotNil(t, err)
+	_, err = LoadConfig(ConfigPath(toolRoot, "missing"))
+	require.NotNil(t, err)
+}
+
+func TestSubstitutions(t *testing.T) {
+	cases := map[string]struct {
+		opts      Options
+		want      map[string]string
+		shouldErr bool
+	}{
+		"StageGreenBuild": {
+			opts: Options{
+				Job: JobStage, Branch: "release-1.17", Official: true, GCPUser: "jane.doe@google.com",
+				KubeCrossVersion: "v1.13.4-1",
+			},
+			want: map[string]string{
+				"_BUILDVERSION":        "",
+				"_BUILD_AT_HEAD":       "",
+				"_BUILD_POINT":         "find_green_build",
+				"_GCP_USER_TAG":        "jane-doe",
+				"_KUBE_CROSS_VERSION":  "v1.13.4-1",
+				"_NOMOCK":              "",
+				"_NOMOCK_TAG":          "",
+				"_OFFICIAL":            "--official",
+				"_OFFICIAL_TAG":        "official",
+				"_RC":                  "",
+				"_RC_TAG":              "",
+				"_RELEASE_BRANCH":      "release-1.17",
+				"_RELEASE_TOOL_BRANCH": "master",
+				"_RELEASE_TOOL_REPO":   "https://github.com/kubernetes/release",
+			},
+		},
+		"StageAtHead": {
+			opts: Options{
+				Job: JobStage, Branch: "master", BuildAtHead: true, RC: true, NoMock: true,
+				GCPUser: "someone@example.com", KubeCrossVersion: "v1.13.4-1",
+				ReleaseToolRepo: "https://github.com/someone/release", ReleaseToolBranch: "fix",
+			},
+			want: map[string]string{
+				"_BUILDVERSION":        "",
+				"_BUILD_AT_HEAD":       "--build-at-head",
+				"_BUILD_POINT":         "HEAD",
+				"_GCP_USER_TAG":        "someone-at-example-com",
+				"_KUBE_CROSS_VERSION":  "v1.13.4-1",
+				"_NOMOCK":              "--nomock",
+				"_NOMOCK_TAG":          "nomock",
+				"_OFFICIAL":            "",
+				"_OFFICIAL_TAG":        "",
+				"_RC":                  "--rc",
+				"_RC_TAG":              "rc",
+				"_RELEASE_BRANCH":      "master",
+				"_RELEASE_TOOL_BRANCH": "fix",
+				"_RELEASE_TOOL_REPO":   "https://github.com/someone/release",
+			},
+		},
+		"Release": {
+			opts: Options{
+				Job: JobRelease, Branch: "release-1.17", BuildVersion: "v1.17.1-beta.0.20+cce11c6a185279",
+				GCPUser: "jane@google.com",
+			},
+			want: map[string]string{
+				"_BUILDVERSION":        "--buildversion=v1.17.1-beta.0.20+cce11c6a185279",
+				"_BUILD_POINT":         "v1.17.1-beta.0.20-cce11c6a185279",
+				"_GCP_USER_TAG":        "jane",
+				"_NOMOCK":              "",
+				"_NOMOCK_TAG":          "",
+				"_OFFICIAL":            "",
+				"_OFFICIAL_TAG":        "",
+				"_RC":                  "",
+				"_RC_TAG":              "",
+				"_RELEASE_BRANCH":      "release-1.17",
+				"_RELEASE_TOOL_BRANCH": "master",
+				"_RELEASE_TOOL_REPO":   "https://github.com/kubernetes/release",
+			},
+		},
+		"ReleaseWithoutBuildVersion": {
+			opts:      Options{Job: JobRelease, Branch: "release-1.17"},
+			shouldErr: true,
+		},
+		"OfficialRC": {
+			opts: Options{
+				Job: JobStage, Branch: "release-1.17", Official: true, RC: true, KubeCrossVersion: "v1.13.4-1",
+			},
+			shouldErr: true,
+		},
+		"NoBranch": {
+			opts:      Options{Job: JobStage, KubeCrossVersion: "v1.13.4-1"},
+			shouldErr: true,
+		},
+		"InvalidBuildVersion": {
+			opts:      Options{Job: JobRelease, Branch: "release-1.17", BuildVersion: "1.17"},
+			shouldErr: true,
+		},
+		"NoKubeCrossVersion": {
+			opts:      Options{Job: JobStage, Branch: "release-1.17"},
+			shouldErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			config, err := LoadConfig(ConfigPath(toolRoot, tc.opts.Job))
+			require.Nil(t, err)
+			res, err := Substitutions(config, &tc.opts)
+			require.Equal(t, tc.shouldErr, err != nil, err)
+			if !tc.shouldErr {
+				require.Equal(t, tc.want, res)
+			}
+		})
+	}
+
+	// Substitutions unknown to gcbmgr are rejected
+	_, err := Substitutions(
+		&Config{Path: "custom", Content: []byte("tags: [${_CUSTOM}]")},
+		&Options{Job: JobRelease, Branch: "master", BuildVersion: "v1.18.0-alpha.1.1+abcdef"},
+	)
+	require.NotNil(t, err)
+}
+
+func TestSubmitAndStream(t *testing.T) {
+	ctx := context.Background()
+	client := NewFakeClient()
+
+	stage, err := Submit(ctx, client, toolRoot, &Options{
+		Job: JobStage, Branch: "release-1.17", Official: true, GCPUser: "jane@google.com",
+		KubeCrossVersion: "v1.13.4-1",
+	})
+	require.Nil(t, err)
+	require.Equal(t, StatusWorking, stage.Status)
+	require.Equal(t, []string{"jane", "release-1.17", "find_green_build", "official", "STAGE"}, stage.Tags)
+	submission, ok := client.Submission(stage.ID)
+	require.True(t, ok)
+	require.EqualValues(t, 300, submission.DiskSizeGB)
+
+	release, err := Submit(ctx, client, toolRoot, &Options{
+		Job: JobRelease, Branch: "release-1.17", Official: true, NoMock: true, GCPUser: "jane@google.com",
+		BuildVersion: "v1.17.1-beta.0.20+cce11c6a185279",
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		"jane", "release-1.17", "v1.17.1-beta.0.20-cce11c6a185279", "nomock", "official", "RELEASE",
+	}, release.Tags)
+	submission, ok = client.Submission(release.ID)
+	require.True(t, ok)
+	require.EqualValues(t, 100, submission.DiskSizeGB)
+
+	// Invalid options are not submitted
+	_, err = Submit(ctx, client, toolRoot, &Options{Job: JobRelease, Branch: "release-1.17"})
+	require.NotNil(t, err)
+
+	builds, err := client.List(ctx, "", 5)
+	require.Nil(t, err)
+	require.Len(t, builds, 2)
+	require.Equal(t, release.ID, builds[0].ID)
+
+	require.Nil(t, client.Finish(stage.ID, StatusSuccess, "staged\n"))
+	latest, err := Latest(ctx, client, StatusWorking)
+	require.Nil(t, err)
+	require.Equal(t, release.ID, latest.ID)
+	latest, err = Latest(ctx, client, StatusSuccess)
+	require.Nil(t, err)
+	require.Equal(t, stage.ID, latest.ID)
+	_, err = Latest(ctx, client, StatusFailure)
+	require.NotNil(t, err)
+
+	log := &bytes.Buffer{}
+	require.Nil(t, client.Stream(ctx, stage.ID, log))
+	require.Equal(t, "staged\n", log.String())
+
+	require.Nil(t, client.Finish(release.ID, StatusFailure, "failed\n"))
+	require.NotNil(t, client.Stream(ctx, release.ID, log))
+	require.NotNil(t, client.Stream(ctx, "missing", log))
+}
+
+func TestGCPUserTag(t *testing.T) {
+	require.Equal(t, "jane", GCPUserTag("jane@google.com"))
+	require.Equal(t, "jane-doe", GCPUserTag("jane.doe@google.com"))
+	require.Equal(t, "jane-at-example-com", GCPUserTag("jane@example.com"))
+}
@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/pkg/errors"
@@ -49,6 +50,28 @@ const (
 	tagPrefix             = "v"
 )
 
+// networkRetryPolicy is used for all git commands and go-git operations which
+// access the network. Only timeouts and failures which indicate an
+// intermittent network issue are retried.
+var networkRetryPolicy = &command.RetryPolicy{
+	MaxAttempts:   3,
+	Backoff:       5 * time.Second,
+	MaxBackoff:    30 * time.Second,
+	RetryTimeouts: true,
+	StderrPatterns: []*regexp.Regexp{
+		regexp.MustCompile(`(?i)could not resolve host`),
+		regexp.MustCompile(`(?i)connection (timed out|reset|refused)`),
+		regexp.MustCompile(`(?i)operation timed out`),
+		regexp.MustCompile(`(?i)the remote end hung up unexpectedly`),
+		regexp.MustCompile(`(?i)early EOF`),
+		regexp.MustCompile(`(?i)RPC failed`),
+		regexp.MustCompile(`(?i)unable to access`),
+		regexp.MustCompile(`(?i)could not read from remote repository`),
+		regexp.MustCompile(`(?i)(internal server error|bad gateway|service unavailable)`),
+		regexp.MustCompile(`(?i)(no such host|i/o timeout|TLS handshake timeout|unexpected EOF)`),
+	},
+}
+
 // Wrapper type for a Kubernetes repository instance
 type Repo struct {
 	inner  *git.Repository
@@ -129,9 +152,18 @@ func CloneOrOpenRepo(repoPath, url string, useSSH bool) (*Repo, error) {
 		targetDir = t
 	}
 
-	r, err := git.PlainClone(targetDir, false, &git.CloneOptions{
-		URL:      url,
-		Progress: os.Stdout,
+	var r *git.Repository
+	ctx := command.DefaultContext()
+	err := networkRetryPolicy.Do(ctx, "clone "+url, func() (err error) {
+		r, err = git.PlainCloneContext(ctx, targetDir, false, &git.CloneOptions{
+			URL:      url,
+			Progress: os.Stdout,
+		})
+		if err != nil {
+			// A partial clone would fail the next attempt
+			os.RemoveAll(targetDir)
+		}
+		return err
 	})
 	if err != nil {
 		return nil, err
@@ -156,13 +188,20 @@ func updateRepo(repoPath string, useSSH bool) (*Repo, error) {
 		}
 	}
 
-	err = r.Fetch(&git.FetchOptions{
-		Auth:     auth,
-		Force:    true,
-		Progress: os.Stdout,
-		RefSpecs: []config.RefSpec{"refs/*:refs/*"},
+	ctx := command.DefaultContext()
+	err = networkRetryPolicy.Do(ctx, "fetch "+repoPath, func() error {
+		err := r.FetchContext(ctx, &git.FetchOptions{
+			Auth:     auth,
+			Force:    true,
+			Progress: os.Stdout,
+			RefSpecs: []config.RefSpec{"refs/*:refs/*"},
+		})
+		if err == git.NoErrAlreadyUpToDate {
+			return nil
+		}
+		return err
 	})
-	if err != nil && err != git.NoErrAlreadyUpToDate {
+	if err != nil {
 		return nil, err
 	}
 	return &Repo{inner: r, auth: auth, dir: repoPath}, nil
@@ -316,7 +355,13 @@ func (r *Repo) HasRemoteBranch(branch string) error {
 	}
 
 	// We can then use every Remote functions to retrieve wanted information
-	refs, err := remote.List(&git.ListOptions{Auth: r.auth})
+	var refs []*plumbing.Reference
+	err = networkRetryPolicy.Do(
+		command.DefaultContext(), "list remote references", func() (err error) {
+			refs, err = remote.List(&git.ListOptions{Auth: r.auth})
+			return err
+		},
+	)
 	if err != nil {
 		logrus.Warn("Could not list references on the remote repository.")
 		return err
@@ -431,14 +476,14 @@ func (r *Repo) Merge(from string) error {
 // Push does push the specified branch to the default remote, but only if the
 // repository is not in dry run mode
 func (r *Repo) Push(remoteBranch string) error {
-	args := []string{"push"}
+	cmd := command.NewWithWorkDir(
+		r.Dir(), gitExecutable, "push", DefaultRemote, remoteBranch,
+	).Mutating().WithRetry(networkRetryPolicy)
 	if r.dryRun {
 		logrus.Infof("Won't push due to dry run repository")
-		args = append(args, "--dry-run")
+		cmd.WithDryRunPolicy(command.DryRunMutating)
 	}
-	args = append(args, DefaultRemote, remoteBranch)
-
-	return command.NewWithWorkDir(r.Dir(), gitExecutable, args...).RunSuccess()
+	return cmd.RunSuccess()
 }
 
 // Head retrieves the current repository HEAD as a string
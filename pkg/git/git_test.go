@@ -343,6 +343,18 @@ func TestSuccessPush(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestSuccessPushDryRun(t *testing.T) {
+	testRepo := newTestRepo(t)
+	defer testRepo.cleanup(t)
+	command.ResetDryRunSummary()
+
+	testRepo.sut.SetDry()
+	err := testRepo.sut.Push("wrong")
+	require.Nil(t, err)
+	require.Len(t, command.DryRunSummary(), 1)
+	require.Contains(t, command.DryRunSummary()[0], "git push origin wrong")
+}
+
 func TestFailurePush(t *testing.T) {
 	testRepo := newTestRepo(t)
 	defer testRepo.cleanup(t)
@@ -401,3 +413,60 @@ func TestFailureLatestPatchToPatchWrongBranch(t *testing.T) {
 	require.Empty(t, start)
 	require.Empty(t, end)
 }
+
+func TestSuccessLatestTagForBranchReplay(t *testing.T) {
+	command.SetDefaultExecutor(command.NewReplayer(
+		&command.Record{
+			Args:   [][]string{{"git", "rev-list", "release-1.16", "--tags", "--max-count=1"}},
+			Stdout: "e9a3b9e1f2b6e5d1c7b4a0f1e8d2c3b4a5f6e7d8\n",
+		},
+		&command.Record{
+			Args:   [][]string{{"git", "describe", "--abbrev=0", "--tags", "e9a3b9e1f2b6e5d1c7b4a0f1e8d2c3b4a5f6e7d8"}},
+			Stdout: "v1.16.3\n",
+		},
+	))
+	defer command.SetDefaultExecutor(command.NewLocalExecutor())
+
+	sut := &Repo{dir: "/not/existing"}
+	version, err := sut.latestTagForBranch("release-1.16")
+	require.Nil(t, err)
+	require.Equal(t, "1.16.3", version.String())
+}
+
+func TestFailureDescribeTagReplay(t *testing.T) {
+	command.SetDefaultExecutor(command.NewReplayer(
+		&command.Record{
+			Args:      [][]string{{"git", "describe", "--abbrev=0", "--tags", "wrong"}},
+			Stderr:    "fatal: Not a valid object name wrong\n",
+			ExitCodes: []int{128},
+		},
+	))
+	defer command.SetDefaultExecutor(command.NewLocalExecutor())
+
+	sut := &Repo{dir: "/not/existing"}
+	_, err := sut.DescribeTag("wrong")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "Not a valid object name")
+}
+
+func TestSuccessNetworkRetryPolicy(t *testing.T) {
+	for _, stderr := range []string{
+		"fatal: unable to access 'https://github.com/kubernetes/kubernetes/': Could not resolve host: github.com",
+		"ssh: connect to host github.com port 22: Connection timed out",
+		"fatal: the remote end hung up unexpectedly",
+		"error: RPC failed; curl 56 GnuTLS recv error (-54): Error in the pull function.",
+	} {
+		res, err := command.New("sh", "-c", "echo '"+stderr+"' >&2; exit 128").
+			RunSilent()
+		require.Nil(t, err)
+		require.True(t, networkRetryPolicy.ShouldRetry(res), stderr)
+	}
+}
+
+func TestFailureNetworkRetryPolicy(t *testing.T) {
+	res, err := command.New(
+		"sh", "-c", "echo 'error: src refspec wrong does not match any' >&2; exit 1",
+	).RunSilent()
+	require.Nil(t, err)
+	require.False(t, networkRetryPolicy.ShouldRetry(res))
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package object
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/release/pkg/command"
+)
+
+// DryRunStore is a Store which follows the global dry run policy of the
+// command package for all modifications of the wrapped store. Skipped
+// modifications are logged and added to the dry run summary. They get
+// applied to a temporary local overlay instead, which all reads take into
+// account, so that written objects can be validated like without dry run.
+// ACL and metadata changes of objects which only exist in the wrapped store
+// are not reflected by the overlay.
+type DryRunStore struct {
+	store   Store
+	overlay *Local
+}
+
+// NewDryRunStore creates a new DryRunStore for the store. It has to be
+// closed to remove the overlay.
+func NewDryRunStore(store Store) (*DryRunStore, error) {
+	dir, err := ioutil.TempDir("", "dry-run-store-")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating dry run overlay directory")
+	}
+	overlay, err := NewLocal(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &DryRunStore{store: store, overlay: overlay}, nil
+}
+
+// Close removes the overlay of the store
+func (d *DryRunStore) Close() error {
+	return errors.Wrap(os.RemoveAll(d.overlay.Root()), "removing dry run overlay")
+}
+
+// String returns the representation of the wrapped store
+func (d *DryRunStore) String() string {
+	return d.store.String()
+}
+
+// List returns the attributes of all objects of the wrapped store and the
+// overlay with the provided prefix
+func (d *DryRunStore) List(ctx context.Context, prefix string) ([]*Attrs, error) {
+	objects, err := d.store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	overlayObjects, err := d.overlay.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*Attrs{}
+	for _, o := range append(objects, overlayObjects...) {
+		byName[o.Name] = o
+	}
+	res := []*Attrs{}
+	for _, o := range byName {
+		res = append(res, o)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// Stat returns the attributes of the object within the overlay or the
+// wrapped store
+func (d *DryRunStore) Stat(ctx context.Context, object string) (*Attrs, error) {
+	attrs, err := d.overlay.Stat(ctx, object)
+	if IsNotExist(err) {
+		return d.store.Stat(ctx, object)
+	}
+	return attrs, err
+}
+
+// Upload writes the content of the reader to the object
+func (d *DryRunStore) Upload(ctx context.Context, object string, reader io.Reader) error {
+	if !command.SkipMutation(fmt.Sprintf("upload %s/%s", d, object)) {
+		return d.store.Upload(ctx, object, reader)
+	}
+	return d.overlay.Upload(ctx, object, reader)
+}
+
+// Download writes the content of the object within the overlay or the wrapped
+// store to the writer
+func (d *DryRunStore) Download(ctx context.Context, object string, writer io.Writer) error {
+	if _, err := d.overlay.Stat(ctx, object); err == nil {
+		return d.overlay.Download(ctx, object, writer)
+	}
+	return d.store.Download(ctx, object, writer)
+}
+
+// Copy copies the src object to the dst object
+func (d *DryRunStore) Copy(ctx context.Context, src, dst string) error {
+	if !command.SkipMutation(fmt.Sprintf("copy %s/%s to %s/%s", d, src, d, dst)) {
+		return d.store.Copy(ctx, src, dst)
+	}
+	if _, err := d.overlay.Stat(ctx, src); err == nil {
+		return d.overlay.Copy(ctx, src, dst)
+	}
+
+	attrs, err := d.store.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(d.store.Download(ctx, src, writer))
+	}()
+	err = d.overlay.Upload(ctx, dst, reader)
+	// Unblocks the download if the upload failed
+	reader.Close() // nolint: errcheck
+	if err != nil {
+		return err
+	}
+	return d.overlay.SetMetadata(ctx, dst, &attrs.Metadata)
+}
+
+// SetACL applies the access control to the object
+func (d *DryRunStore) SetACL(ctx context.Context, object string, acl ACL) error {
+	if !command.SkipMutation(fmt.Sprintf("set %s ACL of %s/%s", acl, d, object)) {
+		return d.store.SetACL(ctx, object, acl)
+	}
+	if _, err := d.overlay.Stat(ctx, object); err == nil {
+		return d.overlay.SetACL(ctx, object, acl)
+	}
+	_, err := d.store.Stat(ctx, object)
+	return err
+}
+
+// SetMetadata replaces the metadata of the object
+func (d *DryRunStore) SetMetadata(ctx context.Context, object string, metadata *Metadata) error {
+	if !command.SkipMutation(fmt.Sprintf("set metadata of %s/%s", d, object)) {
+		return d.store.SetMetadata(ctx, object, metadata)
+	}
+	if _, err := d.overlay.Stat(ctx, object); err == nil {
+		return d.overlay.SetMetadata(ctx, object, metadata)
+	}
+	_, err := d.store.Stat(ctx, object)
+	return err
+}
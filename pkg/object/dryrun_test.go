@@ -0,0 +1,103 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package object
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/release/pkg/command"
+)
+
+func newDryRunStore(t *testing.T) (*DryRunStore, *Local, func()) {
+	store := newLocal(t)
+	sut, err := NewDryRunStore(store)
+	require.Nil(t, err)
+	return sut, store, func() {
+		require.Nil(t, sut.Close())
+		os.RemoveAll(filepath.Dir(store.Root()))
+	}
+}
+
+func TestSuccessDryRunStoreMutating(t *testing.T) {
+	ctx := context.Background()
+	sut, store, cleanup := newDryRunStore(t)
+	defer cleanup()
+	require.Nil(t, WriteString(ctx, store, "ci/latest.txt", "v1.18.0"))
+	require.Nil(t, WriteString(ctx, store, "ci/v1.18.0/kubernetes.tar.gz", "kubernetes"))
+
+	command.ResetDryRunSummary()
+	command.SetGlobalDryRunPolicy(command.DryRunMutating)
+	defer command.SetGlobalDryRunPolicy(command.DryRunDisabled)
+
+	require.Nil(t, WriteString(ctx, sut, "ci/latest.txt", "v1.18.1"))
+	require.Nil(t, WriteString(ctx, sut, "ci/v1.18.1/kubernetes.tar.gz", "kubernetes"))
+	require.Nil(t, sut.SetMetadata(ctx, "ci/latest.txt", &Metadata{ContentType: "text/plain"}))
+	require.Nil(t, sut.SetACL(ctx, "ci/v1.18.0/kubernetes.tar.gz", ACLPublicRead))
+	require.Nil(t, sut.Copy(ctx, "ci/v1.18.0/kubernetes.tar.gz", "release/v1.18.0/kubernetes.tar.gz"))
+	require.True(t, IsNotExist(sut.SetACL(ctx, "missing", ACLPublicRead)))
+	require.Len(t, command.DryRunSummary(), 6)
+
+	// The wrapped store has not been modified
+	content, err := ReadString(ctx, store, "ci/latest.txt")
+	require.Nil(t, err)
+	require.Equal(t, "v1.18.0", content)
+	objects, err := store.List(ctx, "")
+	require.Nil(t, err)
+	require.Equal(t, []string{"ci/latest.txt", "ci/v1.18.0/kubernetes.tar.gz"}, names(objects))
+	attrs, err := store.Stat(ctx, "ci/v1.18.0/kubernetes.tar.gz")
+	require.Nil(t, err)
+	require.False(t, attrs.Public)
+
+	// Reads take the skipped modifications into account
+	content, err = ReadString(ctx, sut, "ci/latest.txt")
+	require.Nil(t, err)
+	require.Equal(t, "v1.18.1", content)
+	attrs, err = sut.Stat(ctx, "ci/latest.txt")
+	require.Nil(t, err)
+	require.Equal(t, "text/plain", attrs.ContentType)
+	content, err = ReadString(ctx, sut, "release/v1.18.0/kubernetes.tar.gz")
+	require.Nil(t, err)
+	require.Equal(t, "kubernetes", content)
+	objects, err = sut.List(ctx, "ci/")
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		"ci/latest.txt", "ci/v1.18.0/kubernetes.tar.gz", "ci/v1.18.1/kubernetes.tar.gz",
+	}, names(objects))
+}
+
+func TestSuccessDryRunStoreDisabled(t *testing.T) {
+	ctx := context.Background()
+	sut, store, cleanup := newDryRunStore(t)
+	defer cleanup()
+
+	command.ResetDryRunSummary()
+	require.Nil(t, WriteString(ctx, sut, "ci/latest.txt", "v1.18.1"))
+	require.Nil(t, sut.SetACL(ctx, "ci/latest.txt", ACLPublicRead))
+	require.Empty(t, command.DryRunSummary())
+
+	attrs, err := store.Stat(ctx, "ci/latest.txt")
+	require.Nil(t, err)
+	require.True(t, attrs.Public)
+	content, err := ReadString(ctx, store, "ci/latest.txt")
+	require.Nil(t, err)
+	require.Equal(t, "v1.18.1", content)
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package object
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+)
+
+// GCS is a Store backed by a Google Cloud Storage bucket
+type GCS struct {
+	name   string
+	bucket *storage.BucketHandle
+}
+
+// NewGCS creates a new GCS store for the bucket with the provided name
+func NewGCS(client *storage.Client, bucket string) *GCS {
+	return &GCS{name: bucket, bucket: client.Bucket(bucket)}
+}
+
+// String returns the gs:// URL of the bucket
+func (g *GCS) String() string {
+	return "gs://" + g.name
+}
+
+// BucketPolicyOnly returns true if the bucket uses bucket level IAM policies
+// only, which means that object ACLs cannot be set.
+func (g *GCS) BucketPolicyOnly(ctx context.Context) (bool, error) {
+	attrs, err := g.bucket.Attrs(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "getting attributes of %s", g)
+	}
+	return attrs.BucketPolicyOnly.Enabled, nil
+}
+
+// List returns the attributes of all objects with the provided prefix
+func (g *GCS) List(ctx context.Context, prefix string) ([]*Attrs, error) {
+	res := []*Attrs{}
+	it := g.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing %s/%s", g, prefix)
+		}
+		res = append(res, fromGCSAttrs(attrs))
+	}
+	return res, nil
+}
+
+// Stat returns the attributes of the object
+func (g *GCS) Stat(ctx context.Context, object string) (*Attrs, error) {
+	attrs, err := g.bucket.Object(object).Attrs(ctx)
+	if err != nil {
+		return nil, g.wrap(err, object)
+	}
+	return fromGCSAttrs(attrs), nil
+}
+
+// Upload writes the content of the reader to the object. No ACL is set,
+// which means that the default object ACL of the bucket applies. The object
+// is only created if the whole content has been written.
+func (g *GCS) Upload(ctx context.Context, object string, reader io.Reader) error {
+	// Closing the writer would commit the partial content, while canceling
+	// the context aborts the upload
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	writer := g.bucket.Object(object).NewWriter(ctx)
+	if _, err := io.Copy(writer, reader); err != nil {
+		cancel()
+		writer.Close()
+		return errors.Wrapf(err, "writing %s/%s", g, object)
+	}
+	return errors.Wrapf(writer.Close(), "writing %s/%s", g, object)
+}
+
+// Download writes the content of the object to the writer
+func (g *GCS) Download(ctx context.Context, object string, writer io.Writer) error {
+	reader, err := g.bucket.Object(object).NewReader(ctx)
+	if err != nil {
+		return g.wrap(err, object)
+	}
+	defer reader.Close()
+	_, err = io.Copy(writer, reader)
+	return errors.Wrapf(err, "reading %s/%s", g, object)
+}
+
+// Copy copies the src object to the dst object within the bucket
+func (g *GCS) Copy(ctx context.Context, src, dst string) error {
+	_, err := g.bucket.Object(dst).CopierFrom(g.bucket.Object(src)).Run(ctx)
+	return g.wrap(err, src)
+}
+
+// SetACL applies the access control to the object
+func (g *GCS) SetACL(ctx context.Context, object string, acl ACL) error {
+	handle := g.bucket.Object(object).ACL()
+	var err error
+	if acl == ACLPublicRead {
+		err = handle.Set(ctx, storage.AllUsers, storage.RoleReader)
+	} else {
+		err = handle.Delete(ctx, storage.AllUsers)
+	}
+	return g.wrap(err, object)
+}
+
+// SetMetadata replaces the metadata of the object
+func (g *GCS) SetMetadata(ctx context.Context, object string, metadata *Metadata) error {
+	custom := metadata.Custom
+	if custom == nil {
+		// An empty map deletes all existing custom metadata
+		custom = map[string]string{}
+	}
+	_, err := g.bucket.Object(object).Update(ctx, storage.ObjectAttrsToUpdate{
+		ContentType:  metadata.ContentType,
+		CacheControl: metadata.CacheControl,
+		Metadata:     custom,
+	})
+	return g.wrap(err, object)
+}
+
+// wrap converts storage.ErrObjectNotExist into ErrNotExist and adds the
+// object to all other errors
+func (g *GCS) wrap(err error, object string) error {
+	if err == nil {
+		return nil
+	}
+	if err == storage.ErrObjectNotExist {
+		return errors.Wrapf(ErrNotExist, "%s/%s", g, object)
+	}
+	return errors.Wrapf(err, "%s/%s", g, object)
+}
+
+func fromGCSAttrs(attrs *storage.ObjectAttrs) *Attrs {
+	public := false
+	for _, rule := range attrs.ACL {
+		if rule.Entity == storage.AllUsers && rule.Role == storage.RoleReader {
+			public = true
+		}
+	}
+	return &Attrs{
+		Metadata: Metadata{
+			ContentType:  attrs.ContentType,
+			CacheControl: attrs.CacheControl,
+			Custom:       attrs.Metadata,
+		},
+		Name:    attrs.Name,
+		Size:    attrs.Size,
+		CRC32C:  attrs.CRC32C,
+		Updated: attrs.Updated,
+		Public:  public,
+	}
+}
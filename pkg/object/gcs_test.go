@@ -0,0 +1,103 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package object
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+// fakeGCS records the uploads which reached the JSON API of a bucket
+type fakeGCS struct {
+	mu      sync.Mutex
+	uploads []string
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("uploadType") == "" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.uploads = append(f.uploads, string(body))
+	f.mu.Unlock()
+	fmt.Fprint(w, `{"bucket": "bucket", "name": "object"}`)
+}
+
+func newGCS(t *testing.T, handler http.Handler) (*GCS, func()) {
+	server := httptest.NewServer(handler)
+	client, err := storage.NewClient(
+		context.Background(),
+		option.WithEndpoint(server.URL+"/storage/v1/"),
+		option.WithHTTPClient(server.Client()),
+	)
+	require.Nil(t, err)
+	return NewGCS(client, "bucket"), server.Close
+}
+
+// failingReader returns its content followed by an error instead of EOF
+type failingReader struct {
+	reader io.Reader
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.reader.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestSuccessGCSUpload(t *testing.T) {
+	fake := &fakeGCS{}
+	store, cleanup := newGCS(t, fake)
+	defer cleanup()
+
+	require.Nil(t, store.Upload(context.Background(), "object", strings.NewReader("v1.18.0")))
+	require.Len(t, fake.uploads, 1)
+	require.Contains(t, fake.uploads[0], "v1.18.0")
+}
+
+func TestFailureGCSUploadReadError(t *testing.T) {
+	fake := &fakeGCS{}
+	store, cleanup := newGCS(t, fake)
+	defer cleanup()
+
+	err := store.Upload(context.Background(), "object", &failingReader{strings.NewReader("v1.18")})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "connection reset")
+
+	// The truncated content must not have been committed
+	require.Empty(t, fake.uploads)
+}
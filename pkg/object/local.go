@@ -0,0 +1,298 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package object
+
+import (
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// localMetadataDir is the directory within the root of a Local store which
+// contains the metadata of all objects
+const localMetadataDir = ".metadata"
+
+// localMetadata is the content of a metadata file of a Local store
+type localMetadata struct {
+	Metadata
+	Public bool `json:"public,omitempty"`
+}
+
+// Local is a Store backed by a directory on the local file system, which is
+// mainly intended for testing and offline runs. Objects are regular files
+// below the root directory, while their metadata and ACL is stored as JSON in
+// a separate directory.
+type Local struct {
+	mu   sync.Mutex
+	root string
+}
+
+// NewLocal creates a new Local store within the root directory, which gets
+// created if it does not exist
+func NewLocal(root string) (*Local, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "creating store directory %s", root)
+	}
+	return &Local{root: root}, nil
+}
+
+// String returns the file:// URL of the root directory
+func (l *Local) String() string {
+	return "file://" + l.root
+}
+
+// Root returns the root directory of the store
+func (l *Local) Root() string {
+	return l.root
+}
+
+// List returns the attributes of all objects with the provided prefix
+func (l *Local) List(ctx context.Context, prefix string) ([]*Attrs, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	res := []*Attrs{}
+	err := filepath.Walk(l.root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.root, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if info.IsDir() {
+			if name == localMetadataDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(name, prefix) ||
+			strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+		attrs, err := l.attrs(name, info)
+		if err != nil {
+			return err
+		}
+		res = append(res, attrs)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing %s/%s", l, prefix)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// Stat returns the attributes of the object
+func (l *Local) Stat(ctx context.Context, object string) (*Attrs, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info, err := os.Stat(l.path(object))
+	if err != nil {
+		return nil, l.wrap(err, object)
+	}
+	return l.attrs(object, info)
+}
+
+// Upload writes the content of the reader to the object. The object is
+// replaced atomically and its metadata is reset.
+func (l *Local) Upload(ctx context.Context, object string, reader io.Reader) error {
+	target := l.path(object)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return errors.Wrapf(err, "creating directory for %s", object)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(target), ".upload-")
+	if err != nil {
+		return errors.Wrapf(err, "creating temp file for %s", object)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "writing %s", object)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "writing %s", object)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return errors.Wrapf(err, "writing %s", object)
+	}
+	return l.wrap(os.RemoveAll(l.metadataPath(object)), object)
+}
+
+// Download writes the content of the object to the writer
+func (l *Local) Download(ctx context.Context, object string, writer io.Writer) error {
+	file, err := os.Open(l.path(object))
+	if err != nil {
+		return l.wrap(err, object)
+	}
+	defer file.Close()
+	_, err = io.Copy(writer, file)
+	return errors.Wrapf(err, "reading %s", object)
+}
+
+// Copy copies the src object including its metadata to the dst object
+func (l *Local) Copy(ctx context.Context, src, dst string) error {
+	file, err := os.Open(l.path(src))
+	if err != nil {
+		return l.wrap(err, src)
+	}
+	defer file.Close()
+	if err := l.Upload(ctx, dst, file); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	metadata, err := l.readMetadata(src)
+	if err != nil {
+		return err
+	}
+	return l.writeMetadata(dst, metadata)
+}
+
+// SetACL applies the access control to the object
+func (l *Local) SetACL(ctx context.Context, object string, acl ACL) error {
+	return l.updateMetadata(object, func(m *localMetadata) {
+		m.Public = acl == ACLPublicRead
+	})
+}
+
+// SetMetadata replaces the metadata of the object
+func (l *Local) SetMetadata(ctx context.Context, object string, metadata *Metadata) error {
+	return l.updateMetadata(object, func(m *localMetadata) {
+		m.Metadata = *metadata
+	})
+}
+
+func (l *Local) updateMetadata(object string, update func(*localMetadata)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := os.Stat(l.path(object)); err != nil {
+		return l.wrap(err, object)
+	}
+	metadata, err := l.readMetadata(object)
+	if err != nil {
+		return err
+	}
+	update(metadata)
+	return l.writeMetadata(object, metadata)
+}
+
+func (l *Local) attrs(object string, info os.FileInfo) (*Attrs, error) {
+	metadata, err := l.readMetadata(object)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := l.checksum(object)
+	if err != nil {
+		return nil, err
+	}
+	return &Attrs{
+		Metadata: metadata.Metadata,
+		Name:     object,
+		Size:     info.Size(),
+		CRC32C:   checksum,
+		Updated:  info.ModTime(),
+		Public:   metadata.Public,
+	}, nil
+}
+
+// checksum returns the CRC32C of the object, which is computed on every
+// call since the object may have been modified outside of the store
+func (l *Local) checksum(object string) (uint32, error) {
+	file, err := os.Open(l.path(object))
+	if err != nil {
+		return 0, l.wrap(err, object)
+	}
+	defer file.Close()
+
+	hash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	if _, err := io.Copy(hash, file); err != nil {
+		return 0, errors.Wrapf(err, "computing checksum of %s", object)
+	}
+	return hash.Sum32(), nil
+}
+
+func (l *Local) readMetadata(object string) (*localMetadata, error) {
+	metadata := &localMetadata{}
+	content, err := ioutil.ReadFile(l.metadataPath(object))
+	if os.IsNotExist(err) {
+		return metadata, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading metadata of %s", object)
+	}
+	return metadata, errors.Wrapf(
+		json.Unmarshal(content, metadata), "parsing metadata of %s", object,
+	)
+}
+
+func (l *Local) writeMetadata(object string, metadata *localMetadata) error {
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return errors.Wrapf(err, "marshaling metadata of %s", object)
+	}
+	file := l.metadataPath(object)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return errors.Wrapf(err, "creating metadata directory for %s", object)
+	}
+	return errors.Wrapf(
+		ioutil.WriteFile(file, content, 0o644),
+		"writing metadata of %s", object,
+	)
+}
+
+// path returns the local path of the object
+func (l *Local) path(object string) string {
+	return filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+object)))
+}
+
+// metadataPath returns the local path of the metadata of the object
+func (l *Local) metadataPath(object string) string {
+	return filepath.Join(
+		l.root, localMetadataDir, filepath.FromSlash(path.Clean("/"+object)+".json"),
+	)
+}
+
+// wrap converts not existing files into ErrNotExist and adds the object to
+// all other errors
+func (l *Local) wrap(err error, object string) error {
+	if err == nil {
+		return nil
+	}
+	if os.IsNotExist(err) {
+		return errors.Wrapf(ErrNotExist, "%s/%s", l, object)
+	}
+	return errors.Wrapf(err, "%s/%s", l, object)
+}
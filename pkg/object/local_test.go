@@ -0,0 +1,185 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package object
+
+import (
+	"context"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newLocal(t *testing.T) *Local {
+	dir, err := ioutil.TempDir("", "store-")
+	require.Nil(t, err)
+	store, err := NewLocal(filepath.Join(dir, "bucket"))
+	require.Nil(t, err)
+	return store
+}
+
+func names(attrs []*Attrs) []string {
+	res := []string{}
+	for _, a := range attrs {
+		res = append(res, a.Name)
+	}
+	return res
+}
+
+func TestSuccessLocalUploadDownload(t *testing.T) {
+	ctx := context.Background()
+	store := newLocal(t)
+	defer os.RemoveAll(filepath.Dir(store.Root()))
+
+	require.Nil(t, WriteString(ctx, store, "ci/latest.txt", "v1.18.0"))
+	content, err := ReadString(ctx, store, "ci/latest.txt")
+	require.Nil(t, err)
+	require.Equal(t, "v1.18.0", content)
+
+	// Uploads replace existing objects
+	require.Nil(t, WriteString(ctx, store, "ci/latest.txt", "v1.18.1"))
+	content, err = ReadString(ctx, store, "ci/latest.txt")
+	require.Nil(t, err)
+	require.Equal(t, "v1.18.1", content)
+
+	attrs, err := store.Stat(ctx, "ci/latest.txt")
+	require.Nil(t, err)
+	require.Equal(t, "ci/latest.txt", attrs.Name)
+	require.EqualValues(t, 7, attrs.Size)
+	require.Equal(t, crc32.Checksum([]byte("v1.18.1"), crc32.MakeTable(crc32.Castagnoli)), attrs.CRC32C)
+	require.False(t, attrs.Public)
+}
+
+func TestSuccessLocalList(t *testing.T) {
+	ctx := context.Background()
+	store := newLocal(t)
+	defer os.RemoveAll(filepath.Dir(store.Root()))
+
+	for _, object := range []string{
+		"ci/v1.18.0/kubernetes.tar.gz",
+		"ci/v1.18.0/bin/linux/amd64/kubectl",
+		"ci/v1.18.0-beta.0/kubernetes.tar.gz",
+		"release/v1.17.0/kubernetes.tar.gz",
+	} {
+		require.Nil(t, WriteString(ctx, store, object, object))
+	}
+	require.Nil(t, store.SetACL(ctx, "ci/v1.18.0/kubernetes.tar.gz", ACLPublicRead))
+
+	objects, err := store.List(ctx, "ci/v1.18.0/")
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		"ci/v1.18.0/bin/linux/amd64/kubectl",
+		"ci/v1.18.0/kubernetes.tar.gz",
+	}, names(objects))
+
+	objects, err = store.List(ctx, "")
+	require.Nil(t, err)
+	require.Len(t, objects, 4)
+
+	exists, err := Exists(ctx, store, "release/")
+	require.Nil(t, err)
+	require.True(t, exists)
+	exists, err = Exists(ctx, store, "devel/")
+	require.Nil(t, err)
+	require.False(t, exists)
+}
+
+func TestSuccessLocalCopyMetadataACL(t *testing.T) {
+	ctx := context.Background()
+	store := newLocal(t)
+	defer os.RemoveAll(filepath.Dir(store.Root()))
+
+	metadata := &Metadata{
+		ContentType:  "text/plain",
+		CacheControl: "private, max-age=0, no-transform",
+		Custom:       map[string]string{"version": "v1.18.0"},
+	}
+	require.Nil(t, WriteString(ctx, store, "src.txt", "content"))
+	require.Nil(t, store.SetMetadata(ctx, "src.txt", metadata))
+	require.Nil(t, store.SetACL(ctx, "src.txt", ACLPublicRead))
+	require.Nil(t, store.Copy(ctx, "src.txt", "dir/dst.txt"))
+
+	for _, object := range []string{"src.txt", "dir/dst.txt"} {
+		attrs, err := store.Stat(ctx, object)
+		require.Nil(t, err)
+		require.Equal(t, *metadata, attrs.Metadata)
+		require.True(t, attrs.Public)
+	}
+
+	require.Nil(t, store.SetACL(ctx, "dir/dst.txt", ACLPrivate))
+	attrs, err := store.Stat(ctx, "dir/dst.txt")
+	require.Nil(t, err)
+	require.False(t, attrs.Public)
+
+	// Uploading resets the metadata
+	require.Nil(t, WriteString(ctx, store, "src.txt", "new"))
+	attrs, err = store.Stat(ctx, "src.txt")
+	require.Nil(t, err)
+	require.Equal(t, Metadata{}, attrs.Metadata)
+}
+
+func TestSuccessLocalFiles(t *testing.T) {
+	ctx := context.Background()
+	store := newLocal(t)
+	defer os.RemoveAll(filepath.Dir(store.Root()))
+
+	src, err := ioutil.TempDir("", "src-")
+	require.Nil(t, err)
+	defer os.RemoveAll(src)
+	require.Nil(t, os.MkdirAll(filepath.Join(src, "bin"), 0o755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "bin", "b"), []byte("b"), 0o755))
+
+	objects, err := UploadDir(ctx, store, src, "dest")
+	require.Nil(t, err)
+	require.Equal(t, []string{"dest/a.txt", "dest/bin/b"}, objects)
+
+	dst := filepath.Join(src, "download", "b")
+	require.Nil(t, DownloadFile(ctx, store, "dest/bin/b", dst))
+	content, err := ioutil.ReadFile(dst)
+	require.Nil(t, err)
+	require.Equal(t, "b", string(content))
+}
+
+func TestFailureLocalNotExist(t *testing.T) {
+	ctx := context.Background()
+	store := newLocal(t)
+	defer os.RemoveAll(filepath.Dir(store.Root()))
+
+	_, err := store.Stat(ctx, "missing")
+	require.True(t, IsNotExist(err))
+
+	_, err = ReadString(ctx, store, "missing")
+	require.True(t, IsNotExist(err))
+
+	require.True(t, IsNotExist(store.Copy(ctx, "missing", "dst")))
+	require.True(t, IsNotExist(store.SetACL(ctx, "missing", ACLPublicRead)))
+	require.True(t, IsNotExist(store.SetMetadata(ctx, "missing", &Metadata{})))
+
+	dst := filepath.Join(store.Root(), "..", "download")
+	require.True(t, IsNotExist(DownloadFile(ctx, store, "missing", dst)))
+	_, err = os.Stat(dst)
+	require.True(t, os.IsNotExist(err))
+
+	// Objects cannot escape the root directory
+	require.Nil(t, WriteString(ctx, store, "../escape", "content"))
+	_, err = os.Stat(filepath.Join(store.Root(), "..", "escape"))
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package object
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotExist is returned if an object does not exist
+var ErrNotExist = errors.New("object does not exist")
+
+// IsNotExist returns true if the error indicates that an object does not
+// exist
+func IsNotExist(err error) bool {
+	return errors.Cause(err) == ErrNotExist
+}
+
+// ACL is the access control applied to an object
+type ACL int
+
+const (
+	// ACLPrivate removes public read access from the object
+	ACLPrivate ACL = iota
+
+	// ACLPublicRead grants read access to everyone
+	ACLPublicRead
+)
+
+func (a ACL) String() string {
+	if a == ACLPublicRead {
+		return "public-read"
+	}
+	return "private"
+}
+
+// Metadata is the user editable metadata of an object
+type Metadata struct {
+	ContentType  string            `json:"contentType,omitempty"`
+	CacheControl string            `json:"cacheControl,omitempty"`
+	Custom       map[string]string `json:"custom,omitempty"`
+}
+
+// Attrs are the attributes of a stored object
+type Attrs struct {
+	Metadata
+
+	// Name is the full path of the object within the store
+	Name string
+
+	// Size is the size of the object in bytes
+	Size int64
+
+	// CRC32C is the CRC32 checksum of the content using the Castagnoli
+	// polynomial, like GCS provides it for every object
+	CRC32C uint32
+
+	// Updated is the time of the last modification of the object
+	Updated time.Time
+
+	// Public indicates that the object is readable by everyone
+	Public bool
+}
+
+// Store is the interface for an object storage like a GCS bucket. Object
+// names are always slash separated paths relative to the root of the store.
+type Store interface {
+	// List returns the attributes of all objects with the provided prefix,
+	// ordered by name
+	List(ctx context.Context, prefix string) ([]*Attrs, error)
+
+	// Stat returns the attributes of the object or an ErrNotExist error
+	Stat(ctx context.Context, object string) (*Attrs, error)
+
+	// Upload writes the content of the reader to the object
+	Upload(ctx context.Context, object string, reader io.Reader) error
+
+	// Download writes the content of the object to the writer or returns an
+	// ErrNotExist error
+	Download(ctx context.Context, object string, writer io.Writer) error
+
+	// Copy copies the src object to the dst object within the store
+	Copy(ctx context.Context, src, dst string) error
+
+	// SetACL applies the access control to the object
+	SetACL(ctx context.Context, object string, acl ACL) error
+
+	// SetMetadata replaces the metadata of the object
+	SetMetadata(ctx context.Context, object string, metadata *Metadata) error
+
+	// String returns a URL like representation of the store
+	String() string
+}
+
+// Exists returns true if any object exists with the provided prefix. A
+// trailing slash can be used to check for directory like prefixes.
+func Exists(ctx context.Context, store Store, prefix string) (bool, error) {
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return false, err
+	}
+	return len(objects) > 0, nil
+}
+
+// ReadString returns the content of the object as string
+func ReadString(ctx context.Context, store Store, object string) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := store.Download(ctx, object, buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// WriteString writes the content to the object
+func WriteString(ctx context.Context, store Store, object, content string) error {
+	return store.Upload(ctx, object, strings.NewReader(content))
+}
+
+// UploadFile uploads the local file src to the object dst
+func UploadFile(ctx context.Context, store Store, src, dst string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", src)
+	}
+	defer file.Close()
+	return errors.Wrapf(
+		store.Upload(ctx, dst, file), "uploading %s to %s", src, dst,
+	)
+}
+
+// DownloadFile downloads the object src to the local file dst, creating all
+// parent directories of dst
+func DownloadFile(ctx context.Context, store Store, src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return errors.Wrapf(err, "creating directory for %s", dst)
+	}
+	file, err := os.Create(dst)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", dst)
+	}
+	if err := store.Download(ctx, src, file); err != nil {
+		file.Close()
+		os.Remove(dst)
+		return errors.Wrapf(err, "downloading %s", src)
+	}
+	return errors.Wrapf(file.Close(), "closing %s", dst)
+}
+
+// UploadDir uploads all files within the local directory src to the dst
+// prefix and returns the names of the uploaded objects
+func UploadDir(ctx context.Context, store Store, src, dst string) ([]string, error) {
+	objects := []string{}
+	err := filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		object := path.Join(dst, filepath.ToSlash(rel))
+		if err := UploadFile(ctx, store, file, object); err != nil {
+			return err
+		}
+		objects = append(objects, object)
+		return nil
+	})
+	return objects, err
+}
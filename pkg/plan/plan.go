@@ -0,0 +1,248 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Step is a single step of a plan
+type Step struct {
+	// Name is the unique name of the step, like prepare-workspace
+	Name string
+
+	// Description is a short human readable summary of the step
+	Description string
+
+	// DependsOn are the names of the steps which have to be completed before
+	// the step runs
+	DependsOn []string
+
+	// Run executes the step. Values set on the state are persisted together
+	// with the progress and are available to all following steps, also when
+	// resuming the plan.
+	Run func(ctx context.Context, state *State) error
+}
+
+// Plan is a set of steps with dependencies, which get executed in
+// dependency order while the progress is persisted to a State. It replaces
+// common::run_stateful of the bash based release tooling.
+type Plan struct {
+	// steps are sorted in execution order
+	steps  []*Step
+	byName map[string]*Step
+}
+
+// New creates a plan from the steps. Steps run in the order they are
+// declared in, as long as their dependencies allow it. Duplicate or empty
+// names, unknown dependencies and dependency cycles are errors.
+func New(steps ...*Step) (*Plan, error) {
+	byName := map[string]*Step{}
+	for _, step := range steps {
+		if step.Name == "" {
+			return nil, errors.New("step without name")
+		}
+		if step.Run == nil {
+			return nil, errors.Errorf("step %s has nothing to run", step.Name)
+		}
+		if _, ok := byName[step.Name]; ok {
+			return nil, errors.Errorf("duplicate step %s", step.Name)
+		}
+		byName[step.Name] = step
+	}
+	for _, step := range steps {
+		for _, dep := range step.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, errors.Errorf("step %s depends on unknown step %s", step.Name, dep)
+			}
+		}
+	}
+
+	// Always pick the first declared step whose dependencies are placed,
+	// which keeps the declaration order wherever possible
+	ordered := []*Step{}
+	placed := map[string]bool{}
+	for len(ordered) < len(steps) {
+		next := -1
+		for i, step := range steps {
+			if placed[step.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range step.DependsOn {
+				ready = ready && placed[dep]
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			remaining := []string{}
+			for _, step := range steps {
+				if !placed[step.Name] {
+					remaining = append(remaining, step.Name)
+				}
+			}
+			return nil, errors.Errorf(
+				"dependency cycle between steps %s", strings.Join(remaining, ", "),
+			)
+		}
+		placed[steps[next].Name] = true
+		ordered = append(ordered, steps[next])
+	}
+	return &Plan{steps: ordered, byName: byName}, nil
+}
+
+// Steps returns the steps in execution order
+func (p *Plan) Steps() []*Step {
+	return append([]*Step{}, p.steps...)
+}
+
+// Dependents returns the names of all steps which directly or indirectly
+// depend on the step, in execution order
+func (p *Plan) Dependents(name string) []string {
+	affected := map[string]bool{name: true}
+	res := []string{}
+	for _, step := range p.steps {
+		for _, dep := range step.DependsOn {
+			if affected[dep] {
+				affected[step.Name] = true
+				res = append(res, step.Name)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// RunOptions are the options for running a plan
+type RunOptions struct {
+	// Resume continues a plan from the last successful step. Without it, a
+	// state containing progress is an error.
+	Resume bool
+
+	// From re-runs the step and all steps depending on it, even if they have
+	// been completed before, and continues all other incomplete steps
+	From string
+}
+
+// Run executes all incomplete steps in order and persists the progress after
+// every step. It stops at the first failing step, which runs again when the
+// plan gets resumed.
+func (p *Plan) Run(ctx context.Context, state *State, opts *RunOptions) error {
+	switch {
+	case opts.From != "":
+		if _, ok := p.byName[opts.From]; !ok {
+			return errors.Errorf("unknown step %s", opts.From)
+		}
+		for _, name := range append([]string{opts.From}, p.Dependents(opts.From)...) {
+			state.reset(name)
+		}
+	case !opts.Resume && p.started(state):
+		return errors.Errorf(
+			"state %s contains progress of a previous run, resume it or start over from a step",
+			state.Path(),
+		)
+	}
+	if err := state.Save(); err != nil {
+		return err
+	}
+
+	for i, step := range p.steps {
+		if state.Status(step.Name) == StatusDone {
+			logrus.Infof("Skipping completed step %d/%d: %s", i+1, len(p.steps), step.Name)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		logrus.Infof("Running step %d/%d: %s", i+1, len(p.steps), step.Name)
+		s := state.step(step.Name)
+		s.Status = StatusRunning
+		s.Started = time.Now().UTC()
+		s.Finished = time.Time{}
+		s.Error = ""
+		if err := state.Save(); err != nil {
+			return err
+		}
+
+		runErr := step.Run(ctx, state)
+		s.Finished = time.Now().UTC()
+		if runErr != nil {
+			s.Status = StatusFailed
+			s.Error = runErr.Error()
+		} else {
+			s.Status = StatusDone
+		}
+		if err := state.Save(); err != nil {
+			return err
+		}
+		if runErr != nil {
+			return errors.Wrapf(runErr, "step %s failed", step.Name)
+		}
+	}
+	logrus.Infof("All %d steps completed", len(p.steps))
+	return nil
+}
+
+// Done returns true if all steps of the plan have been completed
+func (p *Plan) Done(state *State) bool {
+	for _, step := range p.steps {
+		if state.Status(step.Name) != StatusDone {
+			return false
+		}
+	}
+	return true
+}
+
+// started returns true if any step of the plan has been run
+func (p *Plan) started(state *State) bool {
+	for _, step := range p.steps {
+		if state.Status(step.Name) != StatusPending {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the steps in execution order with their dependencies and
+// their status within the state like common::stepindex --toc
+func (p *Plan) Print(w io.Writer, state *State) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tNAME\tSTATUS\tDEPENDS ON\tDESCRIPTION")
+	for i, step := range p.steps {
+		deps := strings.Join(step.DependsOn, ",")
+		if deps == "" {
+			deps = "-"
+		}
+		fmt.Fprintf(
+			tw, "%d\t%s\t%s\t%s\t%s\n",
+			i+1, step.Name, state.Status(step.Name), deps, step.Description,
+		)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plan
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder creates steps which record their execution
+type recorder struct {
+	runs []string
+	fail map[string]bool
+}
+
+func (r *recorder) step(name string, deps ...string) *Step {
+	return &Step{
+		Name:        name,
+		Description: "run " + name,
+		DependsOn:   deps,
+		Run: func(ctx context.Context, state *State) error {
+			r.runs = append(r.runs, name)
+			if r.fail[name] {
+				return errors.Errorf("%s broke", name)
+			}
+			state.SetValue(name, "ran")
+			return nil
+		},
+	}
+}
+
+func names(steps []*Step) []string {
+	res := []string{}
+	for _, step := range steps {
+		res = append(res, step.Name)
+	}
+	return res
+}
+
+func TestNew(t *testing.T) {
+	r := &recorder{}
+	cases := map[string]struct {
+		steps     []*Step
+		want      []string
+		shouldErr bool
+	}{
+		"DeclarationOrder": {
+			steps: []*Step{r.step("a"), r.step("b", "a"), r.step("c")},
+			want:  []string{"a", "b", "c"},
+		},
+		"DependencyOrder": {
+			steps: []*Step{r.step("announce", "push", "stage"), r.step("push", "tag"), r.step("tag"), r.step("stage", "tag")},
+			want:  []string{"tag", "push", "stage", "announce"},
+		},
+		"Cycle": {
+			steps:     []*Step{r.step("a", "c"), r.step("b", "a"), r.step("c", "b"), r.step("d")},
+			shouldErr: true,
+		},
+		"UnknownDependency": {
+			steps:     []*Step{r.step("a", "missing")},
+			shouldErr: true,
+		},
+		"Duplicate": {
+			steps:     []*Step{r.step("a"), r.step("a")},
+			shouldErr: true,
+		},
+		"NoName": {
+			steps:     []*Step{r.step("")},
+			shouldErr: true,
+		},
+		"NoRun": {
+			steps:     []*Step{{Name: "a"}},
+			shouldErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(tc.steps...)
+			require.Equal(t, tc.shouldErr, err != nil, err)
+			if !tc.shouldErr {
+				require.Equal(t, tc.want, names(p.Steps()))
+			}
+		})
+	}
+}
+
+func TestRunAndResume(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "plan-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state", "release.json")
+
+	r := &recorder{fail: map[string]bool{"build": true}}
+	p, err := New(
+		r.step("prepare"), r.step("tag", "prepare"), r.step("build", "tag"),
+		r.step("push", "tag"), r.step("announce", "build", "push"),
+	)
+	require.Nil(t, err)
+	require.Equal(t, []string{"build", "push", "announce"}, p.Dependents("tag"))
+	require.Equal(t, []string{"announce"}, p.Dependents("build"))
+
+	state, err := LoadState(path)
+	require.Nil(t, err)
+	require.NotNil(t, p.Run(ctx, state, &RunOptions{}))
+	require.Equal(t, []string{"prepare", "tag", "build"}, r.runs)
+	require.False(t, p.Done(state))
+
+	// The progress has been persisted including the failure
+	state, err = LoadState(path)
+	require.Nil(t, err)
+	require.Equal(t, StatusDone, state.Status("tag"))
+	require.Equal(t, StatusFailed, state.Status("build"))
+	require.Equal(t, "build broke", state.Steps["build"].Error)
+	require.Equal(t, StatusPending, state.Status("push"))
+	require.Equal(t, "ran", state.Value("tag"))
+
+	// Runs without resuming do not overwrite the progress
+	require.NotNil(t, p.Run(ctx, state, &RunOptions{}))
+
+	r.runs = nil
+	r.fail = nil
+	require.Nil(t, p.Run(ctx, state, &RunOptions{Resume: true}))
+	require.Equal(t, []string{"build", "push", "announce"}, r.runs)
+	require.True(t, p.Done(state))
+
+	// Completed plans only run again from a specific step
+	r.runs = nil
+	require.Nil(t, p.Run(ctx, state, &RunOptions{Resume: true}))
+	require.Empty(t, r.runs)
+	require.Nil(t, p.Run(ctx, state, &RunOptions{From: "build"}))
+	require.Equal(t, []string{"build", "announce"}, r.runs)
+	require.NotNil(t, p.Run(ctx, state, &RunOptions{From: "missing"}))
+
+	// Steps interrupted while running are run again
+	state.Steps["push"].Status = StatusRunning
+	require.Nil(t, state.Save())
+	state, err = LoadState(path)
+	require.Nil(t, err)
+	r.runs = nil
+	require.Nil(t, p.Run(ctx, state, &RunOptions{Resume: true}))
+	require.Equal(t, []string{"push"}, r.runs)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.NotNil(t, p.Run(canceled, state, &RunOptions{From: "prepare"}))
+}
+
+func TestPrint(t *testing.T) {
+	r := &recorder{}
+	p, err := New(r.step("tag"), r.step("push", "tag"))
+	require.Nil(t, err)
+	state := NewState("unused")
+	state.step("tag").Status = StatusDone
+
+	out := &bytes.Buffer{}
+	require.Nil(t, p.Print(out, state))
+	require.Equal(t, `STEP  NAME  STATUS   DEPENDS ON  DESCRIPTION
+1     tag   done     -           run tag
+2     push  pending  tag         run push
+`, out.String())
+}
+
+func TestLoadState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "invalid.json")
+	require.Nil(t, ioutil.WriteFile(path, []byte("{"), 0o644))
+	_, err = LoadState(path)
+	require.NotNil(t, err)
+
+	path = filepath.Join(dir, "empty.json")
+	require.Nil(t, ioutil.WriteFile(path, []byte("{}"), 0o644))
+	state, err := LoadState(path)
+	require.Nil(t, err)
+	state.SetValue("release_version", "v1.17.0")
+	require.Equal(t, StatusPending, state.Status("tag"))
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Status is the status of a step
+type Status string
+
+const (
+	// StatusPending steps have not been run yet
+	StatusPending Status = "pending"
+
+	// StatusRunning steps have been started, but did not finish. This is the
+	// case if a run got killed.
+	StatusRunning Status = "running"
+
+	// StatusDone steps have been completed successfully
+	StatusDone Status = "done"
+
+	// StatusFailed steps have returned an error
+	StatusFailed Status = "failed"
+)
+
+// StepState is the persisted progress of a step
+type StepState struct {
+	Status   Status    `json:"status"`
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// State is the progress of a plan, which gets persisted as JSON to a state
+// file like the PROGSTATE of anago
+type State struct {
+	path string
+
+	// Steps is the progress by step name
+	Steps map[string]*StepState `json:"steps"`
+
+	// Values are set by the steps and are available to the following ones
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// NewState creates an empty state, which gets persisted to the path
+func NewState(path string) *State {
+	return &State{
+		path:   path,
+		Steps:  map[string]*StepState{},
+		Values: map[string]string{},
+	}
+}
+
+// LoadState reads the state file or returns an empty state if it does not
+// exist
+func LoadState(path string) (*State, error) {
+	state := NewState(path)
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading state %s", path)
+	}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, errors.Wrapf(err, "parsing state %s", path)
+	}
+	if state.Steps == nil {
+		state.Steps = map[string]*StepState{}
+	}
+	if state.Values == nil {
+		state.Values = map[string]string{}
+	}
+	return state, nil
+}
+
+// Path returns the path of the state file
+func (s *State) Path() string {
+	return s.path
+}
+
+// Save writes the state file atomically, which means that a killed run
+// never leaves a corrupted state behind
+func (s *State) Save() error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding state")
+	}
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrapf(err, "creating directory for state %s", s.path)
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(s.path)+".tmp-")
+	if err != nil {
+		return errors.Wrapf(err, "creating temp file for state %s", s.path)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(content, '\n')); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "writing state %s", s.path)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "writing state %s", s.path)
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), s.path), "writing state %s", s.path)
+}
+
+// Status returns the status of the step
+func (s *State) Status(step string) Status {
+	if st, ok := s.Steps[step]; ok {
+		return st.Status
+	}
+	return StatusPending
+}
+
+// Value returns a value set by a previous step or an empty string
+func (s *State) Value(key string) string {
+	return s.Values[key]
+}
+
+// SetValue sets a value, which gets persisted after the current step
+func (s *State) SetValue(key, value string) {
+	s.Values[key] = value
+}
+
+// step returns the progress of the step, which gets created if needed
+func (s *State) step(name string) *StepState {
+	st, ok := s.Steps[name]
+	if !ok {
+		st = &StepState{Status: StatusPending}
+		s.Steps[name] = st
+	}
+	return st
+}
+
+// reset marks the step as pending
+func (s *State) reset(name string) {
+	delete(s.Steps, name)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+)
+
+// ClientOptions are the options for a registry client
+type ClientOptions struct {
+	// Insecure uses plain HTTP instead of HTTPS, which is useful for local
+	// registries
+	Insecure bool
+
+	// Auth provides the credentials for the registry, which get exchanged
+	// for a bearer token if the registry asks for one. It defaults to
+	// anonymous access.
+	Auth authn.Authenticator
+
+	// Transport is used for all requests, which defaults to
+	// http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+// Client talks to a single registry via the Docker Registry HTTP API V2
+type Client struct {
+	registry string
+	opts     ClientOptions
+}
+
+// NewClient creates a new client for the registry host
+func NewClient(registry string, opts *ClientOptions) *Client {
+	c := &Client{registry: registry}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.Auth == nil {
+		c.opts.Auth = authn.Anonymous
+	}
+	if c.opts.Transport == nil {
+		c.opts.Transport = http.DefaultTransport
+	}
+	return c
+}
+
+// Registry returns the registry host of the client
+func (c *Client) Registry() string {
+	return c.registry
+}
+
+// GetManifest downloads the manifest by tag or digest and returns it
+// together with its media type
+func (c *Client) GetManifest(
+	ctx context.Context, repository, reference string,
+) (mediaType string, manifest []byte, err error) {
+	ref, err := c.reference(repository, reference)
+	if err != nil {
+		return "", nil, err
+	}
+	descriptor, err := remote.Get(
+		ref, remote.WithAuth(c.opts.Auth), remote.WithTransport(c.transport(ctx)),
+	)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "getting manifest %s", ref)
+	}
+	return string(descriptor.MediaType), descriptor.Manifest, nil
+}
+
+// reference returns the image reference of the tag or digest within the
+// repository
+func (c *Client) reference(repository, reference string) (name.Reference, error) {
+	opts := []name.Option{name.StrictValidation}
+	if c.opts.Insecure {
+		opts = append(opts, name.Insecure)
+	}
+	separator := ":"
+	if strings.HasPrefix(reference, "sha256:") {
+		separator = "@"
+	}
+	ref, err := name.ParseReference(c.registry+"/"+repository+separator+reference, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing reference %s%s%s", repository, separator, reference)
+	}
+	return ref, nil
+}
+
+// transport returns the transport of the client for requests which are
+// canceled together with the context
+func (c *Client) transport(ctx context.Context) http.RoundTripper {
+	return &contextTransport{ctx: ctx, base: c.opts.Transport}
+}
+
+// contextTransport binds all requests to a context, since the remote
+// package does not accept one
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
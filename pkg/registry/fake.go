@@ -0,0 +1,333 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FakeRegistry is an in-memory stand-in for a registry, which implements the
+// parts of the Docker Registry HTTP API V2 used by the Client. It is meant to
+// be served by an httptest.Server for testing.
+type FakeRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string]fakeManifest
+	pending   map[string][]byte
+	uploads   int
+	mounts    int
+
+	// username and password are required to obtain a bearer token if set
+	username string
+	password string
+}
+
+type fakeManifest struct {
+	mediaType string
+	content   []byte
+}
+
+// fakeToken is the bearer token handed out by the registry
+const fakeToken = "fake-token"
+
+// NewFakeRegistry creates a new empty registry
+func NewFakeRegistry() *FakeRegistry {
+	return &FakeRegistry{
+		blobs:     map[string][]byte{},
+		manifests: map[string]fakeManifest{},
+		pending:   map[string][]byte{},
+	}
+}
+
+// RequireAuth makes the registry challenge all clients for a bearer token,
+// which it only issues for the credentials, like GCR does
+func (f *FakeRegistry) RequireAuth(username, password string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.username = username
+	f.password = password
+}
+
+var fakeRoute = regexp.MustCompile(`^/v2/(.+)/(blobs|manifests)/(.+)$`)
+
+// ServeHTTP implements http.Handler
+func (f *FakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		f.serveToken(w, r)
+		return
+	}
+	if f.username != "" && r.Header.Get("Authorization") != "Bearer "+fakeToken {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+			`Bearer realm="http://%s/token",service="fake"`, r.Host,
+		))
+		http.Error(w, "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	match := fakeRoute.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		http.NotFound(w, r)
+		return
+	}
+	repository, kind, reference := match[1], match[2], match[3]
+	query := r.URL.Query()
+
+	switch {
+	case kind == "blobs" && reference == "uploads/" && r.Method == http.MethodPost:
+		mount, from := query.Get("mount"), query.Get("from")
+		if content, ok := f.blobs[from+"@"+mount]; ok && from != "" {
+			f.mounts++
+			f.blobs[repository+"@"+mount] = content
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		f.uploads++
+		location := fmt.Sprintf("/v2/%s/blobs/uploads/%d", repository, f.uploads)
+		f.pending[location] = []byte{}
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusAccepted)
+
+	case kind == "blobs" && (r.Method == http.MethodPatch || r.Method == http.MethodPut):
+		content, ok := f.pending[r.URL.Path]
+		if !ok {
+			http.Error(w, "BLOB_UPLOAD_UNKNOWN", http.StatusNotFound)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content = append(content, body...)
+		if r.Method == http.MethodPatch {
+			f.pending[r.URL.Path] = content
+			w.Header().Set("Location", r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		delete(f.pending, r.URL.Path)
+		digest := query.Get("digest")
+		if Digest(content) != digest {
+			http.Error(w, "DIGEST_INVALID", http.StatusBadRequest)
+			return
+		}
+		f.blobs[repository+"@"+digest] = content
+		w.WriteHeader(http.StatusCreated)
+
+	case kind == "blobs" && (r.Method == http.MethodHead || r.Method == http.MethodGet):
+		content, ok := f.blobs[repository+"@"+reference]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(content) // nolint: errcheck
+		}
+
+	case kind == "manifests" && r.Method == http.MethodPut:
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := f.validateManifest(repository, r.Header.Get("Content-Type"), content); err != nil {
+			http.Error(w, "MANIFEST_BLOB_UNKNOWN: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		manifest := fakeManifest{r.Header.Get("Content-Type"), content}
+		digest := Digest(content)
+		f.manifests[repository+":"+reference] = manifest
+		f.manifests[repository+"@"+digest] = manifest
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+
+	case kind == "manifests" && (r.Method == http.MethodHead || r.Method == http.MethodGet):
+		manifest, ok := f.manifests[repository+":"+reference]
+		if !ok {
+			manifest, ok = f.manifests[repository+"@"+reference]
+		}
+		if !ok {
+			http.Error(w, "MANIFEST_UNKNOWN", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", manifest.mediaType)
+		w.Header().Set("Docker-Content-Digest", Digest(manifest.content))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(manifest.content) // nolint: errcheck
+		}
+
+	default:
+		http.Error(w, "UNSUPPORTED", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveToken issues the bearer token for valid credentials
+func (f *FakeRegistry) serveToken(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok || username != f.username || password != f.password {
+		http.Error(w, "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	fmt.Fprintf(w, `{"token": %q}`, fakeToken)
+}
+
+// Blob returns the content of a blob in the repository
+func (f *FakeRegistry) Blob(repository, digest string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	content, ok := f.blobs[repository+"@"+digest]
+	return content, ok
+}
+
+// Uploads returns the number of started blob uploads
+func (f *FakeRegistry) Uploads() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.uploads
+}
+
+// Mounts returns the number of blobs mounted from other repositories
+func (f *FakeRegistry) Mounts() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mounts
+}
+
+// validateManifest checks that all blobs and manifests referenced by the
+// manifest exist in the repository, like real registries do
+func (f *FakeRegistry) validateManifest(repository, mediaType string, content []byte) error {
+	switch mediaType {
+	case MediaTypeManifest:
+		manifest := Manifest{}
+		if err := unmarshalStrict(content, &manifest); err != nil {
+			return err
+		}
+		for _, blob := range append([]Descriptor{manifest.Config}, manifest.Layers...) {
+			if _, ok := f.blobs[repository+"@"+blob.Digest]; !ok {
+				return errors.Errorf("blob %s not found", blob.Digest)
+			}
+		}
+	case MediaTypeManifestList:
+		list := ManifestList{}
+		if err := unmarshalStrict(content, &list); err != nil {
+			return err
+		}
+		for _, manifest := range list.Manifests {
+			if _, ok := f.manifests[repository+"@"+manifest.Digest]; !ok {
+				return errors.Errorf("manifest %s not found", manifest.Digest)
+			}
+		}
+	default:
+		return errors.Errorf("unsupported media type %q", mediaType)
+	}
+	return nil
+}
+
+// unmarshalStrict unmarshals the JSON content and rejects unknown fields
+func unmarshalStrict(content []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// WriteFakeImageTarball writes a tarball like `docker save` does for a
+// minimal image with the tag and architecture, containing a single
+// uncompressed layer with the file /<arch>
+func WriteFakeImageTarball(path, repoTag, arch string) error {
+	layer := &bytes.Buffer{}
+	lw := tar.NewWriter(layer)
+	if err := lw.WriteHeader(&tar.Header{
+		Name: arch, Mode: 0o644, Size: int64(len(repoTag)),
+	}); err != nil {
+		return err
+	}
+	if _, err := lw.Write([]byte(repoTag)); err != nil {
+		return err
+	}
+	if err := lw.Close(); err != nil {
+		return err
+	}
+
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": arch,
+		"os":           "linux",
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": []string{Digest(layer.Bytes())},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	configName := Digest(config)[len("sha256:"):] + ".json"
+	layerName := Digest(layer.Bytes())[len("sha256:"):] + "/layer.tar"
+	manifest, err := json.Marshal([]tarballManifest{{
+		Config: configName, RepoTags: []string{repoTag}, Layers: []string{layerName},
+	}})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	tw := tar.NewWriter(file)
+	for _, entry := range []struct {
+		name    string
+		content []byte
+	}{
+		{configName, config},
+		{layerName, layer.Bytes()},
+		{"manifest.json", manifest},
+	} {
+		if err := tw.WriteHeader(&tar.Header{
+			Name: entry.name, Mode: 0o644, Size: int64(len(entry.content)),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+)
+
+// imageConfig contains the platform fields of an image config
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Image is an image saved by `docker save`, whose layers have been
+// compressed into a temporary directory once, so that it can be pushed to
+// multiple repositories. It has to be closed to remove the compressed layers.
+type Image struct {
+	tarball    *ImageTarball
+	dir        string
+	image      v1.Image
+	descriptor Descriptor
+
+	// pushed is the reference the image has been pushed to last, which
+	// further pushes mount the layers from
+	pushed name.Reference
+}
+
+// NewImage compresses the layers of the image tarball and creates its
+// manifest
+func NewImage(tarball *ImageTarball) (*Image, error) {
+	config := imageConfig{}
+	if err := json.Unmarshal(tarball.Config, &config); err != nil {
+		return nil, errors.Wrapf(err, "parsing image config of %s", tarball.Path)
+	}
+	dir, err := ioutil.TempDir("", "image-")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating temporary layer directory")
+	}
+	i := &Image{tarball: tarball, dir: dir}
+
+	manifest := &Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifest,
+		Config: Descriptor{
+			MediaType: MediaTypeConfig,
+			Size:      int64(len(tarball.Config)),
+			Digest:    Digest(tarball.Config),
+		},
+		Layers: []Descriptor{},
+	}
+	layers := map[v1.Hash]*compressedLayer{}
+	for n, layer := range tarball.Layers {
+		compressed, err := i.compressLayer(layer, filepath.Join(dir, strconv.Itoa(n)))
+		if err != nil {
+			i.Close() // nolint: errcheck
+			return nil, err
+		}
+		layers[compressed.digest] = compressed
+		manifest.Layers = append(manifest.Layers, Descriptor{
+			MediaType: MediaTypeLayer, Size: compressed.size, Digest: compressed.digest.String(),
+		})
+	}
+
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		i.Close() // nolint: errcheck
+		return nil, errors.Wrap(err, "marshalling image manifest")
+	}
+	i.image, err = partial.CompressedToImage(&compressedImage{
+		config: tarball.Config, manifest: content, layers: layers,
+	})
+	if err != nil {
+		i.Close() // nolint: errcheck
+		return nil, errors.Wrapf(err, "creating image of %s", tarball.Path)
+	}
+	i.descriptor = Descriptor{
+		MediaType: MediaTypeManifest,
+		Size:      int64(len(content)),
+		Digest:    Digest(content),
+		Platform: &Platform{
+			Architecture: config.Architecture,
+			OS:           config.OS,
+			Variant:      config.Variant,
+		},
+	}
+	return i, nil
+}
+
+// Close removes the compressed layers of the image
+func (i *Image) Close() error {
+	return errors.Wrapf(os.RemoveAll(i.dir), "removing layers of %s", i.tarball.Path)
+}
+
+// compressLayer writes the compressed layer of the tarball to the file
+func (i *Image) compressLayer(layer, path string) (*compressedLayer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating temporary layer file")
+	}
+	defer file.Close()
+
+	digest, err := i.tarball.WriteLayer(layer, file)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := v1.NewHash(digest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing digest of layer %s", layer)
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading size of compressed layer")
+	}
+	return &compressedLayer{path: path, digest: hash, size: size}, file.Close()
+}
+
+// compressedImage is the partial.CompressedImageCore of an Image
+type compressedImage struct {
+	config   []byte
+	manifest []byte
+	layers   map[v1.Hash]*compressedLayer
+}
+
+func (c *compressedImage) RawConfigFile() ([]byte, error) {
+	return c.config, nil
+}
+
+func (c *compressedImage) MediaType() (types.MediaType, error) {
+	return types.DockerManifestSchema2, nil
+}
+
+func (c *compressedImage) RawManifest() ([]byte, error) {
+	return c.manifest, nil
+}
+
+func (c *compressedImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	layer, ok := c.layers[h]
+	if !ok {
+		return nil, errors.Errorf("unknown layer %s", h)
+	}
+	return layer, nil
+}
+
+// compressedLayer is a compressed layer within the temporary directory of an
+// Image
+type compressedLayer struct {
+	path   string
+	digest v1.Hash
+	size   int64
+}
+
+func (c *compressedLayer) Digest() (v1.Hash, error) {
+	return c.digest, nil
+}
+
+func (c *compressedLayer) Compressed() (io.ReadCloser, error) {
+	return os.Open(c.path)
+}
+
+func (c *compressedLayer) Size() (int64, error) {
+	return c.size, nil
+}
+
+func (c *compressedLayer) MediaType() (types.MediaType, error) {
+	return types.DockerLayer, nil
+}
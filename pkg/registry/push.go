@@ -0,0 +1,180 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/release/pkg/command"
+)
+
+// PushImage pushes the image to the repository of the client's registry.
+// The reference is either a tag or the digest of the resulting manifest,
+// which is useful to push images only referenced by manifest lists. Blobs
+// which already exist in the repository are not uploaded again and blobs of
+// a previous push of the image to the same registry get mounted from there.
+// It returns the descriptor of the pushed manifest including the platform of
+// the image. The push follows the global dry run policy of the command
+// package.
+func PushImage(
+	ctx context.Context, client *Client, repository, reference string, image *Image,
+) (*Descriptor, error) {
+	if !strings.HasPrefix(reference, "sha256:") {
+		if err := ValidateTag(reference); err != nil {
+			return nil, err
+		}
+	} else if reference != image.descriptor.Digest {
+		return nil, errors.Errorf(
+			"manifest digest %s of %s does not match reference %s",
+			image.descriptor.Digest, image.tarball.Path, reference,
+		)
+	}
+	ref, err := client.reference(repository, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if !command.SkipMutation(fmt.Sprintf("push %s to %s", image.tarball.Path, ref)) {
+		var img v1.Image = image.image
+		if image.pushed != nil &&
+			image.pushed.Context().RegistryStr() == ref.Context().RegistryStr() &&
+			image.pushed.Context() != ref.Context() {
+			img = &mountableImage{Image: img, from: image.pushed}
+		}
+		if err := remote.Write(ref, img, client.opts.Auth, client.transport(ctx)); err != nil {
+			return nil, errors.Wrapf(err, "pushing %s to %s", image.tarball.Path, ref)
+		}
+		image.pushed = ref
+		logrus.Infof("Pushed %s (%s)", ref, image.descriptor.Digest)
+	}
+
+	descriptor := image.descriptor
+	platform := *descriptor.Platform
+	descriptor.Platform = &platform
+	return &descriptor, nil
+}
+
+// PushManifestList pushes a manifest list referencing the manifests, which
+// need to exist in the repository already, and returns its digest. The push
+// follows the global dry run policy of the command package.
+func PushManifestList(
+	ctx context.Context, client *Client, repository, tag string, manifests []Descriptor,
+) (string, error) {
+	if err := ValidateTag(tag); err != nil {
+		return "", err
+	}
+	for _, manifest := range manifests {
+		if manifest.Platform == nil {
+			return "", errors.Errorf("manifest %s has no platform", manifest.Digest)
+		}
+	}
+
+	content, err := json.Marshal(&ManifestList{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifestList,
+		Manifests:     manifests,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "marshalling manifest list")
+	}
+	index, err := newManifestList(content)
+	if err != nil {
+		return "", err
+	}
+	ref, err := client.reference(repository, tag)
+	if err != nil {
+		return "", err
+	}
+	digest := Digest(content)
+	if command.SkipMutation(fmt.Sprintf("push manifest list %s", ref)) {
+		return digest, nil
+	}
+	if err := remote.WriteIndex(ref, index, client.opts.Auth, client.transport(ctx)); err != nil {
+		return "", errors.Wrapf(err, "pushing manifest list %s", ref)
+	}
+	logrus.Infof("Pushed manifest list %s (%s) for %d platforms", ref, digest, len(manifests))
+	return digest, nil
+}
+
+// mountableImage mounts the layers of the image from the repository it has
+// been pushed to before, like remote.MountableLayer documents
+type mountableImage struct {
+	v1.Image
+	from name.Reference
+}
+
+func (i *mountableImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	res := []v1.Layer{}
+	for _, layer := range layers {
+		res = append(res, &remote.MountableLayer{Layer: layer, Reference: i.from})
+	}
+	return res, nil
+}
+
+// manifestList is a v1.ImageIndex of manifests which already exist in the
+// repository, so that none of them gets pushed together with the list
+type manifestList struct {
+	content []byte
+	index   *v1.IndexManifest
+}
+
+func newManifestList(content []byte) (*manifestList, error) {
+	index, err := v1.ParseIndexManifest(bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing manifest list")
+	}
+	return &manifestList{content: content, index: index}, nil
+}
+
+func (m *manifestList) MediaType() (types.MediaType, error) {
+	return types.DockerManifestList, nil
+}
+
+func (m *manifestList) Digest() (v1.Hash, error) {
+	return v1.NewHash(Digest(m.content))
+}
+
+func (m *manifestList) IndexManifest() (*v1.IndexManifest, error) {
+	return m.index, nil
+}
+
+func (m *manifestList) RawManifest() ([]byte, error) {
+	return m.content, nil
+}
+
+func (m *manifestList) Image(h v1.Hash) (v1.Image, error) {
+	return nil, errors.Errorf("manifest %s does not exist in the repository", h)
+}
+
+func (m *manifestList) ImageIndex(h v1.Hash) (v1.ImageIndex, error) {
+	return nil, errors.Errorf("manifest list %s does not exist in the repository", h)
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package registry pushes container images and manifest lists to registries
+// implementing the Docker Registry HTTP API V2 without requiring a docker
+// daemon.
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MediaTypeManifest is the media type of an image manifest
+	MediaTypeManifest = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// MediaTypeManifestList is the media type of a multi-arch manifest list
+	MediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// MediaTypeConfig is the media type of an image config
+	MediaTypeConfig = "application/vnd.docker.container.image.v1+json"
+
+	// MediaTypeLayer is the media type of a gzipped image layer
+	MediaTypeLayer = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// Descriptor references a blob or manifest by its digest
+type Descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Size      int64     `json:"size"`
+	Digest    string    `json:"digest"`
+	Platform  *Platform `json:"platform,omitempty"`
+}
+
+// Platform is the platform of an image within a manifest list
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Manifest is an image manifest in the schema 2 format
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// ManifestList references the images of multiple platforms
+type ManifestList struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// Repository is a repository within a registry, like k8s-staging/pause in
+// gcr.io/k8s-staging/pause
+type Repository struct {
+	// Registry is the host of the registry, optionally with a port
+	Registry string
+
+	// Name is the path of the repository within the registry
+	Name string
+}
+
+// String returns the repository as it is used by docker
+func (r Repository) String() string {
+	return r.Registry + "/" + r.Name
+}
+
+var (
+	nameRegex = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagRegex  = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+)
+
+// ParseRepository parses a repository like gcr.io/k8s-staging/pause. The
+// first path component is always the registry host.
+func ParseRepository(repository string) (Repository, error) {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return Repository{}, errors.Errorf(
+			"repository %q does not contain a registry host", repository,
+		)
+	}
+	if !nameRegex.MatchString(parts[1]) {
+		return Repository{}, errors.Errorf("invalid repository name %q", parts[1])
+	}
+	return Repository{Registry: parts[0], Name: parts[1]}, nil
+}
+
+// ValidateTag returns an error if the tag is not a valid image tag
+func ValidateTag(tag string) error {
+	if !tagRegex.MatchString(tag) {
+		return errors.Errorf("invalid image tag %q", tag)
+	}
+	return nil
+}
+
+// Digest returns the sha256 digest of the content
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// digester calculates the digest of everything written to it
+type digester struct {
+	hash.Hash
+}
+
+func newDigester() *digester {
+	return &digester{sha256.New()}
+}
+
+// Digest returns the sha256 digest of the written content
+func (d *digester) Digest() string {
+	return "sha256:" + hex.EncodeToString(d.Sum(nil))
+}
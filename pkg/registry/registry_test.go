@@ -0,0 +1,293 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/release/pkg/command"
+)
+
+// newTestRegistry starts a fake registry and returns a client for it
+func newTestRegistry(t *testing.T) (*FakeRegistry, *Client, func()) {
+	fake := NewFakeRegistry()
+	server := httptest.NewServer(fake)
+	u, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	return fake, NewClient(u.Host, &ClientOptions{Insecure: true}), server.Close
+}
+
+// newImageTarball writes a fake image tarball into a temporary directory
+func newImageTarball(t *testing.T, repoTag, arch string) (*ImageTarball, func()) {
+	dir, err := ioutil.TempDir("", "image-")
+	require.Nil(t, err)
+	path := filepath.Join(dir, "image.tar")
+	require.Nil(t, WriteFakeImageTarball(path, repoTag, arch))
+	image, err := ReadImageTarball(path)
+	require.Nil(t, err)
+	return image, func() { require.Nil(t, os.RemoveAll(dir)) }
+}
+
+// newImage writes a fake image tarball and compresses its layers
+func newImage(t *testing.T, repoTag, arch string) (*Image, func()) {
+	tarball, cleanup := newImageTarball(t, repoTag, arch)
+	image, err := NewImage(tarball)
+	require.Nil(t, err)
+	return image, func() {
+		require.Nil(t, image.Close())
+		cleanup()
+	}
+}
+
+func TestParseRepository(t *testing.T) {
+	cases := map[string]struct {
+		repository string
+		want       Repository
+		shouldErr  bool
+	}{
+		"GCR": {
+			repository: "gcr.io/k8s-staging-kubernetes",
+			want:       Repository{Registry: "gcr.io", Name: "k8s-staging-kubernetes"},
+		},
+		"Nested": {
+			repository: "localhost:5000/kubernetes/kube-apiserver-amd64",
+			want:       Repository{Registry: "localhost:5000", Name: "kubernetes/kube-apiserver-amd64"},
+		},
+		"NoRegistry":    {repository: "kube-apiserver", shouldErr: true},
+		"UpperCase":     {repository: "gcr.io/Kubernetes", shouldErr: true},
+		"TrailingSlash": {repository: "gcr.io/kubernetes/", shouldErr: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			res, err := ParseRepository(tc.repository)
+			require.Equal(t, tc.shouldErr, err != nil, err)
+			require.Equal(t, tc.want, res)
+			if !tc.shouldErr {
+				require.Equal(t, tc.repository, res.String())
+			}
+		})
+	}
+}
+
+func TestReadImageTarball(t *testing.T) {
+	image, cleanup := newImageTarball(t, "k8s.gcr.io/pause-arm64:3.1", "arm64")
+	defer cleanup()
+
+	require.Equal(t, []string{"k8s.gcr.io/pause-arm64:3.1"}, image.RepoTags)
+	require.Len(t, image.Layers, 1)
+
+	// Layers get compressed with the digest of the compressed content
+	compressed := &bytes.Buffer{}
+	digest, err := image.WriteLayer(image.Layers[0], compressed)
+	require.Nil(t, err)
+	require.Equal(t, Digest(compressed.Bytes()), digest)
+
+	gz, err := gzip.NewReader(compressed)
+	require.Nil(t, err)
+	tr := tar.NewReader(gz)
+	h, err := tr.Next()
+	require.Nil(t, err)
+	require.Equal(t, "arm64", h.Name)
+
+	_, err = image.WriteLayer("missing", compressed)
+	require.NotNil(t, err)
+
+	_, err = ReadImageTarball(filepath.Join(filepath.Dir(image.Path), "missing.tar"))
+	require.NotNil(t, err)
+}
+
+func TestNewImage(t *testing.T) {
+	image, cleanup := newImage(t, "k8s.gcr.io/pause-arm64:3.1", "arm64")
+	defer cleanup()
+
+	require.Equal(t, &Platform{Architecture: "arm64", OS: "linux"}, image.descriptor.Platform)
+	manifest, err := image.image.RawManifest()
+	require.Nil(t, err)
+	require.Equal(t, Digest(manifest), image.descriptor.Digest)
+
+	// The layers are compressed once into the temporary directory
+	layers, err := image.image.Layers()
+	require.Nil(t, err)
+	require.Len(t, layers, 1)
+	entries, err := ioutil.ReadDir(image.dir)
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+	compressed, err := ioutil.ReadFile(filepath.Join(image.dir, entries[0].Name()))
+	require.Nil(t, err)
+	digest, err := layers[0].Digest()
+	require.Nil(t, err)
+	require.Equal(t, Digest(compressed), digest.String())
+
+	require.Nil(t, image.Close())
+	_, err = os.Stat(image.dir)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestPushImage(t *testing.T) {
+	fake, client, stop := newTestRegistry(t)
+	defer stop()
+	ctx := context.Background()
+
+	images := []*Image{}
+	descriptors := []Descriptor{}
+	for _, arch := range []string{"amd64", "arm64"} {
+		image, cleanup := newImage(t, "k8s.gcr.io/pause-"+arch+":3.1", arch)
+		defer cleanup()
+		images = append(images, image)
+
+		descriptor, err := PushImage(ctx, client, "kubernetes/pause-"+arch, "v1.18.0", image)
+		require.Nil(t, err)
+		require.Equal(t, &Platform{Architecture: arch, OS: "linux"}, descriptor.Platform)
+		descriptors = append(descriptors, *descriptor)
+
+		mediaType, content, err := client.GetManifest(ctx, "kubernetes/pause-"+arch, "v1.18.0")
+		require.Nil(t, err)
+		require.Equal(t, MediaTypeManifest, mediaType)
+		require.Equal(t, descriptor.Digest, Digest(content))
+
+		manifest := Manifest{}
+		require.Nil(t, json.Unmarshal(content, &manifest))
+		config, ok := fake.Blob("kubernetes/pause-"+arch, manifest.Config.Digest)
+		require.True(t, ok)
+		require.Equal(t, image.tarball.Config, config)
+	}
+	require.Equal(t, 4, fake.Uploads())
+	require.Zero(t, fake.Mounts())
+
+	// Manifests of other repositories can't be referenced
+	_, err := PushManifestList(ctx, client, "kubernetes/pause", "v1.18.0", descriptors)
+	require.NotNil(t, err)
+
+	// Pushing the images to another repository mounts their layers, while
+	// pushing them again does not upload anything
+	for i, image := range images {
+		descriptor, err := PushImage(ctx, client, "kubernetes/pause", descriptors[i].Digest, image)
+		require.Nil(t, err)
+		require.Equal(t, descriptors[i], *descriptor)
+		_, err = PushImage(ctx, client, "kubernetes/pause", "v1.18.0-"+descriptor.Platform.Architecture, image)
+		require.Nil(t, err)
+	}
+	require.Equal(t, 6, fake.Uploads())
+	require.Equal(t, 2, fake.Mounts())
+
+	digest, err := PushManifestList(ctx, client, "kubernetes/pause", "v1.18.0", descriptors)
+	require.Nil(t, err)
+	mediaType, content, err := client.GetManifest(ctx, "kubernetes/pause", "v1.18.0")
+	require.Nil(t, err)
+	require.Equal(t, MediaTypeManifestList, mediaType)
+	require.Equal(t, digest, Digest(content))
+
+	list := ManifestList{}
+	require.Nil(t, json.Unmarshal(content, &list))
+	require.Equal(t, descriptors, list.Manifests)
+}
+
+func TestPushImageDryRun(t *testing.T) {
+	fake, client, stop := newTestRegistry(t)
+	defer stop()
+	ctx := context.Background()
+	command.ResetDryRunSummary()
+	command.SetGlobalDryRunPolicy(command.DryRunMutating)
+	defer command.SetGlobalDryRunPolicy(command.DryRunDisabled)
+
+	image, cleanup := newImage(t, "k8s.gcr.io/pause-amd64:3.1", "amd64")
+	defer cleanup()
+
+	// The descriptors get computed without writing to the registry
+	descriptor, err := PushImage(ctx, client, "kubernetes/pause-amd64", "v1.18.0", image)
+	require.Nil(t, err)
+	require.Equal(t, image.descriptor.Digest, descriptor.Digest)
+	_, err = PushManifestList(ctx, client, "kubernetes/pause", "v1.18.0", []Descriptor{*descriptor})
+	require.Nil(t, err)
+
+	require.Zero(t, fake.Uploads())
+	require.Zero(t, fake.Mounts())
+	_, _, err = client.GetManifest(ctx, "kubernetes/pause-amd64", "v1.18.0")
+	require.NotNil(t, err)
+	_, _, err = client.GetManifest(ctx, "kubernetes/pause", "v1.18.0")
+	require.NotNil(t, err)
+	require.Len(t, command.DryRunSummary(), 2)
+}
+
+func TestPushImageAuth(t *testing.T) {
+	fake, client, stop := newTestRegistry(t)
+	defer stop()
+	fake.RequireAuth("oauth2accesstoken", "secret")
+	ctx := context.Background()
+
+	image, cleanup := newImage(t, "k8s.gcr.io/pause-amd64:3.1", "amd64")
+	defer cleanup()
+
+	// Anonymous clients don't get a token
+	_, err := PushImage(ctx, client, "kubernetes/pause", "v1.18.0", image)
+	require.NotNil(t, err)
+
+	// The credentials get exchanged for a bearer token
+	client = NewClient(client.Registry(), &ClientOptions{
+		Insecure: true,
+		Auth:     &authn.Basic{Username: "oauth2accesstoken", Password: "secret"},
+	})
+	descriptor, err := PushImage(ctx, client, "kubernetes/pause", "v1.18.0", image)
+	require.Nil(t, err)
+	_, err = PushManifestList(ctx, client, "kubernetes/pause", "v1.18.0", []Descriptor{*descriptor})
+	require.Nil(t, err)
+	_, content, err := client.GetManifest(ctx, "kubernetes/pause", "v1.18.0")
+	require.Nil(t, err)
+	require.Contains(t, string(content), descriptor.Digest)
+}
+
+func TestPushImageFailure(t *testing.T) {
+	_, client, stop := newTestRegistry(t)
+	defer stop()
+	ctx := context.Background()
+
+	image, cleanup := newImage(t, "k8s.gcr.io/pause-amd64:3.1", "amd64")
+	defer cleanup()
+
+	// Invalid tag
+	_, err := PushImage(ctx, client, "kubernetes/pause", "v1.18.0+abcdef", image)
+	require.NotNil(t, err)
+
+	// Digest of another manifest
+	_, err = PushImage(ctx, client, "kubernetes/pause", Digest([]byte("other")), image)
+	require.NotNil(t, err)
+
+	// Canceled context
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = PushImage(canceled, client, "kubernetes/pause", "v1.18.0", image)
+	require.NotNil(t, err)
+
+	// Registry not reachable
+	stop()
+	_, err = PushImage(ctx, client, "kubernetes/pause", "v1.18.0", image)
+	require.NotNil(t, err)
+}
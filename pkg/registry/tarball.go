@@ -0,0 +1,167 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// ImageTarball is a single image saved by `docker save`
+type ImageTarball struct {
+	// Path is the path of the tarball
+	Path string
+
+	// RepoTags are the tags of the image, like k8s.gcr.io/pause-amd64:3.1
+	RepoTags []string
+
+	// Config is the image config
+	Config []byte
+
+	// Layers are the paths of the layers within the tarball, from the base
+	// layer upwards
+	Layers []string
+}
+
+// tarballManifest is an entry of the manifest.json of a saved image
+type tarballManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// ReadImageTarball reads the manifest and config of the image saved in the
+// tarball. Tarballs containing multiple images are not supported.
+func ReadImageTarball(tarball string) (*ImageTarball, error) {
+	content, err := readTarFile(tarball, "manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	manifests := []tarballManifest{}
+	if err := json.Unmarshal(content, &manifests); err != nil {
+		return nil, errors.Wrapf(err, "parsing manifest.json of %s", tarball)
+	}
+	if len(manifests) != 1 {
+		return nil, errors.Errorf(
+			"%s contains %d images, expected exactly one", tarball, len(manifests),
+		)
+	}
+	manifest := manifests[0]
+	if len(manifest.Layers) == 0 {
+		return nil, errors.Errorf("image in %s has no layers", tarball)
+	}
+
+	config, err := readTarFile(tarball, manifest.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &ImageTarball{
+		Path:     tarball,
+		RepoTags: manifest.RepoTags,
+		Config:   config,
+		Layers:   manifest.Layers,
+	}, nil
+}
+
+// WriteLayer writes the gzip compressed layer to w and returns the digest of
+// the compressed layer. Layers which are already compressed are written
+// unchanged.
+func (i *ImageTarball) WriteLayer(layer string, w io.Writer) (digest string, err error) {
+	var res string
+	err = walkTar(i.Path, func(name string, r io.Reader) (bool, error) {
+		if path.Clean(name) != path.Clean(layer) {
+			return false, nil
+		}
+
+		buffered := bufio.NewReader(r)
+		magic, err := buffered.Peek(2)
+		if err != nil && err != io.EOF {
+			return true, err
+		}
+
+		hash := newDigester()
+		out := io.MultiWriter(w, hash)
+		if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+			_, err = io.Copy(out, buffered)
+		} else {
+			gz := gzip.NewWriter(out)
+			if _, err = io.Copy(gz, buffered); err == nil {
+				err = gz.Close()
+			}
+		}
+		res = hash.Digest()
+		return true, err
+	})
+	if err == nil && res == "" {
+		err = errors.Errorf("layer %s not found in %s", layer, i.Path)
+	}
+	return res, errors.Wrapf(err, "compressing layer %s", layer)
+}
+
+// readTarFile returns the content of the file within the tarball
+func readTarFile(tarball, file string) ([]byte, error) {
+	var content []byte
+	err := walkTar(tarball, func(name string, r io.Reader) (bool, error) {
+		if path.Clean(name) != path.Clean(file) {
+			return false, nil
+		}
+		var err error
+		content, err = ioutil.ReadAll(r)
+		return true, err
+	})
+	if err == nil && content == nil {
+		err = errors.Errorf("%s not found", file)
+	}
+	return content, errors.Wrapf(err, "reading %s from %s", file, tarball)
+}
+
+// walkTar calls fn for every regular file within the uncompressed tarball
+// until fn returns true or an error
+func walkTar(tarball string, fn func(name string, r io.Reader) (bool, error)) error {
+	file, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeRegA {
+			continue
+		}
+		done, err := fn(h.Name, tr)
+		if done || err != nil {
+			return err
+		}
+	}
+}
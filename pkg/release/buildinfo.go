@@ -0,0 +1,261 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/release/pkg/util"
+)
+
+// BuildInfo describes the builds found within a kubernetes output tree
+type BuildInfo struct {
+	// Path is the root of the tree, usually a kubernetes checkout
+	Path string
+
+	// ReleaseKind is the kind of release, like kubernetes
+	ReleaseKind string
+
+	// Builds are the found builds, the most recent one first
+	Builds []*Build
+}
+
+// Build is the output of a single build system
+type Build struct {
+	// Builder is either BuilderBazel or BuilderDockerized
+	Builder string
+
+	// ReleaseTarsPath is the directory containing the release tarballs
+	ReleaseTarsPath string
+
+	// Tarballs are the names of all tarballs within ReleaseTarsPath
+	Tarballs []string
+
+	// ModTime is the modification time of the release kind tarball
+	ModTime time.Time
+
+	// Versions are the versions read from all available sources
+	Versions []VersionSource
+}
+
+// VersionSource is a version read from a single source of a build
+type VersionSource struct {
+	// Source is the path of the version file relative to the tree, where
+	// files within tarballs are separated by a colon
+	Source string
+
+	// Version is the trimmed content of the version file
+	Version string
+
+	// Err is set if the version could not be read
+	Err error
+}
+
+// buildSystem describes where a build system puts its output
+type buildSystem struct {
+	builder         string
+	releaseTarsPath string
+	versionPath     string
+}
+
+var buildSystems = []buildSystem{
+	{BuilderBazel, bazelBuildPath, bazelVersionPath},
+	{BuilderDockerized, dockerBuildPath, ""},
+}
+
+// DiscoverBuild inspects the output tree at path for builds of the release
+// kind. A build system is considered to have produced a build if the release
+// kind tarball, like kubernetes.tar.gz, exists. Unreadable version sources do
+// not fail the discovery but are reported by Build.Version.
+func DiscoverBuild(path, releaseKind string) (*BuildInfo, error) {
+	info := &BuildInfo{Path: path, ReleaseKind: releaseKind}
+	tarball := releaseKind + tarballExtension
+
+	for _, system := range buildSystems {
+		releaseTars := filepath.Join(path, system.releaseTarsPath)
+		stat, err := os.Stat(filepath.Join(releaseTars, tarball))
+		if os.IsNotExist(err) {
+			logrus.Debugf("No %s build found in %s", system.builder, releaseTars)
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "inspecting %s build", system.builder)
+		}
+
+		build := &Build{
+			Builder:         system.builder,
+			ReleaseTarsPath: releaseTars,
+			ModTime:         stat.ModTime(),
+		}
+		build.Tarballs, err = listTarballs(releaseTars)
+		if err != nil {
+			return nil, err
+		}
+
+		if system.versionPath != "" {
+			source := VersionSource{Source: system.versionPath}
+			source.Version, source.Err = readVersionFile(filepath.Join(path, system.versionPath))
+			if !os.IsNotExist(errors.Cause(source.Err)) {
+				build.Versions = append(build.Versions, source)
+			}
+		}
+
+		// The release kind tarball contains the version of every build
+		versionFile := filepath.Join(releaseKind, dockerVersionPath)
+		source := VersionSource{
+			Source: filepath.Join(system.releaseTarsPath, tarball) + ":" + versionFile,
+		}
+		source.Version, source.Err = readTarballVersion(
+			filepath.Join(releaseTars, tarball), versionFile,
+		)
+		build.Versions = append(build.Versions, source)
+
+		info.Builds = append(info.Builds, build)
+	}
+
+	sort.SliceStable(info.Builds, func(i, j int) bool {
+		return info.Builds[i].ModTime.After(info.Builds[j].ModTime)
+	})
+	return info, nil
+}
+
+// Latest returns the most recent build. It fails if there is no build at all
+// or if the most recent one is ambiguous.
+func (i *BuildInfo) Latest() (*Build, error) {
+	if len(i.Builds) == 0 {
+		paths := []string{}
+		for _, system := range buildSystems {
+			paths = append(paths, filepath.Join(system.releaseTarsPath, i.ReleaseKind+tarballExtension))
+		}
+		return nil, errors.Errorf(
+			"no %s build found in %s, none of %s exists",
+			i.ReleaseKind, i.Path, strings.Join(paths, ", "),
+		)
+	}
+
+	latest := i.Builds[0]
+	for _, build := range i.Builds[1:] {
+		if build.ModTime.Equal(latest.ModTime) {
+			return nil, errors.Errorf(
+				"unable to determine the latest build: %s and %s build were modified at %s",
+				latest.Builder, build.Builder, latest.ModTime,
+			)
+		}
+		logrus.Infof(
+			"Ignoring older %s build from %s in favor of %s build from %s",
+			build.Builder, build.ModTime, latest.Builder, latest.ModTime,
+		)
+	}
+	return latest, nil
+}
+
+// Version returns the version of the build if all version sources agree
+func (b *Build) Version() (string, error) {
+	if len(b.Versions) == 0 {
+		return "", errors.Errorf("no version source found for %s build", b.Builder)
+	}
+
+	failures := []string{}
+	versions := map[string]bool{}
+	for _, source := range b.Versions {
+		if source.Err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", source.Source, source.Err))
+			continue
+		}
+		versions[source.Version] = true
+	}
+	if len(failures) > 0 {
+		return "", errors.Errorf(
+			"unable to read version of %s build:\n%s", b.Builder, strings.Join(failures, "\n"),
+		)
+	}
+
+	if len(versions) > 1 {
+		for _, source := range b.Versions {
+			failures = append(failures, fmt.Sprintf("%s: %s", source.Source, source.Version))
+		}
+		return "", errors.Errorf(
+			"inconsistent versions for %s build:\n%s", b.Builder, strings.Join(failures, "\n"),
+		)
+	}
+	return b.Versions[0].Version, nil
+}
+
+// HasTarball returns true if the build contains the tarball
+func (b *Build) HasTarball(name string) bool {
+	for _, tarball := range b.Tarballs {
+		if tarball == name {
+			return true
+		}
+	}
+	return false
+}
+
+// listTarballs returns the sorted names of all tarballs in the directory
+func listTarballs(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing tarballs in %s", dir)
+	}
+	tarballs := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), tarballExtension) {
+			tarballs = append(tarballs, file.Name())
+		}
+	}
+	return tarballs, nil
+}
+
+// readVersionFile reads a version file and trims its whitespace
+func readVersionFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "reading version file")
+	}
+	version := strings.TrimSpace(string(content))
+	if version == "" {
+		return "", errors.New("version file is empty")
+	}
+	return version, nil
+}
+
+// readTarballVersion reads a version file from within a gzipped tarball and
+// trims its whitespace
+func readTarballVersion(tarball, file string) (string, error) {
+	reader, err := util.ReadFileFromGzippedTar(tarball, file)
+	if err != nil {
+		return "", errors.Wrap(err, "reading version from tarball")
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", errors.Wrap(err, "reading version from tarball")
+	}
+	version := strings.TrimSpace(string(content))
+	if version == "" {
+		return "", errors.New("version file is empty")
+	}
+	return version, nil
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeReleaseTarball writes a gzipped tarball containing the version file
+// of the release kind, or no version file if version is empty
+func writeReleaseTarball(t *testing.T, path, releaseKind, version string) {
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	file, err := os.Create(path)
+	require.Nil(t, err)
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{
+		releaseKind + "/README.md": "readme",
+		releaseKind + "/version":   version,
+	} {
+		if content == "" {
+			continue
+		}
+		require.Nil(t, tw.WriteHeader(&tar.Header{
+			Name: name, Mode: 0o644, Size: int64(len(content)),
+		}))
+		_, err = tw.Write([]byte(content))
+		require.Nil(t, err)
+	}
+	require.Nil(t, tw.Close())
+	require.Nil(t, gz.Close())
+	require.Nil(t, file.Close())
+}
+
+// newOutputTree creates a kubernetes tree with an optional bazel and
+// dockerized build. The bazel build is older than the dockerized one.
+func newOutputTree(t *testing.T, bazelVersion, bazelTarVersion, dockerVersion string) string {
+	dir, err := ioutil.TempDir("", "output-tree-")
+	require.Nil(t, err)
+
+	past := time.Now().Add(-time.Hour)
+	if bazelTarVersion != "" {
+		tarball := filepath.Join(dir, bazelBuildPath, "kubernetes.tar.gz")
+		writeReleaseTarball(t, tarball, "kubernetes", bazelTarVersion)
+		require.Nil(t, os.Chtimes(tarball, past, past))
+	}
+	if bazelVersion != "" {
+		path := filepath.Join(dir, bazelVersionPath)
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.Nil(t, ioutil.WriteFile(path, []byte(bazelVersion+"\n"), 0o644))
+	}
+	if dockerVersion != "" {
+		releaseTars := filepath.Join(dir, dockerBuildPath)
+		writeReleaseTarball(t, filepath.Join(releaseTars, "kubernetes.tar.gz"), "kubernetes", dockerVersion)
+		writeReleaseTarball(t, filepath.Join(releaseTars, "kubernetes-client-linux-amd64.tar.gz"), "kubernetes", "")
+	}
+	return dir
+}
+
+func TestDiscoverBuild(t *testing.T) {
+	dir := newOutputTree(t, "v1.18.0-alpha.1", "v1.18.0-alpha.1", "v1.18.0-alpha.2")
+	defer cleanupTmps(t, dir)
+
+	info, err := DiscoverBuild(dir, "kubernetes")
+	require.Nil(t, err)
+	require.Len(t, info.Builds, 2)
+
+	latest, err := info.Latest()
+	require.Nil(t, err)
+	require.Equal(t, BuilderDockerized, latest.Builder)
+	require.Equal(t, filepath.Join(dir, dockerBuildPath), latest.ReleaseTarsPath)
+	require.Equal(t, []string{
+		"kubernetes-client-linux-amd64.tar.gz",
+		"kubernetes.tar.gz",
+	}, latest.Tarballs)
+	require.True(t, latest.HasTarball("kubernetes-client-linux-amd64.tar.gz"))
+	require.False(t, latest.HasTarball("kubernetes-server-linux-amd64.tar.gz"))
+	version, err := latest.Version()
+	require.Nil(t, err)
+	require.Equal(t, "v1.18.0-alpha.2", version)
+
+	bazel := info.Builds[1]
+	require.Equal(t, BuilderBazel, bazel.Builder)
+	require.Len(t, bazel.Versions, 2)
+	version, err = bazel.Version()
+	require.Nil(t, err)
+	require.Equal(t, "v1.18.0-alpha.1", version)
+
+	isBazel, err := BuiltWithBazel(dir, "kubernetes")
+	require.Nil(t, err)
+	require.False(t, isBazel)
+}
+
+func TestDiscoverBuildVersion(t *testing.T) {
+	cases := map[string]struct {
+		bazelVersion    string
+		bazelTarVersion string
+		want            string
+		shouldErr       bool
+	}{
+		"Consistent": {
+			bazelVersion:    "v1.18.0",
+			bazelTarVersion: "v1.18.0",
+			want:            "v1.18.0",
+		},
+		"TarballOnly": {
+			bazelTarVersion: "v1.18.0",
+			want:            "v1.18.0",
+		},
+		"Inconsistent": {
+			bazelVersion:    "v1.18.0",
+			bazelTarVersion: "v1.18.1",
+			shouldErr:       true,
+		},
+		"MissingTarballVersion": {
+			bazelVersion:    "v1.18.0",
+			bazelTarVersion: "",
+			shouldErr:       true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := newOutputTree(t, tc.bazelVersion, "none", "")
+			defer cleanupTmps(t, dir)
+			writeReleaseTarball(t,
+				filepath.Join(dir, bazelBuildPath, "kubernetes.tar.gz"),
+				"kubernetes", tc.bazelTarVersion,
+			)
+
+			info, err := DiscoverBuild(dir, "kubernetes")
+			require.Nil(t, err)
+			latest, err := info.Latest()
+			require.Nil(t, err)
+			require.Equal(t, BuilderBazel, latest.Builder)
+
+			version, err := latest.Version()
+			require.Equal(t, tc.shouldErr, err != nil, err)
+			require.Equal(t, tc.want, version)
+		})
+	}
+}
+
+func TestDiscoverBuildFailure(t *testing.T) {
+	// No build at all
+	dir := newOutputTree(t, "v1.18.0", "", "")
+	defer cleanupTmps(t, dir)
+	info, err := DiscoverBuild(dir, "kubernetes")
+	require.Nil(t, err)
+	require.Empty(t, info.Builds)
+	_, err = info.Latest()
+	require.NotNil(t, err)
+	_, err = BuiltWithBazel(dir, "kubernetes")
+	require.NotNil(t, err)
+
+	// Corrupt tarball
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, dockerBuildPath), os.ModePerm))
+	require.Nil(t, ioutil.WriteFile(
+		filepath.Join(dir, dockerBuildPath, "kubernetes.tar.gz"), []byte("invalid"), 0o644,
+	))
+	info, err = DiscoverBuild(dir, "kubernetes")
+	require.Nil(t, err)
+	latest, err := info.Latest()
+	require.Nil(t, err)
+	_, err = latest.Version()
+	require.NotNil(t, err)
+
+	// Same modification time
+	dir = newOutputTree(t, "", "v1.18.0", "v1.18.0")
+	defer cleanupTmps(t, dir)
+	now := time.Now()
+	for _, path := range []string{bazelBuildPath, dockerBuildPath} {
+		require.Nil(t, os.Chtimes(filepath.Join(dir, path, "kubernetes.tar.gz"), now, now))
+	}
+	info, err = DiscoverBuild(dir, "kubernetes")
+	require.Nil(t, err)
+	_, err = info.Latest()
+	require.NotNil(t, err)
+}
@@ -0,0 +1,337 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SHA256Manifest is the manifest containing the SHA256 hashes of all
+	// release artifacts
+	SHA256Manifest = "SHA256SUMS"
+
+	// SHA512Manifest is the manifest containing the SHA512 hashes of all
+	// release artifacts
+	SHA512Manifest = "SHA512SUMS"
+)
+
+// hashAlgorithm is a hash which gets written as per-file sidecar
+type hashAlgorithm struct {
+	// extension is the file extension of the sidecar
+	extension string
+
+	// manifest is the name of the manifest file, if any
+	manifest string
+
+	// legacy algorithms are only published for versions before 1.18
+	legacy bool
+
+	new func() hash.Hash
+}
+
+var hashAlgorithms = []hashAlgorithm{
+	{extension: ".md5", legacy: true, new: md5.New},
+	{extension: ".sha1", legacy: true, new: sha1.New},
+	{extension: ".sha256", manifest: SHA256Manifest, new: sha256.New},
+	{extension: ".sha512", manifest: SHA512Manifest, new: sha512.New},
+}
+
+// UsesLegacyHashes returns true if .md5 and .sha1 files should be published
+// for the release, which is only the case for versions before 1.18
+func UsesLegacyHashes(version Version) bool {
+	return version.Major < 1 || (version.Major == 1 && version.Minor < 18)
+}
+
+// WriteChecksums writes the SHA256SUMS and SHA512SUMS manifests in the
+// coreutils format for all files within the directory, followed by the
+// per-file .sha256 and .sha512 sidecars for all files including the
+// manifests. Legacy .md5 and .sha1 sidecars are written if legacy is set.
+func WriteChecksums(dir string, legacy bool) error {
+	artifacts, err := listArtifacts(dir)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Writing artifact hashes to %s/%s and %s", dir, SHA256Manifest, SHA512Manifest)
+	hashes := map[string]map[string]string{}
+	for _, artifact := range artifacts {
+		h, err := hashFile(filepath.Join(dir, artifact), legacy)
+		if err != nil {
+			return err
+		}
+		hashes[artifact] = h
+	}
+
+	for _, algorithm := range hashAlgorithms {
+		if algorithm.manifest == "" {
+			continue
+		}
+		content := &strings.Builder{}
+		for _, artifact := range artifacts {
+			fmt.Fprintf(content, "%s  %s\n", hashes[artifact][algorithm.extension], artifact)
+		}
+		if err := ioutil.WriteFile(
+			filepath.Join(dir, algorithm.manifest), []byte(content.String()), 0o644,
+		); err != nil {
+			return errors.Wrapf(err, "writing %s", algorithm.manifest)
+		}
+	}
+
+	logrus.Infof("Hashing files in %s", dir)
+	for _, algorithm := range hashAlgorithms {
+		if algorithm.manifest == "" {
+			continue
+		}
+		h, err := hashFile(filepath.Join(dir, algorithm.manifest), legacy)
+		if err != nil {
+			return err
+		}
+		hashes[algorithm.manifest] = h
+	}
+	for file, h := range hashes {
+		for extension, sum := range h {
+			if err := ioutil.WriteFile(
+				filepath.Join(dir, file+extension), []byte(sum+"\n"), 0o644,
+			); err != nil {
+				return errors.Wrapf(err, "writing %s hash of %s", extension, file)
+			}
+		}
+	}
+	return nil
+}
+
+// Verify checks all files within the directory, like a staged or downloaded
+// release, against the SHA256SUMS and SHA512SUMS manifests and against all
+// available hash sidecars. At least one manifest has to exist.
+func Verify(dir string) error {
+	failures := []string{}
+	manifests := 0
+	for _, algorithm := range hashAlgorithms {
+		if algorithm.manifest == "" {
+			continue
+		}
+		entries, err := readManifest(filepath.Join(dir, algorithm.manifest))
+		if os.IsNotExist(errors.Cause(err)) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		manifests++
+
+		for file, want := range entries {
+			got, err := hashWith(filepath.Join(dir, file), algorithm.new)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", file, err))
+				continue
+			}
+			if got != want {
+				failures = append(failures, fmt.Sprintf(
+					"%s: %s mismatch, got %s want %s", file, algorithm.manifest, got, want,
+				))
+			}
+		}
+	}
+	if manifests == 0 {
+		return errors.Errorf(
+			"neither %s nor %s found in %s", SHA256Manifest, SHA512Manifest, dir,
+		)
+	}
+
+	sidecarFailures, err := verifySidecars(dir)
+	if err != nil {
+		return err
+	}
+	failures = append(failures, sidecarFailures...)
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return errors.Errorf(
+			"verification of %s failed:\n%s", dir, strings.Join(failures, "\n"),
+		)
+	}
+	return nil
+}
+
+// verifySidecars checks every hash sidecar against the file it belongs to
+func verifySidecars(dir string) ([]string, error) {
+	failures := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		algorithm, ok := sidecarAlgorithm(path)
+		if !ok {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		file := strings.TrimSuffix(path, algorithm.extension)
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		got, err := hashWith(file, algorithm.new)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", rel, err))
+			return nil
+		}
+		if want := strings.TrimSpace(string(content)); got != want {
+			failures = append(failures, fmt.Sprintf(
+				"%s: %s mismatch, got %s want %s", rel, algorithm.extension, got, want,
+			))
+		}
+		return nil
+	})
+	return failures, errors.Wrapf(err, "verifying hash files in %s", dir)
+}
+
+// readManifest parses a manifest in the coreutils format and returns the
+// hashes by slash separated file path
+func readManifest(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening manifest %s", path)
+	}
+	defer file.Close()
+	return parseManifest(file, path)
+}
+
+// parseManifest parses the content of a manifest in the coreutils format,
+// where path is only used for error messages
+func parseManifest(reader io.Reader, path string) (map[string]string, error) {
+	entries := map[string]string{}
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" {
+			continue
+		}
+		// Entries are "<hash>  <file>" or "<hash> *<file>" in binary mode
+		parts := strings.SplitN(text, " ", 2)
+		if len(parts) != 2 || len(parts[1]) < 2 {
+			return nil, errors.Errorf("invalid entry in %s line %d: %q", path, line, text)
+		}
+		entries[parts[1][1:]] = strings.ToLower(parts[0])
+	}
+	return entries, errors.Wrapf(scanner.Err(), "reading manifest %s", path)
+}
+
+// listArtifacts returns all files within the directory relative to it,
+// excluding manifests, hash sidecars and the provenance
+func listArtifacts(dir string) ([]string, error) {
+	artifacts := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if isArtifact(rel) {
+			artifacts = append(artifacts, rel)
+		}
+		return nil
+	})
+	sort.Strings(artifacts)
+	return artifacts, errors.Wrapf(err, "listing artifacts in %s", dir)
+}
+
+// isArtifact returns true if the slash separated path is neither a manifest,
+// a hash sidecar nor part of the provenance
+func isArtifact(rel string) bool {
+	if _, ok := sidecarAlgorithm(rel); ok {
+		return false
+	}
+	return rel != SHA256Manifest && rel != SHA512Manifest &&
+		rel != ProvenanceFile && rel != ProvenanceSignatureFile
+}
+
+// sidecarAlgorithm returns the hash algorithm if the path is a hash sidecar
+func sidecarAlgorithm(path string) (hashAlgorithm, bool) {
+	for _, algorithm := range hashAlgorithms {
+		if strings.HasSuffix(path, algorithm.extension) {
+			return algorithm, true
+		}
+	}
+	return hashAlgorithm{}, false
+}
+
+// hashFile returns the hex encoded hashes of the file by sidecar extension
+func hashFile(path string, legacy bool) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", path)
+	}
+	defer file.Close()
+
+	hashes := map[string]hash.Hash{}
+	writers := []io.Writer{}
+	for _, algorithm := range hashAlgorithms {
+		if algorithm.legacy && !legacy {
+			continue
+		}
+		h := algorithm.new()
+		hashes[algorithm.extension] = h
+		writers = append(writers, h)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return nil, errors.Wrapf(err, "hashing %s", path)
+	}
+
+	res := map[string]string{}
+	for extension, h := range hashes {
+		res[extension] = hex.EncodeToString(h.Sum(nil))
+	}
+	return res, nil
+}
+
+// hashWith returns the hex encoded hash of the file
+func hashWith(path string, newHash func() hash.Hash) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// listFiles returns all files below the directory relative to it
+func listFiles(t *testing.T, dir string) []string {
+	files := []string{}
+	require.Nil(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, rel)
+		return err
+	}))
+	sort.Strings(files)
+	return files
+}
+
+func TestUsesLegacyHashes(t *testing.T) {
+	require.True(t, UsesLegacyHashes(MustParseVersion("v1.17.3")))
+	require.True(t, UsesLegacyHashes(MustParseVersion("v0.9.0")))
+	require.False(t, UsesLegacyHashes(MustParseVersion("v1.18.0-alpha.1")))
+	require.False(t, UsesLegacyHashes(MustParseVersion("v2.0.0")))
+}
+
+func TestWriteChecksums(t *testing.T) {
+	cases := map[string]struct {
+		legacy bool
+		want   []string
+	}{
+		"Default": {
+			legacy: false,
+			want: []string{
+				"SHA256SUMS",
+				"SHA256SUMS.sha256",
+				"SHA256SUMS.sha512",
+				"SHA512SUMS",
+				"SHA512SUMS.sha256",
+				"SHA512SUMS.sha512",
+				"bin/linux/amd64/kubectl",
+				"bin/linux/amd64/kubectl.sha256",
+				"bin/linux/amd64/kubectl.sha512",
+				"kubernetes.tar.gz",
+				"kubernetes.tar.gz.sha256",
+				"kubernetes.tar.gz.sha512",
+			},
+		},
+		"Legacy": {
+			legacy: true,
+			want: []string{
+				"SHA256SUMS",
+				"SHA256SUMS.md5",
+				"SHA256SUMS.sha1",
+				"SHA256SUMS.sha256",
+				"SHA256SUMS.sha512",
+				"SHA512SUMS",
+				"SHA512SUMS.md5",
+				"SHA512SUMS.sha1",
+				"SHA512SUMS.sha256",
+				"SHA512SUMS.sha512",
+				"bin/linux/amd64/kubectl",
+				"bin/linux/amd64/kubectl.md5",
+				"bin/linux/amd64/kubectl.sha1",
+				"bin/linux/amd64/kubectl.sha256",
+				"bin/linux/amd64/kubectl.sha512",
+				"kubernetes.tar.gz",
+				"kubernetes.tar.gz.md5",
+				"kubernetes.tar.gz.sha1",
+				"kubernetes.tar.gz.sha256",
+				"kubernetes.tar.gz.sha512",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := newBuildOutput(t, "kubernetes.tar.gz", "bin/linux/amd64/kubectl")
+			defer cleanupTmps(t, dir)
+
+			require.Nil(t, WriteChecksums(dir, tc.legacy))
+			require.Equal(t, tc.want, listFiles(t, dir))
+			require.Nil(t, Verify(dir))
+
+			// Rewriting the checksums does not hash the hashes
+			require.Nil(t, WriteChecksums(dir, tc.legacy))
+			require.Equal(t, tc.want, listFiles(t, dir))
+		})
+	}
+}
+
+func TestWriteChecksumsFormat(t *testing.T) {
+	dir := newBuildOutput(t, "kubernetes.tar.gz", "bin/linux/amd64/kubectl")
+	defer cleanupTmps(t, dir)
+	require.Nil(t, WriteChecksums(dir, false))
+
+	// Output of sha256sum for the test files, which contain their own path
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, SHA256Manifest))
+	require.Nil(t, err)
+	require.Equal(t,
+		"0900e6a18087fb3431f424a2fda98bfd1d0fc30cf2ea3dbf427253f20c65cf9a  bin/linux/amd64/kubectl\n"+
+			"72aa4b1eb01c99221a891054752bee9817df83497b36302590589a348ba6de50  kubernetes.tar.gz\n",
+		string(manifest),
+	)
+
+	sidecar, err := ioutil.ReadFile(filepath.Join(dir, "kubernetes.tar.gz.sha256"))
+	require.Nil(t, err)
+	require.Equal(t,
+		"72aa4b1eb01c99221a891054752bee9817df83497b36302590589a348ba6de50\n",
+		string(sidecar),
+	)
+}
+
+func TestVerifyFailure(t *testing.T) {
+	dir := newBuildOutput(t, "kubernetes.tar.gz", "bin/linux/amd64/kubectl")
+	defer cleanupTmps(t, dir)
+
+	// No manifests
+	require.NotNil(t, Verify(dir))
+
+	require.Nil(t, WriteChecksums(dir, false))
+	require.Nil(t, ioutil.WriteFile(
+		filepath.Join(dir, "kubernetes.tar.gz"), []byte("modified"), 0o644,
+	))
+	require.Nil(t, os.Remove(filepath.Join(dir, "bin/linux/amd64/kubectl")))
+
+	err := Verify(dir)
+	require.NotNil(t, err)
+	for _, failure := range []string{
+		"kubernetes.tar.gz: SHA256SUMS mismatch",
+		"kubernetes.tar.gz: SHA512SUMS mismatch",
+		"kubernetes.tar.gz: .sha256 mismatch",
+		"kubernetes.tar.gz: .sha512 mismatch",
+		"bin/linux/amd64/kubectl: open",
+	} {
+		require.True(t, strings.Contains(err.Error(), failure), failure)
+	}
+
+	// Invalid manifest
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, SHA256Manifest), []byte("invalid\n"), 0o644))
+	require.NotNil(t, Verify(dir))
+}
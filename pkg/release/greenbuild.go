@@ -0,0 +1,319 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/release/pkg/object"
+)
+
+const (
+	// JobResultsBucket is the bucket containing the results of the CI jobs
+	JobResultsBucket = "kubernetes-jenkins"
+
+	// JobResultsPrefix is the path of the job results within the bucket
+	JobResultsPrefix = "logs"
+
+	jobResultsCache = "jobResultsCache.json"
+	jobResultPassed = "SUCCESS"
+
+	// DefaultContiguous is the default amount of contiguous passing runs of
+	// a job bracketing a build, which prove that the build passed the job
+	DefaultContiguous = 2
+
+	// DefaultGreenBuildLimit is the default amount of primary job builds to
+	// check before giving up
+	DefaultGreenBuildLimit = 100
+)
+
+// JobRun is a single run of a CI job
+type JobRun struct {
+	// Number is the run number of the job
+	Number int
+
+	// Passed indicates that the run succeeded
+	Passed bool
+
+	// Version is the build version tested by the run
+	Version Version
+}
+
+// JobResultSource provides the results of CI jobs
+type JobResultSource interface {
+	// JobRuns returns the runs of the job with a build version, ordered from
+	// the newest to the oldest run. A job without results returns no runs.
+	JobRuns(ctx context.Context, job string) ([]*JobRun, error)
+}
+
+// StoreJobResults reads the jobResultsCache.json files written by the CI
+// jobs from <prefix>/<job>/ of an object store. Use object.NewGCS for the
+// JobResultsBucket or object.NewLocal for a local copy of the files.
+type StoreJobResults struct {
+	store  object.Store
+	prefix string
+}
+
+// NewStoreJobResults creates a job result source for the store
+func NewStoreJobResults(store object.Store, prefix string) *StoreJobResults {
+	return &StoreJobResults{store: store, prefix: prefix}
+}
+
+// jobResult is an entry of the jobResultsCache.json
+type jobResult struct {
+	BuildNumber string `json:"buildnumber"`
+	Result      string `json:"result"`
+	Version     string `json:"version"`
+}
+
+// JobRuns implements JobResultSource
+func (s *StoreJobResults) JobRuns(ctx context.Context, job string) ([]*JobRun, error) {
+	name := path.Join(s.prefix, job, jobResultsCache)
+	content := &bytes.Buffer{}
+	if err := s.store.Download(ctx, name, content); err != nil {
+		if object.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "downloading results of %s", job)
+	}
+
+	results := []jobResult{}
+	if err := json.Unmarshal(content.Bytes(), &results); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s/%s", s.store, name)
+	}
+
+	runs := []*JobRun{}
+	for _, result := range results {
+		// Runs which failed before building don't have a version
+		if result.Version == "" {
+			continue
+		}
+		number, err := strconv.Atoi(result.BuildNumber)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing run number of %s", job)
+		}
+		version, err := ParseVersion(result.Version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing version of %s run %d", job, number)
+		}
+		runs = append(runs, &JobRun{
+			Number:  number,
+			Passed:  result.Result == jobResultPassed,
+			Version: version,
+		})
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Number > runs[j].Number
+	})
+	return runs, nil
+}
+
+// GreenBuildOptions are the options for finding a green build
+type GreenBuildOptions struct {
+	// Jobs are the blocking jobs, where the first one is the primary job
+	// whose passing runs are the candidates for the green build
+	Jobs []string
+
+	// Exclude are regular expressions of secondary jobs to ignore
+	Exclude []string
+
+	// Contiguous is the amount of contiguous passing runs of a secondary job
+	// required to prove that a build in between passed. A run testing
+	// exactly the build is always sufficient.
+	Contiguous int
+
+	// Limit is the maximum amount of builds of the primary job to check, where
+	// 0 means no limit
+	Limit int
+}
+
+// GreenBuild is a build which passed all blocking jobs
+type GreenBuild struct {
+	// Version is the build version
+	Version Version
+
+	// Run is the run of the primary job which tested the build
+	Run int
+
+	// Skipped are the secondary jobs which have no results
+	Skipped []string
+}
+
+// FindGreenBuild finds the newest build which passed all blocking jobs like
+// release::set_build_version does. The candidates are the passing runs of
+// the primary job. A build passed a secondary job if a passing run tested it
+// or if it lies between the builds of the oldest and newest of contiguous
+// passing runs. Secondary jobs without results are skipped.
+func FindGreenBuild(
+	ctx context.Context, source JobResultSource, opts *GreenBuildOptions,
+) (*GreenBuild, error) {
+	if len(opts.Jobs) == 0 {
+		return nil, errors.New("no blocking jobs provided")
+	}
+	if opts.Contiguous < 1 {
+		return nil, errors.Errorf("invalid amount of contiguous runs %d", opts.Contiguous)
+	}
+	excludes := []*regexp.Regexp{}
+	for _, exclude := range opts.Exclude {
+		re, err := regexp.Compile(exclude)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing exclude pattern %q", exclude)
+		}
+		excludes = append(excludes, re)
+	}
+
+	mainJob := opts.Jobs[0]
+	mainRuns, err := source.JobRuns(ctx, mainJob)
+	if err != nil {
+		return nil, err
+	}
+	if len(mainRuns) == 0 {
+		return nil, errors.Errorf("primary job %s has no results", mainJob)
+	}
+
+	green := &GreenBuild{Skipped: []string{}}
+	secondaryRuns := map[string][]*JobRun{}
+	secondaryJobs := []string{}
+jobs:
+	for _, job := range opts.Jobs[1:] {
+		for _, re := range excludes {
+			if re.MatchString(job) {
+				logrus.Infof("Excluding job %s", job)
+				continue jobs
+			}
+		}
+		runs, err := source.JobRuns(ctx, job)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) == 0 {
+			logrus.Warnf("Skipping job %s without results", job)
+			green.Skipped = append(green.Skipped, job)
+			continue
+		}
+		secondaryJobs = append(secondaryJobs, job)
+		secondaryRuns[job] = runs
+	}
+
+	// Builds newer than a failed one are not considered anymore
+	var giveUp *Version
+	checked := 0
+	last := ""
+	for _, run := range mainRuns {
+		// Only check each build once
+		if !run.Passed || run.Version.String() == last {
+			continue
+		}
+		last = run.Version.String()
+		if opts.Limit > 0 && checked == opts.Limit {
+			return nil, errors.Errorf("no green build found within %d builds of %s", opts.Limit, mainJob)
+		}
+		checked++
+
+		if !run.Version.IsBuild() {
+			return nil, errors.Errorf(
+				"%s run %d tested the tagged version %s without build information, "+
+					"which needs new commits on the branch",
+				mainJob, run.Number, run.Version,
+			)
+		}
+		if giveUp != nil && run.Version.GreaterThan(*giveUp) {
+			continue
+		}
+
+		logrus.Infof("Checking build %s of %s run %d", run.Version, mainJob, run.Number)
+		passed := true
+		for _, job := range secondaryJobs {
+			if secondary := passedBuild(secondaryRuns[job], run.Version, opts.Contiguous); secondary != nil {
+				logrus.Infof("Job %s passed in run %d", job, secondary.Number)
+				continue
+			}
+			// Keep going to show all failed jobs
+			logrus.Infof("Job %s did not pass", job)
+			passed = false
+		}
+		if passed {
+			green.Version = run.Version
+			green.Run = run.Number
+			return green, nil
+		}
+		version := run.Version
+		giveUp = &version
+	}
+	return nil, errors.Errorf("no green build found in the results of %s", mainJob)
+}
+
+// passedBuild returns the passing run proving that the build passed the job
+// or nil if there is none. The runs are ordered from newest to oldest.
+func passedBuild(runs []*JobRun, build Version, contiguous int) *JobRun {
+	for i, run := range runs {
+		if run.Passed && run.Version.String() == build.String() {
+			return run
+		}
+		if i+contiguous > len(runs) {
+			continue
+		}
+		window := runs[i : i+contiguous]
+		allPassed := true
+		for _, r := range window {
+			allPassed = allPassed && r.Passed
+		}
+		oldest := window[len(window)-1]
+		if allPassed &&
+			!build.GreaterThan(run.Version) && !build.LessThan(oldest.Version) &&
+			run.Number-oldest.Number == contiguous-1 {
+			return oldest
+		}
+	}
+	return nil
+}
+
+// branchRE matches release branches like release-1.17
+var branchRE = regexp.MustCompile(`^release-([0-9]+)\.([0-9]+)(\.[0-9]+)?$`)
+
+// GreenBuildReleaseVersion returns the version to release from the green build
+// of the branch like release::set_release_version does: an alpha for master
+// and a beta on release branches, or an official release or release candidate
+// if requested. Release candidates get incremented automatically.
+func GreenBuildReleaseVersion(build Version, branch string, official, rc bool) (Version, error) {
+	var kind PreRelease
+	switch {
+	case branch == "master":
+		if official || rc {
+			return Version{}, errors.New("official releases and release candidates need a release branch")
+		}
+		kind = PreReleaseAlpha
+	case !branchRE.MatchString(branch):
+		return Version{}, errors.Errorf("invalid branch %q", branch)
+	case official:
+		kind = PreReleaseNone
+	case rc || build.PreRelease == PreReleaseRC:
+		kind = PreReleaseRC
+	default:
+		kind = PreReleaseBeta
+	}
+	return build.Next(kind)
+}
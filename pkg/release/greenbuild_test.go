@@ -0,0 +1,281 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/release/pkg/object"
+)
+
+// newJobResults creates a local job result source with the results of the
+// jobs, which are given as "<run> <result> <version>"
+func newJobResults(t *testing.T, jobs map[string][]string) (*StoreJobResults, func()) {
+	ctx := context.Background()
+	store := newLocalStore(t)
+	for job, runs := range jobs {
+		results := []jobResult{}
+		for _, run := range runs {
+			fields := strings.Fields(run)
+			require.Len(t, fields, 3)
+			results = append(results, jobResult{
+				BuildNumber: fields[0], Result: fields[1], Version: fields[2],
+			})
+		}
+		content, err := json.Marshal(results)
+		require.Nil(t, err)
+		require.Nil(t, object.WriteString(
+			ctx, store, path.Join(JobResultsPrefix, job, jobResultsCache), string(content),
+		))
+	}
+	return NewStoreJobResults(store, JobResultsPrefix), func() {
+		require.Nil(t, os.RemoveAll(store.Root()))
+	}
+}
+
+func TestStoreJobResults(t *testing.T) {
+	source, cleanup := newJobResults(t, map[string][]string{
+		"ci-kubernetes-e2e-gce": {
+			"9 FAILURE v1.17.1-beta.0.12+aaaaaaa",
+			"11 SUCCESS v1.17.1-beta.0.14+bbbbbbb",
+			"10 SUCCESS v1.17.1-beta.0.12+aaaaaaa",
+		},
+		"ci-kubernetes-broken": {"1 SUCCESS 1.17"},
+	})
+	defer cleanup()
+	ctx := context.Background()
+
+	runs, err := source.JobRuns(ctx, "ci-kubernetes-e2e-gce")
+	require.Nil(t, err)
+	require.Equal(t, []*JobRun{
+		{Number: 11, Passed: true, Version: MustParseVersion("v1.17.1-beta.0.14+bbbbbbb")},
+		{Number: 10, Passed: true, Version: MustParseVersion("v1.17.1-beta.0.12+aaaaaaa")},
+		{Number: 9, Passed: false, Version: MustParseVersion("v1.17.1-beta.0.12+aaaaaaa")},
+	}, runs)
+
+	runs, err = source.JobRuns(ctx, "ci-kubernetes-missing")
+	require.Nil(t, err)
+	require.Empty(t, runs)
+
+	_, err = source.JobRuns(ctx, "ci-kubernetes-broken")
+	require.NotNil(t, err)
+}
+
+func TestFindGreenBuild(t *testing.T) {
+	primary := []string{
+		"10 SUCCESS v1.17.1-beta.0.20+aaaaaaa",
+		"9 SUCCESS v1.17.1-beta.0.20+aaaaaaa",
+		"8 FAILURE v1.17.1-beta.0.18+ccccccc",
+		"7 SUCCESS v1.17.1-beta.0.15+bbbbbbb",
+	}
+	serial := []string{
+		"5 SUCCESS v1.17.1-beta.0.22+ddddddd",
+		"4 SUCCESS v1.17.1-beta.0.17+eeeeeee",
+		"3 SUCCESS v1.17.1-beta.0.12+fffffff",
+	}
+	jobs := []string{"ci-kubernetes-e2e-gce", "ci-kubernetes-e2e-gce-serial", "ci-kubernetes-e2e-gce-slow"}
+
+	cases := map[string]struct {
+		results    map[string][]string
+		exclude    []string
+		contiguous int
+		limit      int
+		want       string
+		wantRun    int
+		skipped    []string
+		shouldErr  bool
+	}{
+		"Exact": {
+			results: map[string][]string{
+				"ci-kubernetes-e2e-gce":        primary,
+				"ci-kubernetes-e2e-gce-serial": {"2 SUCCESS v1.17.1-beta.0.20+aaaaaaa"},
+				"ci-kubernetes-e2e-gce-slow":   {"1 SUCCESS v1.17.1-beta.0.20+aaaaaaa"},
+			},
+			want:    "v1.17.1-beta.0.20+aaaaaaa",
+			wantRun: 10,
+		},
+		"Contiguous": {
+			results: map[string][]string{
+				"ci-kubernetes-e2e-gce":        primary,
+				"ci-kubernetes-e2e-gce-serial": serial,
+				"ci-kubernetes-e2e-gce-slow":   {"1 SUCCESS v1.17.1-beta.0.20+aaaaaaa"},
+			},
+			want:    "v1.17.1-beta.0.20+aaaaaaa",
+			wantRun: 10,
+		},
+		"OlderBuild": {
+			results: map[string][]string{
+				"ci-kubernetes-e2e-gce":        primary,
+				"ci-kubernetes-e2e-gce-serial": serial,
+				"ci-kubernetes-e2e-gce-slow": {
+					"2 FAILURE v1.17.1-beta.0.21+aaaaaaa",
+					"1 SUCCESS v1.17.1-beta.0.15+bbbbbbb",
+				},
+			},
+			want:    "v1.17.1-beta.0.15+bbbbbbb",
+			wantRun: 7,
+		},
+		"Limit": {
+			results: map[string][]string{
+				"ci-kubernetes-e2e-gce":        primary,
+				"ci-kubernetes-e2e-gce-serial": serial,
+				"ci-kubernetes-e2e-gce-slow": {
+					"2 FAILURE v1.17.1-beta.0.21+aaaaaaa",
+					"1 SUCCESS v1.17.1-beta.0.15+bbbbbbb",
+				},
+			},
+			limit:     1,
+			shouldErr: true,
+		},
+		"Excluded": {
+			results: map[string][]string{
+				"ci-kubernetes-e2e-gce":        primary,
+				"ci-kubernetes-e2e-gce-serial": serial,
+				"ci-kubernetes-e2e-gce-slow":   {"1 FAILURE v1.17.1-beta.0.20+aaaaaaa"},
+			},
+			exclude: []string{"slow$"},
+			want:    "v1.17.1-beta.0.20+aaaaaaa",
+			wantRun: 10,
+		},
+		"Skipped": {
+			results: map[string][]string{
+				"ci-kubernetes-e2e-gce":        primary,
+				"ci-kubernetes-e2e-gce-serial": serial,
+			},
+			want:    "v1.17.1-beta.0.20+aaaaaaa",
+			wantRun: 10,
+			skipped: []string{"ci-kubernetes-e2e-gce-slow"},
+		},
+		"MoreContiguous": {
+			results: map[string][]string{
+				"ci-kubernetes-e2e-gce":        primary,
+				"ci-kubernetes-e2e-gce-serial": serial,
+			},
+			contiguous: 3,
+			want:       "v1.17.1-beta.0.20+aaaaaaa",
+			wantRun:    10,
+			skipped:    []string{"ci-kubernetes-e2e-gce-slow"},
+		},
+		"NotContiguous": {
+			results: map[string][]string{
+				"ci-kubernetes-e2e-gce": primary,
+				"ci-kubernetes-e2e-gce-serial": {
+					"5 SUCCESS v1.17.1-beta.0.22+ddddddd",
+					"3 SUCCESS v1.17.1-beta.0.12+fffffff",
+				},
+			},
+			shouldErr: true,
+		},
+		"TaggedVersion": {
+			results: map[string][]string{
+				"ci-kubernetes-e2e-gce": {"1 SUCCESS v1.17.0"},
+			},
+			shouldErr: true,
+		},
+		"NoPrimaryResults": {
+			results: map[string][]string{
+				"ci-kubernetes-e2e-gce-serial": serial,
+			},
+			shouldErr: true,
+		},
+		"InvalidExclude": {
+			results: map[string][]string{
+				"ci-kubernetes-e2e-gce": primary,
+			},
+			exclude:   []string{"("},
+			shouldErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			source, cleanup := newJobResults(t, tc.results)
+			defer cleanup()
+
+			contiguous := tc.contiguous
+			if contiguous == 0 {
+				contiguous = DefaultContiguous
+			}
+			res, err := FindGreenBuild(context.Background(), source, &GreenBuildOptions{
+				Jobs:       jobs,
+				Exclude:    tc.exclude,
+				Contiguous: contiguous,
+				Limit:      tc.limit,
+			})
+			require.Equal(t, tc.shouldErr, err != nil, err)
+			if tc.shouldErr {
+				return
+			}
+			require.Equal(t, tc.want, res.Version.String())
+			require.Equal(t, tc.wantRun, res.Run)
+			if tc.skipped == nil {
+				tc.skipped = []string{}
+			}
+			require.Equal(t, tc.skipped, res.Skipped)
+		})
+	}
+}
+
+func TestGreenBuildReleaseVersion(t *testing.T) {
+	cases := map[string]struct {
+		build     string
+		branch    string
+		official  bool
+		rc        bool
+		want      string
+		shouldErr bool
+	}{
+		"Master": {
+			build: "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0", branch: "master", want: "v1.18.0-alpha.2",
+		},
+		"Beta": {
+			build: "v1.17.1-beta.0.20+aaaaaaa", branch: "release-1.17", want: "v1.17.1-beta.1",
+		},
+		"FirstRC": {
+			build: "v1.17.0-beta.2.20+aaaaaaa", branch: "release-1.17", rc: true, want: "v1.17.0-rc.1",
+		},
+		"NextRC": {
+			build: "v1.17.0-rc.1.20+aaaaaaa", branch: "release-1.17", want: "v1.17.0-rc.2",
+		},
+		"Official": {
+			build: "v1.17.1-beta.0.20+aaaaaaa", branch: "release-1.17", official: true, want: "v1.17.1",
+		},
+		"OfficialMaster": {
+			build: "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0", branch: "master", official: true, shouldErr: true,
+		},
+		"InvalidBranch": {
+			build: "v1.17.1-beta.0.20+aaaaaaa", branch: "feature-1.17", shouldErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			res, err := GreenBuildReleaseVersion(MustParseVersion(tc.build), tc.branch, tc.official, tc.rc)
+			require.Equal(t, tc.shouldErr, err != nil, err)
+			if !tc.shouldErr {
+				require.Equal(t, tc.want, res.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/release/pkg/registry"
+)
+
+const (
+	releaseImagesPath = "release-images"
+
+	// GCRIOPathProd is the production registry alias
+	GCRIOPathProd = "k8s.gcr.io"
+
+	// GCRIOPathProdPush is the registry to push to for GCRIOPathProd
+	GCRIOPathProdPush = "gcr.io/google-containers"
+)
+
+// ImagePushOptions are the options for pushing the release images
+type ImagePushOptions struct {
+	// BuildOutput is the build output directory containing the
+	// release-images/<arch>/*.tar image tarballs
+	BuildOutput string
+
+	// Registry is the registry including its path to push to, like
+	// gcr.io/k8s-staging-kubernetes
+	Registry string
+
+	// Version is the version to tag the images with
+	Version string
+}
+
+// imageTagRegex matches the tags of the release images, like
+// k8s.gcr.io/kube-apiserver-amd64:v1.18.0
+var imageTagRegex = regexp.MustCompile(`^.+/(.+):.+$`)
+
+// PushImageRepository returns the registry which gets used for pushes to
+// the registry, which differs for the production alias
+func PushImageRepository(reg string) string {
+	if reg == GCRIOPathProd {
+		return GCRIOPathProdPush
+	}
+	return reg
+}
+
+// ImageTag returns the image tag for the version, since tags cannot contain
+// the "+" of build versions
+func ImageTag(version string) string {
+	return strings.Replace(version, "+", "_", -1)
+}
+
+// PushImages pushes the release image tarballs of every architecture like
+// release::docker::release does. Every image gets pushed as
+// <registry>/<name>-<arch>:<tag> and afterwards a manifest list
+// <registry>/<name>:<tag> gets created for every image name. The client has
+// to be configured for the registry host of the push registry. It returns the
+// pushed manifest lists.
+func PushImages(
+	ctx context.Context, client *registry.Client, opts *ImagePushOptions,
+) ([]string, error) {
+	repo, err := registry.ParseRepository(PushImageRepository(opts.Registry))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing image registry")
+	}
+	if repo.Registry != client.Registry() {
+		return nil, errors.Errorf(
+			"registry client is configured for %s instead of %s", client.Registry(), repo.Registry,
+		)
+	}
+	tag := ImageTag(opts.Version)
+	if err := registry.ValidateTag(tag); err != nil {
+		return nil, err
+	}
+
+	releaseImages := filepath.Join(opts.BuildOutput, releaseImagesPath)
+	arches, err := ioutil.ReadDir(releaseImages)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading architectures from %s", releaseImages)
+	}
+
+	logrus.Infof("Pushing images from %s to %s", releaseImages, repo)
+	manifests := map[string][]registry.Descriptor{}
+	for _, arch := range arches {
+		if !arch.IsDir() {
+			continue
+		}
+		tarballs, err := filepath.Glob(filepath.Join(releaseImages, arch.Name(), "*.tar"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing image tarballs of %s", arch.Name())
+		}
+		sort.Strings(tarballs)
+
+		for _, tarball := range tarballs {
+			descriptor, listRepository, err := pushImage(ctx, client, repo, arch.Name(), tag, tarball)
+			if err != nil {
+				return nil, errors.Wrapf(err, "pushing %s", tarball)
+			}
+			descriptor.Platform.Architecture = arch.Name()
+			manifests[listRepository] = append(manifests[listRepository], *descriptor)
+		}
+	}
+
+	lists := []string{}
+	for listRepository := range manifests {
+		lists = append(lists, listRepository)
+	}
+	sort.Strings(lists)
+
+	pushed := []string{}
+	for _, listRepository := range lists {
+		if _, err := registry.PushManifestList(
+			ctx, client, listRepository, tag, manifests[listRepository],
+		); err != nil {
+			return nil, errors.Wrapf(err, "pushing manifest list %s", listRepository)
+		}
+		pushed = append(pushed, repo.Registry+"/"+listRepository+":"+tag)
+	}
+	return pushed, nil
+}
+
+// pushImage pushes the image tarball as <name>-<arch>:<tag> and by digest to
+// the repository of its manifest list, which mounts the already uploaded
+// layers. It returns the pushed manifest and the manifest list repository.
+func pushImage(
+	ctx context.Context, client *registry.Client, repo registry.Repository, arch, tag, tarball string,
+) (*registry.Descriptor, string, error) {
+	imageTarball, err := registry.ReadImageTarball(tarball)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// There may be multiple tags, just use the first one
+	if len(imageTarball.RepoTags) == 0 {
+		return nil, "", errors.Errorf("image %s has no tag", tarball)
+	}
+	match := imageTagRegex.FindStringSubmatch(imageTarball.RepoTags[0])
+	if match == nil {
+		return nil, "", errors.Errorf("malformed tag %q in %s", imageTarball.RepoTags[0], tarball)
+	}
+	name := strings.Replace(match[1], "-"+arch, "", 1)
+
+	image, err := registry.NewImage(imageTarball)
+	if err != nil {
+		return nil, "", err
+	}
+	defer image.Close() // nolint: errcheck
+
+	descriptor, err := registry.PushImage(ctx, client, path.Join(repo.Name, name+"-"+arch), tag, image)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The manifest list can only reference manifests within its own
+	// repository, which get pushed by digest like `docker manifest push` does
+	listRepository := path.Join(repo.Name, name)
+	if _, err := registry.PushImage(ctx, client, listRepository, descriptor.Digest, image); err != nil {
+		return nil, "", err
+	}
+	return descriptor, listRepository, nil
+}
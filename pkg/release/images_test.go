@@ -0,0 +1,184 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/release/pkg/command"
+	"k8s.io/release/pkg/registry"
+)
+
+// newReleaseImages creates a build output with release images for the
+// provided architectures
+func newReleaseImages(t *testing.T, images map[string][]string) string {
+	buildOutput := newBuildOutput(t)
+	for arch, names := range images {
+		dir := filepath.Join(buildOutput, releaseImagesPath, arch)
+		require.Nil(t, os.MkdirAll(dir, os.ModePerm))
+		for _, name := range names {
+			require.Nil(t, registry.WriteFakeImageTarball(
+				filepath.Join(dir, name+".tar"),
+				"k8s.gcr.io/"+name+"-"+arch+":v1.18.0-alpha.1.123_5a1ae3a2aaa3c0",
+				arch,
+			))
+		}
+	}
+	return buildOutput
+}
+
+func TestPushImages(t *testing.T) {
+	fake := registry.NewFakeRegistry()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	client := registry.NewClient(u.Host, &registry.ClientOptions{Insecure: true})
+
+	buildOutput := newReleaseImages(t, map[string][]string{
+		"amd64": {"kube-apiserver", "kube-proxy"},
+		"arm":   {"kube-apiserver", "kube-proxy"},
+		"s390x": {"kube-proxy"},
+	})
+	defer cleanupTmps(t, buildOutput)
+
+	ctx := context.Background()
+	lists, err := PushImages(ctx, client, &ImagePushOptions{
+		BuildOutput: buildOutput,
+		Registry:    u.Host + "/k8s-staging",
+		Version:     "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0",
+	})
+	require.Nil(t, err)
+	tag := "v1.18.0-alpha.1.123_5a1ae3a2aaa3c0"
+	require.Equal(t, []string{
+		u.Host + "/k8s-staging/kube-apiserver:" + tag,
+		u.Host + "/k8s-staging/kube-proxy:" + tag,
+	}, lists)
+
+	// The layers of the manifest list repositories get mounted from the
+	// architecture specific repositories
+	require.Equal(t, 5, fake.Mounts())
+
+	for _, image := range []string{
+		"k8s-staging/kube-apiserver-amd64",
+		"k8s-staging/kube-apiserver-arm",
+		"k8s-staging/kube-proxy-amd64",
+		"k8s-staging/kube-proxy-arm",
+		"k8s-staging/kube-proxy-s390x",
+	} {
+		mediaType, _, err := client.GetManifest(ctx, image, tag)
+		require.Nil(t, err, image)
+		require.Equal(t, registry.MediaTypeManifest, mediaType)
+	}
+
+	mediaType, content, err := client.GetManifest(ctx, "k8s-staging/kube-proxy", tag)
+	require.Nil(t, err)
+	require.Equal(t, registry.MediaTypeManifestList, mediaType)
+	list := registry.ManifestList{}
+	require.Nil(t, json.Unmarshal(content, &list))
+	arches := []string{}
+	for _, manifest := range list.Manifests {
+		arches = append(arches, manifest.Platform.Architecture)
+		_, _, err := client.GetManifest(ctx, "k8s-staging/kube-proxy", manifest.Digest)
+		require.Nil(t, err)
+	}
+	require.Equal(t, []string{"amd64", "arm", "s390x"}, arches)
+}
+
+func TestPushImagesDryRun(t *testing.T) {
+	fake := registry.NewFakeRegistry()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	client := registry.NewClient(u.Host, &registry.ClientOptions{Insecure: true})
+
+	buildOutput := newReleaseImages(t, map[string][]string{
+		"amd64": {"kube-apiserver", "kube-proxy"},
+		"arm":   {"kube-proxy"},
+	})
+	defer cleanupTmps(t, buildOutput)
+
+	command.ResetDryRunSummary()
+	command.SetGlobalDryRunPolicy(command.DryRunMutating)
+	defer command.SetGlobalDryRunPolicy(command.DryRunDisabled)
+
+	ctx := context.Background()
+	lists, err := PushImages(ctx, client, &ImagePushOptions{
+		BuildOutput: buildOutput,
+		Registry:    u.Host + "/k8s-staging",
+		Version:     "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0",
+	})
+	require.Nil(t, err)
+	require.Len(t, lists, 2)
+
+	// Mock mode does not write anything to the registry
+	require.Zero(t, fake.Uploads())
+	require.Zero(t, fake.Mounts())
+	for _, image := range []string{"k8s-staging/kube-proxy-amd64", "k8s-staging/kube-proxy"} {
+		_, _, err := client.GetManifest(ctx, image, "v1.18.0-alpha.1.123_5a1ae3a2aaa3c0")
+		require.NotNil(t, err, image)
+	}
+	// Every image gets pushed to its architecture and manifest list repository
+	require.Len(t, command.DryRunSummary(), 8)
+}
+
+func TestPushImagesFailure(t *testing.T) {
+	server := httptest.NewServer(registry.NewFakeRegistry())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	client := registry.NewClient(u.Host, &registry.ClientOptions{Insecure: true})
+	ctx := context.Background()
+
+	buildOutput := newReleaseImages(t, map[string][]string{"amd64": {"kube-proxy"}})
+	defer cleanupTmps(t, buildOutput)
+
+	// Client for another registry
+	_, err = PushImages(ctx, client, &ImagePushOptions{
+		BuildOutput: buildOutput, Registry: "gcr.io/k8s-staging", Version: "v1.18.0",
+	})
+	require.NotNil(t, err)
+
+	// No release images
+	_, err = PushImages(ctx, client, &ImagePushOptions{
+		BuildOutput: filepath.Join(buildOutput, "missing"), Registry: u.Host + "/k8s-staging", Version: "v1.18.0",
+	})
+	require.NotNil(t, err)
+
+	// Malformed tag
+	require.Nil(t, registry.WriteFakeImageTarball(
+		filepath.Join(buildOutput, releaseImagesPath, "amd64", "invalid.tar"), "invalid", "amd64",
+	))
+	_, err = PushImages(ctx, client, &ImagePushOptions{
+		BuildOutput: buildOutput, Registry: u.Host + "/k8s-staging", Version: "v1.18.0",
+	})
+	require.NotNil(t, err)
+}
+
+func TestPushImageRepository(t *testing.T) {
+	require.Equal(t, "gcr.io/google-containers", PushImageRepository("k8s.gcr.io"))
+	require.Equal(t, "gcr.io/k8s-staging", PushImageRepository("gcr.io/k8s-staging"))
+}
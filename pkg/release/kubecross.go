@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// KubeCrossVersionURL is the format of the URL of the kube-cross image
+// version file of a kubernetes branch
+const KubeCrossVersionURL = "https://raw.githubusercontent.com/kubernetes/kubernetes/%s/build/build-image/cross/VERSION"
+
+// KubeCrossVersion returns the kube-cross image version of the first branch
+// having one like release::kubecross_version. The urlFormat contains the %s
+// placeholder for the branch, like KubeCrossVersionURL.
+func KubeCrossVersion(ctx context.Context, urlFormat string, branches ...string) (string, error) {
+	for _, branch := range branches {
+		url := fmt.Sprintf(urlFormat, branch)
+		version, err := readVersionURL(ctx, url)
+		if err != nil {
+			logrus.Infof("Unable to get kube-cross version for %s: %v", branch, err)
+			continue
+		}
+		logrus.Infof("Found kube-cross version %s for %s", version, branch)
+		return version, nil
+	}
+	return "", errors.Errorf("unable to find kube-cross version in %s", strings.Join(branches, ", "))
+}
+
+// readVersionURL returns the trimmed content of the URL
+func readVersionURL(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("unexpected status %s", res.Status)
+	}
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	version := strings.TrimSpace(string(content))
+	if version == "" {
+		return "", errors.New("empty version")
+	}
+	return version, nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubeCrossVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/master/VERSION":
+			w.Write([]byte("v1.13.4-1\n")) // nolint: errcheck
+		case "/empty/VERSION":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	urlFormat := server.URL + "/%s/VERSION"
+
+	version, err := KubeCrossVersion(ctx, urlFormat, "release-1.17", "empty", "master")
+	require.Nil(t, err)
+	require.Equal(t, "v1.13.4-1", version)
+
+	_, err = KubeCrossVersion(ctx, urlFormat, "release-1.17", "empty")
+	require.NotNil(t, err)
+}
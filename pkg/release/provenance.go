@@ -0,0 +1,277 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/release/pkg/command"
+)
+
+const (
+	// ProvenanceFile is the name of the provenance document next to the
+	// release artifacts
+	ProvenanceFile = "provenance.json"
+
+	// ProvenanceSignatureFile is the detached signature of the provenance
+	// document
+	ProvenanceSignatureFile = ProvenanceFile + ".sig"
+
+	// BuilderBazel is the builder of releases built with Bazel
+	BuilderBazel = "bazel"
+
+	// BuilderDockerized is the builder of releases built with the dockerized
+	// make based build
+	BuilderDockerized = "dockerized"
+
+	provenanceTool = "krel"
+
+	// kubeGitCommitEnv overrides the commit of a kubernetes build
+	kubeGitCommitEnv = "KUBE_GIT_COMMIT"
+)
+
+// Provenance records what was built, from which source and by whom
+type Provenance struct {
+	// Version is the build version
+	Version string `json:"version"`
+
+	// Commit is the source commit of the build
+	Commit string `json:"commit"`
+
+	// Builder is either BuilderBazel or BuilderDockerized
+	Builder string `json:"builder"`
+
+	// BuiltBy is the user who pushed the build
+	BuiltBy string `json:"builtBy,omitempty"`
+
+	// Tool and ToolVersion identify the tool which pushed the build
+	Tool        string `json:"tool"`
+	ToolVersion string `json:"toolVersion"`
+
+	// Artifacts are all release artifacts sorted by name
+	Artifacts []ProvenanceArtifact `json:"artifacts"`
+}
+
+// ProvenanceArtifact is a single release artifact
+type ProvenanceArtifact struct {
+	// Name is the slash separated path relative to the release directory
+	Name string `json:"name"`
+
+	// Size is the file size in bytes
+	Size int64 `json:"size"`
+
+	// Digests are the hex encoded digests by algorithm, like sha256
+	Digests map[string]string `json:"digests"`
+}
+
+// ProvenanceOptions are the build details recorded in the provenance
+type ProvenanceOptions struct {
+	Version     string
+	Commit      string
+	Bazel       bool
+	BuiltBy     string
+	ToolVersion string
+}
+
+// BuildCommit returns the source commit of a build of the version within
+// the kubernetes tree at dir. Builds carry their commit within the version,
+// while tagged versions get resolved via KUBE_GIT_COMMIT, which overrides the
+// commit of a kubernetes build, or the tag within the tree.
+func BuildCommit(dir string, version Version) (string, error) {
+	if version.IsBuild() {
+		return version.Commit, nil
+	}
+	if commit := os.Getenv(kubeGitCommitEnv); commit != "" {
+		return commit, nil
+	}
+
+	tag := version.Release().String()
+	status, err := command.NewWithWorkDir(
+		dir, "git", "rev-parse", "--verify", "--quiet", tag+"^{commit}",
+	).RunSilent()
+	if err != nil {
+		return "", errors.Wrapf(err, "resolving commit of %s", tag)
+	}
+	commit := strings.TrimSpace(status.Output())
+	if !status.Success() || commit == "" {
+		return "", errors.Errorf(
+			"unable to determine the commit of %s: neither %s is set nor the tag exists in %s",
+			tag, kubeGitCommitEnv, dir,
+		)
+	}
+	return commit, nil
+}
+
+// WriteProvenance writes the provenance document for all artifacts within
+// the directory. The document gets signed if a signer is provided.
+func WriteProvenance(dir string, opts *ProvenanceOptions, signer Signer) (*Provenance, error) {
+	builder := BuilderDockerized
+	if opts.Bazel {
+		builder = BuilderBazel
+	}
+	provenance := &Provenance{
+		Version:     opts.Version,
+		Commit:      opts.Commit,
+		Builder:     builder,
+		BuiltBy:     opts.BuiltBy,
+		Tool:        provenanceTool,
+		ToolVersion: opts.ToolVersion,
+		Artifacts:   []ProvenanceArtifact{},
+	}
+
+	artifacts, err := listArtifacts(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, artifact := range artifacts {
+		path := filepath.Join(dir, artifact)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading file info of %s", path)
+		}
+		hashes, err := hashFile(path, false)
+		if err != nil {
+			return nil, err
+		}
+		digests := map[string]string{}
+		for extension, sum := range hashes {
+			digests[strings.TrimPrefix(extension, ".")] = sum
+		}
+		provenance.Artifacts = append(provenance.Artifacts, ProvenanceArtifact{
+			Name: artifact, Size: info.Size(), Digests: digests,
+		})
+	}
+
+	content, err := json.MarshalIndent(provenance, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling provenance")
+	}
+	content = append(content, '\n')
+
+	logrus.Infof("Writing provenance of %d artifacts to %s", len(artifacts), dir)
+	if err := ioutil.WriteFile(
+		filepath.Join(dir, ProvenanceFile), content, 0o644,
+	); err != nil {
+		return nil, errors.Wrapf(err, "writing %s", ProvenanceFile)
+	}
+
+	signaturePath := filepath.Join(dir, ProvenanceSignatureFile)
+	if signer == nil {
+		logrus.Warn("No signing key provided, not signing the provenance")
+		if err := os.RemoveAll(signaturePath); err != nil {
+			return nil, errors.Wrapf(err, "removing %s", signaturePath)
+		}
+		return provenance, nil
+	}
+	signature, err := signer.Sign(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing provenance")
+	}
+	if err := ioutil.WriteFile(signaturePath, signature, 0o644); err != nil {
+		return nil, errors.Wrapf(err, "writing %s", ProvenanceSignatureFile)
+	}
+	return provenance, nil
+}
+
+// VerifyProvenance checks the signature of the provenance document within the
+// directory and afterwards that the directory contains exactly the recorded
+// artifacts with matching sizes and digests.
+func VerifyProvenance(dir string, verifier Verifier) (*Provenance, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, ProvenanceFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", ProvenanceFile)
+	}
+	signature, err := ioutil.ReadFile(filepath.Join(dir, ProvenanceSignatureFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", ProvenanceSignatureFile)
+	}
+	if err := verifier.Verify(content, signature); err != nil {
+		return nil, errors.Wrap(err, "verifying provenance signature")
+	}
+
+	provenance := &Provenance{}
+	if err := json.Unmarshal(content, provenance); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", ProvenanceFile)
+	}
+
+	failures := []string{}
+	recorded := map[string]bool{}
+	for _, artifact := range provenance.Artifacts {
+		recorded[artifact.Name] = true
+		if failure := verifyArtifact(dir, artifact); failure != "" {
+			failures = append(failures, fmt.Sprintf("%s: %s", artifact.Name, failure))
+		}
+	}
+
+	artifacts, err := listArtifacts(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, artifact := range artifacts {
+		if !recorded[artifact] {
+			failures = append(failures, fmt.Sprintf("%s: not part of the provenance", artifact))
+		}
+	}
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return nil, errors.Errorf(
+			"provenance verification of %s failed:\n%s", dir, strings.Join(failures, "\n"),
+		)
+	}
+	return provenance, nil
+}
+
+// verifyArtifact returns a description of the failure if the artifact does
+// not match its provenance record
+func verifyArtifact(dir string, artifact ProvenanceArtifact) string {
+	path := filepath.Join(dir, filepath.FromSlash(artifact.Name))
+	info, err := os.Stat(path)
+	if err != nil {
+		return err.Error()
+	}
+	if info.Size() != artifact.Size {
+		return fmt.Sprintf("size mismatch, got %d want %d", info.Size(), artifact.Size)
+	}
+	if len(artifact.Digests) == 0 {
+		return "no digests recorded"
+	}
+
+	for name, want := range artifact.Digests {
+		algorithm, ok := sidecarAlgorithm("." + name)
+		if !ok || algorithm.legacy {
+			return fmt.Sprintf("unsupported digest algorithm %q", name)
+		}
+		got, err := hashWith(path, algorithm.new)
+		if err != nil {
+			return err.Error()
+		}
+		if got != want {
+			return fmt.Sprintf("%s mismatch, got %s want %s", name, got, want)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/release/pkg/command"
+)
+
+var testProvenanceOptions = &ProvenanceOptions{
+	Version:     "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0",
+	Commit:      "5a1ae3a2aaa3c0",
+	Bazel:       true,
+	BuiltBy:     "prow",
+	ToolVersion: "v0.1.0",
+}
+
+// newSignedRelease creates a release directory with checksums and a signed
+// provenance and returns it together with the verifier for the signature
+func newSignedRelease(t *testing.T) (string, Verifier) {
+	dir := newBuildOutput(t, "kubernetes.tar.gz", "bin/linux/amd64/kubectl")
+	private, public := writeEd25519Keys(t, dir)
+	signer, err := LoadSigner(private)
+	require.Nil(t, err)
+	verifier, err := LoadVerifier(public)
+	require.Nil(t, err)
+	require.Nil(t, os.Remove(private))
+	require.Nil(t, os.Remove(public))
+
+	require.Nil(t, WriteChecksums(dir, false))
+	_, err = WriteProvenance(dir, testProvenanceOptions, signer)
+	require.Nil(t, err)
+	return dir, verifier
+}
+
+func TestWriteProvenance(t *testing.T) {
+	dir, verifier := newSignedRelease(t)
+	defer cleanupTmps(t, dir)
+
+	provenance, err := VerifyProvenance(dir, verifier)
+	require.Nil(t, err)
+	require.Equal(t, "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0", provenance.Version)
+	require.Equal(t, "5a1ae3a2aaa3c0", provenance.Commit)
+	require.Equal(t, BuilderBazel, provenance.Builder)
+	require.Equal(t, "prow", provenance.BuiltBy)
+	require.Equal(t, "krel", provenance.Tool)
+	require.Equal(t, "v0.1.0", provenance.ToolVersion)
+
+	require.Len(t, provenance.Artifacts, 2)
+	require.Equal(t, ProvenanceArtifact{
+		Name: "bin/linux/amd64/kubectl",
+		Size: int64(len("bin/linux/amd64/kubectl")),
+		Digests: map[string]string{
+			"sha256": "0900e6a18087fb3431f424a2fda98bfd1d0fc30cf2ea3dbf427253f20c65cf9a",
+			"sha512": provenance.Artifacts[0].Digests["sha512"],
+		},
+	}, provenance.Artifacts[0])
+	require.Equal(t, "kubernetes.tar.gz", provenance.Artifacts[1].Name)
+
+	// The provenance is not part of the checksums and vice versa
+	require.Nil(t, Verify(dir))
+	require.NotContains(t, listArtifactFiles(t, dir), ProvenanceFile)
+}
+
+func TestWriteProvenanceUnsigned(t *testing.T) {
+	dir, verifier := newSignedRelease(t)
+	defer cleanupTmps(t, dir)
+
+	provenance, err := WriteProvenance(dir, &ProvenanceOptions{}, nil)
+	require.Nil(t, err)
+	require.Equal(t, BuilderDockerized, provenance.Builder)
+	require.False(t, exists(filepath.Join(dir, ProvenanceSignatureFile)))
+
+	_, err = VerifyProvenance(dir, verifier)
+	require.NotNil(t, err)
+}
+
+// newTaggedTree creates a git repository with a single commit tagged with
+// the version and returns it together with the commit
+func newTaggedTree(t *testing.T, tag string) (string, string) {
+	dir, err := ioutil.TempDir("", "tree-")
+	require.Nil(t, err)
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "--allow-empty", "-m", "release"},
+		{"tag", tag},
+	} {
+		require.Nil(t, command.NewWithWorkDir(dir, "git", args...).RunSilentSuccess())
+	}
+	status, err := command.NewWithWorkDir(dir, "git", "rev-parse", "HEAD").RunSilent()
+	require.Nil(t, err)
+	require.True(t, status.Success())
+	return dir, strings.TrimSpace(status.Output())
+}
+
+func TestBuildCommit(t *testing.T) {
+	dir, commit := newTaggedTree(t, "v1.17.0")
+	defer os.RemoveAll(dir)
+	defer os.Setenv(kubeGitCommitEnv, os.Getenv(kubeGitCommitEnv))
+	os.Unsetenv(kubeGitCommitEnv)
+
+	// Builds carry their commit within the version
+	actual, err := BuildCommit(dir, MustParseVersion("v1.18.0-alpha.1.123+5a1ae3a2aaa3c0"))
+	require.Nil(t, err)
+	require.Equal(t, "5a1ae3a2aaa3c0", actual)
+
+	// Tagged versions resolve to the commit of the tag
+	actual, err = BuildCommit(dir, MustParseVersion("v1.17.0"))
+	require.Nil(t, err)
+	require.Equal(t, commit, actual)
+	require.Len(t, actual, 40)
+
+	actual, err = BuildCommit(dir, MustParseVersion("v1.17.0-dirty"))
+	require.Nil(t, err)
+	require.Equal(t, commit, actual)
+
+	// Without the tag the commit is unknown
+	_, err = BuildCommit(dir, MustParseVersion("v1.17.1"))
+	require.NotNil(t, err)
+
+	// KUBE_GIT_COMMIT overrides the commit of tagged versions
+	os.Setenv(kubeGitCommitEnv, "ff8716f4cf6180")
+	actual, err = BuildCommit(dir, MustParseVersion("v1.17.1"))
+	require.Nil(t, err)
+	require.Equal(t, "ff8716f4cf6180", actual)
+}
+
+func TestVerifyProvenanceFailure(t *testing.T) {
+	cases := map[string]struct {
+		modify func(t *testing.T, dir string)
+		want   string
+	}{
+		"ModifiedArtifact": {
+			modify: func(t *testing.T, dir string) {
+				require.Nil(t, ioutil.WriteFile(
+					filepath.Join(dir, "kubernetes.tar.gz"), []byte("kubernetes.tar.gZ"), 0o644,
+				))
+			},
+			want: "kubernetes.tar.gz: sha",
+		},
+		"TruncatedArtifact": {
+			modify: func(t *testing.T, dir string) {
+				require.Nil(t, ioutil.WriteFile(
+					filepath.Join(dir, "kubernetes.tar.gz"), nil, 0o644,
+				))
+			},
+			want: "kubernetes.tar.gz: size mismatch",
+		},
+		"MissingArtifact": {
+			modify: func(t *testing.T, dir string) {
+				require.Nil(t, os.Remove(filepath.Join(dir, "bin/linux/amd64/kubectl")))
+			},
+			want: "bin/linux/amd64/kubectl: stat",
+		},
+		"AdditionalArtifact": {
+			modify: func(t *testing.T, dir string) {
+				require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "extra"), nil, 0o644))
+			},
+			want: "extra: not part of the provenance",
+		},
+		"ModifiedProvenance": {
+			modify: func(t *testing.T, dir string) {
+				path := filepath.Join(dir, ProvenanceFile)
+				content, err := ioutil.ReadFile(path)
+				require.Nil(t, err)
+				require.Nil(t, ioutil.WriteFile(path, []byte(strings.Replace(
+					string(content), "prow", "someone", 1,
+				)), 0o644))
+			},
+			want: "verifying provenance signature",
+		},
+		"MissingSignature": {
+			modify: func(t *testing.T, dir string) {
+				require.Nil(t, os.Remove(filepath.Join(dir, ProvenanceSignatureFile)))
+			},
+			want: ProvenanceSignatureFile,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir, verifier := newSignedRelease(t)
+			defer cleanupTmps(t, dir)
+
+			tc.modify(t, dir)
+			_, err := VerifyProvenance(dir, verifier)
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), tc.want)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/release/pkg/object"
+)
+
+const (
+	markerLatest = "latest"
+	markerStable = "stable"
+
+	markerContentType  = "text/plain"
+	markerCacheControl = "private, max-age=0, no-transform"
+)
+
+// isReleaseBuildType returns true if the build type directory, including an
+// optional GCS suffix, contains tagged releases
+func isReleaseBuildType(buildType string) bool {
+	return strings.HasPrefix(buildType, "release")
+}
+
+// markerRule decides whether a published version marker gets updated
+type markerRule struct {
+	// release selects the rule for markers within release build types
+	release bool
+
+	// compare compares the new version with the published one
+	compare func(version, published Version) int
+
+	// updateEqual allows updating a marker if both versions are equal
+	updateEqual bool
+}
+
+// markerRules are the rules for updating a marker, where the rule matching
+// the build type of the marker path applies. A marker only gets updated if the new
+// version is greater than the published one, like in
+// release::gcs::verify_latest_update.
+var markerRules = []markerRule{
+	// Release markers point to tagged versions. Equal versions are not
+	// published again to maintain the timestamp of the original marker.
+	{
+		release: true,
+		compare: func(version, published Version) int {
+			return version.Release().Compare(published.Release())
+		},
+		updateEqual: false,
+	},
+	// All other markers, like the ci ones, point to builds, which get updated
+	// if the new build is at least as recent as the published one.
+	{
+		release:     false,
+		compare:     Version.Compare,
+		updateEqual: true,
+	},
+}
+
+// ShouldUpdateMarker returns true if the marker at the provided path should
+// be updated from the published version to the new version
+func ShouldUpdateMarker(marker string, version, published Version) bool {
+	buildType := strings.SplitN(marker, "/", 2)[0]
+	for _, rule := range markerRules {
+		if rule.release != isReleaseBuildType(buildType) {
+			continue
+		}
+		res := rule.compare(version, published)
+		return res > 0 || (res == 0 && rule.updateEqual)
+	}
+	return false
+}
+
+// VersionMarkers returns the paths of all version markers to be published
+// for the version within the build type directory:
+//
+//	build type | version     | markers
+//	-----------+-------------+-------------------------------------------
+//	release*   | official    | stable.txt, stable-X.txt, stable-X.Y.txt
+//	release*   | pre-release | latest.txt, latest-X.txt, latest-X.Y.txt
+//	other      | any         | latest.txt, latest-X.txt, latest-X.Y.txt
+//
+// Release build types may have a GCS suffix, like for the marker rules. The
+// optional extra publish file gets appended as <extra>.txt.
+func VersionMarkers(buildType string, version Version, extraPublishFile string) []string {
+	kind := markerLatest
+	if isReleaseBuildType(buildType) && !version.IsPreRelease() {
+		kind = markerStable
+	}
+
+	names := []string{
+		kind,
+		fmt.Sprintf("%s-%d", kind, version.Major),
+		fmt.Sprintf("%s-%d.%d", kind, version.Major, version.Minor),
+	}
+	if extraPublishFile != "" {
+		names = append(names, extraPublishFile)
+	}
+
+	markers := []string{}
+	for _, name := range names {
+		markers = append(markers, path.Join(buildType, name+".txt"))
+	}
+	return markers
+}
+
+// PublishOptions are the options for publishing version markers
+type PublishOptions struct {
+	// BuildType is the directory of the build within the store, like ci,
+	// devel or release, including an optional GCS suffix
+	BuildType string
+
+	// Version is the published version, which may contain a custom suffix
+	Version string
+
+	// ExtraPublishFile is an additional marker name without extension
+	ExtraPublishFile string
+
+	// Public makes the markers publicly readable
+	Public bool
+}
+
+// PublishVersion updates all version markers of the build like
+// release::gcs::publish_version does. Markers which already point to a
+// greater version are skipped. It returns the updated markers.
+func PublishVersion(
+	ctx context.Context, store object.Store, opts *PublishOptions,
+) ([]string, error) {
+	version, err := ParseVersionPrefix(opts.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseDir := path.Join(opts.BuildType, opts.Version)
+	exists, err := object.Exists(ctx, store, releaseDir+"/")
+	if err != nil {
+		return nil, errors.Wrapf(err, "checking release files at %s", releaseDir)
+	}
+	if !exists {
+		return nil, errors.Errorf("release files don't exist at %s/%s", store, releaseDir)
+	}
+
+	updated := []string{}
+	for _, marker := range VersionMarkers(opts.BuildType, version, opts.ExtraPublishFile) {
+		update, err := verifyMarkerUpdate(ctx, store, marker, version)
+		if err != nil {
+			return nil, err
+		}
+		if !update {
+			continue
+		}
+		if err := publishMarker(ctx, store, marker, opts); err != nil {
+			return nil, errors.Wrapf(err, "publishing %s", marker)
+		}
+		updated = append(updated, marker)
+	}
+	return updated, nil
+}
+
+// verifyMarkerUpdate returns true if the marker does not exist yet or if it
+// should be updated according to the markerRules
+func verifyMarkerUpdate(
+	ctx context.Context, store object.Store, marker string, version Version,
+) (bool, error) {
+	content, err := object.ReadString(ctx, store, marker)
+	if object.IsNotExist(err) {
+		logrus.Infof("%s does not exist yet, it will be created", marker)
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "reading %s", marker)
+	}
+
+	published, err := ParseVersionPrefix(content)
+	if err != nil {
+		logrus.Warnf(
+			"%s contains an invalid release version %q, not updating it",
+			marker, strings.TrimSpace(content),
+		)
+		return false, nil
+	}
+
+	if !ShouldUpdateMarker(marker, version, published) {
+		logrus.Warnf("%s <= %s (published in %s), not updating it", version, published, marker)
+		return false, nil
+	}
+	logrus.Infof("%s > %s (published in %s), updating it", version, published, marker)
+	return true, nil
+}
+
+// publishMarker uploads and validates a single marker
+func publishMarker(
+	ctx context.Context, store object.Store, marker string, opts *PublishOptions,
+) error {
+	if err := object.WriteString(ctx, store, marker, opts.Version+"\n"); err != nil {
+		return err
+	}
+	if err := store.SetMetadata(ctx, marker, &object.Metadata{
+		ContentType:  markerContentType,
+		CacheControl: markerCacheControl,
+	}); err != nil {
+		return err
+	}
+	if opts.Public {
+		if err := store.SetACL(ctx, marker, object.ACLPublicRead); err != nil {
+			return err
+		}
+	}
+
+	content, err := object.ReadString(ctx, store, marker)
+	if err != nil {
+		return errors.Wrap(err, "validating uploaded version marker")
+	}
+	if strings.TrimSpace(content) != opts.Version {
+		return errors.Errorf(
+			"uploaded version marker contains %q instead of %q",
+			strings.TrimSpace(content), opts.Version,
+		)
+	}
+	logrus.Infof("Published %s/%s", store, marker)
+	return nil
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/release/pkg/object"
+)
+
+func TestVersionMarkers(t *testing.T) {
+	cases := map[string]struct {
+		buildType string
+		version   string
+		extra     string
+		want      []string
+	}{
+		"CI": {
+			buildType: "ci",
+			version:   "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0",
+			extra:     "k8s-master",
+			want: []string{
+				"ci/latest.txt",
+				"ci/latest-1.txt",
+				"ci/latest-1.18.txt",
+				"ci/k8s-master.txt",
+			},
+		},
+		"ReleasePreRelease": {
+			buildType: "release",
+			version:   "v1.18.0-rc.1",
+			want: []string{
+				"release/latest.txt",
+				"release/latest-1.txt",
+				"release/latest-1.18.txt",
+			},
+		},
+		"ReleaseOfficial": {
+			buildType: "release",
+			version:   "v1.17.3",
+			want: []string{
+				"release/stable.txt",
+				"release/stable-1.txt",
+				"release/stable-1.17.txt",
+			},
+		},
+		"ReleaseSuffixOfficial": {
+			buildType: "release-suffix",
+			version:   "v1.17.3",
+			want: []string{
+				"release-suffix/stable.txt",
+				"release-suffix/stable-1.txt",
+				"release-suffix/stable-1.17.txt",
+			},
+		},
+		"CIOfficial": {
+			buildType: "ci-suffix",
+			version:   "v1.17.3",
+			want: []string{
+				"ci-suffix/latest.txt",
+				"ci-suffix/latest-1.txt",
+				"ci-suffix/latest-1.17.txt",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			res := VersionMarkers(tc.buildType, MustParseVersion(tc.version), tc.extra)
+			require.Equal(t, tc.want, res)
+		})
+	}
+}
+
+func TestShouldUpdateMarker(t *testing.T) {
+	cases := map[string]struct {
+		marker    string
+		version   string
+		published string
+		want      bool
+	}{
+		"GreaterMinor":           {"ci/latest.txt", "v1.18.0-alpha.0", "v1.17.9", true},
+		"LowerPatch":             {"ci/latest.txt", "v1.17.1", "v1.17.2", false},
+		"OfficialOverRC":         {"release/latest.txt", "v1.17.0", "v1.17.0-rc.2", true},
+		"RCBelowOfficial":        {"release/latest.txt", "v1.17.0-rc.2", "v1.17.0", false},
+		"BetaOverAlpha":          {"ci/latest.txt", "v1.17.0-beta.0", "v1.17.0-alpha.3", true},
+		"GreaterPreReleaseID":    {"release/latest.txt", "v1.17.0-beta.2", "v1.17.0-beta.1", true},
+		"LowerPreReleaseID":      {"ci/latest.txt", "v1.17.0-beta.1.9+abcdef", "v1.17.0-beta.2", false},
+		"MoreCommitsCI":          {"ci/latest.txt", "v1.17.0-beta.1.10+abcdef", "v1.17.0-beta.1.9+fedcba", true},
+		"FewerCommitsCI":         {"ci/latest.txt", "v1.17.0-beta.1.8+abcdef", "v1.17.0-beta.1.9+fedcba", false},
+		"EqualCI":                {"ci/latest.txt", "v1.17.0-beta.1.9+abcdef", "v1.17.0-beta.1.9+abcdef", true},
+		"EqualRelease":           {"release/stable.txt", "v1.17.0", "v1.17.0", false},
+		"EqualPreReleaseRelease": {"release/latest.txt", "v1.17.0-rc.1", "v1.17.0-rc.1", false},
+		"MoreCommitsRelease":     {"release/latest.txt", "v1.17.0-rc.1.9+abcdef", "v1.17.0-rc.1", false},
+		"EqualReleaseSuffix":     {"release-suffix/stable.txt", "v1.17.0", "v1.17.0", false},
+		"EqualCISuffix":          {"ci-suffix/latest.txt", "v1.17.0", "v1.17.0", true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			res := ShouldUpdateMarker(
+				tc.marker, MustParseVersion(tc.version), MustParseVersion(tc.published),
+			)
+			require.Equal(t, tc.want, res)
+		})
+	}
+}
+
+// newPublishStore creates a local store containing the release directories
+// and the published markers
+func newPublishStore(t *testing.T, releases []string, markers map[string]string) *object.Local {
+	ctx := context.Background()
+	store := newLocalStore(t)
+	for _, r := range releases {
+		require.Nil(t, object.WriteString(ctx, store, r+"/kubernetes.tar.gz", r))
+	}
+	for marker, content := range markers {
+		require.Nil(t, object.WriteString(ctx, store, marker, content+"\n"))
+	}
+	return store
+}
+
+func TestPublishVersion(t *testing.T) {
+	ctx := context.Background()
+	store := newPublishStore(t,
+		[]string{"ci/v1.18.0-alpha.1.123+5a1ae3a2aaa3c0"},
+		map[string]string{
+			"ci/latest.txt":      "v1.18.0-alpha.1.100+abcdef",
+			"ci/latest-1.txt":    "v1.19.0-alpha.0.5+abcdef",
+			"ci/latest-1.18.txt": "invalid",
+		},
+	)
+	defer cleanupTmps(t, store.Root())
+
+	updated, err := PublishVersion(ctx, store, &PublishOptions{
+		BuildType:        "ci",
+		Version:          "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0",
+		ExtraPublishFile: "k8s-master",
+		Public:           true,
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"ci/latest.txt", "ci/k8s-master.txt"}, updated)
+
+	for marker, want := range map[string]string{
+		"ci/latest.txt":      "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0\n",
+		"ci/k8s-master.txt":  "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0\n",
+		"ci/latest-1.txt":    "v1.19.0-alpha.0.5+abcdef\n",
+		"ci/latest-1.18.txt": "invalid\n",
+	} {
+		content, err := object.ReadString(ctx, store, marker)
+		require.Nil(t, err)
+		require.Equal(t, want, content, marker)
+	}
+
+	attrs, err := store.Stat(ctx, "ci/latest.txt")
+	require.Nil(t, err)
+	require.True(t, attrs.Public)
+	require.Equal(t, "text/plain", attrs.ContentType)
+	require.Equal(t, "private, max-age=0, no-transform", attrs.CacheControl)
+}
+
+func TestPublishVersionEqualKeepsTimestamp(t *testing.T) {
+	ctx := context.Background()
+	store := newPublishStore(t,
+		[]string{"release/v1.17.0", "ci/v1.17.0"},
+		map[string]string{
+			"release/stable.txt":      "v1.17.0",
+			"release/stable-1.txt":    "v1.17.0",
+			"release/stable-1.17.txt": "v1.17.0",
+			"ci/latest.txt":           "v1.17.0",
+			"ci/latest-1.txt":         "v1.17.0",
+			"ci/latest-1.17.txt":      "v1.17.0",
+		},
+	)
+	defer cleanupTmps(t, store.Root())
+
+	// Move all markers into the past to detect updates
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	objects, err := store.List(ctx, "")
+	require.Nil(t, err)
+	for _, o := range objects {
+		require.Nil(t, os.Chtimes(filepath.Join(store.Root(), o.Name), past, past))
+	}
+
+	updated, err := PublishVersion(ctx, store, &PublishOptions{
+		BuildType: "release", Version: "v1.17.0",
+	})
+	require.Nil(t, err)
+	require.Empty(t, updated)
+	attrs, err := store.Stat(ctx, "release/stable.txt")
+	require.Nil(t, err)
+	require.Equal(t, past, attrs.Updated.Truncate(time.Second))
+
+	updated, err = PublishVersion(ctx, store, &PublishOptions{
+		BuildType: "ci", Version: "v1.17.0",
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		"ci/latest.txt", "ci/latest-1.txt", "ci/latest-1.17.txt",
+	}, updated)
+	attrs, err = store.Stat(ctx, "ci/latest.txt")
+	require.Nil(t, err)
+	require.True(t, attrs.Updated.After(past))
+}
+
+func TestPublishVersionFailure(t *testing.T) {
+	ctx := context.Background()
+	store := newPublishStore(t, []string{"ci/v1.18.0"}, nil)
+	defer cleanupTmps(t, store.Root())
+
+	// Release directory does not exist
+	_, err := PublishVersion(ctx, store, &PublishOptions{
+		BuildType: "ci", Version: "v1.18.1",
+	})
+	require.NotNil(t, err)
+
+	// Invalid version
+	_, err = PublishVersion(ctx, store, &PublishOptions{
+		BuildType: "ci", Version: "1.18.0",
+	})
+	require.NotNil(t, err)
+
+	objects, err := store.List(ctx, "ci/latest")
+	require.Nil(t, err)
+	require.Empty(t, objects)
+}
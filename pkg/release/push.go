@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/release/pkg/object"
+)
+
+// PushOptions are the options for pushing staged artifacts
+type PushOptions struct {
+	// AllowDup allows overwriting an already existing destination
+	AllowDup bool
+
+	// CheckDestination fails the push if the destination is not empty and
+	// AllowDup is not set
+	CheckDestination bool
+
+	// Public makes all uploaded artifacts publicly readable
+	Public bool
+}
+
+// PushArtifacts uploads all files within the stageDir to the dest path of the
+// store, like release::gcs::push_release_artifacts does.
+func PushArtifacts(
+	ctx context.Context, store object.Store, stageDir, dest string, opts *PushOptions,
+) error {
+	if opts.CheckDestination {
+		logrus.Infof("Checking whether %s/%s already exists", store, dest)
+		exists, err := object.Exists(ctx, store, dest+"/")
+		if err != nil {
+			return errors.Wrapf(err, "checking destination %s", dest)
+		}
+		if exists {
+			if !opts.AllowDup {
+				return errors.Errorf(
+					"destination %s already exists, use --allow-dup to overwrite it",
+					dest,
+				)
+			}
+			logrus.Infof("Destination %s exists, overwriting it because of --allow-dup", dest)
+		}
+	}
+
+	logrus.Infof("Copying artifacts from %s to %s/%s", stageDir, store, dest)
+	objects, err := object.UploadDir(ctx, store, stageDir, dest)
+	if err != nil {
+		return errors.Wrap(err, "copying artifacts")
+	}
+
+	if opts.Public {
+		for _, o := range objects {
+			if err := store.SetACL(ctx, o, object.ACLPublicRead); err != nil {
+				return errors.Wrapf(err, "making %s public", o)
+			}
+		}
+	}
+	logrus.Infof("Pushed %d artifacts to %s/%s", len(objects), store, dest)
+	return nil
+}
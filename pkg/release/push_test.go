@@ -0,0 +1,225 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/release/pkg/command"
+	"k8s.io/release/pkg/object"
+)
+
+func newLocalStore(t *testing.T) *object.Local {
+	dir, err := ioutil.TempDir("", "bucket-")
+	require.Nil(t, err)
+	store, err := object.NewLocal(dir)
+	require.Nil(t, err)
+	return store
+}
+
+// listObjects returns the names of all objects and of the public ones
+func listObjects(t *testing.T, store object.Store) (all, public []string) {
+	objects, err := store.List(context.Background(), "")
+	require.Nil(t, err)
+	for _, o := range objects {
+		all = append(all, o.Name)
+		if o.Public {
+			public = append(public, o.Name)
+		}
+	}
+	return all, public
+}
+
+func TestPushArtifacts(t *testing.T) {
+	stageDir := newBuildOutput(t, "kubernetes.tar.gz", "bin/linux/amd64/kubectl")
+	defer cleanupTmps(t, stageDir)
+
+	type want struct {
+		files  []string
+		public []string
+		rErr   bool
+	}
+	cases := map[string]struct {
+		existing []string
+		opts     PushOptions
+		want     want
+	}{
+		"EmptyDestination": {
+			opts: PushOptions{CheckDestination: true},
+			want: want{
+				files: []string{
+					"ci/v1.18.0/bin/linux/amd64/kubectl",
+					"ci/v1.18.0/kubernetes.tar.gz",
+				},
+			},
+		},
+		"Public": {
+			opts: PushOptions{Public: true},
+			want: want{
+				files: []string{
+					"ci/v1.18.0/bin/linux/amd64/kubectl",
+					"ci/v1.18.0/kubernetes.tar.gz",
+				},
+				public: []string{
+					"ci/v1.18.0/bin/linux/amd64/kubectl",
+					"ci/v1.18.0/kubernetes.tar.gz",
+				},
+			},
+		},
+		"ExistingDestination": {
+			existing: []string{"ci/v1.18.0/kubernetes.tar.gz"},
+			opts:     PushOptions{CheckDestination: true},
+			want: want{
+				files: []string{"ci/v1.18.0/kubernetes.tar.gz"},
+				rErr:  true,
+			},
+		},
+		"ExistingDestinationAllowDup": {
+			existing: []string{"ci/v1.18.0/kubernetes.tar.gz"},
+			opts:     PushOptions{CheckDestination: true, AllowDup: true},
+			want: want{
+				files: []string{
+					"ci/v1.18.0/bin/linux/amd64/kubectl",
+					"ci/v1.18.0/kubernetes.tar.gz",
+				},
+			},
+		},
+		"ExistingSimilarDestination": {
+			existing: []string{"ci/v1.18.0-beta.0/kubernetes.tar.gz"},
+			opts:     PushOptions{CheckDestination: true},
+			want: want{
+				files: []string{
+					"ci/v1.18.0-beta.0/kubernetes.tar.gz",
+					"ci/v1.18.0/bin/linux/amd64/kubectl",
+					"ci/v1.18.0/kubernetes.tar.gz",
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			store := newLocalStore(t)
+			defer cleanupTmps(t, store.Root())
+			for _, o := range tc.existing {
+				require.Nil(t, object.WriteString(context.Background(), store, o, o))
+			}
+
+			err := PushArtifacts(
+				context.Background(), store, stageDir, "ci/v1.18.0", &tc.opts,
+			)
+			require.Equal(t, tc.want.rErr, err != nil)
+			files, public := listObjects(t, store)
+			require.Equal(t, tc.want.files, files)
+			require.Equal(t, tc.want.public, public)
+		})
+	}
+}
+
+func TestStageAndPushBuild(t *testing.T) {
+	buildOutput := newBuildOutput(t,
+		"release-tars/kubernetes.tar.gz",
+		"release-stage/client/linux-amd64/kubernetes/client/bin/kubectl",
+	)
+	defer cleanupTmps(t, buildOutput)
+	store := newLocalStore(t)
+	defer cleanupTmps(t, store.Root())
+
+	version := "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0"
+	stageDir, err := StageLocalArtifacts(&StageOptions{
+		BuildOutput: buildOutput,
+		ReleaseTars: filepath.Join(buildOutput, "release-tars"),
+		Version:     version,
+		ReleaseKind: "kubernetes",
+	})
+	require.Nil(t, err)
+
+	opts := &PushOptions{CheckDestination: true, Public: true}
+	require.Nil(t, PushArtifacts(context.Background(), store, stageDir, "ci/"+version, opts))
+
+	files, public := listObjects(t, store)
+	require.Contains(t, files, "ci/"+version+"/bin/linux/amd64/kubectl")
+	require.Contains(t, files, "ci/"+version+"/kubernetes.tar.gz")
+	require.Contains(t, files, "ci/"+version+"/SHA512SUMS")
+	require.Contains(t, files, "ci/"+version+"/kubernetes.tar.gz.sha256")
+	require.Equal(t, files, public)
+
+	// Download the release and verify it against its manifests
+	downloadDir, err := ioutil.TempDir("", "download-")
+	require.Nil(t, err)
+	defer cleanupTmps(t, downloadDir)
+	for _, f := range files {
+		require.Nil(t, object.DownloadFile(
+			context.Background(), store, f,
+			filepath.Join(downloadDir, strings.TrimPrefix(f, "ci/"+version+"/")),
+		))
+	}
+	require.Nil(t, Verify(downloadDir))
+
+	content, err := object.ReadString(
+		context.Background(), store, "ci/"+version+"/kubernetes.tar.gz",
+	)
+	require.Nil(t, err)
+	require.Equal(t, "release-tars/kubernetes.tar.gz", content)
+
+	// Pushing the same version again fails
+	require.NotNil(t, PushArtifacts(context.Background(), store, stageDir, "ci/"+version, opts))
+}
+
+func TestStageAndPushBuildDryRun(t *testing.T) {
+	ctx := context.Background()
+	buildOutput := newBuildOutput(t, "release-tars/kubernetes.tar.gz")
+	defer cleanupTmps(t, buildOutput)
+	bucket := newLocalStore(t)
+	defer cleanupTmps(t, bucket.Root())
+	store, err := object.NewDryRunStore(bucket)
+	require.Nil(t, err)
+	defer store.Close() // nolint: errcheck
+
+	version := "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0"
+	stageDir, err := StageLocalArtifacts(&StageOptions{
+		BuildOutput: buildOutput,
+		ReleaseTars: filepath.Join(buildOutput, "release-tars"),
+		Version:     version,
+		ReleaseKind: "kubernetes",
+	})
+	require.Nil(t, err)
+
+	command.ResetDryRunSummary()
+	command.SetGlobalDryRunPolicy(command.DryRunMutating)
+	defer command.SetGlobalDryRunPolicy(command.DryRunDisabled)
+
+	// Pushing and publishing validate the skipped uploads
+	require.Nil(t, PushArtifacts(
+		ctx, store, stageDir, "ci/"+version, &PushOptions{CheckDestination: true, Public: true},
+	))
+	updated, err := PublishVersion(ctx, store, &PublishOptions{
+		BuildType: "ci", Version: version, Public: true,
+	})
+	require.Nil(t, err)
+	require.Len(t, updated, 3)
+	require.NotEmpty(t, command.DryRunSummary())
+
+	files, _ := listObjects(t, bucket)
+	require.Empty(t, files)
+}
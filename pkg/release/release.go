@@ -19,17 +19,9 @@ package release
 import (
 	"io/ioutil"
 	"path/filepath"
-	"regexp"
-	"strings"
-
-	"k8s.io/release/pkg/util"
 )
 
 const (
-	versionReleaseRE  = `v(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[a-zA-Z0-9]+)*\.*(0|[1-9][0-9]*)?`
-	versionDotZeroRE  = `v(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.0$`
-	versionBuildRE    = `([0-9]{1,})\+([0-9a-f]{5,40})`
-	versionDirtyRE    = `(-dirty)`
 	dockerBuildPath   = "_output/release-tars"
 	bazelBuildPath    = "bazel-bin/build/release-tars"
 	bazelVersionPath  = "bazel-genfiles/version"
@@ -39,10 +31,24 @@ const (
 
 // BuiltWithBazel determines whether the most recent release was built with Bazel.
 func BuiltWithBazel(path, releaseKind string) (bool, error) {
-	tar := releaseKind + tarballExtension
-	bazelBuild := filepath.Join(path, bazelBuildPath, tar)
-	dockerBuild := filepath.Join(path, dockerBuildPath, tar)
-	return util.MoreRecent(bazelBuild, dockerBuild)
+	info, err := DiscoverBuild(path, releaseKind)
+	if err != nil {
+		return false, err
+	}
+	latest, err := info.Latest()
+	if err != nil {
+		return false, err
+	}
+	return latest.Builder == BuilderBazel, nil
+}
+
+// ReleaseTarsPath returns the directory containing the release tarballs
+// within the repository at path, depending on the used build system.
+func ReleaseTarsPath(path string, bazel bool) string {
+	if bazel {
+		return filepath.Join(path, bazelBuildPath)
+	}
+	return filepath.Join(path, dockerBuildPath)
 }
 
 // ReadBazelVersion reads the version from a Bazel build.
@@ -51,25 +57,10 @@ func ReadBazelVersion(path string) (string, error) {
 	return string(version), err
 }
 
-// ReadDockerizedVersion reads the version from a Dockerized
+// ReadDockerizedVersion reads the version from a Dockerized build.
 func ReadDockerizedVersion(path, releaseKind string) (string, error) {
 	tar := releaseKind + tarballExtension
 	dockerTarball := filepath.Join(path, dockerBuildPath, tar)
 	versionFile := filepath.Join(releaseKind, dockerVersionPath)
-	reader, err := util.ReadFileFromGzippedTar(dockerTarball, versionFile)
-	if err != nil {
-		return "", err
-	}
-	file, err := ioutil.ReadAll(reader)
-	return strings.TrimSuffix(string(file), "\n"), err
-}
-
-// IsValidReleaseBuild checks if build version is valid for release.
-func IsValidReleaseBuild(build string) (bool, error) {
-	return regexp.MatchString("("+versionReleaseRE+`(\.`+versionBuildRE+")?"+versionDirtyRE+"?)", build)
-}
-
-// IsDirtyBuild checks if build version is dirty.
-func IsDirtyBuild(build string) bool {
-	return strings.Contains(build, "dirty")
+	return readTarballVersion(dockerTarball, versionFile)
 }
@@ -201,8 +201,8 @@ func TestReadDockerVersion(t *testing.T) {
 	}))
 	_, err = tw.Write([]byte(version))
 	require.Nil(t, err)
-	require.Nil(t, gz.Close())
 	require.Nil(t, tw.Close())
+	require.Nil(t, gz.Close())
 	require.Nil(t, ioutil.WriteFile(
 		filepath.Join(baseTmpDir, dockerBuildPath, "kubernetes.tar.gz"),
 		b.Bytes(),
@@ -253,77 +253,6 @@ func TestReadDockerVersion(t *testing.T) {
 	}
 }
 
-func TestIsValidReleaseBuild(t *testing.T) {
-	type want struct {
-		r    bool
-		rErr bool
-	}
-	cases := map[string]struct {
-		build string
-		want  want
-	}{
-		"ValidRelease": {
-			build: "v1.17.6",
-			want: want{
-				r:    true,
-				rErr: false,
-			},
-		},
-		"ValidReleaseBuild": {
-			build: "v1.17.6.abcde",
-			want: want{
-				r:    true,
-				rErr: false,
-			},
-		},
-		"ValidReleaseDirty": {
-			build: "v1.17.6.abcde-dirty",
-			want: want{
-				r:    true,
-				rErr: false,
-			},
-		},
-		"NotValidRelease": {
-			build: "1.1.1",
-			want: want{
-				r:    false,
-				rErr: false,
-			},
-		},
-	}
-
-	for name, tc := range cases {
-		t.Run(name, func(t *testing.T) {
-			res, err := IsValidReleaseBuild(tc.build)
-			require.Equal(t, tc.want.rErr, err != nil)
-			require.Equal(t, tc.want.r, res)
-		})
-	}
-}
-
-func TestIsDirtyBuild(t *testing.T) {
-	cases := map[string]struct {
-		build string
-		want  bool
-	}{
-		"Dirty": {
-			build: "v1.17.6-dirty",
-			want:  true,
-		},
-		"NotDirty": {
-			build: "v1.17.6.abcde",
-			want:  false,
-		},
-	}
-
-	for name, tc := range cases {
-		t.Run(name, func(t *testing.T) {
-			res := IsDirtyBuild(tc.build)
-			require.Equal(t, tc.want, res)
-		})
-	}
-}
-
 func cleanupTmps(t *testing.T, dir ...string) {
 	for _, each := range dir {
 		require.Nil(t, os.RemoveAll(each))
@@ -0,0 +1,333 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/release/pkg/command"
+	"k8s.io/release/pkg/object"
+	"k8s.io/release/pkg/plan"
+)
+
+// The steps of a release plan
+const (
+	StepPrepareWorkspace = "prepare-workspace"
+	StepTag              = "tag"
+	StepBuild            = "build"
+	StepStage            = "stage"
+	StepPushGitObjects   = "push-git-objects"
+	StepAnnounce         = "announce"
+)
+
+// The values persisted by the steps of a release plan
+const (
+	StateTreeRoot       = "tree_root"
+	StateReleaseVersion = "release_version"
+	StateStageDir       = "stage_dir"
+	StateAnnouncement   = "announcement"
+)
+
+// DefaultKubernetesRepoURL is the repository released by default
+const DefaultKubernetesRepoURL = "https://github.com/kubernetes/kubernetes"
+
+// ReleasePlanOptions are the options for releasing a build
+type ReleasePlanOptions struct {
+	// Branch is the branch to release from, like master or release-1.17
+	Branch string
+
+	// BuildVersion is the green build to release
+	BuildVersion Version
+
+	// Official releases an official version instead of a beta
+	Official bool
+
+	// RC releases a release candidate instead of a beta
+	RC bool
+
+	// ReleaseKind is the kind of release, like kubernetes
+	ReleaseKind string
+
+	// RepoURL is the URL of the repository to release
+	RepoURL string
+
+	// Workdir is the directory containing the source tree and all outputs
+	Workdir string
+
+	// Store is the release bucket the build gets staged to, which is only
+	// needed to run the plan
+	Store object.Store
+}
+
+// releasePlan holds the options for the steps of a release plan
+type releasePlan struct {
+	opts *ReleasePlanOptions
+}
+
+// Validate checks that the options describe a releasable build
+func (o *ReleasePlanOptions) Validate() error {
+	if o.Branch == "" || o.Workdir == "" {
+		return errors.New("branch and workdir are required")
+	}
+	if !o.BuildVersion.IsBuild() {
+		return errors.Errorf("%s is no build version", o.BuildVersion)
+	}
+	_, err := GreenBuildReleaseVersion(o.BuildVersion, o.Branch, o.Official, o.RC)
+	return err
+}
+
+// NewReleasePlan declares the steps of a release like anago does. The
+// options are only used when the steps run and should be validated before.
+// Mutating commands like pushing git objects follow the global dry run policy
+// of the command package, which means that they are not executed in mock
+// mode.
+func NewReleasePlan(opts *ReleasePlanOptions) (*plan.Plan, error) {
+	if opts.ReleaseKind == "" {
+		opts.ReleaseKind = "kubernetes"
+	}
+	if opts.RepoURL == "" {
+		opts.RepoURL = DefaultKubernetesRepoURL
+	}
+
+	r := &releasePlan{opts: opts}
+	return plan.New(
+		&plan.Step{
+			Name:        StepPrepareWorkspace,
+			Description: "clone or update the source tree within the workdir",
+			Run:         r.prepareWorkspace,
+		},
+		&plan.Step{
+			Name:        StepTag,
+			Description: "tag the release version at the commit of the build",
+			DependsOn:   []string{StepPrepareWorkspace},
+			Run:         r.tag,
+		},
+		&plan.Step{
+			Name:        StepBuild,
+			Description: "build the release from the tag",
+			DependsOn:   []string{StepTag},
+			Run:         r.build,
+		},
+		&plan.Step{
+			Name:        StepStage,
+			Description: "stage the source, artifacts and images to the release bucket",
+			DependsOn:   []string{StepBuild},
+			Run:         r.stage,
+		},
+		&plan.Step{
+			Name:        StepPushGitObjects,
+			Description: "push the release tag",
+			DependsOn:   []string{StepTag, StepStage},
+			Run:         r.pushGitObjects,
+		},
+		&plan.Step{
+			Name:        StepAnnounce,
+			Description: "write the release announcement",
+			DependsOn:   []string{StepPushGitObjects},
+			Run:         r.announce,
+		},
+	)
+}
+
+func (r *releasePlan) prepareWorkspace(ctx context.Context, state *plan.State) error {
+	tree := filepath.Join(r.opts.Workdir, "src", "k8s.io", r.opts.ReleaseKind)
+	if exists(filepath.Join(tree, ".git")) {
+		logrus.Infof("Updating source tree %s", tree)
+		if err := r.git(ctx, tree, "fetch", "--tags", "origin").RunSuccess(); err != nil {
+			return err
+		}
+	} else {
+		logrus.Infof("Cloning %s to %s", r.opts.RepoURL, tree)
+		if err := os.MkdirAll(filepath.Dir(tree), 0o755); err != nil {
+			return errors.Wrapf(err, "creating workdir %s", r.opts.Workdir)
+		}
+		if err := r.git(ctx, "", "clone", r.opts.RepoURL, tree).RunSuccess(); err != nil {
+			return err
+		}
+	}
+	if err := r.git(
+		ctx, tree, "checkout", "-B", r.opts.Branch, "origin/"+r.opts.Branch,
+	).RunSuccess(); err != nil {
+		return err
+	}
+	state.SetValue(StateTreeRoot, tree)
+	return nil
+}
+
+func (r *releasePlan) tag(ctx context.Context, state *plan.State) error {
+	version, err := GreenBuildReleaseVersion(
+		r.opts.BuildVersion, r.opts.Branch, r.opts.Official, r.opts.RC,
+	)
+	if err != nil {
+		return err
+	}
+	tree := state.Value(StateTreeRoot)
+	commit := r.opts.BuildVersion.Commit
+
+	// Tagging again is fine as long as the tag points to the build
+	status, err := r.git(ctx, tree, "rev-parse", "--verify", "--quiet", version.String()+"^{commit}").RunSilent()
+	if err != nil {
+		return err
+	}
+	if status.Success() {
+		existing := strings.TrimSpace(status.Output())
+		if !strings.HasPrefix(existing, commit) {
+			return errors.Errorf("tag %s already exists at %s instead of %s", version, existing, commit)
+		}
+		logrus.Infof("Tag %s already exists at %s", version, commit)
+	} else {
+		logrus.Infof("Tagging %s at %s", version, commit)
+		if err := r.git(
+			ctx, tree, "tag", "-a", "-m", fmt.Sprintf("Kubernetes %s release %s", r.opts.Branch, version),
+			version.String(), commit,
+		).RunSuccess(); err != nil {
+			return err
+		}
+	}
+	state.SetValue(StateReleaseVersion, version.String())
+	return nil
+}
+
+func (r *releasePlan) build(ctx context.Context, state *plan.State) error {
+	tree := state.Value(StateTreeRoot)
+	version := state.Value(StateReleaseVersion)
+	if err := r.git(ctx, tree, "checkout", version).RunSuccess(); err != nil {
+		return err
+	}
+
+	logrus.Infof("Building %s in %s", version, tree)
+	if err := command.NewWithWorkDir(tree, "make", "release").
+		WithContext(ctx).
+		WithEnv("KUBE_RELEASE_RUN_TESTS=n").
+		RunSuccess(); err != nil {
+		return errors.Wrap(err, "building release")
+	}
+
+	build, err := r.latestBuild(tree)
+	if err != nil {
+		return err
+	}
+	built, err := build.Version()
+	if err != nil {
+		return err
+	}
+	if built != version {
+		return errors.Errorf("built version %s does not match release version %s", built, version)
+	}
+	return nil
+}
+
+func (r *releasePlan) stage(ctx context.Context, state *plan.State) error {
+	if r.opts.Store == nil {
+		return errors.New("no release bucket to stage to")
+	}
+	tree := state.Value(StateTreeRoot)
+	version := state.Value(StateReleaseVersion)
+	build, err := r.latestBuild(tree)
+	if err != nil {
+		return err
+	}
+
+	stageDir, err := StageLocalArtifacts(&StageOptions{
+		BuildOutput: filepath.Join(tree, BuildOutputPath),
+		ReleaseTars: build.ReleaseTarsPath,
+		Version:     version,
+		ReleaseKind: r.opts.ReleaseKind,
+	})
+	if err != nil {
+		return err
+	}
+	state.SetValue(StateStageDir, stageDir)
+
+	// Staging is repeatable, which means that existing objects are
+	// overwritten when the step runs again
+	pushOpts := &PushOptions{AllowDup: true}
+	if err := PushArtifacts(
+		ctx, r.opts.Store, stageDir, StagedArtifactsPath(r.opts.BuildVersion, version), pushOpts,
+	); err != nil {
+		return err
+	}
+	images := filepath.Join(tree, BuildOutputPath, stagedImagesPath)
+	if err := PushArtifacts(
+		ctx, r.opts.Store, images, StagedImagesPath(r.opts.BuildVersion, version), pushOpts,
+	); err != nil {
+		return err
+	}
+
+	source := filepath.Join(r.opts.Workdir, StagedSourceArchive)
+	logrus.Infof("Archiving source tree of %s to %s", version, source)
+	if err := r.git(
+		ctx, tree, "archive", "--format=tar.gz", "--prefix=kubernetes/", "-o", source, version,
+	).RunSuccess(); err != nil {
+		return err
+	}
+	if err := object.UploadFile(
+		ctx, r.opts.Store, source, path.Join(StagedBuildPath(r.opts.BuildVersion), StagedSourceArchive),
+	); err != nil {
+		return err
+	}
+	return ValidateStagedBuild(ctx, r.opts.Store, r.opts.BuildVersion, version)
+}
+
+func (r *releasePlan) pushGitObjects(ctx context.Context, state *plan.State) error {
+	version := state.Value(StateReleaseVersion)
+	logrus.Infof("Pushing tag %s", version)
+	return r.git(ctx, state.Value(StateTreeRoot), "push", "origin", version).
+		Mutating().
+		RunSuccess()
+}
+
+func (r *releasePlan) announce(ctx context.Context, state *plan.State) error {
+	version := state.Value(StateReleaseVersion)
+	announcement := filepath.Join(r.opts.Workdir, "announcement.txt")
+	content := fmt.Sprintf(
+		"Kubernetes Community,\n\n"+
+			"Kubernetes %s has been built and pushed.\n\n"+
+			"The release notes have been updated in CHANGELOG-%d.%d.md, with a pointer to them on GitHub:\n"+
+			"https://github.com/kubernetes/kubernetes/releases/tag/%s\n",
+		version, r.opts.BuildVersion.Major, r.opts.BuildVersion.Minor, version,
+	)
+	if err := ioutil.WriteFile(announcement, []byte(content), 0o644); err != nil {
+		return errors.Wrapf(err, "writing announcement %s", announcement)
+	}
+	logrus.Infof("Wrote announcement of %s to %s", version, announcement)
+	state.SetValue(StateAnnouncement, announcement)
+	return nil
+}
+
+// git creates a git command within the directory
+func (r *releasePlan) git(ctx context.Context, dir string, args ...string) *command.Command {
+	return command.NewWithWorkDir(dir, "git", args...).WithContext(ctx)
+}
+
+// latestBuild returns the most recent build within the tree
+func (r *releasePlan) latestBuild(tree string) (*Build, error) {
+	info, err := DiscoverBuild(tree, r.opts.ReleaseKind)
+	if err != nil {
+		return nil, err
+	}
+	return info.Latest()
+}
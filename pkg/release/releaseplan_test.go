@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleasePlanOptions(t *testing.T) {
+	build := MustParseVersion("v1.17.1-beta.0.20+cce11c6a185279")
+	cases := map[string]struct {
+		opts      ReleasePlanOptions
+		shouldErr bool
+	}{
+		"Beta": {
+			opts: ReleasePlanOptions{Branch: "release-1.17", BuildVersion: build, Workdir: "/tmp"},
+		},
+		"Official": {
+			opts: ReleasePlanOptions{Branch: "release-1.17", BuildVersion: build, Workdir: "/tmp", Official: true},
+		},
+		"OfficialOnMaster": {
+			opts:      ReleasePlanOptions{Branch: "master", BuildVersion: build, Workdir: "/tmp", Official: true},
+			shouldErr: true,
+		},
+		"NoBuild": {
+			opts:      ReleasePlanOptions{Branch: "release-1.17", BuildVersion: MustParseVersion("v1.17.0"), Workdir: "/tmp"},
+			shouldErr: true,
+		},
+		"NoWorkdir": {
+			opts:      ReleasePlanOptions{Branch: "release-1.17", BuildVersion: build},
+			shouldErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.opts.Validate()
+			require.Equal(t, tc.shouldErr, err != nil, err)
+		})
+	}
+}
+
+func TestNewReleasePlan(t *testing.T) {
+	opts := &ReleasePlanOptions{Branch: "release-1.17", Workdir: "/tmp"}
+	p, err := NewReleasePlan(opts)
+	require.Nil(t, err)
+	require.Equal(t, "kubernetes", opts.ReleaseKind)
+	require.Equal(t, DefaultKubernetesRepoURL, opts.RepoURL)
+
+	steps := []string{}
+	for _, step := range p.Steps() {
+		steps = append(steps, step.Name)
+	}
+	require.Equal(t, []string{
+		StepPrepareWorkspace, StepTag, StepBuild, StepStage, StepPushGitObjects, StepAnnounce,
+	}, steps)
+	require.Equal(t, []string{StepPushGitObjects, StepAnnounce}, p.Dependents(StepStage))
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+)
+
+// Signer creates detached signatures
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// Verifier checks detached signatures created by a Signer
+type Verifier interface {
+	Verify(data, signature []byte) error
+}
+
+// Ed25519Signer signs with an ed25519 private key. Signatures are base64
+// encoded.
+type Ed25519Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates a new signer for the private key
+func NewEd25519Signer(key ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{key}
+}
+
+// Sign signs the data
+func (s *Ed25519Signer) Sign(data []byte) ([]byte, error) {
+	signature := ed25519.Sign(s.key, data)
+	return []byte(base64.StdEncoding.EncodeToString(signature) + "\n"), nil
+}
+
+// Ed25519Verifier verifies signatures of an Ed25519Signer
+type Ed25519Verifier struct {
+	key ed25519.PublicKey
+}
+
+// NewEd25519Verifier creates a new verifier for the public key
+func NewEd25519Verifier(key ed25519.PublicKey) *Ed25519Verifier {
+	return &Ed25519Verifier{key}
+}
+
+// Verify checks the signature of the data
+func (v *Ed25519Verifier) Verify(data, signature []byte) error {
+	decoded, err := base64.StdEncoding.DecodeString(
+		strings.TrimSpace(string(signature)),
+	)
+	if err != nil {
+		return errors.Wrap(err, "decoding ed25519 signature")
+	}
+	if !ed25519.Verify(v.key, data, decoded) {
+		return errors.New("ed25519 signature does not match")
+	}
+	return nil
+}
+
+// PGPSigner signs with the private key of a PGP entity. Signatures are ASCII
+// armored.
+type PGPSigner struct {
+	entity *openpgp.Entity
+}
+
+// NewPGPSigner creates a new signer for the entity, which needs to have a
+// decrypted private key
+func NewPGPSigner(entity *openpgp.Entity) (*PGPSigner, error) {
+	if entity.PrivateKey == nil {
+		return nil, errors.New("PGP entity has no private key")
+	}
+	if entity.PrivateKey.Encrypted {
+		return nil, errors.New("encrypted PGP private keys are not supported")
+	}
+	return &PGPSigner{entity}, nil
+}
+
+// Sign signs the data
+func (s *PGPSigner) Sign(data []byte) ([]byte, error) {
+	signature := &bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(
+		signature, s.entity, bytes.NewReader(data), nil,
+	); err != nil {
+		return nil, errors.Wrap(err, "creating PGP signature")
+	}
+	return signature.Bytes(), nil
+}
+
+// PGPVerifier verifies signatures of any key within a PGP keyring
+type PGPVerifier struct {
+	keyring openpgp.EntityList
+}
+
+// NewPGPVerifier creates a new verifier for the keyring
+func NewPGPVerifier(keyring openpgp.EntityList) *PGPVerifier {
+	return &PGPVerifier{keyring}
+}
+
+// Verify checks the signature of the data
+func (v *PGPVerifier) Verify(data, signature []byte) error {
+	_, err := openpgp.CheckArmoredDetachedSignature(
+		v.keyring, bytes.NewReader(data), bytes.NewReader(signature),
+	)
+	return errors.Wrap(err, "checking PGP signature")
+}
+
+// LoadSigner creates a signer from a key file, which is either a PEM encoded
+// PKCS #8 ed25519 private key or an ASCII armored PGP private keyring. The
+// first private key of the keyring is used for signing.
+func LoadSigner(path string) (Signer, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading signing key %s", path)
+	}
+
+	// PGP armor looks like PEM, hence the check for the block type
+	if block, _ := pem.Decode(content); block != nil && block.Type == "PRIVATE KEY" {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing private key %s", path)
+		}
+		ed25519Key, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.Errorf("private key %s is not an ed25519 key", path)
+		}
+		return NewEd25519Signer(ed25519Key), nil
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing PGP keyring %s", path)
+	}
+	for _, entity := range keyring {
+		if entity.PrivateKey != nil {
+			return NewPGPSigner(entity)
+		}
+	}
+	return nil, errors.Errorf("PGP keyring %s contains no private key", path)
+}
+
+// LoadVerifier creates a verifier from a key file, which is either a PEM
+// encoded PKIX ed25519 public key or an ASCII armored PGP keyring
+func LoadVerifier(path string) (Verifier, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading verification key %s", path)
+	}
+
+	if block, _ := pem.Decode(content); block != nil && block.Type == "PUBLIC KEY" {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing public key %s", path)
+		}
+		ed25519Key, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.Errorf("public key %s is not an ed25519 key", path)
+		}
+		return NewEd25519Verifier(ed25519Key), nil
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing PGP keyring %s", path)
+	}
+	return NewPGPVerifier(keyring), nil
+}
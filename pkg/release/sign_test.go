@@ -0,0 +1,149 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// writeEd25519Keys writes a new PEM encoded ed25519 key pair to the
+// directory and returns the private and public key paths
+func writeEd25519Keys(t *testing.T, dir string) (private, public string) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	privateBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.Nil(t, err)
+	publicBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.Nil(t, err)
+
+	private = filepath.Join(dir, "ed25519.key")
+	public = filepath.Join(dir, "ed25519.pub")
+	require.Nil(t, ioutil.WriteFile(private, pem.EncodeToMemory(
+		&pem.Block{Type: "PRIVATE KEY", Bytes: privateBytes},
+	), 0o600))
+	require.Nil(t, ioutil.WriteFile(public, pem.EncodeToMemory(
+		&pem.Block{Type: "PUBLIC KEY", Bytes: publicBytes},
+	), 0o644))
+	return private, public
+}
+
+// writePGPKeys writes a new ASCII armored PGP keyring to the directory and
+// returns the private and public keyring paths
+func writePGPKeys(t *testing.T, dir string) (private, public string) {
+	entity, err := openpgp.NewEntity("Release Test", "", "release@example.com", nil)
+	require.Nil(t, err)
+
+	private = filepath.Join(dir, "secring.asc")
+	privateFile, err := os.Create(private)
+	require.Nil(t, err)
+	w, err := armor.Encode(privateFile, openpgp.PrivateKeyType, nil)
+	require.Nil(t, err)
+	require.Nil(t, entity.SerializePrivate(w, nil))
+	require.Nil(t, w.Close())
+	require.Nil(t, privateFile.Close())
+
+	public = filepath.Join(dir, "pubring.asc")
+	publicFile, err := os.Create(public)
+	require.Nil(t, err)
+	w, err = armor.Encode(publicFile, openpgp.PublicKeyType, nil)
+	require.Nil(t, err)
+	require.Nil(t, entity.Serialize(w))
+	require.Nil(t, w.Close())
+	require.Nil(t, publicFile.Close())
+	return private, public
+}
+
+func TestLoadSignerAndVerifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys-")
+	require.Nil(t, err)
+	defer cleanupTmps(t, dir)
+
+	ed25519Private, ed25519Public := writeEd25519Keys(t, dir)
+	pgpPrivate, pgpPublic := writePGPKeys(t, dir)
+
+	cases := map[string]struct {
+		private, public string
+	}{
+		"Ed25519": {ed25519Private, ed25519Public},
+		"PGP":     {pgpPrivate, pgpPublic},
+		// A private keyring contains the public keys as well
+		"PGPPrivateKeyring": {pgpPrivate, pgpPrivate},
+	}
+
+	data := []byte("data")
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			signer, err := LoadSigner(tc.private)
+			require.Nil(t, err)
+			verifier, err := LoadVerifier(tc.public)
+			require.Nil(t, err)
+
+			signature, err := signer.Sign(data)
+			require.Nil(t, err)
+			require.Nil(t, verifier.Verify(data, signature))
+			require.NotNil(t, verifier.Verify([]byte("modified"), signature))
+		})
+	}
+
+	// Signatures of other keys get rejected
+	signer, err := LoadSigner(ed25519Private)
+	require.Nil(t, err)
+	signature, err := signer.Sign(data)
+	require.Nil(t, err)
+	otherDir := filepath.Join(dir, "other")
+	require.Nil(t, os.Mkdir(otherDir, 0o755))
+	_, otherPublic := writeEd25519Keys(t, otherDir)
+	verifier, err := LoadVerifier(otherPublic)
+	require.Nil(t, err)
+	require.NotNil(t, verifier.Verify(data, signature))
+}
+
+func TestLoadSignerFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys-")
+	require.Nil(t, err)
+	defer cleanupTmps(t, dir)
+
+	_, ed25519Public := writeEd25519Keys(t, dir)
+	_, pgpPublic := writePGPKeys(t, dir)
+	invalid := filepath.Join(dir, "invalid")
+	require.Nil(t, ioutil.WriteFile(invalid, []byte("invalid"), 0o644))
+
+	for _, path := range []string{
+		ed25519Public,
+		pgpPublic,
+		invalid,
+		filepath.Join(dir, "missing"),
+	} {
+		_, err := LoadSigner(path)
+		require.NotNil(t, err, path)
+	}
+
+	_, err = LoadVerifier(invalid)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/release/pkg/util"
+)
+
+const (
+	// BuildOutputPath is the default build output directory of a Kubernetes
+	// build
+	BuildOutputPath = "_output"
+
+	releaseStagePath = "release-stage"
+	gcsStagePath     = "gcs-stage"
+)
+
+// StageOptions are the options for staging release artifacts locally
+type StageOptions struct {
+	// BuildOutput is the build output directory, usually _output
+	BuildOutput string
+
+	// ReleaseTars is the directory containing the release tarballs
+	ReleaseTars string
+
+	// Version is the version to be staged
+	Version string
+
+	// ReleaseKind is the kind of release, like kubernetes
+	ReleaseKind string
+}
+
+// StageDir returns the local staging directory for the options, which is
+// <BuildOutput>/gcs-stage/<Version>
+func (o *StageOptions) StageDir() string {
+	return filepath.Join(o.BuildOutput, gcsStagePath, o.Version)
+}
+
+// StageLocalArtifacts stages the release artifacts for the upload to GCS like
+// release::gcs::locally_stage_release_artifacts does. It returns the staging
+// directory, which gets recreated on every call.
+func StageLocalArtifacts(opts *StageOptions) (string, error) {
+	stageDir := opts.StageDir()
+	releaseStage := filepath.Join(opts.BuildOutput, releaseStagePath)
+	logrus.Infof("Locally staging release artifacts to %s", stageDir)
+
+	if err := os.RemoveAll(stageDir); err != nil {
+		return "", errors.Wrapf(err, "removing staging directory %s", stageDir)
+	}
+	if err := os.MkdirAll(stageDir, 0o755); err != nil {
+		return "", errors.Wrapf(err, "creating staging directory %s", stageDir)
+	}
+
+	logrus.Infof("Staging release tarballs from %s", opts.ReleaseTars)
+	if err := util.CopyDirContentsLocal(opts.ReleaseTars, stageDir); err != nil {
+		return "", errors.Wrap(err, "staging release tarballs")
+	}
+
+	if opts.ReleaseKind == "kubernetes" {
+		if err := stageGCEExtras(releaseStage, stageDir); err != nil {
+			return "", errors.Wrap(err, "staging GCE extras")
+		}
+	}
+
+	if err := stageBinaries(releaseStage, stageDir, opts.ReleaseKind); err != nil {
+		return "", errors.Wrap(err, "staging release binaries")
+	}
+
+	legacy := true
+	if version, err := ParseVersionPrefix(opts.Version); err == nil {
+		legacy = UsesLegacyHashes(version)
+	}
+	if err := WriteChecksums(stageDir, legacy); err != nil {
+		return "", errors.Wrap(err, "writing artifact hashes")
+	}
+	return stageDir, nil
+}
+
+// stageGCEExtras stages the GCE cluster scripts, which are useful for GKE
+func stageGCEExtras(releaseStage, stageDir string) error {
+	gcePath := filepath.Join(releaseStage, "full", "kubernetes", "cluster", "gce")
+	if !exists(gcePath) {
+		logrus.Infof("Skipping GCE extras because %s does not exist", gcePath)
+		return nil
+	}
+
+	// The GCI path changed in the 1.2 -> 1.3 time period
+	gciPath := filepath.Join(gcePath, "gci")
+	if !exists(gciPath) {
+		gciPath = filepath.Join(gcePath, "trusty")
+	}
+
+	extraDir := filepath.Join(stageDir, "extra", "gce")
+	files := []struct {
+		src      string
+		required bool
+	}{
+		// Removed in 1.10+
+		{filepath.Join(gcePath, "configure-vm.sh"), false},
+		{filepath.Join(gciPath, "node.yaml"), true},
+		{filepath.Join(gciPath, "master.yaml"), true},
+		{filepath.Join(gciPath, "configure.sh"), true},
+		// Available starting from 1.11
+		{filepath.Join(gciPath, "shutdown.sh"), false},
+	}
+	for _, file := range files {
+		if !file.required && !exists(file.src) {
+			continue
+		}
+		dst := filepath.Join(extraDir, filepath.Base(file.src))
+		if err := util.CopyFileLocal(file.src, dst); err != nil {
+			return errors.Wrapf(err, "copying %s", file.src)
+		}
+	}
+
+	windowsPath := filepath.Join(gcePath, "windows")
+	if !exists(windowsPath) {
+		return nil
+	}
+	for _, file := range []string{
+		"configure.ps1",
+		"common.psm1",
+		"k8s-node-setup.psm1",
+		"testonly/install-ssh.psm1",
+		"testonly/user-profile.psm1",
+	} {
+		src := filepath.Join(windowsPath, file)
+		dst := filepath.Join(extraDir, "windows", filepath.Base(file))
+		if err := util.CopyFileLocal(src, dst); err != nil {
+			return errors.Wrapf(err, "copying %s", src)
+		}
+	}
+	return nil
+}
+
+// stageBinaries stages the "naked" binaries for every platform to
+// bin/<os>/<arch>, which is useful for install scripts that download the
+// binaries directly.
+func stageBinaries(releaseStage, stageDir, releaseKind string) error {
+	clientDir := filepath.Join(releaseStage, "client")
+	platforms, err := ioutil.ReadDir(clientDir)
+	if os.IsNotExist(err) {
+		logrus.Infof("Skipping binaries because %s does not exist", clientDir)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "reading platforms from %s", clientDir)
+	}
+
+	for _, platform := range platforms {
+		if !platform.IsDir() {
+			continue
+		}
+		name := platform.Name()
+		dst := filepath.Join(
+			append([]string{stageDir, "bin"}, strings.SplitN(name, "-", 2)...)...,
+		)
+
+		// The server binaries get copied after the client ones, so that they
+		// win for binaries contained in both packages. The node package only
+		// exists for platforms without a server package.
+		src := filepath.Join(clientDir, name, releaseKind, "client", "bin")
+		serverDir := filepath.Join(releaseStage, "server", name)
+		nodeDir := filepath.Join(releaseStage, "node", name)
+		srcs := []string{src}
+		if exists(serverDir) {
+			srcs = append(srcs, filepath.Join(serverDir, releaseKind, "server", "bin"))
+		} else if exists(nodeDir) {
+			srcs = append(srcs, filepath.Join(nodeDir, releaseKind, "node", "bin"))
+		}
+
+		for _, src := range srcs {
+			logrus.Infof("Staging %s binaries from %s", name, src)
+			if err := util.CopyDirContentsLocal(src, dst); err != nil {
+				return errors.Wrapf(err, "copying binaries from %s", src)
+			}
+		}
+	}
+	return nil
+}
+
+// exists returns true if the path exists
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newBuildOutput creates a fake build output directory containing the
+// provided files
+func newBuildOutput(t *testing.T, files ...string) string {
+	dir, err := ioutil.TempDir("", "build-output-")
+	require.Nil(t, err)
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.Nil(t, ioutil.WriteFile(path, []byte(file), 0o644))
+	}
+	return dir
+}
+
+// listArtifactFiles returns all files below the directory relative to it,
+// excluding the manifests and hash sidecars
+func listArtifactFiles(t *testing.T, dir string) []string {
+	files, err := listArtifacts(dir)
+	require.Nil(t, err)
+	return files
+}
+
+func TestStageLocalArtifacts(t *testing.T) {
+	gce := "release-stage/full/kubernetes/cluster/gce/"
+	buildOutput := newBuildOutput(t,
+		"release-tars/kubernetes.tar.gz",
+		"release-tars/kubernetes-client-linux-amd64.tar.gz",
+		gce+"gci/node.yaml",
+		gce+"gci/master.yaml",
+		gce+"gci/configure.sh",
+		gce+"windows/configure.ps1",
+		gce+"windows/common.psm1",
+		gce+"windows/k8s-node-setup.psm1",
+		gce+"windows/testonly/install-ssh.psm1",
+		gce+"windows/testonly/user-profile.psm1",
+		"release-stage/client/linux-amd64/kubernetes/client/bin/kubectl",
+		"release-stage/client/linux-amd64/kubernetes/client/bin/kubectl-convert",
+		"release-stage/server/linux-amd64/kubernetes/server/bin/kubectl",
+		"release-stage/server/linux-amd64/kubernetes/server/bin/kubelet",
+		"release-stage/client/windows-amd64/kubernetes/client/bin/kubectl.exe",
+		"release-stage/node/windows-amd64/kubernetes/node/bin/kubelet.exe",
+	)
+	defer cleanupTmps(t, buildOutput)
+
+	// Leftovers of previous runs get removed
+	opts := &StageOptions{
+		BuildOutput: buildOutput,
+		ReleaseTars: filepath.Join(buildOutput, "release-tars"),
+		Version:     "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0",
+		ReleaseKind: "kubernetes",
+	}
+	require.Nil(t, os.MkdirAll(opts.StageDir(), os.ModePerm))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(opts.StageDir(), "old"), nil, 0o644))
+
+	stageDir, err := StageLocalArtifacts(opts)
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(buildOutput, "gcs-stage", opts.Version), stageDir)
+
+	require.Equal(t, []string{
+		"bin/linux/amd64/kubectl",
+		"bin/linux/amd64/kubectl-convert",
+		"bin/linux/amd64/kubelet",
+		"bin/windows/amd64/kubectl.exe",
+		"bin/windows/amd64/kubelet.exe",
+		"extra/gce/configure.sh",
+		"extra/gce/master.yaml",
+		"extra/gce/node.yaml",
+		"extra/gce/windows/common.psm1",
+		"extra/gce/windows/configure.ps1",
+		"extra/gce/windows/install-ssh.psm1",
+		"extra/gce/windows/k8s-node-setup.psm1",
+		"extra/gce/windows/user-profile.psm1",
+		"kubernetes-client-linux-amd64.tar.gz",
+		"kubernetes.tar.gz",
+	}, listArtifactFiles(t, stageDir))
+	require.Nil(t, Verify(stageDir))
+
+	// The server binaries are preferred over the client ones
+	content, err := ioutil.ReadFile(filepath.Join(stageDir, "bin/linux/amd64/kubectl"))
+	require.Nil(t, err)
+	require.Equal(t, "release-stage/server/linux-amd64/kubernetes/server/bin/kubectl", string(content))
+}
+
+func TestStageLocalArtifactsFailure(t *testing.T) {
+	buildOutput := newBuildOutput(t,
+		"release-tars/kubernetes.tar.gz",
+		"release-stage/full/kubernetes/cluster/gce/gci/node.yaml",
+	)
+	defer cleanupTmps(t, buildOutput)
+
+	_, err := StageLocalArtifacts(&StageOptions{
+		BuildOutput: buildOutput,
+		ReleaseTars: filepath.Join(buildOutput, "release-tars"),
+		Version:     "v1.18.0",
+		ReleaseKind: "kubernetes",
+	})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,429 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/release/pkg/object"
+)
+
+const (
+	// StagePath is the path of the staged builds within a release bucket
+	StagePath = "stage"
+
+	// StagedSourceArchive is the archive of the source tree a staged build
+	// has been built from
+	StagedSourceArchive = "src.tar.gz"
+
+	stagedImagesPath = "release-images"
+)
+
+// StagedBuild is a build staged below stage/<BuildVersion>, which contains
+// the source archive and the artifacts and images of every release version
+// built from it
+type StagedBuild struct {
+	// BuildVersion is the version of the build, like
+	// v1.17.1-beta.0.20+cce11c6a185279
+	BuildVersion Version
+
+	// Versions are the release versions staged for the build, sorted from
+	// the oldest to the newest
+	Versions []string
+
+	// Objects is the number of staged objects
+	Objects int
+
+	// Size is the total size of the staged objects in bytes
+	Size int64
+
+	// Updated is the time of the latest modification of any staged object
+	Updated time.Time
+}
+
+// StagedBuildPath returns the path of the staged build within a release
+// bucket
+func StagedBuildPath(build Version) string {
+	return path.Join(StagePath, build.String())
+}
+
+// StagedArtifactsPath returns the path of the release artifacts of the
+// version within the staged build, which is
+// stage/<build>/<version>/gcs-stage/<version>
+func StagedArtifactsPath(build Version, version string) string {
+	return path.Join(StagedBuildPath(build), version, gcsStagePath, version)
+}
+
+// StagedImagesPath returns the path of the release image tarballs of the
+// version within the staged build
+func StagedImagesPath(build Version, version string) string {
+	return path.Join(StagedBuildPath(build), version, stagedImagesPath)
+}
+
+// ListStagedBuilds returns the builds staged in the store, sorted from the
+// oldest to the newest version. Directories which are no valid build versions
+// are ignored.
+func ListStagedBuilds(ctx context.Context, store object.Store) ([]*StagedBuild, error) {
+	objects, err := store.List(ctx, StagePath+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	builds := map[string]*StagedBuild{}
+	versions := map[string]map[string]bool{}
+	for _, o := range objects {
+		parts := strings.SplitN(strings.TrimPrefix(o.Name, StagePath+"/"), "/", 3)
+		build, ok := builds[parts[0]]
+		if !ok {
+			buildVersion, err := ParseVersion(parts[0])
+			if err != nil {
+				logrus.Debugf("Ignoring staged directory %s: %v", parts[0], err)
+				builds[parts[0]] = nil
+				continue
+			}
+			build = &StagedBuild{BuildVersion: buildVersion}
+			builds[parts[0]] = build
+			versions[parts[0]] = map[string]bool{}
+		}
+		if build == nil {
+			continue
+		}
+
+		build.Objects++
+		build.Size += o.Size
+		if o.Updated.After(build.Updated) {
+			build.Updated = o.Updated
+		}
+		if len(parts) == 3 {
+			if _, err := ParseVersion(parts[1]); err == nil {
+				versions[parts[0]][parts[1]] = true
+			}
+		}
+	}
+
+	res := []*StagedBuild{}
+	for dir, build := range builds {
+		if build == nil {
+			continue
+		}
+		build.Versions = sortedVersions(versions[dir])
+		res = append(res, build)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].BuildVersion.LessThan(res[j].BuildVersion)
+	})
+	return res, nil
+}
+
+// sortedVersions returns the set of valid versions sorted from the oldest to
+// the newest
+func sortedVersions(set map[string]bool) []string {
+	versions := []string{}
+	for version := range set {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return MustParseVersion(versions[i]).LessThan(MustParseVersion(versions[j]))
+	})
+	return versions
+}
+
+// FindStagedBuild returns the staged build of the version or an error if it
+// has not been staged
+func FindStagedBuild(ctx context.Context, store object.Store, build Version) (*StagedBuild, error) {
+	builds, err := ListStagedBuilds(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range builds {
+		if b.BuildVersion.Equal(build) {
+			return b, nil
+		}
+	}
+	return nil, errors.Errorf("build %s is not staged on %s", build, store)
+}
+
+// ValidateStagedBuild checks that the staged build is complete like
+// found_staged_location does. The source archive has to exist, and every
+// version, or all staged ones if none are provided, needs release tarballs,
+// release images and the SHA256SUMS or SHA512SUMS manifest. Every artifact
+// has to be listed in the manifests and has to have their hash sidecars,
+// while every file listed in a manifest has to exist. The content of the
+// artifacts is not verified.
+func ValidateStagedBuild(ctx context.Context, store object.Store, build Version, versions ...string) error {
+	buildPath := StagedBuildPath(build)
+	objects, err := store.List(ctx, buildPath+"/")
+	if err != nil {
+		return errors.Wrapf(err, "listing staged build %s", build)
+	}
+	if len(objects) == 0 {
+		return errors.Errorf("build %s is not staged on %s", build, store)
+	}
+	if len(versions) == 0 {
+		staged := map[string]bool{}
+		for _, o := range objects {
+			parts := strings.SplitN(strings.TrimPrefix(o.Name, buildPath+"/"), "/", 2)
+			if _, err := ParseVersion(parts[0]); err == nil && len(parts) == 2 {
+				staged[parts[0]] = true
+			}
+		}
+		versions = sortedVersions(staged)
+	}
+
+	names := map[string]bool{}
+	for _, o := range objects {
+		names[o.Name] = true
+	}
+	failures := []string{}
+	if !names[path.Join(buildPath, StagedSourceArchive)] {
+		failures = append(failures, "missing source archive "+StagedSourceArchive)
+	}
+	if len(versions) == 0 {
+		failures = append(failures, "no staged release versions")
+	}
+	for _, version := range versions {
+		versionFailures, err := validateStagedVersion(ctx, store, build, version, names)
+		if err != nil {
+			return err
+		}
+		failures = append(failures, versionFailures...)
+	}
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return errors.Errorf(
+			"staged build %s on %s is incomplete:\n%s",
+			build, store, strings.Join(failures, "\n"),
+		)
+	}
+	return nil
+}
+
+// validateStagedVersion returns the completeness failures of a staged
+// release version. names contains all objects of the staged build.
+func validateStagedVersion(
+	ctx context.Context, store object.Store, build Version, version string, names map[string]bool,
+) ([]string, error) {
+	failures := []string{}
+	artifactsPath := StagedArtifactsPath(build, version)
+	imagesPath := StagedImagesPath(build, version)
+	artifacts := []string{}
+	tarballs, images := 0, 0
+	for name := range names {
+		if strings.HasPrefix(name, imagesPath+"/") && strings.HasSuffix(name, ".tar") {
+			images++
+		}
+		if !strings.HasPrefix(name, artifactsPath+"/") {
+			continue
+		}
+		rel := strings.TrimPrefix(name, artifactsPath+"/")
+		if !isArtifact(rel) {
+			continue
+		}
+		artifacts = append(artifacts, rel)
+		if !strings.Contains(rel, "/") && strings.HasSuffix(rel, ".tar.gz") {
+			tarballs++
+		}
+	}
+	if tarballs == 0 {
+		failures = append(failures, fmt.Sprintf("%s: no release tarballs", version))
+	}
+	if images == 0 {
+		failures = append(failures, fmt.Sprintf("%s: no release images", version))
+	}
+
+	manifests := 0
+	for _, algorithm := range hashAlgorithms {
+		if algorithm.manifest == "" {
+			continue
+		}
+		manifestPath := path.Join(artifactsPath, algorithm.manifest)
+		if !names[manifestPath] {
+			continue
+		}
+		manifests++
+
+		content := &bytes.Buffer{}
+		if err := store.Download(ctx, manifestPath, content); err != nil {
+			return nil, errors.Wrapf(err, "downloading %s", manifestPath)
+		}
+		entries, err := parseManifest(content, manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		for file := range entries {
+			if !names[path.Join(artifactsPath, file)] {
+				failures = append(failures, fmt.Sprintf(
+					"%s: %s listed in %s is missing", version, file, algorithm.manifest,
+				))
+			}
+		}
+		for _, artifact := range artifacts {
+			if _, ok := entries[artifact]; !ok {
+				failures = append(failures, fmt.Sprintf(
+					"%s: %s is not listed in %s", version, artifact, algorithm.manifest,
+				))
+			}
+			if !names[path.Join(artifactsPath, artifact+algorithm.extension)] {
+				failures = append(failures, fmt.Sprintf(
+					"%s: missing %s%s", version, artifact, algorithm.extension,
+				))
+			}
+		}
+	}
+	if manifests == 0 {
+		failures = append(failures, fmt.Sprintf(
+			"%s: neither %s nor %s found", version, SHA256Manifest, SHA512Manifest,
+		))
+	}
+	return failures, nil
+}
+
+// PromoteOptions are the options for promoting a staged build
+type PromoteOptions struct {
+	// Version is the staged release version to promote, like v1.17.0
+	Version string
+
+	// Dest is the release path within the destination store, like
+	// release/v1.17.0
+	Dest string
+
+	// Public makes all promoted objects publicly readable
+	Public bool
+}
+
+// PromoteResult are the objects handled by a promotion
+type PromoteResult struct {
+	// Promoted are the objects copied to the destination
+	Promoted []string
+
+	// Skipped are the objects which already existed in the destination
+	Skipped []string
+}
+
+// PromoteStagedBuild validates the staged build and copies the release
+// artifacts of the version to the release path like copy_staged_from_gcs
+// does. The source and destination store may be the same.
+//
+// Every object is copied atomically, which means that an object either exists
+// completely in the destination or not at all. This allows resuming an
+// interrupted promotion by calling it again, which skips all objects
+// existing with the same size and CRC32C in the destination. The manifests are copied
+// last, which means that their presence in the destination indicates a
+// completed promotion.
+func PromoteStagedBuild(
+	ctx context.Context, src, dst object.Store, build Version, opts *PromoteOptions,
+) (*PromoteResult, error) {
+	if opts.Version == "" || opts.Dest == "" {
+		return nil, errors.New("version and destination are required")
+	}
+	if err := ValidateStagedBuild(ctx, src, build, opts.Version); err != nil {
+		return nil, err
+	}
+
+	artifactsPath := StagedArtifactsPath(build, opts.Version)
+	objects, err := src.List(ctx, artifactsPath+"/")
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing %s", artifactsPath)
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return promotionOrder(objects[i].Name) < promotionOrder(objects[j].Name)
+	})
+
+	logrus.Infof(
+		"Promoting %d objects from %s/%s to %s/%s",
+		len(objects), src, artifactsPath, dst, opts.Dest,
+	)
+	res := &PromoteResult{Promoted: []string{}, Skipped: []string{}}
+	for _, o := range objects {
+		target := path.Join(opts.Dest, strings.TrimPrefix(o.Name, artifactsPath+"/"))
+		existing, err := dst.Stat(ctx, target)
+		switch {
+		case err == nil && existing.Size == o.Size && existing.CRC32C == o.CRC32C:
+			logrus.Debugf("Skipping already promoted %s", target)
+			res.Skipped = append(res.Skipped, target)
+		case err == nil || object.IsNotExist(err):
+			if err := copyObject(ctx, src, dst, o, target); err != nil {
+				return res, errors.Wrapf(err, "promoting %s", o.Name)
+			}
+			res.Promoted = append(res.Promoted, target)
+		default:
+			return res, errors.Wrapf(err, "checking %s", target)
+		}
+
+		if opts.Public {
+			if err := dst.SetACL(ctx, target, object.ACLPublicRead); err != nil {
+				return res, errors.Wrapf(err, "making %s public", target)
+			}
+		}
+	}
+	logrus.Infof(
+		"Promoted %d objects to %s/%s, %d already existed",
+		len(res.Promoted), dst, opts.Dest, len(res.Skipped),
+	)
+	return res, nil
+}
+
+// promotionOrder sorts the artifacts before their hash sidecars and both
+// before the manifests and the provenance
+func promotionOrder(name string) int {
+	base := path.Base(name)
+	if isArtifact(base) {
+		return 0
+	}
+	if algorithm, ok := sidecarAlgorithm(base); ok &&
+		isArtifact(strings.TrimSuffix(base, algorithm.extension)) {
+		return 1
+	}
+	return 2
+}
+
+// copyObject copies the object including its metadata to the target. Objects
+// are streamed between different stores, which relies on uploads being
+// atomic.
+func copyObject(ctx context.Context, src, dst object.Store, o *object.Attrs, target string) error {
+	if src == dst {
+		return dst.Copy(ctx, o.Name, target)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(src.Download(ctx, o.Name, writer))
+	}()
+	err := dst.Upload(ctx, target, reader)
+	// Unblocks the download if the upload failed
+	reader.Close() // nolint: errcheck
+	if err != nil {
+		return err
+	}
+
+	if o.ContentType == "" && o.CacheControl == "" && len(o.Custom) == 0 {
+		return nil
+	}
+	metadata := o.Metadata
+	return dst.SetMetadata(ctx, target, &metadata)
+}
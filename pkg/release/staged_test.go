@@ -0,0 +1,274 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/release/pkg/object"
+)
+
+const testStagedBuild = "v1.17.1-beta.0.20+cce11c6a185279"
+
+// stageTestBuild stages a complete build of the version to the store
+func stageTestBuild(t *testing.T, store *object.Local, version string) {
+	ctx := context.Background()
+	build := MustParseVersion(testStagedBuild)
+	dir, err := ioutil.TempDir("", "gcs-stage-")
+	require.Nil(t, err)
+	defer cleanupTmps(t, dir)
+
+	for file, content := range map[string]string{
+		"kubernetes.tar.gz":                    "kubernetes",
+		"kubernetes-server-linux-amd64.tar.gz": "server",
+		"bin/linux/amd64/kubectl":              "kubectl",
+	} {
+		require.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0o755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0o644))
+	}
+	require.Nil(t, WriteChecksums(dir, false))
+	_, err = object.UploadDir(ctx, store, dir, StagedArtifactsPath(build, version))
+	require.Nil(t, err)
+
+	require.Nil(t, object.WriteString(
+		ctx, store, StagedImagesPath(build, version)+"/amd64/kube-apiserver.tar", "image",
+	))
+	require.Nil(t, object.WriteString(
+		ctx, store, StagedBuildPath(build)+"/"+StagedSourceArchive, "src",
+	))
+}
+
+func TestListStagedBuilds(t *testing.T) {
+	ctx := context.Background()
+	store := newLocalStore(t)
+	defer cleanupTmps(t, store.Root())
+
+	stageTestBuild(t, store, "v1.17.1")
+	stageTestBuild(t, store, "v1.18.0-alpha.0")
+	for _, name := range []string{
+		"stage/v1.18.0-alpha.1.123+5a1ae3a2aaa3c0/src.tar.gz",
+		"stage/v1.17.0/kubernetes.tar.gz",
+		"stage/invalid/kubernetes.tar.gz",
+		"release/v1.16.0/kubernetes.tar.gz",
+	} {
+		require.Nil(t, object.WriteString(ctx, store, name, name))
+	}
+
+	builds, err := ListStagedBuilds(ctx, store)
+	require.Nil(t, err)
+	res := []string{}
+	for _, b := range builds {
+		res = append(res, b.BuildVersion.String())
+	}
+	require.Equal(t, []string{
+		"v1.17.0",
+		testStagedBuild,
+		"v1.18.0-alpha.1.123+5a1ae3a2aaa3c0",
+	}, res)
+
+	staged := builds[1]
+	require.Equal(t, []string{"v1.17.1", "v1.18.0-alpha.0"}, staged.Versions)
+	// Per version 3 artifacts, 2 manifests and 2 sidecars for each of them
+	// plus one image, and the source archive
+	require.Equal(t, 2*(3+2+2*5+1)+1, staged.Objects)
+	require.False(t, staged.Updated.IsZero())
+	require.Empty(t, builds[2].Versions)
+
+	found, err := FindStagedBuild(ctx, store, MustParseVersion(testStagedBuild))
+	require.Nil(t, err)
+	require.Equal(t, staged, found)
+	_, err = FindStagedBuild(ctx, store, MustParseVersion("v1.16.0"))
+	require.NotNil(t, err)
+
+	empty := newLocalStore(t)
+	defer cleanupTmps(t, empty.Root())
+	builds, err = ListStagedBuilds(ctx, empty)
+	require.Nil(t, err)
+	require.Empty(t, builds)
+}
+
+func TestValidateStagedBuild(t *testing.T) {
+	ctx := context.Background()
+	build := MustParseVersion(testStagedBuild)
+	artifacts := StagedArtifactsPath(build, "v1.17.1")
+
+	cases := map[string]struct {
+		remove   []string
+		versions []string
+		failures []string
+	}{
+		"Complete": {},
+		"CompleteVersion": {
+			versions: []string{"v1.17.1"},
+		},
+		"NotStagedVersion": {
+			versions: []string{"v1.17.2"},
+			failures: []string{"v1.17.2: neither", "v1.17.2: no release images"},
+		},
+		"MissingSource": {
+			remove:   []string{StagedBuildPath(build) + "/src.tar.gz"},
+			failures: []string{"missing source archive"},
+		},
+		"MissingTarball": {
+			remove: []string{
+				artifacts + "/kubernetes.tar.gz",
+				artifacts + "/kubernetes.tar.gz.sha256",
+				artifacts + "/kubernetes.tar.gz.sha512",
+			},
+			failures: []string{
+				"kubernetes.tar.gz listed in SHA256SUMS is missing",
+				"kubernetes.tar.gz listed in SHA512SUMS is missing",
+			},
+		},
+		"MissingSidecar": {
+			remove:   []string{artifacts + "/bin/linux/amd64/kubectl.sha512"},
+			failures: []string{"missing bin/linux/amd64/kubectl.sha512"},
+		},
+		"MissingManifests": {
+			remove:   []string{artifacts + "/SHA256SUMS", artifacts + "/SHA512SUMS"},
+			failures: []string{"neither SHA256SUMS nor SHA512SUMS found"},
+		},
+		"MissingImages": {
+			remove:   []string{StagedImagesPath(build, "v1.17.1") + "/amd64/kube-apiserver.tar"},
+			failures: []string{"v1.17.1: no release images"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			store := newLocalStore(t)
+			defer cleanupTmps(t, store.Root())
+			stageTestBuild(t, store, "v1.17.1")
+			for _, o := range tc.remove {
+				require.Nil(t, os.Remove(filepath.Join(store.Root(), o)))
+			}
+
+			err := ValidateStagedBuild(ctx, store, build, tc.versions...)
+			require.Equal(t, len(tc.failures) > 0, err != nil, err)
+			for _, failure := range tc.failures {
+				require.Contains(t, err.Error(), failure)
+			}
+		})
+	}
+
+	// Artifacts not listed in the manifests are incomplete stages
+	store := newLocalStore(t)
+	defer cleanupTmps(t, store.Root())
+	stageTestBuild(t, store, "v1.17.1")
+	require.Nil(t, object.WriteString(ctx, store, artifacts+"/extra.tar.gz", "extra"))
+	err := ValidateStagedBuild(ctx, store, build)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "extra.tar.gz is not listed in SHA256SUMS")
+
+	require.NotNil(t, ValidateStagedBuild(ctx, store, MustParseVersion("v1.16.0")))
+}
+
+// failingStore fails the upload of an object
+type failingStore struct {
+	object.Store
+	fail string
+}
+
+func (f *failingStore) Upload(ctx context.Context, o string, reader io.Reader) error {
+	if o == f.fail {
+		// Consume parts of the content like an interrupted upload
+		buf := make([]byte, 1)
+		reader.Read(buf) // nolint: errcheck
+		return errors.Errorf("upload of %s interrupted", o)
+	}
+	return f.Store.Upload(ctx, o, reader)
+}
+
+func TestPromoteStagedBuild(t *testing.T) {
+	ctx := context.Background()
+	build := MustParseVersion(testStagedBuild)
+	src := newLocalStore(t)
+	dst := newLocalStore(t)
+	defer cleanupTmps(t, src.Root(), dst.Root())
+	stageTestBuild(t, src, "v1.17.1")
+	require.Nil(t, src.SetMetadata(
+		ctx, StagedArtifactsPath(build, "v1.17.1")+"/kubernetes.tar.gz",
+		&object.Metadata{ContentType: "application/gzip"},
+	))
+	opts := &PromoteOptions{Version: "v1.17.1", Dest: "release/v1.17.1", Public: true}
+
+	// An interrupted promotion does not leave any partial object behind
+	_, err := PromoteStagedBuild(ctx, src, &failingStore{
+		Store: dst, fail: "release/v1.17.1/kubernetes.tar.gz",
+	}, build, opts)
+	require.NotNil(t, err)
+	all, _ := listObjects(t, dst)
+	require.NotContains(t, all, "release/v1.17.1/kubernetes.tar.gz")
+	require.NotContains(t, all, "release/v1.17.1/SHA256SUMS")
+	promoted := len(all)
+	require.NotZero(t, promoted)
+
+	// Resuming skips the already promoted objects
+	res, err := PromoteStagedBuild(ctx, src, dst, build, opts)
+	require.Nil(t, err)
+	require.Len(t, res.Skipped, promoted)
+	require.Len(t, res.Promoted, 3+2+2*5-promoted)
+	all, public := listObjects(t, dst)
+	require.Equal(t, all, public)
+	require.Contains(t, all, "release/v1.17.1/bin/linux/amd64/kubectl.sha256")
+
+	attrs, err := dst.Stat(ctx, "release/v1.17.1/kubernetes.tar.gz")
+	require.Nil(t, err)
+	require.Equal(t, "application/gzip", attrs.ContentType)
+	content, err := object.ReadString(ctx, dst, "release/v1.17.1/kubernetes.tar.gz")
+	require.Nil(t, err)
+	require.Equal(t, "kubernetes", content)
+
+	res, err = PromoteStagedBuild(ctx, src, dst, build, opts)
+	require.Nil(t, err)
+	require.Empty(t, res.Promoted)
+
+	// Objects of the same size but with a different content get replaced
+	require.Nil(t, object.WriteString(ctx, dst, "release/v1.17.1/kubernetes.tar.gz", "corrupted!"))
+	res, err = PromoteStagedBuild(ctx, src, dst, build, opts)
+	require.Nil(t, err)
+	require.Equal(t, []string{"release/v1.17.1/kubernetes.tar.gz"}, res.Promoted)
+	content, err = object.ReadString(ctx, dst, "release/v1.17.1/kubernetes.tar.gz")
+	require.Nil(t, err)
+	require.Equal(t, "kubernetes", content)
+
+	// Promotions within the same store copy the objects
+	res, err = PromoteStagedBuild(ctx, src, src, build, &PromoteOptions{
+		Version: "v1.17.1", Dest: "release/v1.17.1",
+	})
+	require.Nil(t, err)
+	require.Len(t, res.Promoted, 3+2+2*5)
+	for _, name := range res.Promoted {
+		require.True(t, strings.HasPrefix(name, "release/v1.17.1/"))
+	}
+
+	// Incomplete builds are not promoted
+	require.Nil(t, os.Remove(filepath.Join(src.Root(), StagedBuildPath(build), StagedSourceArchive)))
+	_, err = PromoteStagedBuild(ctx, src, dst, build, opts)
+	require.NotNil(t, err)
+	_, err = PromoteStagedBuild(ctx, src, dst, build, &PromoteOptions{Version: "v1.17.1"})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/test-infra/testgrid/config"
+)
+
+const (
+	// TestgridConfigURL is the location of the serialized testgrid config
+	TestgridConfigURL = "https://storage.googleapis.com/k8s-testgrid/config"
+
+	testgridDownloadTimeout = 10 * time.Second
+)
+
+// ReadTestgridConfig reads the serialized testgrid config from an http(s)
+// URL or a local file path
+func ReadTestgridConfig(ctx context.Context, location string) (*config.Configuration, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		conf, err := config.ReadPath(location)
+		return conf, errors.Wrapf(err, "reading testgrid config %s", location)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, testgridDownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating request for %s", location)
+	}
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "downloading testgrid config %s", location)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf(
+			"downloading testgrid config %s: unexpected status %s", location, res.Status,
+		)
+	}
+
+	conf, err := config.Unmarshal(res.Body)
+	return conf, errors.Wrapf(err, "parsing testgrid config %s", location)
+}
+
+// BlockingDashboard returns the name of the testgrid dashboard containing the
+// release blocking jobs of the branch, like sig-release-1.17-blocking
+func BlockingDashboard(branch string) string {
+	// The dashboards of the master branch are named inconsistently
+	if branch == "master" {
+		branch = "release-master"
+	}
+	return "sig-" + branch + "-blocking"
+}
+
+// BlockingJobs returns the names of the release blocking jobs of the branch
+// in the order of the dashboard tabs. The first one is considered to be the
+// primary job by find_green_build.
+func BlockingJobs(conf *config.Configuration, branch string) ([]string, error) {
+	name := BlockingDashboard(branch)
+	dashboard := conf.FindDashboard(name)
+	if dashboard == nil {
+		return nil, errors.Errorf("testgrid dashboard %s not found", name)
+	}
+
+	jobs := []string{}
+	for _, tab := range dashboard.DashboardTab {
+		jobs = append(jobs, tab.TestGroupName)
+	}
+	if len(jobs) == 0 {
+		return nil, errors.Errorf("testgrid dashboard %s has no jobs", name)
+	}
+	return jobs, nil
+}
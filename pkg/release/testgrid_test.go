@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/test-infra/testgrid/config"
+)
+
+func TestBlockingJobs(t *testing.T) {
+	conf := &config.Configuration{
+		Dashboards: []*config.Dashboard{
+			{
+				Name: "sig-release-master-blocking",
+				DashboardTab: []*config.DashboardTab{
+					{TestGroupName: "ci-kubernetes-e2e-gce"},
+					{TestGroupName: "ci-kubernetes-e2e-gce-serial"},
+				},
+			},
+			{Name: "sig-release-1.17-blocking"},
+		},
+	}
+
+	jobs, err := BlockingJobs(conf, "master")
+	require.Nil(t, err)
+	require.Equal(t, []string{"ci-kubernetes-e2e-gce", "ci-kubernetes-e2e-gce-serial"}, jobs)
+
+	_, err = BlockingJobs(conf, "release-1.17")
+	require.NotNil(t, err)
+
+	_, err = BlockingJobs(conf, "release-1.16")
+	require.NotNil(t, err)
+}
+
+func TestReadTestgridConfig(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "testgrid-")
+	require.Nil(t, err)
+	defer cleanupTmps(t, dir)
+	empty := filepath.Join(dir, "config")
+	require.Nil(t, ioutil.WriteFile(empty, []byte{}, os.FileMode(0o644)))
+
+	conf, err := ReadTestgridConfig(ctx, empty)
+	require.Nil(t, err)
+	require.Empty(t, conf.Dashboards)
+
+	_, err = ReadTestgridConfig(ctx, filepath.Join(dir, "missing"))
+	require.NotNil(t, err)
+
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	conf, err = ReadTestgridConfig(ctx, server.URL+"/config")
+	require.Nil(t, err)
+	require.Empty(t, conf.Dashboards)
+
+	_, err = ReadTestgridConfig(ctx, server.URL+"/missing")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// BuildVariantsPath is the path of the build variants within the release
+// repository
+const BuildVariantsPath = "gcb/build/variants.yaml"
+
+// BuildVariant is a CI build variant of gcb/build/variants.yaml, which
+// configures how a build gets pushed
+type BuildVariant struct {
+	// Name is the name of the variant, like build-ci
+	Name string
+
+	// CI pushes a CI build
+	CI bool
+
+	// NoMock pushes in non mock mode
+	NoMock bool
+
+	// AllowDup does not fail if the build already exists
+	AllowDup bool
+
+	// Hyperkube builds the hyperkube image. It only affects the build and not
+	// the push of the build.
+	Hyperkube bool
+
+	// Bucket is the GCS bucket to push to
+	Bucket string
+
+	// DockerRegistry is the registry to push the release images to
+	DockerRegistry string
+
+	// ExtraPublishFile is an additional version marker to publish
+	ExtraPublishFile string
+}
+
+// variantKey describes a key of a variant, whose value is the push-build.sh
+// flag it stands for
+type variantKey struct {
+	// flag is the name of the flag without dashes
+	flag string
+
+	// set applies the flag value to the variant. Boolean flags have no value.
+	set func(v *BuildVariant, value string)
+
+	// boolean indicates that the flag has no value
+	boolean bool
+}
+
+var variantKeys = map[string]variantKey{
+	"CI": {
+		flag: "ci", boolean: true, set: func(v *BuildVariant, _ string) { v.CI = true },
+	},
+	"NOMOCK": {
+		flag: "nomock", boolean: true, set: func(v *BuildVariant, _ string) { v.NoMock = true },
+	},
+	"ALLOW_DUP": {
+		flag: "allow-dup", boolean: true, set: func(v *BuildVariant, _ string) { v.AllowDup = true },
+	},
+	"HYPERKUBE": {
+		flag: "hyperkube", boolean: true, set: func(v *BuildVariant, _ string) { v.Hyperkube = true },
+	},
+	"BUCKET": {
+		flag: "bucket", set: func(v *BuildVariant, value string) { v.Bucket = value },
+	},
+	"REGISTRY": {
+		flag: "docker-registry", set: func(v *BuildVariant, value string) { v.DockerRegistry = value },
+	},
+	"EXTRA_PUBLISH_FILE": {
+		flag: "extra-publish-file", set: func(v *BuildVariant, value string) { v.ExtraPublishFile = value },
+	},
+}
+
+// buildVariantsFile is the content of gcb/build/variants.yaml
+type buildVariantsFile struct {
+	Variants map[string]map[string]string `yaml:"variants"`
+}
+
+// LoadBuildVariants reads the build variants file
+func LoadBuildVariants(path string) (map[string]*BuildVariant, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading build variants %s", path)
+	}
+	variants, err := ParseBuildVariants(content)
+	return variants, errors.Wrapf(err, "parsing build variants %s", path)
+}
+
+// ParseBuildVariants parses the build variants, whose values are the flags
+// substituted into the build like '--bucket=k8s-staging-release-test'. Every
+// key has to be known and its value has to be its own flag or empty, which
+// disables it.
+func ParseBuildVariants(content []byte) (map[string]*BuildVariant, error) {
+	file := buildVariantsFile{}
+	if err := yaml.UnmarshalStrict(content, &file); err != nil {
+		return nil, err
+	}
+	if len(file.Variants) == 0 {
+		return nil, errors.New("no variants defined")
+	}
+
+	variants := map[string]*BuildVariant{}
+	for name, values := range file.Variants {
+		variant := &BuildVariant{Name: name}
+		for key, value := range values {
+			if err := variant.set(key, value); err != nil {
+				return nil, errors.Wrapf(err, "variant %s", name)
+			}
+		}
+		variants[name] = variant
+	}
+	return variants, nil
+}
+
+// set applies the flag of the key to the variant
+func (v *BuildVariant) set(key, value string) error {
+	k, ok := variantKeys[key]
+	if !ok {
+		return errors.Errorf("unknown key %s", key)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	flag := "--" + k.flag
+	if k.boolean {
+		if value != flag {
+			return errors.Errorf("%s has to be %q or empty instead of %q", key, flag, value)
+		}
+		k.set(v, "")
+		return nil
+	}
+	if !strings.HasPrefix(value, flag+"=") || value == flag+"=" {
+		return errors.Errorf("%s has to be %q with a value or empty instead of %q", key, flag+"=", value)
+	}
+	k.set(v, strings.TrimPrefix(value, flag+"="))
+	return nil
+}
+
+// Flags returns the krel push flags and their values the variant stands for.
+// Hyperkube is not included since it does not affect pushes.
+func (v *BuildVariant) Flags() map[string]string {
+	flags := map[string]string{}
+	setBool := func(name string, enabled bool) {
+		if enabled {
+			flags[name] = strconv.FormatBool(enabled)
+		}
+	}
+	setString := func(name, value string) {
+		if value != "" {
+			flags[name] = value
+		}
+	}
+	setBool("ci", v.CI)
+	setBool("nomock", v.NoMock)
+	setBool("allow-dup", v.AllowDup)
+	setString("bucket", v.Bucket)
+	setString("docker-registry", v.DockerRegistry)
+	setString("extra-publish-file", v.ExtraPublishFile)
+	return flags
+}
+
+// BuildVariantNames returns the sorted names of the variants
+func BuildVariantNames(variants map[string]*BuildVariant) []string {
+	names := []string{}
+	for name := range variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
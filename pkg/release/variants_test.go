@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadBuildVariants(t *testing.T) {
+	variants, err := LoadBuildVariants(filepath.Join("..", "..", BuildVariantsPath))
+	require.Nil(t, err)
+	require.Equal(t, []string{"build-ci", "build-ci-fast", "build-ci-old"}, BuildVariantNames(variants))
+
+	require.Equal(t, &BuildVariant{
+		Name:             "build-ci",
+		CI:               true,
+		NoMock:           true,
+		AllowDup:         true,
+		Hyperkube:        true,
+		Bucket:           "k8s-staging-release-test",
+		DockerRegistry:   "gcr.io/k8s-staging-release-test",
+		ExtraPublishFile: "k8s-master",
+	}, variants["build-ci"])
+	require.Equal(t, map[string]string{
+		"ci":        "true",
+		"nomock":    "true",
+		"allow-dup": "true",
+		"bucket":    "k8s-staging-release-test",
+	}, variants["build-ci-fast"].Flags())
+
+	_, err = LoadBuildVariants(filepath.Join("..", "..", "missing.yaml"))
+	require.NotNil(t, err)
+}
+
+func TestParseBuildVariants(t *testing.T) {
+	cases := map[string]struct {
+		content   string
+		want      *BuildVariant
+		shouldErr bool
+	}{
+		"Disabled": {
+			content: "variants:\n  fast:\n    CI: '--ci'\n    NOMOCK: ''\n    BUCKET: ''\n",
+			want:    &BuildVariant{Name: "fast", CI: true},
+		},
+		"UnknownKey": {
+			content:   "variants:\n  fast:\n    FEDERATION: '--federation'\n",
+			shouldErr: true,
+		},
+		"WrongFlag": {
+			content:   "variants:\n  fast:\n    CI: '--nomock'\n",
+			shouldErr: true,
+		},
+		"MissingValue": {
+			content:   "variants:\n  fast:\n    BUCKET: '--bucket='\n",
+			shouldErr: true,
+		},
+		"ValueOfOtherFlag": {
+			content:   "variants:\n  fast:\n    BUCKET: '--docker-registry=gcr.io/foo'\n",
+			shouldErr: true,
+		},
+		"UnknownField": {
+			content:   "variants:\n  fast:\n    CI: '--ci'\nvariant: {}\n",
+			shouldErr: true,
+		},
+		"NoVariants": {
+			content:   "variants: {}\n",
+			shouldErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			res, err := ParseBuildVariants([]byte(tc.content))
+			require.Equal(t, tc.shouldErr, err != nil, err)
+			if !tc.shouldErr {
+				require.Equal(t, tc.want, res[tc.want.Name])
+			}
+		})
+	}
+}
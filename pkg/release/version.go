@@ -0,0 +1,301 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PreRelease is the pre-release label of a version
+type PreRelease string
+
+const (
+	// PreReleaseNone is used for official releases
+	PreReleaseNone PreRelease = ""
+
+	// PreReleaseAlpha is the label for alpha versions
+	PreReleaseAlpha PreRelease = "alpha"
+
+	// PreReleaseBeta is the label for beta versions
+	PreReleaseBeta PreRelease = "beta"
+
+	// PreReleaseRC is the label for release candidates
+	PreReleaseRC PreRelease = "rc"
+)
+
+// order returns the precedence of the pre-release label, where official
+// releases have the highest precedence
+func (p PreRelease) order() int {
+	switch p {
+	case PreReleaseAlpha:
+		return 0
+	case PreReleaseBeta:
+		return 1
+	case PreReleaseRC:
+		return 2
+	}
+	return 3
+}
+
+// versionRE matches vX.Y.Z[-alpha|beta|rc.N][.NN+sha][-dirty] at the
+// beginning of a string
+var versionRE = regexp.MustCompile(
+	`^v(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)` +
+		`(?:-(alpha|beta|rc)\.(0|[1-9][0-9]*))?` +
+		`(?:\.([0-9]+)\+([0-9a-f]{5,40}))?` +
+		`(-dirty)?`,
+)
+
+// Version is a Kubernetes release or build version like v1.17.0,
+// v1.17.0-rc.1 or v1.18.0-alpha.1.123+5a1ae3a2aaa3c0-dirty
+type Version struct {
+	Major uint64
+	Minor uint64
+	Patch uint64
+
+	// PreRelease is the pre-release label, which is empty for official
+	// releases
+	PreRelease PreRelease
+
+	// PreReleaseID is the number of the pre-release, like 1 for v1.17.0-rc.1
+	PreReleaseID uint64
+
+	// Commits is the amount of commits on top of the tagged version for
+	// builds, like 123 for v1.18.0-alpha.1.123+5a1ae3a2aaa3c0
+	Commits uint64
+
+	// Commit is the abbreviated commit SHA of a build
+	Commit string
+
+	// Dirty indicates that the build has been done from a modified tree
+	Dirty bool
+}
+
+// ParseVersion parses a version string. Surrounding whitespace is ignored.
+func ParseVersion(version string) (Version, error) {
+	return parseVersion(version, true)
+}
+
+// ParseVersionPrefix parses the version at the beginning of a string like
+// v1.18.0-alpha.1.123+5a1ae3a2aaa3c0-suffix and ignores everything after it.
+// This is useful for versions with a custom suffix given by --version-suffix.
+func ParseVersionPrefix(version string) (Version, error) {
+	return parseVersion(version, false)
+}
+
+func parseVersion(version string, strict bool) (Version, error) {
+	trimmed := strings.TrimSpace(version)
+	match := versionRE.FindStringSubmatch(trimmed)
+	if match == nil || (strict && match[0] != trimmed) {
+		return Version{}, errors.Errorf("invalid release version %q", trimmed)
+	}
+
+	// All numeric submatches are guaranteed to be digits by the regex, so
+	// only overflows can fail
+	numbers := []uint64{}
+	for _, i := range []int{1, 2, 3, 5, 6} {
+		if match[i] == "" {
+			numbers = append(numbers, 0)
+			continue
+		}
+		n, err := strconv.ParseUint(match[i], 10, 64)
+		if err != nil {
+			return Version{}, errors.Wrapf(err, "parsing release version %q", trimmed)
+		}
+		numbers = append(numbers, n)
+	}
+
+	return Version{
+		Major:        numbers[0],
+		Minor:        numbers[1],
+		Patch:        numbers[2],
+		PreRelease:   PreRelease(match[4]),
+		PreReleaseID: numbers[3],
+		Commits:      numbers[4],
+		Commit:       match[7],
+		Dirty:        match[8] != "",
+	}, nil
+}
+
+// MustParseVersion parses a version string and panics on failure
+func MustParseVersion(version string) Version {
+	v, err := ParseVersion(version)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// String returns the version in the form it has been parsed from
+func (v Version) String() string {
+	s := fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.IsPreRelease() {
+		s += fmt.Sprintf("-%s.%d", v.PreRelease, v.PreReleaseID)
+	}
+	if v.IsBuild() {
+		s += fmt.Sprintf(".%d+%s", v.Commits, v.Commit)
+	}
+	if v.Dirty {
+		s += "-dirty"
+	}
+	return s
+}
+
+// IsPreRelease returns true if the version is an alpha, beta or release
+// candidate
+func (v Version) IsPreRelease() bool {
+	return v.PreRelease != PreReleaseNone
+}
+
+// IsBuild returns true if the version refers to a build on top of a tagged
+// version
+func (v Version) IsBuild() bool {
+	return v.Commit != ""
+}
+
+// Release returns the tagged version without build information
+func (v Version) Release() Version {
+	return Version{
+		Major:        v.Major,
+		Minor:        v.Minor,
+		Patch:        v.Patch,
+		PreRelease:   v.PreRelease,
+		PreReleaseID: v.PreReleaseID,
+	}
+}
+
+// Compare returns -1 if the version is lower than the other one, 1 if it is
+// greater and 0 if both are equal. Builds are greater than their tagged
+// version, while the commit SHA and the dirty state are not considered.
+func (v Version) Compare(o Version) int {
+	pairs := [][2]uint64{
+		{v.Major, o.Major},
+		{v.Minor, o.Minor},
+		{v.Patch, o.Patch},
+		{uint64(v.PreRelease.order()), uint64(o.PreRelease.order())},
+		{v.PreReleaseID, o.PreReleaseID},
+		{v.Commits, o.Commits},
+	}
+	for _, p := range pairs {
+		switch {
+		case p[0] < p[1]:
+			return -1
+		case p[0] > p[1]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// LessThan returns true if the version is lower than the other one
+func (v Version) LessThan(o Version) bool {
+	return v.Compare(o) < 0
+}
+
+// GreaterThan returns true if the version is greater than the other one
+func (v Version) GreaterThan(o Version) bool {
+	return v.Compare(o) > 0
+}
+
+// Equal returns true if both versions have the same precedence
+func (v Version) Equal(o Version) bool {
+	return v.Compare(o) == 0
+}
+
+// Next computes the next version of the provided kind to be released from
+// this version, following the rules of release::set_release_version:
+//
+//   - alpha: increments an alpha, otherwise starts with alpha.0 of the next
+//     minor version
+//   - beta: increments a beta, starts with beta.0 of the same version for
+//     alphas and of the next patch version for official releases
+//   - rc: increments a release candidate, otherwise starts with rc.1 of the
+//     same version for pre-releases and of the next patch version for official
+//     releases
+//   - none: the official release of a pre-release, otherwise the next patch
+//     version
+//
+// Build information is dropped from the result.
+func (v Version) Next(kind PreRelease) (Version, error) {
+	next := v.Release()
+
+	// The pre-release version of the next patch version
+	nextPatch := func(id uint64) Version {
+		return Version{
+			Major:        v.Major,
+			Minor:        v.Minor,
+			Patch:        v.Patch + 1,
+			PreRelease:   kind,
+			PreReleaseID: id,
+		}
+	}
+
+	switch kind {
+	case PreReleaseAlpha:
+		if v.PreRelease == PreReleaseAlpha {
+			next.PreReleaseID++
+			return next, nil
+		}
+		return Version{
+			Major: v.Major, Minor: v.Minor + 1, PreRelease: kind,
+		}, nil
+
+	case PreReleaseBeta:
+		switch v.PreRelease {
+		case PreReleaseBeta:
+			next.PreReleaseID++
+		case PreReleaseAlpha:
+			next.PreRelease = kind
+			next.PreReleaseID = 0
+		case PreReleaseNone:
+			next = nextPatch(0)
+		default:
+			return Version{}, errors.Errorf(
+				"beta versions are not allowed after release candidate %s", v,
+			)
+		}
+		return next, nil
+
+	case PreReleaseRC:
+		switch v.PreRelease {
+		case PreReleaseRC:
+			next.PreReleaseID++
+		case PreReleaseNone:
+			// Release candidates start at 1 instead of 0
+			next = nextPatch(1)
+		default:
+			next.PreRelease = kind
+			next.PreReleaseID = 1
+		}
+		return next, nil
+
+	case PreReleaseNone:
+		if v.IsPreRelease() {
+			next.PreRelease = PreReleaseNone
+			next.PreReleaseID = 0
+			return next, nil
+		}
+		return nextPatch(0), nil
+	}
+
+	return Version{}, errors.Errorf("unknown pre-release kind %q", kind)
+}
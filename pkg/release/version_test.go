@@ -0,0 +1,263 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	type want struct {
+		r    Version
+		rErr bool
+	}
+	cases := map[string]struct {
+		version string
+		want    want
+	}{
+		"ValidRelease": {
+			version: "v1.17.6",
+			want: want{
+				r: Version{Major: 1, Minor: 17, Patch: 6},
+			},
+		},
+		"ValidPreRelease": {
+			version: "v1.17.0-rc.2",
+			want: want{
+				r: Version{
+					Major: 1, Minor: 17, PreRelease: PreReleaseRC, PreReleaseID: 2,
+				},
+			},
+		},
+		"ValidReleaseBuild": {
+			version: "v1.17.6.12+abcdef",
+			want: want{
+				r: Version{
+					Major: 1, Minor: 17, Patch: 6, Commits: 12, Commit: "abcdef",
+				},
+			},
+		},
+		"ValidPreReleaseBuild": {
+			version: "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0\n",
+			want: want{
+				r: Version{
+					Major:        1,
+					Minor:        18,
+					PreRelease:   PreReleaseAlpha,
+					PreReleaseID: 1,
+					Commits:      123,
+					Commit:       "5a1ae3a2aaa3c0",
+				},
+			},
+		},
+		"ValidReleaseDirty": {
+			version: "v1.17.6.12+abcdef-dirty",
+			want: want{
+				r: Version{
+					Major:   1,
+					Minor:   17,
+					Patch:   6,
+					Commits: 12,
+					Commit:  "abcdef",
+					Dirty:   true,
+				},
+			},
+		},
+		"ValidDirty": {
+			version: "v1.17.6-dirty",
+			want: want{
+				r: Version{Major: 1, Minor: 17, Patch: 6, Dirty: true},
+			},
+		},
+		"NotValidRelease": {
+			version: "1.1.1",
+			want:    want{rErr: true},
+		},
+		"NotValidLeadingZero": {
+			version: "v1.07.0",
+			want:    want{rErr: true},
+		},
+		"NotValidPreRelease": {
+			version: "v1.17.0-gamma.1",
+			want:    want{rErr: true},
+		},
+		"NotValidBuild": {
+			version: "v1.17.6.abcde",
+			want:    want{rErr: true},
+		},
+		"NotValidTrailing": {
+			version: "v1.17.6-foo",
+			want:    want{rErr: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			res, err := ParseVersion(tc.version)
+			require.Equal(t, tc.want.rErr, err != nil)
+			require.Equal(t, tc.want.r, res)
+		})
+	}
+}
+
+func TestParseVersionPrefix(t *testing.T) {
+	v, err := ParseVersionPrefix("v1.18.0-alpha.1.123+5a1ae3a2aaa3c0-suffix")
+	require.Nil(t, err)
+	require.Equal(t, "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0", v.String())
+
+	v, err = ParseVersionPrefix("v1.17.0-dirty-suffix\n")
+	require.Nil(t, err)
+	require.Equal(t, "v1.17.0-dirty", v.String())
+
+	_, err = ParseVersionPrefix("1.17.0")
+	require.NotNil(t, err)
+}
+
+func TestVersionString(t *testing.T) {
+	for _, version := range []string{
+		"v1.17.0",
+		"v1.17.0-alpha.0",
+		"v1.17.0-beta.2",
+		"v1.17.0-rc.1-dirty",
+		"v1.17.6.12+abcdef",
+		"v1.18.0-alpha.1.123+5a1ae3a2aaa3c0-dirty",
+	} {
+		require.Equal(t, version, MustParseVersion(version).String())
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	ordered := []string{
+		"v1.16.9",
+		"v1.17.0-alpha.0",
+		"v1.17.0-alpha.0.1+abcdef",
+		"v1.17.0-alpha.0.20+abcdef",
+		"v1.17.0-alpha.1",
+		"v1.17.0-alpha.10",
+		"v1.17.0-beta.0",
+		"v1.17.0-rc.1",
+		"v1.17.0-rc.2",
+		"v1.17.0",
+		"v1.17.0.3+abcdef",
+		"v1.17.1-beta.0",
+		"v1.17.1",
+		"v2.0.0",
+	}
+
+	versions := []Version{}
+	for i := len(ordered) - 1; i >= 0; i-- {
+		versions = append(versions, MustParseVersion(ordered[i]))
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].LessThan(versions[j])
+	})
+	for i, version := range versions {
+		require.Equal(t, ordered[i], version.String())
+	}
+
+	a := MustParseVersion("v1.17.0-rc.1.5+abcdef")
+	b := MustParseVersion("v1.17.0-rc.1.5+fedcba-dirty")
+	require.True(t, a.Equal(b))
+	require.False(t, a.GreaterThan(b))
+	require.True(t, a.GreaterThan(a.Release()))
+}
+
+func TestVersionNext(t *testing.T) {
+	type want struct {
+		r    string
+		rErr bool
+	}
+	cases := map[string]struct {
+		version string
+		kind    PreRelease
+		want    want
+	}{
+		"AlphaFromAlphaBuild": {
+			version: "v1.18.0-alpha.1.123+5a1ae3a2aaa3c0",
+			kind:    PreReleaseAlpha,
+			want:    want{r: "v1.18.0-alpha.2"},
+		},
+		"AlphaFromBeta": {
+			version: "v1.17.0-beta.0",
+			kind:    PreReleaseAlpha,
+			want:    want{r: "v1.18.0-alpha.0"},
+		},
+		"BetaFromBeta": {
+			version: "v1.17.0-beta.1.12+abcdef",
+			kind:    PreReleaseBeta,
+			want:    want{r: "v1.17.0-beta.2"},
+		},
+		"BetaFromAlpha": {
+			version: "v1.17.0-alpha.3.40+abcdef",
+			kind:    PreReleaseBeta,
+			want:    want{r: "v1.17.0-beta.0"},
+		},
+		"BetaFromRelease": {
+			version: "v1.17.0",
+			kind:    PreReleaseBeta,
+			want:    want{r: "v1.17.1-beta.0"},
+		},
+		"BetaFromRC": {
+			version: "v1.17.0-rc.1",
+			kind:    PreReleaseBeta,
+			want:    want{rErr: true},
+		},
+		"RCFromRC": {
+			version: "v1.17.0-rc.1.2+abcdef",
+			kind:    PreReleaseRC,
+			want:    want{r: "v1.17.0-rc.2"},
+		},
+		"RCFromBeta": {
+			version: "v1.17.0-beta.2.12+abcdef",
+			kind:    PreReleaseRC,
+			want:    want{r: "v1.17.0-rc.1"},
+		},
+		"RCFromRelease": {
+			version: "v1.17.0",
+			kind:    PreReleaseRC,
+			want:    want{r: "v1.17.1-rc.1"},
+		},
+		"OfficialFromRC": {
+			version: "v1.17.0-rc.2.3+abcdef",
+			kind:    PreReleaseNone,
+			want:    want{r: "v1.17.0"},
+		},
+		"PatchFromRelease": {
+			version: "v1.17.0",
+			kind:    PreReleaseNone,
+			want:    want{r: "v1.17.1"},
+		},
+		"UnknownKind": {
+			version: "v1.17.0",
+			kind:    PreRelease("gamma"),
+			want:    want{rErr: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			res, err := MustParseVersion(tc.version).Next(tc.kind)
+			require.Equal(t, tc.want.rErr, err != nil)
+			if !tc.want.rErr {
+				require.Equal(t, tc.want.r, res.String())
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ package util
 import (
 	"archive/tar"
 	"bufio"
+	"bytes"
 	"compress/gzip"
 	"errors"
 	"fmt"
@@ -126,16 +127,20 @@ func FakeGOPATH(srcDir string) (string, error) {
 }
 
 // ReadFileFromGzippedTar opens a tarball and reads contents of a file inside.
+// The tarball gets closed before returning, while the returned reader holds
+// the file contents in memory.
 func ReadFileFromGzippedTar(tarPath, filePath string) (io.Reader, error) {
 	file, err := os.Open(tarPath)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
 	archive, err := gzip.NewReader(file)
 	if err != nil {
 		return nil, err
 	}
+	defer archive.Close()
 	tr := tar.NewReader(archive)
 
 	for {
@@ -143,9 +148,16 @@ func ReadFileFromGzippedTar(tarPath, filePath string) (io.Reader, error) {
 		if err == io.EOF {
 			break // End of archive
 		}
+		if err != nil {
+			return nil, err
+		}
 
 		if h.Name == filePath {
-			return tr, nil
+			content, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			return bytes.NewReader(content), nil
 		}
 	}
 
@@ -177,3 +189,55 @@ func MoreRecent(a, b string) (bool, error) {
 
 	return (fileA.ModTime().Unix() >= fileB.ModTime().Unix()), nil
 }
+
+// CopyFileLocal copies the file at src to dst, creating all parent
+// directories of dst and retaining the file mode of src.
+func CopyFileLocal(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("source %s is a directory", src)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	dstFile, err := os.OpenFile(
+		dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm(),
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
+
+// CopyDirContentsLocal recursively copies all files within the src directory
+// into the dst directory, which gets created if it does not exist.
+func CopyDirContentsLocal(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		return CopyFileLocal(path, target)
+	})
+}
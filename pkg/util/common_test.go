@@ -147,8 +147,8 @@ func TestReadFileFromGzippedTar(t *testing.T) {
 	}))
 	_, err = tw.Write([]byte(testFileContents))
 	require.Nil(t, err)
-	require.Nil(t, gz.Close())
 	require.Nil(t, tw.Close())
+	require.Nil(t, gz.Close())
 	require.Nil(t, ioutil.WriteFile(
 		testTarPath,
 		b.Bytes(),
@@ -206,3 +206,35 @@ func TestReadFileFromGzippedTar(t *testing.T) {
 func cleanupTmp(t *testing.T, dir string) {
 	require.Nil(t, os.RemoveAll(dir))
 }
+
+func TestCopyDirContentsLocal(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "src-")
+	require.Nil(t, err)
+	defer cleanupTmp(t, srcDir)
+	dstDir, err := ioutil.TempDir("", "dst-")
+	require.Nil(t, err)
+	defer cleanupTmp(t, dstDir)
+
+	require.Nil(t, os.MkdirAll(filepath.Join(srcDir, "a", "b"), 0o755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(srcDir, "top"), []byte("top"), 0o644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(srcDir, "a", "b", "bin"), []byte("bin"), 0o755))
+
+	require.Nil(t, CopyDirContentsLocal(srcDir, filepath.Join(dstDir, "new")))
+
+	content, err := ioutil.ReadFile(filepath.Join(dstDir, "new", "top"))
+	require.Nil(t, err)
+	require.Equal(t, "top", string(content))
+
+	info, err := os.Stat(filepath.Join(dstDir, "new", "a", "b", "bin"))
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+}
+
+func TestCopyFileLocalFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copy-")
+	require.Nil(t, err)
+	defer cleanupTmp(t, dir)
+
+	require.NotNil(t, CopyFileLocal(filepath.Join(dir, "missing"), filepath.Join(dir, "dst")))
+	require.NotNil(t, CopyFileLocal(dir, filepath.Join(dir, "dst")))
+}